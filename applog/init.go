@@ -225,6 +225,9 @@ func GetEventLogByAppIdAndCommandId(tenantId, appId, commandId string) (*[]Event
 //  @return error
 //
 func writeEventLog(ctx context.Context, tenantId, structName, funcName string, level Level, message, eventId, commandId, pubAppId string, status bool) (string, error) {
+	if log == nil {
+		return "", nil
+	}
 	uid := uuid.New().String()
 	timeNow := time.Now()
 	req := &WriteEventLogRequest{
@@ -340,7 +343,7 @@ func getEventLogByAppIdAndCommandId(ctx context.Context, tenantId, appId, comman
 //  @return error 错误
 //
 func writeAppLog(ctx context.Context, tenantId, className, funcName string, level Level, message string) (string, error) {
-	if level < log.GetLevel() {
+	if log == nil || level < log.GetLevel() {
 		return "", nil
 	}
 	uid := uuid.New().String()
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const eventStorageKey = "ddd-events"
+
+type eventsOptions struct {
+	daprHost       string
+	daprHttpPort   int64
+	daprGrpcPort   int64
+	pubsubName     string
+	tenantId       string
+	file           string
+	aggregateTypes string
+	fromTime       string
+	toTime         string
+	snapshots      bool
+	gzip           bool
+	pageSize       uint64
+}
+
+// newEventStorage 导出与导入需要查询与创建事件，sidecar 的事件存储 HTTP API 不支持，使用 gRPC 事件存储器
+var newEventStorage = func(opts *eventsOptions) (ddd.EventStorage, error) {
+	client, err := daprclient.NewDaprDddClient(opts.daprHost, opts.daprHttpPort, opts.daprGrpcPort)
+	if err != nil {
+		return nil, err
+	}
+	return ddd.NewGrpcEventStorage(client, ddd.PubsubName(opts.pubsubName))
+}
+
+func runExport(ctx context.Context, opts *eventsOptions, stdout io.Writer) (*ddd.ExportResult, error) {
+	if opts.tenantId == "" {
+		return nil, fmt.Errorf("-tenant cannot be empty")
+	}
+	aggregateTypes := splitNames(opts.aggregateTypes)
+	if len(aggregateTypes) == 0 {
+		return nil, fmt.Errorf("-aggregate-type cannot be empty")
+	}
+	exportOptions := ddd.NewExportEventsOptions().
+		SetEventStorageKey(eventStorageKey).
+		SetIncludeSnapshots(opts.snapshots).
+		SetGzip(opts.gzip || strings.HasSuffix(opts.file, ".gz")).
+		SetPageSize(opts.pageSize)
+	if opts.fromTime != "" {
+		fromTime, err := time.Parse(time.RFC3339, opts.fromTime)
+		if err != nil {
+			return nil, fmt.Errorf("-from: %s", err.Error())
+		}
+		exportOptions.SetFromTime(fromTime)
+	}
+	if opts.toTime != "" {
+		toTime, err := time.Parse(time.RFC3339, opts.toTime)
+		if err != nil {
+			return nil, fmt.Errorf("-to: %s", err.Error())
+		}
+		exportOptions.SetToTime(toTime)
+	}
+	if err := registerEventStorage(opts); err != nil {
+		return nil, err
+	}
+
+	w := stdout
+	if opts.file != "" && opts.file != "-" {
+		file, err := os.Create(opts.file)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		w = file
+	}
+	return ddd.ExportEvents(ctx, w, opts.tenantId, aggregateTypes, exportOptions)
+}
+
+func runImport(ctx context.Context, opts *eventsOptions, stdin io.Reader) (*ddd.ImportResult, error) {
+	if err := registerEventStorage(opts); err != nil {
+		return nil, err
+	}
+	r := stdin
+	if opts.file != "" && opts.file != "-" {
+		file, err := os.Open(opts.file)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+	importOptions := ddd.NewImportEventsOptions().SetEventStorageKey(eventStorageKey)
+	if opts.tenantId != "" {
+		importOptions.SetTenantId(opts.tenantId)
+	}
+	return ddd.ImportEvents(ctx, r, importOptions)
+}
+
+func registerEventStorage(opts *eventsOptions) error {
+	eventStorage, err := newEventStorage(opts)
+	if err != nil {
+		return err
+	}
+	ddd.RegisterEventStorage(eventStorageKey, eventStorage)
+	return nil
+}
+
+func splitNames(names string) []string {
+	var res []string
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			res = append(res, name)
+		}
+	}
+	return res
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	source := newTestEventStorage(t)
+	for _, id := range []string{"user-1", "user-2"} {
+		_, err := source.CreateEvent(ctx, &daprclient.CreateEventRequest{
+			TenantId:      "t1",
+			AggregateId:   id,
+			AggregateType: "UserAggregate",
+			Events: []*daprclient.EventDto{{
+				EventId:      "event-" + id,
+				CommandId:    "command-" + id,
+				EventData:    map[string]interface{}{"id": id},
+				EventType:    "UserCreateEvent",
+				EventVersion: "v1.0",
+				Topic:        "UserCreateEvent",
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "ddd-events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "t1.ndjson.gz")
+
+	setTestEventStorage(t, source)
+	exportResult, err := runExport(ctx, &eventsOptions{tenantId: "t1", aggregateTypes: "UserAggregate, OrderAggregate", file: file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exportResult.EventRows != 2 {
+		t.Errorf("eventRows = %d, want 2", exportResult.EventRows)
+	}
+	if data, _ := ioutil.ReadFile(file); len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		t.Error("file with .gz suffix should be gzip compressed")
+	}
+
+	target := newTestEventStorage(t)
+	setTestEventStorage(t, target)
+	importResult, err := runImport(ctx, &eventsOptions{tenantId: "t2", file: file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if importResult.CreatedRows != 2 {
+		t.Errorf("createdRows = %d, want 2", importResult.CreatedRows)
+	}
+	resp, err := target.LoadEvent(ctx, &daprclient.LoadEventsRequest{TenantId: "t2", AggregateId: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*resp.EventRecords) != 1 || (*resp.EventRecords)[0].EventId != "event-user-1" {
+		t.Errorf("events = %v", *resp.EventRecords)
+	}
+}
+
+func TestExportToStdout(t *testing.T) {
+	setTestEventStorage(t, newTestEventStorage(t))
+	buf := &bytes.Buffer{}
+	if _, err := runExport(context.Background(), &eventsOptions{tenantId: "t1", aggregateTypes: "UserAggregate", file: "-"}, buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("output = %s, want empty", buf.String())
+	}
+	if _, err := runExport(context.Background(), &eventsOptions{tenantId: "t1", aggregateTypes: "UserAggregate", fromTime: "2023-01-01"}, buf); err == nil {
+		t.Error("invalid -from should return error")
+	}
+	if _, err := runExport(context.Background(), &eventsOptions{tenantId: "t1"}, buf); err == nil {
+		t.Error("empty -aggregate-type should return error")
+	}
+}
+
+func newTestEventStorage(t *testing.T) ddd.EventStorage {
+	eventStorage, err := ddd.NewMemoryEventStorage(ddd.PubsubName("pubsub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return eventStorage
+}
+
+func setTestEventStorage(t *testing.T, eventStorage ddd.EventStorage) {
+	old := newEventStorage
+	newEventStorage = func(opts *eventsOptions) (ddd.EventStorage, error) {
+		return eventStorage, nil
+	}
+	t.Cleanup(func() { newEventStorage = old })
+}
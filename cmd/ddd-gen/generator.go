@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const dddImportPath = "github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+
+var eventMethodRegexp = regexp.MustCompile(`^On[A-Z]\w*V\d+(s\d+)*$`)
+
+//
+// generator
+// @Description: 扫描包内聚合与查询处理器的方法，生成事件与命令分发方法
+//
+type generator struct {
+	pkgName  string
+	typeList map[string]bool
+	types    map[string]*genType
+	imports  map[string]string
+}
+
+type genType struct {
+	name     string
+	events   []*genMethod
+	commands []*genMethod
+}
+
+type genMethod struct {
+	name      string
+	paramType string
+}
+
+func newGenerator(typeNames []string) *generator {
+	g := &generator{
+		types:   make(map[string]*genType),
+		imports: make(map[string]string),
+	}
+	if len(typeNames) > 0 {
+		g.typeList = make(map[string]bool)
+		for _, name := range typeNames {
+			g.typeList[name] = true
+		}
+	}
+	return g
+}
+
+//
+// parseDir
+// @Description: 解析目录下的 go 文件，忽略测试文件与生成文件
+// @param dir 目录
+// @param output 生成的文件名称
+// @return error
+//
+func (g *generator) parseDir(dir, output string) error {
+	fset := token.NewFileSet()
+	filter := func(info os.FileInfo) bool {
+		name := info.Name()
+		return !strings.HasSuffix(name, "_test.go") && name != output
+	}
+	pkgs, err := parser.ParseDir(fset, dir, filter, 0)
+	if err != nil {
+		return err
+	}
+	if len(pkgs) != 1 {
+		return fmt.Errorf("directory %s must contain exactly one package, found %d", dir, len(pkgs))
+	}
+	for name, pkg := range pkgs {
+		g.pkgName = name
+		fileNames := make([]string, 0, len(pkg.Files))
+		for fileName := range pkg.Files {
+			fileNames = append(fileNames, fileName)
+		}
+		sort.Strings(fileNames)
+		for _, fileName := range fileNames {
+			if err := g.parseFile(pkg.Files[fileName]); err != nil {
+				return fmt.Errorf("%s: %w", filepath.Base(fileName), err)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *generator) parseFile(file *ast.File) error {
+	imports := make(map[string]string)
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return err
+		}
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = path
+	}
+
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 || !fn.Name.IsExported() {
+			continue
+		}
+		star, ok := fn.Recv.List[0].Type.(*ast.StarExpr)
+		if !ok {
+			continue
+		}
+		recv, ok := star.X.(*ast.Ident)
+		if !ok || (g.typeList != nil && !g.typeList[recv.Name]) {
+			continue
+		}
+		params := flattenFields(fn.Type.Params)
+		if !isErrorResult(fn.Type.Results) || len(params) < 2 || !isContextType(params[0], imports) {
+			continue
+		}
+
+		methodName := fn.Name.Name
+		var method *genMethod
+		var isEvent bool
+		switch {
+		case len(params) == 2 && eventMethodRegexp.MatchString(methodName):
+			method, isEvent = &genMethod{name: methodName, paramType: types.ExprString(params[1])}, true
+		case len(params) == 3 && isMetadataType(params[2]) && getTypeName(params[1]) == methodName:
+			method = &genMethod{name: methodName, paramType: types.ExprString(params[1])}
+		default:
+			continue
+		}
+		if err := g.addImports(params[1], imports); err != nil {
+			return err
+		}
+		t := g.getType(recv.Name)
+		if isEvent {
+			t.events = append(t.events, method)
+		} else {
+			t.commands = append(t.commands, method)
+		}
+	}
+	return nil
+}
+
+func (g *generator) getType(name string) *genType {
+	t, ok := g.types[name]
+	if !ok {
+		t = &genType{name: name}
+		g.types[name] = t
+	}
+	return t
+}
+
+//
+// addImports
+// @Description: 记录参数类型中引用的包
+//
+func (g *generator) addImports(expr ast.Expr, imports map[string]string) (err error) {
+	ast.Inspect(expr, func(node ast.Node) bool {
+		sel, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); ok {
+			path, ok := imports[ident.Name]
+			if !ok {
+				err = fmt.Errorf("import of %s not found", ident.Name)
+				return false
+			}
+			if name, ok := g.imports[path]; ok && name != ident.Name {
+				err = fmt.Errorf("package %s imported as both %s and %s", path, name, ident.Name)
+				return false
+			}
+			g.imports[path] = ident.Name
+		}
+		return false
+	})
+	return err
+}
+
+//
+// generate
+// @Description: 生成分发方法代码
+// @return []byte 格式化后的代码，没有可生成的类型时返回 nil
+// @return error
+//
+func (g *generator) generate() ([]byte, error) {
+	names := make([]string, 0, len(g.types))
+	for name := range g.types {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "// Code generated by ddd-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package %s\n\n", g.pkgName)
+	fmt.Fprintf(buf, "import (\n\t\"context\"\n\n\t\"%s\"\n", dddImportPath)
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		if path != "context" && path != dddImportPath {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		name := g.imports[path]
+		if name == path[strings.LastIndex(path, "/")+1:] {
+			fmt.Fprintf(buf, "\t%q\n", path)
+		} else {
+			fmt.Fprintf(buf, "\t%s %q\n", name, path)
+		}
+	}
+	fmt.Fprintf(buf, ")\n\n")
+
+	fmt.Fprintf(buf, "func init() {\n")
+	for _, name := range names {
+		t := g.types[name]
+		if len(t.events) > 0 {
+			fmt.Fprintf(buf, "\tddd.RegisterEventDispatchFunc((*%s)(nil), dispatch%sEvent)\n", name, name)
+		}
+		if len(t.commands) > 0 {
+			fmt.Fprintf(buf, "\tddd.RegisterCommandDispatchFunc((*%s)(nil), dispatch%sCommand)\n", name, name)
+		}
+	}
+	fmt.Fprintf(buf, "}\n")
+
+	for _, name := range names {
+		t := g.types[name]
+		if len(t.events) > 0 {
+			fmt.Fprintf(buf, "\nfunc dispatch%sEvent(dddCtx context.Context, dddHandler interface{}, dddMethodName string, dddEvent interface{}) (bool, error) {\n", name)
+			fmt.Fprintf(buf, "\tdddRecv := dddHandler.(*%s)\n\tswitch dddMethodName {\n", name)
+			for _, m := range t.events {
+				fmt.Fprintf(buf, "\tcase %q:\n\t\tif dddValue, ok := dddEvent.(%s); ok {\n\t\t\treturn true, dddRecv.%s(dddCtx, dddValue)\n\t\t}\n", m.name, m.paramType, m.name)
+			}
+			fmt.Fprintf(buf, "\t}\n\treturn false, nil\n}\n")
+		}
+		if len(t.commands) > 0 {
+			fmt.Fprintf(buf, "\nfunc dispatch%sCommand(dddCtx context.Context, dddAggregate interface{}, dddCmd interface{}, dddMetadata *map[string]string) (bool, error) {\n", name)
+			fmt.Fprintf(buf, "\tdddRecv := dddAggregate.(*%s)\n\tswitch dddValue := dddCmd.(type) {\n", name)
+			for _, m := range t.commands {
+				fmt.Fprintf(buf, "\tcase %s:\n\t\treturn true, dddRecv.%s(dddCtx, dddValue, dddMetadata)\n", m.paramType, m.name)
+			}
+			fmt.Fprintf(buf, "\t}\n\treturn false, nil\n}\n")
+		}
+	}
+	return format.Source(buf.Bytes())
+}
+
+func flattenFields(fields *ast.FieldList) []ast.Expr {
+	var res []ast.Expr
+	if fields == nil {
+		return res
+	}
+	for _, field := range fields.List {
+		count := len(field.Names)
+		if count == 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			res = append(res, field.Type)
+		}
+	}
+	return res
+}
+
+func isErrorResult(results *ast.FieldList) bool {
+	list := flattenFields(results)
+	if len(list) != 1 {
+		return false
+	}
+	ident, ok := list[0].(*ast.Ident)
+	return ok && ident.Name == "error"
+}
+
+func isContextType(expr ast.Expr, imports map[string]string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Context" {
+		return false
+	}
+	ident, ok := sel.X.(*ast.Ident)
+	return ok && imports[ident.Name] == "context"
+}
+
+func isMetadataType(expr ast.Expr) bool {
+	return types.ExprString(expr) == "*map[string]string"
+}
+
+//
+// getTypeName
+// @Description: 获取命令参数的类型名称，如 *command.CreateUserCommand 返回 CreateUserCommand
+//
+func getTypeName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch v := expr.(type) {
+	case *ast.Ident:
+		return v.Name
+	case *ast.SelectorExpr:
+		return v.Sel.Name
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSource = `package model
+
+import (
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+	evt "example.com/app/event"
+	"example.com/app/command"
+)
+
+type UserAggregate struct {
+	Id string
+}
+
+func (a *UserAggregate) OnUserCreateEventV1s0(ctx context.Context, event *evt.UserCreateEvent) error {
+	return nil
+}
+
+func (a *UserAggregate) OnUserUpdateEventV1(ctx context.Context, event *evt.UserUpdateEvent) error {
+	return nil
+}
+
+func (a *UserAggregate) UserCreateCommand(ctx context.Context, cmd *command.UserCreateCommand, metadata *map[string]string) error {
+	return nil
+}
+
+func (a *UserAggregate) OnInvalid(ctx context.Context, event *evt.UserCreateEvent) error {
+	return nil
+}
+
+func (a *UserAggregate) GetAggregateId() ddd.AggregateId {
+	return nil
+}
+
+type UserQueryHandler struct {
+}
+
+func (h *UserQueryHandler) OnUserCreateEventV1s0(ctx context.Context, event *evt.UserCreateEvent) error {
+	return nil
+}
+`
+
+func TestGenerator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ddd-gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "user.go"), []byte(testSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = run(dir, "ddd_dispatch_gen.go", []string{"UserAggregate"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "ddd_dispatch_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := string(data)
+	for _, want := range []string{
+		"package model",
+		`evt "example.com/app/event"`,
+		`"example.com/app/command"`,
+		"ddd.RegisterEventDispatchFunc((*UserAggregate)(nil), dispatchUserAggregateEvent)",
+		"ddd.RegisterCommandDispatchFunc((*UserAggregate)(nil), dispatchUserAggregateCommand)",
+		`case "OnUserCreateEventV1s0":`,
+		`case "OnUserUpdateEventV1":`,
+		"dddEvent.(*evt.UserCreateEvent)",
+		"case *command.UserCreateCommand:",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated source does not contain %q\n%s", want, src)
+		}
+	}
+	for _, unwanted := range []string{"OnInvalid", "GetAggregateId", "UserQueryHandler"} {
+		if strings.Contains(src, unwanted) {
+			t.Errorf("generated source should not contain %q", unwanted)
+		}
+	}
+
+	if err = run(dir, "ddd_dispatch_gen.go", []string{"OrderAggregate"}); err == nil {
+		t.Error("unknown type should return error")
+	}
+}
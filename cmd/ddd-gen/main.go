@@ -0,0 +1,72 @@
+//
+// ddd-gen 生成聚合与查询处理器的事件、命令分发方法，代替运行时的反射调用。
+// 方法签名不正确时生成的代码无法编译，在编译期发现错误。
+//
+// 用法，在聚合或查询处理器所在的包中添加：
+//
+//	//go:generate go run github.com/liuxd6825/dapr-go-ddd-sdk/cmd/ddd-gen -type=UserAggregate,UserQueryHandler
+//
+// 识别的方法：
+//
+//	事件处理方法 On<Event>V<ver>(ctx context.Context, event *Event) error
+//	命令处理方法 <Command>(ctx context.Context, cmd *Command, metadata *map[string]string) error
+//
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeNames := flag.String("type", "", "逗号分隔的类型名称，为空时扫描包内全部类型")
+	output := flag.String("output", "ddd_dispatch_gen.go", "生成的文件名称")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ddd-gen [flags] [directory]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	if err := run(dir, *output, splitNames(*typeNames)); err != nil {
+		fmt.Fprintf(os.Stderr, "ddd-gen: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(dir, output string, typeNames []string) error {
+	g := newGenerator(typeNames)
+	if err := g.parseDir(dir, output); err != nil {
+		return err
+	}
+	for _, name := range typeNames {
+		if _, ok := g.types[name]; !ok {
+			return fmt.Errorf("type %s has no event or command handler methods", name)
+		}
+	}
+	src, err := g.generate()
+	if err != nil {
+		return err
+	}
+	if src == nil {
+		return fmt.Errorf("no event or command handler methods found in %s", dir)
+	}
+	return ioutil.WriteFile(filepath.Join(dir, output), src, 0644)
+}
+
+func splitNames(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
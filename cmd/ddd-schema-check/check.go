@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type report = ddd.SchemaCompatibilityReport
+
+type checkOptions struct {
+	url           string
+	file          string
+	eventType     string
+	fromVersion   string
+	toVersion     string
+	tenantId      string
+	aggregateType string
+	sampleSize    uint64
+}
+
+func check(opts *checkOptions) (*report, error) {
+	if opts.eventType == "" || opts.fromVersion == "" {
+		return nil, fmt.Errorf("-type and -from cannot be empty")
+	}
+	switch {
+	case opts.url != "":
+		return checkByUrl(opts)
+	case opts.file != "":
+		data, err := ioutil.ReadFile(opts.file)
+		if err != nil {
+			return nil, err
+		}
+		var schemas []*ddd.EventTypeSchema
+		if err = json.Unmarshal(data, &schemas); err != nil {
+			return nil, err
+		}
+		return checkBySchemas(schemas, opts)
+	}
+	return nil, fmt.Errorf("-url or -file must be specified")
+}
+
+func checkByUrl(opts *checkOptions) (*report, error) {
+	query := url.Values{}
+	query.Set("eventType", opts.eventType)
+	query.Set("fromVersion", opts.fromVersion)
+	query.Set("toVersion", opts.toVersion)
+	if opts.tenantId != "" {
+		query.Set("tenantId", opts.tenantId)
+		query.Set("aggregateType", opts.aggregateType)
+		query.Set("sampleSize", strconv.FormatUint(opts.sampleSize, 10))
+	}
+	resp, err := http.Get(strings.TrimSuffix(opts.url, "/") + "/dapr/event-types/compatibility?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, string(body))
+	}
+	r := &report{}
+	if err = json.Unmarshal(body, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func checkBySchemas(schemas []*ddd.EventTypeSchema, opts *checkOptions) (*report, error) {
+	var from, to *ddd.EventTypeSchema
+	for _, item := range schemas {
+		if item.EventType != opts.eventType {
+			continue
+		}
+		if item.EventVersion == opts.fromVersion {
+			from = item
+		}
+		if opts.toVersion == "" {
+			if to == nil || ddd.CompareEventVersion(item.EventVersion, to.EventVersion) > 0 {
+				to = item
+			}
+		} else if item.EventVersion == opts.toVersion {
+			to = item
+		}
+	}
+	if from == nil {
+		return nil, fmt.Errorf("event %s %s not found", opts.eventType, opts.fromVersion)
+	}
+	if to == nil {
+		return nil, fmt.Errorf("event %s %s not found", opts.eventType, opts.toVersion)
+	}
+	return &report{
+		EventType:    opts.eventType,
+		FromVersion:  from.EventVersion,
+		ToVersion:    to.EventVersion,
+		Changes:      ddd.CompareJsonSchemas(from.Schema, to.Schema),
+		RecordErrors: make([]*ddd.EventRecordDecodeError, 0),
+	}, nil
+}
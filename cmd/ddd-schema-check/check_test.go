@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type userEventV1 struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userEventV2 struct {
+	Id    string `json:"id"`
+	Title string `json:"title"`
+}
+
+func TestCheckByFile(t *testing.T) {
+	schemas := []*ddd.EventTypeSchema{
+		{EventType: "UserEvent", EventVersion: "v1.0", Schema: ddd.NewJsonSchema(reflect.TypeOf(userEventV1{}))},
+		{EventType: "UserEvent", EventVersion: "v1.1", Schema: ddd.NewJsonSchema(reflect.TypeOf(userEventV1{}))},
+		{EventType: "UserEvent", EventVersion: "v2.0", Schema: ddd.NewJsonSchema(reflect.TypeOf(userEventV2{}))},
+	}
+	data, err := json.Marshal(schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "ddd-schema-check")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "event-types.json")
+	if err = ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := check(&checkOptions{file: file, eventType: "UserEvent", fromVersion: "v1.0", toVersion: "v1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.IsBreaking() || len(r.Changes) != 0 {
+		t.Errorf("changes = %+v", r.Changes)
+	}
+
+	r, err = check(&checkOptions{file: file, eventType: "UserEvent", fromVersion: "v1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ToVersion != "v2.0" || !r.IsBreaking() || len(r.Changes) != 2 {
+		t.Errorf("report = %+v", r)
+	}
+
+	if _, err = check(&checkOptions{file: file, eventType: "UserEvent", fromVersion: "v0.1"}); err == nil {
+		t.Error("unknown version should return error")
+	}
+}
+
+func TestCheckByUrl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/dapr/event-types/compatibility" || q.Get("eventType") != "UserEvent" || q.Get("tenantId") != "t1" || q.Get("sampleSize") != "10" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(&ddd.SchemaCompatibilityReport{
+			EventType:      "UserEvent",
+			FromVersion:    q.Get("fromVersion"),
+			ToVersion:      "v2.0",
+			CheckedRecords: 1,
+			RecordErrors:   []*ddd.EventRecordDecodeError{{EventId: "e1", Error: "unknown field"}},
+		})
+	}))
+	defer server.Close()
+
+	r, err := check(&checkOptions{url: server.URL + "/", eventType: "UserEvent", fromVersion: "v1.0", tenantId: "t1", aggregateType: "User", sampleSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.FromVersion != "v1.0" || !r.IsBreaking() {
+		t.Errorf("report = %+v", r)
+	}
+
+	if _, err = check(&checkOptions{url: server.URL, eventType: "Other", fromVersion: "v1.0"}); err == nil {
+		t.Error("bad request should return error")
+	}
+}
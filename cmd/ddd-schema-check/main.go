@@ -0,0 +1,75 @@
+//
+// ddd-schema-check 检查事件新旧版本的结构兼容性，存在不兼容变化或无法解析的事件记录时返回非0退出码，可用于 CI。
+//
+// 用法：
+//
+//	# 调用运行中服务的 /dapr/event-types/compatibility，指定 -tenant 时抽样解析已存储的事件记录
+//	ddd-schema-check -url=http://localhost:8080 -type=UserCreateEvent -from=v1.0 -tenant=t1 -aggregate-type=UserAggregate
+//
+//	# 比较 /dapr/event-types 导出的文件
+//	ddd-schema-check -file=event-types.json -type=UserCreateEvent -from=v1.0 -to=v2.0
+//
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	opts := &checkOptions{}
+	flag.StringVar(&opts.url, "url", "", "服务地址")
+	flag.StringVar(&opts.file, "file", "", "/dapr/event-types 导出的 JSON 文件")
+	flag.StringVar(&opts.eventType, "type", "", "事件类型")
+	flag.StringVar(&opts.fromVersion, "from", "", "原版本")
+	flag.StringVar(&opts.toVersion, "to", "", "新版本，为空时使用最新版本")
+	flag.StringVar(&opts.tenantId, "tenant", "", "租户id，指定时抽样解析已存储的事件记录(仅 -url)")
+	flag.StringVar(&opts.aggregateType, "aggregate-type", "", "聚合类型(仅 -url)")
+	flag.Uint64Var(&opts.sampleSize, "sample", 100, "抽样的事件记录数量(仅 -url)")
+	jsonOutput := flag.Bool("json", false, "以 JSON 格式输出报告")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ddd-schema-check [flags]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	report, err := check(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ddd-schema-check: %s\n", err.Error())
+		os.Exit(2)
+	}
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(report)
+	} else {
+		printReport(os.Stdout, report)
+	}
+	if report.IsBreaking() {
+		os.Exit(1)
+	}
+}
+
+func printReport(w io.Writer, report *report) {
+	fmt.Fprintf(w, "%s %s -> %s\n", report.EventType, report.FromVersion, report.ToVersion)
+	for _, c := range report.Changes {
+		level := "ok"
+		if c.Breaking {
+			level = "BREAKING"
+		}
+		fmt.Fprintf(w, "  [%s] %s %s: %s", level, c.Kind, c.Path, c.Message)
+		if c.OldType != "" || c.NewType != "" {
+			fmt.Fprintf(w, " (%s -> %s)", c.OldType, c.NewType)
+		}
+		fmt.Fprintln(w)
+	}
+	if report.CheckedRecords > 0 {
+		fmt.Fprintf(w, "  checked %d records, %d failed\n", report.CheckedRecords, len(report.RecordErrors))
+	}
+	for _, e := range report.RecordErrors {
+		fmt.Fprintf(w, "  [BREAKING] record %s(%s %s): %s\n", e.EventId, e.AggregateId, e.EventVersion, e.Error)
+	}
+}
@@ -44,6 +44,11 @@ type DaprDddClient interface {
 
 var _daprClient DaprDddClient
 
+var ErrGrpcClientNil = errors.New("dapr grpc client is nil, the client is created by NewDaprDddHttpClient")
+
+// ErrGrpcFieldUnsupported sidecar 的 gRPC proto 中没有需要的字段
+var ErrGrpcFieldUnsupported = errors.New("field is not supported by the dapr grpc api")
+
 func GetDaprDDDClient() DaprDddClient {
 	return _daprClient
 }
@@ -82,7 +87,39 @@ func NewDaprDddClient(host string, httpPort int64, grpcPort int64, opts ...Optio
 		return nil, err
 	}
 
-	httpClient := &http.Client{
+	return &daprDddClient{
+		httpClient: newHttpClient(options),
+		host:       host,
+		httpPort:   httpPort,
+		grpcPort:   grpcPort,
+		grpcClient: grpcClient,
+	}, nil
+}
+
+//
+// NewDaprDddHttpClient
+// @Description: 新建只使用 http 访问 sidecar 的客户端，用于无法使用 gRPC 的环境，配合 ddd.NewHttpEventStorage 使用，
+// 事件存储的 HTTP API 只支持加载、应用事件与保存快照。
+// 客户端的 gRPC 方法返回 ErrGrpcClientNil。
+// @param host sidecar 地址
+// @param httpPort sidecar http 端口
+// @param opts 选项
+// @return DaprDddClient
+//
+func NewDaprDddHttpClient(host string, httpPort int64, opts ...Option) DaprDddClient {
+	options := newHttpOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &daprDddClient{
+		httpClient: newHttpClient(options),
+		host:       host,
+		httpPort:   httpPort,
+	}
+}
+
+func newHttpClient(options *DaprHttpOptions) *http.Client {
+	return &http.Client{
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
 			DialContext: (&net.Dialer{
@@ -94,14 +131,6 @@ func NewDaprDddClient(host string, httpPort int64, grpcPort int64, opts ...Optio
 			IdleConnTimeout:     time.Second * time.Duration(options.IdleConnTimeout),
 		},
 	}
-
-	return &daprDddClient{
-		httpClient: httpClient,
-		host:       host,
-		httpPort:   httpPort,
-		grpcPort:   grpcPort,
-		grpcClient: grpcClient,
-	}, nil
 }
 
 func newDaprClient(host string, grpcPort int64) (dapr_sdk_client.Client, error) {
@@ -156,6 +185,9 @@ func (c *daprDddClient) InvokeService(ctx context.Context, appID, methodName, ve
 			err = e
 		}
 	}()
+	if c.grpcClient == nil {
+		return nil, ErrGrpcClientNil
+	}
 	var respBytes []byte
 
 	if request != nil {
@@ -192,5 +224,8 @@ func (c *daprDddClient) InvokeService(ctx context.Context, appID, methodName, ve
 }
 
 func (c *daprDddClient) DaprClient() (dapr_sdk_client.Client, error) {
+	if c.grpcClient == nil {
+		return nil, ErrGrpcClientNil
+	}
 	return c.grpcClient, nil
 }
@@ -4,11 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd/ddd_utils"
 	pb "github.com/liuxd6825/dapr/pkg/proto/runtime/v1"
+	log "github.com/sirupsen/logrus"
+	"sync"
 )
 
+// gRPC 不支持事件时间时只警告一次
+var warnEventTimeUnsupported sync.Once
+
 func (c *daprDddClient) LoadEvents(ctx context.Context, req *LoadEventsRequest) (*LoadEventsResponse, error) {
+	if c.grpcClient == nil {
+		return nil, ErrGrpcClientNil
+	}
 	if err := ddd_utils.IsEmpty(req.TenantId, "TenantId"); err != nil {
 		return nil, err
 	}
@@ -21,6 +30,10 @@ func (c *daprDddClient) LoadEvents(ctx context.Context, req *LoadEventsRequest)
 		AggregateType: req.AggregateType,
 		AggregateId:   req.AggregateId,
 	}
+	// pb 中没有 FromSequenceNumber 字段时返回快照及之后的全部事件，由调用方按序号过滤
+	if req.FromSequenceNumber > 0 {
+		setPbUint64(in, "FromSequenceNumber", req.FromSequenceNumber)
+	}
 	out, err := c.grpcClient.LoadEvents(ctx, in)
 	if err != nil {
 		return nil, err
@@ -59,11 +72,20 @@ func (c *daprDddClient) LoadEvents(ctx context.Context, req *LoadEventsRequest)
 				return nil, err
 			}
 			event := EventRecord{
+				TenantId:     out.TenantId,
+				AggregateId:  out.AggregateId,
 				EventId:      item.EventId,
 				EventData:    eventData,
 				EventVersion: item.EventVersion,
 				EventType:    item.EventType,
 			}
+			// pb 中没有 SequenceNumber 字段时为0，依赖事件序号的功能需要检查
+			event.SequenceNumber, _ = getPbUint64(item, "SequenceNumber")
+			if metadata, ok := getPbString(item, "Metadata"); ok && len(metadata) > 0 {
+				if event.Metadata, err = ddd_utils.NewMapString(metadata); err != nil {
+					return nil, err
+				}
+			}
 			events = append(events, event)
 		}
 	}
@@ -73,6 +95,9 @@ func (c *daprDddClient) LoadEvents(ctx context.Context, req *LoadEventsRequest)
 }
 
 func (c *daprDddClient) ApplyEvent(ctx context.Context, req *ApplyEventRequest) (*ApplyEventResponse, error) {
+	if c.grpcClient == nil {
+		return nil, ErrGrpcClientNil
+	}
 	if err := ddd_utils.IsEmpty(req.TenantId, "tenantId"); err != nil {
 		return nil, err
 	}
@@ -85,17 +110,10 @@ func (c *daprDddClient) ApplyEvent(ctx context.Context, req *ApplyEventRequest)
 	if req.Events == nil {
 		return nil, errors.New("req.events cannot be nil")
 	}
-	events, err := c.newEvents(req.Events)
+	in, err := c.newApplyEventRequest(req)
 	if err != nil {
 		return nil, err
 	}
-
-	in := &pb.ApplyEventRequest{
-		TenantId:      req.TenantId,
-		AggregateId:   req.AggregateId,
-		AggregateType: req.AggregateType,
-		Events:        events,
-	}
 	out, err := c.grpcClient.ApplyEvent(ctx, in)
 	if err != nil {
 		return nil, err
@@ -103,10 +121,15 @@ func (c *daprDddClient) ApplyEvent(ctx context.Context, req *ApplyEventRequest)
 	resp := &ApplyEventResponse{
 		Headers: c.newResponseHeaders(out.Headers),
 	}
+	// pb 中没有 SequenceNumber 字段时为0，由调用方使用加载聚合时记录的序号
+	resp.SequenceNumber, _ = getPbUint64(out, "SequenceNumber")
 	return resp, nil
 }
 
 func (c *daprDddClient) CreateEvent(ctx context.Context, req *CreateEventRequest) (*CreateEventResponse, error) {
+	if c.grpcClient == nil {
+		return nil, ErrGrpcClientNil
+	}
 	if err := ddd_utils.IsEmpty(req.TenantId, "tenantId"); err != nil {
 		return nil, err
 	}
@@ -138,10 +161,14 @@ func (c *daprDddClient) CreateEvent(ctx context.Context, req *CreateEventRequest
 	resp := &CreateEventResponse{
 		Headers: c.newResponseHeaders(out.Headers),
 	}
+	resp.SequenceNumber, _ = getPbUint64(out, "SequenceNumber")
 	return resp, nil
 }
 
 func (c *daprDddClient) DeleteEvent(ctx context.Context, req *DeleteEventRequest) (*DeleteEventResponse, error) {
+	if c.grpcClient == nil {
+		return nil, ErrGrpcClientNil
+	}
 	if err := ddd_utils.IsEmpty(req.TenantId, "tenantId"); err != nil {
 		return nil, err
 	}
@@ -172,9 +199,36 @@ func (c *daprDddClient) DeleteEvent(ctx context.Context, req *DeleteEventRequest
 	resp := &DeleteEventResponse{
 		Headers: c.newResponseHeaders(out.Headers),
 	}
+	resp.SequenceNumber, _ = getPbUint64(out, "SequenceNumber")
 	return resp, nil
 }
 
+//
+// newApplyEventRequest
+// @Description: 转换为 gRPC 请求。pb 中没有 ExpectedSequenceNumber 字段时无法进行并发检查，
+// 要求了期望序号的请求返回 ErrGrpcFieldUnsupported，而不是跳过检查直接写入
+// @receiver c
+// @param req 应用事件请求
+// @return *pb.ApplyEventRequest gRPC 请求
+// @return error 错误
+//
+func (c *daprDddClient) newApplyEventRequest(req *ApplyEventRequest) (*pb.ApplyEventRequest, error) {
+	events, err := c.newEvents(req.Events)
+	if err != nil {
+		return nil, err
+	}
+	in := &pb.ApplyEventRequest{
+		TenantId:      req.TenantId,
+		AggregateId:   req.AggregateId,
+		AggregateType: req.AggregateType,
+		Events:        events,
+	}
+	if req.ExpectedSequenceNumber > 0 && !setPbUint64(in, "ExpectedSequenceNumber", req.ExpectedSequenceNumber) {
+		return nil, newGrpcFieldUnsupportedError("ApplyEventRequest.ExpectedSequenceNumber")
+	}
+	return in, nil
+}
+
 func (c *daprDddClient) newEvents(events []*EventDto) ([]*pb.EventDto, error) {
 	var resList []*pb.EventDto
 	for _, e := range events {
@@ -227,10 +281,21 @@ func (c *daprDddClient) newEvent(e *EventDto) (*pb.EventDto, error) {
 		Topic:        e.Topic,
 		Relations:    e.Relations,
 	}
+	if err := setPbRelationValues(event, e.RelationValues); err != nil {
+		return nil, err
+	}
+	if e.EventTime != nil && !setPbTime(event, "EventTime", *e.EventTime) {
+		warnEventTimeUnsupported.Do(func() {
+			log.Warnln("dapr grpc EventDto has no EventTime field, eventTime is not sent and the event storage generates a new one")
+		})
+	}
 	return event, nil
 }
 
 func (c *daprDddClient) SaveSnapshot(ctx context.Context, req *SaveSnapshotRequest) (*SaveSnapshotResponse, error) {
+	if c.grpcClient == nil {
+		return nil, ErrGrpcClientNil
+	}
 	if err := ddd_utils.IsEmpty(req.TenantId, "tenantId"); err != nil {
 		return nil, err
 	}
@@ -272,6 +337,9 @@ func (c *daprDddClient) SaveSnapshot(ctx context.Context, req *SaveSnapshotReque
 }
 
 func (c *daprDddClient) GetRelations(ctx context.Context, req *GetRelationsRequest) (*GetRelationsResponse, error) {
+	if c.grpcClient == nil {
+		return nil, ErrGrpcClientNil
+	}
 	if req == nil {
 		return nil, errors.New("daprclient.GetRelations(ctx, req) error: req is nil")
 	}
@@ -327,6 +395,9 @@ func (c *daprDddClient) GetRelations(ctx context.Context, req *GetRelationsReque
 }
 
 func (c *daprDddClient) GetEvents(ctx context.Context, req *GetEventsRequest) (*GetEventsResponse, error) {
+	if c.grpcClient == nil {
+		return nil, ErrGrpcClientNil
+	}
 	if req == nil {
 		return nil, errors.New("daprclient.GetRelations(ctx, req) error: req is nil")
 	}
@@ -367,11 +438,11 @@ func (c *daprDddClient) GetEvents(ctx context.Context, req *GetEventsRequest) (*
 				EventData:    eventData,
 				EventType:    datum.EventType,
 				EventVersion: datum.EventVersion,
-				// EventTime:    datum.EventTime,
-				PubsubName: datum.PubsubName,
-				Topic:      datum.Topic,
-				Metadata:   metadata,
+				PubsubName:   datum.PubsubName,
+				Topic:        datum.Topic,
+				Metadata:     metadata,
 			}
+			setGetEventsItemFields(eventItem, datum)
 			events = append(events, eventItem)
 		}
 	}
@@ -391,6 +462,57 @@ func (c *daprDddClient) GetEvents(ctx context.Context, req *GetEventsRequest) (*
 	return resp, nil
 }
 
+//
+// setPbRelationValues
+// @Description: 以 JSON 字符串写入 pb.EventDto.RelationValues。pb 中没有该字段时 Relations 只保留每个关系的第一个值，
+// 有多个值的关系会丢失，因此返回 ErrGrpcFieldUnsupported
+//
+func setPbRelationValues(event *pb.EventDto, relationValues map[string][]string) error {
+	if len(relationValues) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(relationValues)
+	if err != nil {
+		return err
+	}
+	if setPbString(event, "RelationValues", string(data)) {
+		return nil
+	}
+	for name, values := range relationValues {
+		if len(values) > 1 {
+			return fmt.Errorf("%w: EventDto.RelationValues, relation %s has %d values, upgrade the dapr sidecar and its proto", ErrGrpcFieldUnsupported, name, len(values))
+		}
+	}
+	return nil
+}
+
+//
+// setGetEventsItemFields
+// @Description: 复制 pb.EventItemDto 中的聚合id、事件序号与事件时间，pb 中没有的字段保持零值。
+// 回放、导出、历史等依赖这些字段的功能自行检查并报错
+//
+func setGetEventsItemFields(item *GetEventsItem, datum *pb.EventItemDto) {
+	item.AggregateId, _ = getPbString(datum, "AggregateId")
+	item.SequenceNumber, _ = getPbUint64(datum, "SequenceNumber")
+	item.EventTime, _ = getPbTime(datum, "EventTime")
+}
+
+//
+// GrpcSupportsSequenceNumber
+// @Description: sidecar 的 gRPC proto 是否支持事件序号，即 EventRecordDto.SequenceNumber、LoadEventRequest.FromSequenceNumber
+// 与 ApplyEventRequest.ExpectedSequenceNumber。
+// 不支持时 LoadEvents 返回的事件序号为0，依赖事件序号的功能(如聚合根缓存)需要升级 sidecar 及其 proto
+// @return bool
+//
+func GrpcSupportsSequenceNumber() bool {
+	return hasPbField(&pb.EventRecordDto{}, "SequenceNumber") && hasPbField(&pb.LoadEventRequest{}, "FromSequenceNumber") &&
+		hasPbField(&pb.ApplyEventRequest{}, "ExpectedSequenceNumber")
+}
+
+func newGrpcFieldUnsupportedError(field string) error {
+	return fmt.Errorf("%w: %s, upgrade the dapr sidecar and its proto", ErrGrpcFieldUnsupported, field)
+}
+
 func (c *daprDddClient) newResponseHeaders(out *pb.ResponseHeaders) *ResponseHeaders {
 	if out == nil {
 		return &ResponseHeaders{
@@ -0,0 +1,89 @@
+package daprclient
+
+import (
+	"errors"
+	pb "github.com/liuxd6825/dapr/pkg/proto/runtime/v1"
+	"testing"
+)
+
+func TestDaprDddClient_NewEventRelationValues(t *testing.T) {
+	c := &daprDddClient{}
+	e := &EventDto{
+		EventId:        "event-1",
+		CommandId:      "command-1",
+		EventType:      "test.Event",
+		EventVersion:   "v1.0",
+		PubsubName:     "pubsub",
+		Topic:          "test.Event",
+		Relations:      map[string]string{"userId": "u1"},
+		RelationValues: map[string][]string{"userId": {"u1"}},
+	}
+	event, err := c.newEvent(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Relations["userId"] != "u1" {
+		t.Errorf("relations = %v", event.Relations)
+	}
+
+	e.RelationValues = map[string][]string{"userId": {"u1", "u2"}}
+	event, err = c.newEvent(e)
+	if !hasPbField(&pb.EventDto{}, "RelationValues") {
+		if !errors.Is(err, ErrGrpcFieldUnsupported) {
+			t.Errorf("err = %v, want ErrGrpcFieldUnsupported", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := getPbString(event, "RelationValues"); v != `{"userId":["u1","u2"]}` {
+		t.Errorf("relationValues = %s", v)
+	}
+}
+
+func TestDaprDddClient_NewApplyEventRequest(t *testing.T) {
+	c := &daprDddClient{}
+	req := &ApplyEventRequest{
+		TenantId:      "tenant-1",
+		AggregateId:   "agg-1",
+		AggregateType: "test.Aggregate",
+		Events:        []*EventDto{{EventId: "event-1", CommandId: "command-1", EventType: "test.Event", EventVersion: "v1.0", PubsubName: "pubsub", Topic: "test.Event"}},
+	}
+	if _, err := c.newApplyEventRequest(req); err != nil {
+		t.Fatal(err)
+	}
+
+	req.ExpectedSequenceNumber = 3
+	in, err := c.newApplyEventRequest(req)
+	if !hasPbField(&pb.ApplyEventRequest{}, "ExpectedSequenceNumber") {
+		if !errors.Is(err, ErrGrpcFieldUnsupported) {
+			t.Errorf("err = %v, want ErrGrpcFieldUnsupported", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := getPbUint64(in, "ExpectedSequenceNumber"); v != 3 {
+		t.Errorf("expectedSequenceNumber = %d, want 3", v)
+	}
+}
+
+func TestSetGetEventsItemFields(t *testing.T) {
+	datum := &pb.EventItemDto{EventId: "event-1"}
+	setPbString(datum, "AggregateId", "agg-1")
+	setPbUint64(datum, "SequenceNumber", 2)
+
+	item := &GetEventsItem{EventId: "event-1"}
+	setGetEventsItemFields(item, datum)
+	if !hasPbField(datum, "AggregateId") {
+		if item.AggregateId != "" || item.SequenceNumber != 0 || item.EventTime != nil {
+			t.Errorf("item = %+v, missing fields should be zero", item)
+		}
+		return
+	}
+	if item.AggregateId != "agg-1" || item.SequenceNumber != 2 {
+		t.Errorf("aggregateId = %s, sequenceNumber = %d", item.AggregateId, item.SequenceNumber)
+	}
+}
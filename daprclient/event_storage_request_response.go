@@ -6,14 +6,16 @@ import (
 )
 
 type ApplyEventRequest struct {
-	TenantId      string      `json:"tenantId"`
-	AggregateId   string      `json:"aggregateId"`
-	AggregateType string      `json:"aggregateType"`
-	Events        []*EventDto `json:"events"`
+	TenantId               string      `json:"tenantId"`
+	AggregateId            string      `json:"aggregateId"`
+	AggregateType          string      `json:"aggregateType"`
+	Events                 []*EventDto `json:"events"`
+	ExpectedSequenceNumber uint64      `json:"expectedSequenceNumber"` // 期望的聚合当前序号，0表示不检查
 }
 
 type ApplyEventResponse struct {
-	Headers *ResponseHeaders `json:"headers"`
+	Headers        *ResponseHeaders `json:"headers"`
+	SequenceNumber uint64           `json:"sequenceNumber"` // 写入后聚合最后的事件序号，0表示存储器未返回
 }
 
 type CreateEventRequest struct {
@@ -24,7 +26,8 @@ type CreateEventRequest struct {
 }
 
 type CreateEventResponse struct {
-	Headers *ResponseHeaders `json:"headers"`
+	Headers        *ResponseHeaders `json:"headers"`
+	SequenceNumber uint64           `json:"sequenceNumber"` // 写入后聚合最后的事件序号，0表示存储器未返回
 }
 
 type DeleteEventRequest struct {
@@ -35,7 +38,8 @@ type DeleteEventRequest struct {
 }
 
 type DeleteEventResponse struct {
-	Headers *ResponseHeaders `json:"headers"`
+	Headers        *ResponseHeaders `json:"headers"`
+	SequenceNumber uint64           `json:"sequenceNumber"` // 写入后聚合最后的事件序号，0表示存储器未返回
 }
 
 type EventDto struct {
@@ -47,7 +51,12 @@ type EventDto struct {
 	Metadata     map[string]string `json:"metadata"`
 	PubsubName   string            `json:"pubsubName"`
 	Topic        string            `json:"topic"`
-	Relations    map[string]string `json:"relations"` // 聚合关系
+	Relations    map[string]string `json:"relations"` // 聚合关系，每个关系取第一个值
+	// 多值的聚合关系，切片类型的字段产生多个值。gRPC 协议中 pb.EventDto 没有 RelationValues 字段时只能传递单值的 Relations，
+	// 此时有多个值的关系返回 ErrGrpcFieldUnsupported
+	RelationValues map[string][]string `json:"relationValues,omitempty"`
+	// 事件时间，为空时由事件存储器生成，导入事件时用于保留原事件时间。gRPC 协议中 pb.EventDto 没有 EventTime 字段时不传递
+	EventTime *time.Time `json:"eventTime,omitempty"`
 }
 
 type ExistAggregateResponse struct {
@@ -56,9 +65,10 @@ type ExistAggregateResponse struct {
 }
 
 type LoadEventsRequest struct {
-	TenantId      string `json:"tenantId"`
-	AggregateId   string `json:"aggregateId"`
-	AggregateType string `json:"aggregateType"`
+	TenantId           string `json:"tenantId"`
+	AggregateId        string `json:"aggregateId"`
+	AggregateType      string `json:"aggregateType"`
+	FromSequenceNumber uint64 `json:"fromSequenceNumber"` // 大于0时不返回快照，只返回序号大于此值的事件
 }
 
 type LoadEventsResponse struct {
@@ -78,11 +88,14 @@ type Snapshot struct {
 }
 
 type EventRecord struct {
+	TenantId       string                 `json:"tenantId,omitempty"`
+	AggregateId    string                 `json:"aggregateId,omitempty"`
 	EventId        string                 `json:"eventId"`
 	EventData      map[string]interface{} `json:"eventData"`
 	EventType      string                 `json:"eventType"`
 	EventVersion   string                 `json:"eventVersion"`
 	SequenceNumber uint64                 `json:"sequenceNumber"`
+	Metadata       map[string]string      `json:"metadata"`
 }
 
 // NewEventRecordByJsonBytes 通过json反序列化EventRecord
@@ -217,23 +230,26 @@ type GetEventsResponse struct {
 }
 
 type GetEventsItem struct {
-	EventId      string
-	CommandId    string
-	EventData    map[string]interface{}
-	EventType    string
-	EventVersion string
-	EventTime    *time.Time
-	PubsubName   string
-	Topic        string
-	Metadata     map[string]string
+	EventId        string
+	CommandId      string
+	EventData      map[string]interface{}
+	EventType      string
+	EventVersion   string
+	EventTime      *time.Time
+	PubsubName     string
+	Topic          string
+	Metadata       map[string]string
+	AggregateId    string
+	SequenceNumber uint64
 }
 
 type ResponseStatus int32
 
 const (
-	ResponseStatusSuccess        ResponseStatus = iota // 执行成功
-	ResponseStatusError                                // 执行错误
-	ResponseStatusEventDuplicate                       // 事件已经存在，被重复执行
+	ResponseStatusSuccess             ResponseStatus = iota // 执行成功
+	ResponseStatusError                                     // 执行错误
+	ResponseStatusEventDuplicate                            // 事件已经存在，被重复执行
+	ResponseStatusConcurrencyConflict                       // 聚合序号与期望序号不一致，并发冲突
 )
 
 func NewResponseHeaders(status ResponseStatus, err error, values map[string]string) *ResponseHeaders {
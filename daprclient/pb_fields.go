@@ -0,0 +1,141 @@
+package daprclient
+
+import (
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"reflect"
+	"time"
+)
+
+//
+// 不同版本的 sidecar proto 中事件存储消息的字段不同，例如 EventRecordDto.SequenceNumber、
+// ApplyEventRequest.ExpectedSequenceNumber。以下方法按字段名称读写 pb 消息，字段不存在时返回 false，
+// 由调用方决定报错还是降级，不会静默地使用零值。
+//
+
+func getPbField(msg interface{}, name string) (reflect.Value, bool) {
+	v := reflect.ValueOf(msg)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return reflect.Value{}, false
+	}
+	v = v.Elem()
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	field := v.FieldByName(name)
+	if !field.IsValid() || !field.CanInterface() {
+		return reflect.Value{}, false
+	}
+	return field, true
+}
+
+// hasPbField pb 消息是否有该字段
+func hasPbField(msg interface{}, name string) bool {
+	_, ok := getPbField(msg, name)
+	return ok
+}
+
+func getPbUint64(msg interface{}, name string) (uint64, bool) {
+	field, ok := getPbField(msg, name)
+	if !ok {
+		return 0, false
+	}
+	switch field.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field.Uint(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if field.Int() >= 0 {
+			return uint64(field.Int()), true
+		}
+	}
+	return 0, false
+}
+
+func getPbString(msg interface{}, name string) (string, bool) {
+	field, ok := getPbField(msg, name)
+	if !ok || field.Kind() != reflect.String {
+		return "", false
+	}
+	return field.String(), true
+}
+
+//
+// getPbTime
+// @Description: 读取时间字段，支持 timestamppb.Timestamp(AsTime)、time.Time 与 RFC3339 字符串。字段为空时返回 nil, true
+//
+func getPbTime(msg interface{}, name string) (*time.Time, bool) {
+	field, ok := getPbField(msg, name)
+	if !ok {
+		return nil, false
+	}
+	if (field.Kind() == reflect.Ptr || field.Kind() == reflect.Interface) && field.IsNil() {
+		return nil, true
+	}
+	switch v := field.Interface().(type) {
+	case interface{ AsTime() time.Time }:
+		t := v.AsTime()
+		return &t, true
+	case time.Time:
+		return &v, true
+	case *time.Time:
+		return v, true
+	case string:
+		if len(v) == 0 {
+			return nil, true
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, false
+		}
+		return &t, true
+	}
+	return nil, false
+}
+
+func setPbString(msg interface{}, name string, value string) bool {
+	field, ok := getPbField(msg, name)
+	if !ok || !field.CanSet() || field.Kind() != reflect.String {
+		return false
+	}
+	field.SetString(value)
+	return true
+}
+
+//
+// setPbTime
+// @Description: 写入时间字段，支持 timestamppb.Timestamp、time.Time 与 RFC3339 字符串
+//
+func setPbTime(msg interface{}, name string, value time.Time) bool {
+	field, ok := getPbField(msg, name)
+	if !ok || !field.CanSet() {
+		return false
+	}
+	switch field.Interface().(type) {
+	case *timestamppb.Timestamp:
+		field.Set(reflect.ValueOf(timestamppb.New(value)))
+	case time.Time:
+		field.Set(reflect.ValueOf(value))
+	case *time.Time:
+		field.Set(reflect.ValueOf(&value))
+	case string:
+		field.SetString(value.Format(time.RFC3339Nano))
+	default:
+		return false
+	}
+	return true
+}
+
+func setPbUint64(msg interface{}, name string, value uint64) bool {
+	field, ok := getPbField(msg, name)
+	if !ok || !field.CanSet() {
+		return false
+	}
+	switch field.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		field.SetUint(value)
+		return true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		field.SetInt(int64(value))
+		return true
+	}
+	return false
+}
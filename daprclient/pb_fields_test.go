@@ -0,0 +1,63 @@
+package daprclient
+
+import (
+	"errors"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"testing"
+	"time"
+)
+
+type pbTimestamp struct{ t time.Time }
+
+func (p *pbTimestamp) AsTime() time.Time { return p.t }
+
+type pbNewItem struct {
+	AggregateId    string
+	SequenceNumber uint64
+	EventTime      *pbTimestamp
+}
+
+type pbOldItem struct {
+	EventId string
+}
+
+type pbEventDto struct {
+	EventTime *timestamppb.Timestamp
+	Created   string
+}
+
+func TestPbFields(t *testing.T) {
+	now := time.Now()
+	item := &pbNewItem{AggregateId: "agg-1", SequenceNumber: 3, EventTime: &pbTimestamp{t: now}}
+	if v, ok := getPbString(item, "AggregateId"); !ok || v != "agg-1" {
+		t.Errorf("getPbString() = %s, %v", v, ok)
+	}
+	if v, ok := getPbUint64(item, "SequenceNumber"); !ok || v != 3 {
+		t.Errorf("getPbUint64() = %d, %v", v, ok)
+	}
+	if v, ok := getPbTime(item, "EventTime"); !ok || v == nil || !v.Equal(now) {
+		t.Errorf("getPbTime() = %v, %v", v, ok)
+	}
+	if !setPbUint64(item, "SequenceNumber", 5) || item.SequenceNumber != 5 {
+		t.Errorf("setPbUint64() sequenceNumber = %d", item.SequenceNumber)
+	}
+
+	event := &pbEventDto{}
+	if !setPbTime(event, "EventTime", now) || !event.EventTime.AsTime().Equal(now) {
+		t.Errorf("setPbTime() eventTime = %v", event.EventTime)
+	}
+	if !setPbTime(event, "Created", now) || event.Created != now.Format(time.RFC3339Nano) {
+		t.Errorf("setPbTime() created = %s", event.Created)
+	}
+
+	old := &pbOldItem{}
+	if _, ok := getPbUint64(old, "SequenceNumber"); ok {
+		t.Error("getPbUint64() of missing field ok = true")
+	}
+	if setPbUint64(old, "SequenceNumber", 1) || setPbTime(old, "EventTime", now) || hasPbField(old, "SequenceNumber") {
+		t.Error("missing field should not be set")
+	}
+	if err := newGrpcFieldUnsupportedError("EventItemDto.SequenceNumber"); !errors.Is(err, ErrGrpcFieldUnsupported) {
+		t.Errorf("err = %v, want ErrGrpcFieldUnsupported", err)
+	}
+}
@@ -0,0 +1,255 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/assert"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/rsql"
+	"math"
+	"reflect"
+	"time"
+)
+
+var ErrReadOnlyAggregate = errors.New("aggregate is read-only")
+
+//
+// ReadOnlyAggregate
+// @Description: 按事件序号或时间加载的历史聚合根，不能用于 CreateEvent、ApplyEvent、DeleteEvent。
+// 通过 GetAggregate() 获取重放了历史事件的聚合根，该对象与加载时传入的聚合根类型相同，但不是同一个对象。
+//
+type ReadOnlyAggregate struct {
+	Aggregate
+	sequenceNumber uint64
+}
+
+func (a *ReadOnlyAggregate) GetAggregate() Aggregate {
+	return a.Aggregate
+}
+
+//
+// GetSequenceNumber
+// @Description: 聚合根历史状态对应的最后事件序号
+//
+func (a *ReadOnlyAggregate) GetSequenceNumber() uint64 {
+	return a.sequenceNumber
+}
+
+//
+// loadAggregateAsOf
+// @Description: 加载聚合根在指定事件序号或时间的状态。快照的序号在范围内时从快照恢复，否则从第一个事件开始重放。
+// LoadEvent 返回的事件没有序号时(如 pb 中没有 SequenceNumber 字段的 gRPC 事件存储)改用 GetEvents 查询快照之后的事件，
+// 事件仍没有序号时返回错误。加载结果不会记录到上下文的聚合序号中。
+// 历史状态重放到新建的同类型聚合根中，传入的聚合根对象不会被修改。
+// @param ctx 上下文
+// @param eventStorage 事件存储器
+// @param tenantId 租户id
+// @param aggregateId 聚合根id
+// @param aggregate 聚合根对象，只用于确定聚合类型
+// @param toSequenceNumber 最大事件序号（包含），可为nil
+// @param toTime 最大事件时间（包含），可为nil
+// @return Aggregate *ReadOnlyAggregate
+// @return bool 是否找到
+// @return error
+//
+func loadAggregateAsOf(ctx context.Context, eventStorage EventStorage, tenantId, aggregateId string, aggregate Aggregate, toSequenceNumber *uint64, toTime *time.Time) (Aggregate, bool, error) {
+	if err := assert.NotNil(aggregate, assert.NewOptions("aggregate is nil")); err != nil {
+		return nil, false, err
+	}
+	if err := assert.NotEmpty(aggregateId, assert.NewOptions("aggregateId is nil")); err != nil {
+		return nil, false, err
+	}
+	if err := assert.NotEmpty(tenantId, assert.NewOptions("tenantId is nil")); err != nil {
+		return nil, false, err
+	}
+	aggregate, err := newEmptyAggregate(aggregate)
+	if err != nil {
+		return nil, false, err
+	}
+	aggregateType := aggregate.GetAggregateType()
+	resp, err := eventStorage.LoadEvent(ctx, &daprclient.LoadEventsRequest{
+		TenantId:      tenantId,
+		AggregateId:   aggregateId,
+		AggregateType: aggregateType,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.Snapshot == nil && (resp.EventRecords == nil || len(*resp.EventRecords) == 0) {
+		return nil, false, nil
+	}
+
+	bound := uint64(math.MaxUint64)
+	if toSequenceNumber != nil {
+		bound = *toSequenceNumber
+	}
+	var items []*daprclient.GetEventsItem
+	if toTime != nil {
+		// RSQL 的日期时间精确到秒，按向上取整的秒查询后再按事件时间过滤
+		filter := rsql.NewFilterBuilder().Eq("aggregateId", aggregateId).Le("eventTime", ceilSecond(*toTime))
+		if items, err = getAggregateEventItems(ctx, eventStorage, tenantId, aggregateType, filter); err != nil {
+			return nil, false, err
+		}
+		items = filterEventItemsByTime(items, *toTime)
+		last := uint64(0)
+		if count := len(items); count > 0 {
+			last = items[count-1].SequenceNumber
+		}
+		if last < bound {
+			bound = last
+		}
+	}
+	if bound == 0 {
+		return nil, false, nil
+	}
+
+	var records []daprclient.EventRecord
+	sequenceNumber := uint64(0)
+	if snapshot := resp.Snapshot; snapshot == nil || snapshot.SequenceNumber <= bound {
+		if snapshot != nil {
+			bytes, err := json.Marshal(snapshot.AggregateData)
+			if err != nil {
+				return nil, false, err
+			}
+			if err = json.Unmarshal(bytes, aggregate); err != nil {
+				return nil, false, err
+			}
+			sequenceNumber = snapshot.SequenceNumber
+		}
+		if resp.EventRecords != nil {
+			records = *resp.EventRecords
+		}
+		if hasEventRecordWithoutSequenceNumber(records) {
+			records = nil
+			filter := rsql.NewFilterBuilder().Eq("aggregateId", aggregateId).Gt("sequenceNumber", sequenceNumber).Le("sequenceNumber", bound)
+			if items, err = getAggregateEventItems(ctx, eventStorage, tenantId, aggregateType, filter); err != nil {
+				return nil, false, err
+			}
+			for _, item := range items {
+				records = append(records, *newEventRecordByGetEventsItem(tenantId, item))
+			}
+		}
+	} else {
+		if items == nil {
+			filter := rsql.NewFilterBuilder().Eq("aggregateId", aggregateId).Le("sequenceNumber", bound)
+			if items, err = getAggregateEventItems(ctx, eventStorage, tenantId, aggregateType, filter); err != nil {
+				return nil, false, err
+			}
+		}
+		for _, item := range items {
+			records = append(records, *newEventRecordByGetEventsItem(tenantId, item))
+		}
+	}
+
+	if hasEventRecordWithoutSequenceNumber(records) {
+		return nil, false, errors.ErrorOf("loadAggregateAsOf() error: event storage returned events without sequence number, aggregateId is %s", aggregateId)
+	}
+	for i := range records {
+		record := &records[i]
+		if record.SequenceNumber <= sequenceNumber {
+			continue
+		}
+		if record.SequenceNumber > bound {
+			break
+		}
+		if err := CallEventHandler(ctx, aggregate, record); err != nil {
+			return nil, false, err
+		}
+		sequenceNumber = record.SequenceNumber
+	}
+	if sequenceNumber == 0 {
+		return nil, false, nil
+	}
+	return &ReadOnlyAggregate{Aggregate: aggregate, sequenceNumber: sequenceNumber}, true, nil
+}
+
+//
+// newEmptyAggregate
+// @Description: 新建与 aggregate 类型相同的空聚合根
+//
+func newEmptyAggregate(aggregate Aggregate) (Aggregate, error) {
+	t := reflect.TypeOf(aggregate)
+	if t.Kind() != reflect.Ptr {
+		return nil, errors.ErrorOf("aggregate %s must be a pointer", aggregate.GetAggregateType())
+	}
+	res, ok := reflect.New(t.Elem()).Interface().(Aggregate)
+	if !ok {
+		return nil, errors.ErrorOf("%s is not ddd.Aggregate", t.String())
+	}
+	return res, nil
+}
+
+func ceilSecond(t time.Time) time.Time {
+	if value := t.Truncate(time.Second); !value.Equal(t) {
+		return value.Add(time.Second)
+	}
+	return t
+}
+
+// filterEventItemsByTime 只保留事件时间不晚于 toTime 的事件，没有事件时间的事件保留
+func filterEventItemsByTime(items []*daprclient.GetEventsItem, toTime time.Time) []*daprclient.GetEventsItem {
+	res := make([]*daprclient.GetEventsItem, 0, len(items))
+	for _, item := range items {
+		if item.EventTime == nil || !item.EventTime.After(toTime) {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+func hasEventRecordWithoutSequenceNumber(records []daprclient.EventRecord) bool {
+	for _, record := range records {
+		if record.SequenceNumber == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// getAggregateEventItems
+// @Description: 分页查询满足条件的全部事件，按事件序号升序
+//
+func getAggregateEventItems(ctx context.Context, eventStorage EventStorage, tenantId, aggregateType string, filterBuilder *rsql.FilterBuilder) ([]*daprclient.GetEventsItem, error) {
+	filter, err := filterBuilder.Build()
+	if err != nil {
+		return nil, err
+	}
+	pageSize := defaultReplayPageSize
+	var items []*daprclient.GetEventsItem
+	for pageNum := uint64(0); ; pageNum++ {
+		resp, err := eventStorage.GetEvents(ctx, &daprclient.GetEventsRequest{
+			TenantId:      tenantId,
+			AggregateType: aggregateType,
+			Filter:        filter,
+			Sort:          "sequenceNumber:asc",
+			PageNum:       pageNum,
+			PageSize:      pageSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := checkEventItems(resp.Data); err != nil {
+			return nil, err
+		}
+		items = append(items, resp.Data...)
+		if uint64(len(resp.Data)) < pageSize {
+			break
+		}
+	}
+	return items, nil
+}
+
+func newEventRecordByGetEventsItem(tenantId string, item *daprclient.GetEventsItem) *daprclient.EventRecord {
+	return &daprclient.EventRecord{
+		TenantId:       tenantId,
+		AggregateId:    item.AggregateId,
+		EventId:        item.EventId,
+		EventData:      item.EventData,
+		EventType:      item.EventType,
+		EventVersion:   item.EventVersion,
+		SequenceNumber: item.SequenceNumber,
+		Metadata:       item.Metadata,
+	}
+}
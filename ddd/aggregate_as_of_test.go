@@ -0,0 +1,182 @@
+package ddd
+
+import (
+	"context"
+	"errors"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"testing"
+	"time"
+)
+
+func TestLoadAggregate_ToSequenceNumber(t *testing.T) {
+	ctx := context.Background()
+	eventStorage := newMemoryStorage(t)
+	newAsOfTestAggregate(t, "name-2", "name-3")
+
+	for _, c := range []struct {
+		toSequenceNumber uint64
+		name             string
+		sequenceNumber   uint64
+	}{
+		{1, "name-1", 1},
+		{2, "name-2", 2},
+		{10, "name-3", 3},
+	} {
+		agg, find, err := LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{}, NewLoadAggregateOptions().SetToSequenceNumber(c.toSequenceNumber))
+		if err != nil || !find {
+			t.Fatalf("LoadAggregate(%d) = %v, %v", c.toSequenceNumber, find, err)
+		}
+		readOnly, ok := agg.(*ReadOnlyAggregate)
+		if !ok {
+			t.Fatalf("LoadAggregate(%d) returns %T, want *ReadOnlyAggregate", c.toSequenceNumber, agg)
+		}
+		if name := readOnly.GetAggregate().(*memAggregate).Name; name != c.name || readOnly.GetSequenceNumber() != c.sequenceNumber {
+			t.Errorf("LoadAggregate(%d) = %s, %d; want %s, %d", c.toSequenceNumber, name, readOnly.GetSequenceNumber(), c.name, c.sequenceNumber)
+		}
+	}
+
+	if _, err := eventStorage.SaveSnapshot(ctx, &daprclient.SaveSnapshotRequest{
+		TenantId:         "tenant-1",
+		AggregateId:      "agg-1",
+		AggregateType:    memAggregateType,
+		AggregateData:    &memAggregate{Id: "agg-1", TenantId: "tenant-1", Name: "snapshot", UserId: "user-1"},
+		AggregateVersion: "v1.0",
+		SequenceNumber:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	agg, _, err := LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{}, NewLoadAggregateOptions().SetToSequenceNumber(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := agg.(*ReadOnlyAggregate).GetAggregate().(*memAggregate).Name; name != "name-1" {
+		t.Errorf("snapshot newer than the bound should be skipped, name = %s", name)
+	}
+	agg, _, err = LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{}, NewLoadAggregateOptions().SetToSequenceNumber(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := agg.(*ReadOnlyAggregate).GetAggregate().(*memAggregate).Name; name != "snapshot" {
+		t.Errorf("snapshot within the bound should be used, name = %s", name)
+	}
+
+	if _, find, err := LoadAggregate(ctx, "tenant-1", "agg-none", &memAggregate{}, NewLoadAggregateOptions().SetToSequenceNumber(1)); err != nil || find {
+		t.Errorf("LoadAggregate(agg-none) = %v, %v; want false, nil", find, err)
+	}
+}
+
+func TestLoadAggregate_ToSequenceNumberKeepsAggregate(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+	newAsOfTestAggregate(t, "name-2")
+
+	aggregate := &memAggregate{Name: "current"}
+	agg, find, err := LoadAggregate(ctx, "tenant-1", "agg-1", aggregate, NewLoadAggregateOptions().SetToSequenceNumber(1))
+	if err != nil || !find {
+		t.Fatalf("LoadAggregate() = %v, %v", find, err)
+	}
+	if aggregate.Name != "current" || aggregate.Id != "" {
+		t.Errorf("aggregate = %+v, the aggregate passed in should not be changed", aggregate)
+	}
+	loaded := agg.(*ReadOnlyAggregate).GetAggregate().(*memAggregate)
+	if loaded == aggregate || loaded.Name != "name-1" {
+		t.Errorf("loaded = %+v, want a new aggregate with name-1", loaded)
+	}
+}
+
+func TestLoadAggregate_ToTime(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+	before := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	newAsOfTestAggregate(t)
+	time.Sleep(2 * time.Millisecond)
+	created := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	if _, err := ApplyEvent(ctx, &memAggregate{}, newMemUpdatedEvent("tenant-1", "agg-1", "name-2")); err != nil {
+		t.Fatal(err)
+	}
+
+	agg, find, err := LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{}, NewLoadAggregateOptions().SetToTime(created))
+	if err != nil || !find {
+		t.Fatalf("LoadAggregate() = %v, %v", find, err)
+	}
+	if name := agg.(*ReadOnlyAggregate).GetAggregate().(*memAggregate).Name; name != "name-1" {
+		t.Errorf("name = %s, want name-1", name)
+	}
+	agg, _, err = LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{}, NewLoadAggregateOptions().SetToTime(time.Now()).SetToSequenceNumber(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := agg.(*ReadOnlyAggregate).GetAggregate().(*memAggregate).Name; name != "name-2" {
+		t.Errorf("name = %s, want name-2", name)
+	}
+	if _, find, err = LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{}, NewLoadAggregateOptions().SetToTime(before)); err != nil || find {
+		t.Errorf("LoadAggregate(before created) = %v, %v; want false, nil", find, err)
+	}
+}
+
+func TestReadOnlyAggregate_ApplyEvent(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+	newAsOfTestAggregate(t, "name-2")
+
+	agg, _, err := LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{}, NewLoadAggregateOptions().SetToSequenceNumber(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ApplyEvent(ctx, agg, newMemUpdatedEvent("tenant-1", "agg-1", "name-3")); err != ErrReadOnlyAggregate {
+		t.Errorf("ApplyEvent() error = %v, want ErrReadOnlyAggregate", err)
+	}
+	loaded, _, err := LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := loaded.(*memAggregate).Name; name != "name-2" {
+		t.Errorf("name = %s, want name-2", name)
+	}
+}
+
+func TestLoadAggregate_ToSequenceNumberGrpc(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryStorage(t)
+	newAsOfTestAggregate(t, "name-2", "name-3")
+
+	// pb 中没有事件序号字段时 LoadEvent 的事件序号为0，需要改用 GetEvents 查询，GetEvents 同样没有事件序号时返回错误
+	RegisterEventStorage("grpc", newContractGrpcEventStorage(t, backend))
+	agg, find, err := LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{}, NewLoadAggregateOptions().SetToSequenceNumber(2).SetEventStorageKey("grpc"))
+	if daprclient.GrpcSupportsSequenceNumber() {
+		if err != nil || !find || agg.(*ReadOnlyAggregate).GetAggregate().(*memAggregate).Name != "name-2" {
+			t.Errorf("LoadAggregate() = %v, %v, %v; want name-2", agg, find, err)
+		}
+	} else if !errors.Is(err, ErrEventItemFieldMissing) {
+		t.Errorf("LoadAggregate() error = %v, want ErrEventItemFieldMissing", err)
+	}
+
+	// LoadEvent 没有事件序号而 GetEvents 有事件序号时从 GetEvents 重放
+	eventStorage, err := NewGrpcEventStorage(&seqlessGrpcClient{contractGrpcClient: contractGrpcClient{backend: backend}}, PubsubName("pubsub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterEventStorage("seqless", eventStorage)
+	agg, find, err = LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{}, NewLoadAggregateOptions().SetToSequenceNumber(2).SetEventStorageKey("seqless"))
+	if err != nil || !find {
+		t.Fatalf("LoadAggregate() = %v, %v", find, err)
+	}
+	if readOnly := agg.(*ReadOnlyAggregate); readOnly.GetAggregate().(*memAggregate).Name != "name-2" || readOnly.GetSequenceNumber() != 2 {
+		t.Errorf("LoadAggregate() = %s, %d; want name-2, 2", readOnly.GetAggregate().(*memAggregate).Name, readOnly.GetSequenceNumber())
+	}
+}
+
+func newAsOfTestAggregate(t *testing.T, names ...string) {
+	ctx := context.Background()
+	agg := &memAggregate{}
+	if _, err := CreateEvent(ctx, agg, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if _, err := ApplyEvent(ctx, agg, newMemUpdatedEvent("tenant-1", "agg-1", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
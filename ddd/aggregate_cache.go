@@ -0,0 +1,284 @@
+package ddd
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"sync"
+	"time"
+)
+
+type AggregateCacheOptions struct {
+	Size int           // 最多缓存的聚合数量，默认为1000
+	TTL  time.Duration // 缓存有效期，0表示不过期
+}
+
+//
+// AggregateCache
+// @Description: 聚合根 LRU 缓存。缓存聚合根状态与最后的事件序号，ApplyCommand 命中缓存时只加载序号之后的事件。
+// 缓存的聚合根以 JSON 保存，与快照相同，聚合根字段需可 JSON 序列化。
+// 事件存储器不返回事件序号时(如 proto 中没有序号字段的 gRPC 事件存储器)，ApplyCommand 不使用缓存。
+//
+type AggregateCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	items map[string]*list.Element
+	lru   *list.List
+}
+
+type aggregateCacheEntry struct {
+	key            string
+	data           []byte
+	sequenceNumber uint64
+	expireTime     time.Time
+}
+
+var _aggregateCache = &aggregateCacheHolder{}
+
+type aggregateCacheHolder struct {
+	mu    sync.RWMutex
+	cache *AggregateCache
+}
+
+//
+// SetAggregateCache
+// @Description: 设置 ApplyCommand 使用的聚合根缓存，为 nil 时不使用缓存(默认)
+// @param cache 聚合根缓存
+//
+func SetAggregateCache(cache *AggregateCache) {
+	_aggregateCache.mu.Lock()
+	defer _aggregateCache.mu.Unlock()
+	_aggregateCache.cache = cache
+}
+
+//
+// GetAggregateCache
+// @Description: 获取聚合根缓存
+// @return *AggregateCache 未设置时为 nil
+//
+func GetAggregateCache() *AggregateCache {
+	_aggregateCache.mu.RLock()
+	defer _aggregateCache.mu.RUnlock()
+	return _aggregateCache.cache
+}
+
+//
+// NewAggregateCache
+// @Description: 新建聚合根缓存
+// @param opts 选项
+// @return *AggregateCache
+//
+func NewAggregateCache(opts *AggregateCacheOptions) *AggregateCache {
+	size, ttl := 1000, time.Duration(0)
+	if opts != nil {
+		if opts.Size > 0 {
+			size = opts.Size
+		}
+		ttl = opts.TTL
+	}
+	return &AggregateCache{
+		size:  size,
+		ttl:   ttl,
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+//
+// Get
+// @Description: 从缓存中恢复聚合根
+// @param tenantId 租户id
+// @param aggregateType 聚合类型
+// @param aggregateId 聚合根id
+// @param aggregate 聚合根对象，命中时被覆盖为缓存的状态
+// @return uint64 缓存的事件序号
+// @return bool 是否命中
+//
+func (c *AggregateCache) Get(tenantId, aggregateType, aggregateId string, aggregate Aggregate) (uint64, bool) {
+	key := c.getKey(tenantId, aggregateType, aggregateId)
+	c.mu.Lock()
+	elem, ok := c.items[key]
+	if !ok {
+		c.mu.Unlock()
+		return 0, false
+	}
+	entry := elem.Value.(*aggregateCacheEntry)
+	if !entry.expireTime.IsZero() && time.Now().After(entry.expireTime) {
+		c.removeElement(elem)
+		c.mu.Unlock()
+		return 0, false
+	}
+	c.lru.MoveToFront(elem)
+	data, sequenceNumber := entry.data, entry.sequenceNumber
+	c.mu.Unlock()
+
+	resetAggregate(aggregate)
+	if err := json.Unmarshal(data, aggregate); err != nil {
+		c.Remove(tenantId, aggregateType, aggregateId)
+		resetAggregate(aggregate)
+		return 0, false
+	}
+	return sequenceNumber, true
+}
+
+//
+// Put
+// @Description: 缓存聚合根，事件序号为0(事件存储器未返回序号)时不缓存
+// @param tenantId 租户id
+// @param aggregateType 聚合类型
+// @param aggregateId 聚合根id
+// @param aggregate 聚合根对象
+// @param sequenceNumber 聚合根最后的事件序号
+// @return error
+//
+func (c *AggregateCache) Put(tenantId, aggregateType, aggregateId string, aggregate Aggregate, sequenceNumber uint64) error {
+	if sequenceNumber == 0 {
+		c.Remove(tenantId, aggregateType, aggregateId)
+		return nil
+	}
+	data, err := json.Marshal(aggregate)
+	if err != nil {
+		c.Remove(tenantId, aggregateType, aggregateId)
+		return err
+	}
+	entry := &aggregateCacheEntry{
+		key:            c.getKey(tenantId, aggregateType, aggregateId),
+		data:           data,
+		sequenceNumber: sequenceNumber,
+	}
+	if c.ttl > 0 {
+		entry.expireTime = time.Now().Add(c.ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[entry.key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return nil
+	}
+	c.items[entry.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		c.removeElement(c.lru.Back())
+	}
+	return nil
+}
+
+//
+// Remove
+// @Description: 使聚合根缓存失效
+//
+func (c *AggregateCache) Remove(tenantId, aggregateType, aggregateId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[c.getKey(tenantId, aggregateType, aggregateId)]; ok {
+		c.removeElement(elem)
+	}
+}
+
+//
+// Clear
+// @Description: 清空缓存
+//
+func (c *AggregateCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+//
+// Len
+// @Description: 缓存的聚合数量
+//
+func (c *AggregateCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *AggregateCache) removeElement(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*aggregateCacheEntry)
+	delete(c.items, entry.key)
+}
+
+func (c *AggregateCache) getKey(tenantId, aggregateType, aggregateId string) string {
+	return fmt.Sprintf("%s/%s/%s", tenantId, aggregateType, aggregateId)
+}
+
+//
+// loadAggregate
+// @Description: 优先从缓存恢复聚合根，只加载缓存序号之后的事件；未命中或事件序号不连续时完整加载聚合根
+// @param ctx 上下文，需包含聚合序号
+// @param tenantId 租户id
+// @param aggregateId 聚合根id
+// @param agg 聚合根对象
+// @param eventStorageKey 事件存储器名称
+// @return bool 是否找到
+// @return error
+//
+func (c *AggregateCache) loadAggregate(ctx context.Context, tenantId, aggregateId string, agg Aggregate, eventStorageKey string) (bool, error) {
+	aggregateType := agg.GetAggregateType()
+	if sequenceNumber, ok := c.Get(tenantId, aggregateType, aggregateId, agg); ok {
+		req := &daprclient.LoadEventsRequest{
+			TenantId:           tenantId,
+			AggregateId:        aggregateId,
+			AggregateType:      aggregateType,
+			FromSequenceNumber: sequenceNumber,
+		}
+		resp, err := LoadEvents(ctx, req, eventStorageKey)
+		if err != nil {
+			return false, err
+		}
+		if ok, err = c.applyEventRecords(ctx, tenantId, aggregateId, agg, resp, sequenceNumber); err != nil {
+			c.Remove(tenantId, aggregateType, aggregateId)
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+		c.Remove(tenantId, aggregateType, aggregateId)
+		resetAggregate(agg)
+	}
+
+	_, find, err := LoadAggregate(ctx, tenantId, aggregateId, agg, NewLoadAggregateOptions().SetEventStorageKey(eventStorageKey))
+	return find, err
+}
+
+//
+// applyEventRecords
+// @Description: 在缓存的聚合根上执行序号之后的事件。事件存储器可能忽略 FromSequenceNumber，已缓存的事件在此跳过；
+// 事件缺少序号或序号不连续时返回 false，由调用方完整加载
+//
+func (c *AggregateCache) applyEventRecords(ctx context.Context, tenantId, aggregateId string, agg Aggregate, resp *daprclient.LoadEventsResponse, sequenceNumber uint64) (bool, error) {
+	if resp == nil {
+		return false, nil
+	}
+	var records []daprclient.EventRecord
+	if resp.EventRecords != nil {
+		for _, record := range *resp.EventRecords {
+			if record.SequenceNumber == 0 {
+				return false, nil
+			}
+			if record.SequenceNumber <= sequenceNumber {
+				continue
+			}
+			if record.SequenceNumber != sequenceNumber+uint64(len(records))+1 {
+				return false, nil
+			}
+			records = append(records, record)
+		}
+	}
+	for i := range records {
+		if err := CallEventHandler(ctx, agg, &records[i]); err != nil {
+			return false, err
+		}
+	}
+	if s := getAggregateSequence(ctx); s != nil {
+		s.set(tenantId, aggregateId, sequenceNumber+uint64(len(records)))
+	}
+	return true, nil
+}
@@ -0,0 +1,165 @@
+package ddd
+
+import (
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"testing"
+	"time"
+)
+
+func TestAggregateCache_ApplyCommand(t *testing.T) {
+	ctx := context.Background()
+	eventStorage := &countingEventStorage{EventStorage: newMemoryStorage(t)}
+	RegisterEventStorage("", eventStorage)
+	cache := NewAggregateCache(&AggregateCacheOptions{Size: 10})
+	SetAggregateCache(cache)
+	defer SetAggregateCache(nil)
+
+	if _, err := CreateEvent(ctx, &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	cmd := &MemUpdateCommand{TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-2"}
+	if err := ApplyCommand(ctx, &memAggregate{}, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if eventStorage.loadAggregateCount != 1 || cache.Len() != 1 {
+		t.Fatalf("loadAggregateCount = %d, cache len = %d", eventStorage.loadAggregateCount, cache.Len())
+	}
+
+	// 其它实例写入的事件，命中缓存后只加载此事件
+	if _, err := ApplyEvent(ctx, &memAggregate{}, newMemUpdatedEvent("tenant-1", "agg-1", "other")); err != nil {
+		t.Fatal(err)
+	}
+	cmd = &MemUpdateCommand{TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-3"}
+	agg := &memAggregate{}
+	if err := ApplyCommand(ctx, agg, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if eventStorage.loadAggregateCount != 1 {
+		t.Errorf("loadAggregateCount = %d, want 1", eventStorage.loadAggregateCount)
+	}
+	if eventStorage.fromSequenceNumber != 2 || eventStorage.loadEventCount != 1 {
+		t.Errorf("fromSequenceNumber = %d, loaded events = %d", eventStorage.fromSequenceNumber, eventStorage.loadEventCount)
+	}
+	if agg.Name != "name-3" || agg.UserId != "user-1" {
+		t.Errorf("aggregate = %+v", agg)
+	}
+
+	// 并发冲突时缓存失效，重试时完整加载
+	cmd = &MemUpdateCommand{TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-4", concurrent: 1}
+	agg = &memAggregate{}
+	if err := ApplyCommand(ctx, agg, cmd, NewApplyCommandOptions().SetRetryCount(1)); err != nil {
+		t.Fatal(err)
+	}
+	if eventStorage.loadAggregateCount != 2 {
+		t.Errorf("loadAggregateCount = %d, want 2", eventStorage.loadAggregateCount)
+	}
+	cached := &memAggregate{}
+	if seq, ok := cache.Get("tenant-1", memAggregateType, "agg-1", cached); !ok || seq != 6 || cached.Name != "name-4" {
+		t.Errorf("cache sequenceNumber = %d, ok = %v, name = %s", seq, ok, cached.Name)
+	}
+}
+
+func TestAggregateCache_LRU(t *testing.T) {
+	cache := NewAggregateCache(&AggregateCacheOptions{Size: 2, TTL: 50 * time.Millisecond})
+	for _, id := range []string{"agg-1", "agg-2"} {
+		if err := cache.Put("tenant-1", memAggregateType, id, &memAggregate{Id: id}, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := cache.Get("tenant-1", memAggregateType, "agg-1", &memAggregate{}); !ok {
+		t.Fatal("agg-1 not found")
+	}
+	_ = cache.Put("tenant-1", memAggregateType, "agg-3", &memAggregate{Id: "agg-3"}, 1)
+	if _, ok := cache.Get("tenant-1", memAggregateType, "agg-2", &memAggregate{}); ok {
+		t.Error("agg-2 should be evicted")
+	}
+	_ = cache.Put("tenant-1", memAggregateType, "agg-4", &memAggregate{Id: "agg-4"}, 0)
+	if cache.Len() != 2 {
+		t.Errorf("len = %d, want 2", cache.Len())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := cache.Get("tenant-1", memAggregateType, "agg-1", &memAggregate{}); ok {
+		t.Error("agg-1 should be expired")
+	}
+}
+
+func TestAggregateCache_GrpcWithoutSequenceNumber(t *testing.T) {
+	if daprclient.GrpcSupportsSequenceNumber() {
+		t.Skip("dapr grpc proto supports sequence number")
+	}
+	ctx := context.Background()
+	client := &seqlessGrpcClient{contractGrpcClient: contractGrpcClient{backend: newMemoryStorage(t)}}
+	eventStorage, err := NewGrpcEventStorage(client, PubsubName("pubsub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterEventStorage("", eventStorage)
+	cache := NewAggregateCache(&AggregateCacheOptions{Size: 10})
+	SetAggregateCache(cache)
+	defer SetAggregateCache(nil)
+
+	if _, err := CreateEvent(ctx, &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyCommand(ctx, &memAggregate{}, &MemUpdateCommand{TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApplyEvent(ctx, &memAggregate{}, newMemUpdatedEvent("tenant-1", "agg-1", "other")); err != nil {
+		t.Fatal(err)
+	}
+	agg := &memAggregate{}
+	if err := ApplyCommand(ctx, agg, &MemUpdateCommand{TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-3"}); err != nil {
+		t.Fatal(err)
+	}
+	if agg.Name != "name-3" || agg.UserId != "user-1" {
+		t.Errorf("aggregate = %+v", agg)
+	}
+	if cache.Len() != 0 || client.fromSequenceNumberCount != 0 {
+		t.Errorf("cache len = %d, requests with fromSequenceNumber = %d; cache should be disabled", cache.Len(), client.fromSequenceNumberCount)
+	}
+}
+
+//
+// seqlessGrpcClient
+// @Description: 模拟 proto 中没有事件序号字段的 dapr gRPC 客户端，加载的事件序号为0
+//
+type seqlessGrpcClient struct {
+	contractGrpcClient
+	fromSequenceNumberCount int
+}
+
+func (c *seqlessGrpcClient) LoadEvents(ctx context.Context, req *daprclient.LoadEventsRequest) (*daprclient.LoadEventsResponse, error) {
+	if req.FromSequenceNumber > 0 {
+		c.fromSequenceNumberCount++
+	}
+	resp, err := c.contractGrpcClient.LoadEvents(ctx, &daprclient.LoadEventsRequest{TenantId: req.TenantId, AggregateId: req.AggregateId, AggregateType: req.AggregateType})
+	if err == nil && resp.EventRecords != nil {
+		for i := range *resp.EventRecords {
+			(*resp.EventRecords)[i].SequenceNumber = 0
+		}
+	}
+	return resp, err
+}
+
+type countingEventStorage struct {
+	EventStorage
+	loadAggregateCount int
+	loadEventCount     int
+	fromSequenceNumber uint64
+}
+
+func (s *countingEventStorage) LoadAggregate(ctx context.Context, tenantId string, aggregateId string, aggregate Aggregate) (Aggregate, bool, error) {
+	s.loadAggregateCount++
+	return s.EventStorage.LoadAggregate(ctx, tenantId, aggregateId, aggregate)
+}
+
+func (s *countingEventStorage) LoadEvent(ctx context.Context, req *daprclient.LoadEventsRequest) (*daprclient.LoadEventsResponse, error) {
+	resp, err := s.EventStorage.LoadEvent(ctx, req)
+	if err == nil && resp.EventRecords != nil {
+		s.loadEventCount = len(*resp.EventRecords)
+		s.fromSequenceNumber = req.FromSequenceNumber
+	}
+	return resp, err
+}
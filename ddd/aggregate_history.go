@@ -0,0 +1,205 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/rsql"
+	"reflect"
+	"sort"
+	"time"
+)
+
+//
+// AggregateHistory
+// @Description: 聚合根的变更历史，按事件序号排列
+//
+type AggregateHistory struct {
+	TenantId      string                  `json:"tenantId"`
+	AggregateType string                  `json:"aggregateType"`
+	AggregateId   string                  `json:"aggregateId"`
+	Items         []*AggregateHistoryItem `json:"items"`
+}
+
+//
+// AggregateHistoryItem
+// @Description: 一个事件及其引起的聚合根字段变化
+//
+type AggregateHistoryItem struct {
+	SequenceNumber uint64            `json:"sequenceNumber"`
+	EventId        string            `json:"eventId"`
+	CommandId      string            `json:"commandId"`
+	EventType      string            `json:"eventType"`
+	EventVersion   string            `json:"eventVersion"`
+	EventTime      *time.Time        `json:"eventTime"`
+	Metadata       map[string]string `json:"metadata"`
+	Changes        []*FieldChange    `json:"changes"`
+}
+
+//
+// FieldChange
+// @Description: 聚合根 JSON 中一个字段的变化，Path 为以点分隔的 JSON 字段路径，数组作为整体比较。
+// 新增字段的 OldValue 为 nil，删除字段的 NewValue 为 nil。
+//
+type FieldChange struct {
+	Path     string      `json:"path"`
+	OldValue interface{} `json:"oldValue"`
+	NewValue interface{} `json:"newValue"`
+}
+
+type AggregateHistoryOptions struct {
+	eventStorageKey *string
+}
+
+func NewAggregateHistoryOptions() *AggregateHistoryOptions {
+	return &AggregateHistoryOptions{}
+}
+
+func (o *AggregateHistoryOptions) Merge(opts ...*AggregateHistoryOptions) *AggregateHistoryOptions {
+	for _, item := range opts {
+		if item == nil {
+			continue
+		}
+		if item.eventStorageKey != nil {
+			o.eventStorageKey = item.eventStorageKey
+		}
+	}
+	return o
+}
+
+func (o *AggregateHistoryOptions) SetEventStorageKey(v string) *AggregateHistoryOptions {
+	o.eventStorageKey = &v
+	return o
+}
+
+func (o *AggregateHistoryOptions) GetEventStorageKey() string {
+	if o.eventStorageKey == nil {
+		return ""
+	}
+	return *o.eventStorageKey
+}
+
+//
+// GetAggregateHistory
+// @Description: 从第一个事件开始逐个调用 CallEventHandler 重放聚合根，比较每个事件前后聚合根的 JSON，返回变更历史。
+// 聚合类型需要通过 RegisterAggregateType 注册，不使用快照。
+// @param ctx 上下文
+// @param tenantId 租户id
+// @param aggregateType 聚合类型
+// @param aggregateId 聚合根id
+// @param opts 选项
+// @return *AggregateHistory 变更历史
+// @return bool 是否找到
+// @return error 错误
+//
+func GetAggregateHistory(ctx context.Context, tenantId, aggregateType, aggregateId string, opts ...*AggregateHistoryOptions) (*AggregateHistory, bool, error) {
+	if len(tenantId) == 0 {
+		return nil, false, errors.ErrorOf("GetAggregateHistory() error: tenantId is empty")
+	}
+	if len(aggregateId) == 0 {
+		return nil, false, errors.ErrorOf("GetAggregateHistory() error: aggregateId is empty")
+	}
+	aggregate, err := NewAggregate(aggregateType)
+	if err != nil {
+		return nil, false, err
+	}
+	options := NewAggregateHistoryOptions().Merge(opts...)
+	eventStorage, err := GetEventStorage(options.GetEventStorageKey())
+	if err != nil {
+		return nil, false, err
+	}
+
+	filter := rsql.NewFilterBuilder().Eq("aggregateId", aggregateId)
+	items, err := getAggregateEventItems(ctx, eventStorage, tenantId, aggregateType, filter)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(items) == 0 {
+		return nil, false, nil
+	}
+
+	history := &AggregateHistory{
+		TenantId:      tenantId,
+		AggregateType: aggregateType,
+		AggregateId:   aggregateId,
+		Items:         make([]*AggregateHistoryItem, 0, len(items)),
+	}
+	oldValue, err := getAggregateJsonValue(aggregate)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, item := range items {
+		if err := CallEventHandler(ctx, aggregate, newEventRecordByGetEventsItem(tenantId, item)); err != nil {
+			return nil, false, err
+		}
+		newValue, err := getAggregateJsonValue(aggregate)
+		if err != nil {
+			return nil, false, err
+		}
+		history.Items = append(history.Items, &AggregateHistoryItem{
+			SequenceNumber: item.SequenceNumber,
+			EventId:        item.EventId,
+			CommandId:      item.CommandId,
+			EventType:      item.EventType,
+			EventVersion:   item.EventVersion,
+			EventTime:      item.EventTime,
+			Metadata:       item.Metadata,
+			Changes:        DiffJsonValue(oldValue, newValue),
+		})
+		oldValue = newValue
+	}
+	return history, true, nil
+}
+
+//
+// DiffJsonValue
+// @Description: 比较两个 JSON 值（json.Unmarshal 到 interface{} 的结果），对象逐字段递归比较，按路径排序返回变化的字段
+// @param oldValue 原值
+// @param newValue 新值
+// @return []*FieldChange 变化的字段
+//
+func DiffJsonValue(oldValue, newValue interface{}) []*FieldChange {
+	changes := make([]*FieldChange, 0)
+	diffJsonValue("", oldValue, newValue, &changes)
+	return changes
+}
+
+func diffJsonValue(path string, oldValue, newValue interface{}, changes *[]*FieldChange) {
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if !oldIsMap || !newIsMap {
+		if !reflect.DeepEqual(oldValue, newValue) {
+			*changes = append(*changes, &FieldChange{Path: path, OldValue: oldValue, NewValue: newValue})
+		}
+		return
+	}
+	keys := make([]string, 0, len(oldMap)+len(newMap))
+	for k := range oldMap {
+		keys = append(keys, k)
+	}
+	for k := range newMap {
+		if _, ok := oldMap[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fieldPath := k
+		if len(path) > 0 {
+			fieldPath = path + "." + k
+		}
+		diffJsonValue(fieldPath, oldMap[k], newMap[k], changes)
+	}
+}
+
+func getAggregateJsonValue(aggregate Aggregate) (interface{}, error) {
+	bytes, err := json.Marshal(aggregate)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err = json.Unmarshal(bytes, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,79 @@
+package ddd
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestGetAggregateHistory(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+	newAsOfTestAggregate(t, "name-2", "name-2")
+
+	history, find, err := GetAggregateHistory(ctx, "tenant-1", memAggregateType, "agg-1")
+	if err != nil || !find {
+		t.Fatalf("GetAggregateHistory() = %v, %v", find, err)
+	}
+	if len(history.Items) != 3 {
+		t.Fatalf("items = %d, want 3", len(history.Items))
+	}
+
+	created := history.Items[0]
+	if created.SequenceNumber != 1 || created.EventType != "test.MemCreatedEvent" || created.EventTime == nil {
+		t.Errorf("item[0] = %+v", created)
+	}
+	paths := make([]string, 0)
+	for _, c := range created.Changes {
+		paths = append(paths, c.Path)
+	}
+	if got := strings.Join(paths, ","); got != "id,name,tenantId,userId" {
+		t.Errorf("item[0] paths = %s, want id,name,tenantId,userId", got)
+	}
+
+	updated := history.Items[1].Changes
+	if len(updated) != 1 || updated[0].Path != "name" || updated[0].OldValue != "name-1" || updated[0].NewValue != "name-2" {
+		t.Errorf("item[1] changes = %+v", updated)
+	}
+	if changes := history.Items[2].Changes; len(changes) != 0 {
+		t.Errorf("item[2] changes = %+v, want none", changes)
+	}
+
+	if _, find, err = GetAggregateHistory(ctx, "tenant-1", memAggregateType, "agg-none"); err != nil || find {
+		t.Errorf("GetAggregateHistory(agg-none) = %v, %v; want false, nil", find, err)
+	}
+	if _, _, err = GetAggregateHistory(ctx, "tenant-1", "ddd.unknownAggregate", "agg-1"); err == nil {
+		t.Error("unregistered aggregateType should return error")
+	}
+}
+
+func TestDiffJsonValue(t *testing.T) {
+	oldValue := map[string]interface{}{
+		"name":    "a",
+		"removed": 1.0,
+		"address": map[string]interface{}{"city": "x", "zip": "1"},
+		"tags":    []interface{}{"a"},
+	}
+	newValue := map[string]interface{}{
+		"name":    "a",
+		"added":   true,
+		"address": map[string]interface{}{"city": "y", "zip": "1"},
+		"tags":    []interface{}{"a", "b"},
+	}
+	changes := DiffJsonValue(oldValue, newValue)
+	want := []string{"added", "address.city", "removed", "tags"}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %d, want %d", len(changes), len(want))
+	}
+	for i, c := range changes {
+		if c.Path != want[i] {
+			t.Errorf("changes[%d].Path = %s, want %s", i, c.Path, want[i])
+		}
+	}
+	if changes[0].OldValue != nil || changes[0].NewValue != true {
+		t.Errorf("added = %+v", changes[0])
+	}
+	if changes[2].OldValue != 1.0 || changes[2].NewValue != nil {
+		t.Errorf("removed = %+v", changes[2])
+	}
+}
@@ -0,0 +1,114 @@
+package ddd
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"sync"
+)
+
+type ctxAggregateSequenceKey struct {
+}
+
+//
+// aggregateSequence
+// @Description: 记录命令执行过程中聚合根的当前事件序号，用于乐观并发控制
+//
+type aggregateSequence struct {
+	mu    sync.Mutex
+	items map[string]uint64
+}
+
+//
+// newAggregateSequenceContext
+// @Description: 新建可记录聚合序号的上下文
+// @param parent
+// @return context.Context
+//
+func newAggregateSequenceContext(parent context.Context) context.Context {
+	if getAggregateSequence(parent) != nil {
+		return parent
+	}
+	return context.WithValue(parent, ctxAggregateSequenceKey{}, &aggregateSequence{items: make(map[string]uint64)})
+}
+
+func getAggregateSequence(ctx context.Context) *aggregateSequence {
+	if ctx == nil {
+		return nil
+	}
+	if v, ok := ctx.Value(ctxAggregateSequenceKey{}).(*aggregateSequence); ok {
+		return v
+	}
+	return nil
+}
+
+//
+// GetAggregateSequenceNumber
+// @Description: 获取上下文中聚合根最后加载的事件序号
+// @param ctx 上下文
+// @param tenantId 租户id
+// @param aggregateId 聚合根id
+// @return uint64 事件序号
+// @return bool 是否存在
+//
+func GetAggregateSequenceNumber(ctx context.Context, tenantId, aggregateId string) (uint64, bool) {
+	if s := getAggregateSequence(ctx); s != nil {
+		return s.get(tenantId, aggregateId)
+	}
+	return 0, false
+}
+
+//
+// setAggregateSequenceNumber
+// @Description: 根据加载的快照与事件，记录聚合根最后的事件序号
+// @param ctx 上下文
+// @param tenantId 租户id
+// @param aggregateId 聚合根id
+// @param resp 加载事件的返回值
+//
+func setAggregateSequenceNumber(ctx context.Context, tenantId, aggregateId string, resp *daprclient.LoadEventsResponse) {
+	s := getAggregateSequence(ctx)
+	if s == nil || resp == nil {
+		return
+	}
+	sequenceNumber := uint64(0)
+	if resp.Snapshot != nil {
+		sequenceNumber = resp.Snapshot.SequenceNumber
+	}
+	if resp.EventRecords != nil {
+		if count := len(*resp.EventRecords); count > 0 {
+			sequenceNumber = (*resp.EventRecords)[count-1].SequenceNumber
+		}
+	}
+	s.set(tenantId, aggregateId, sequenceNumber)
+}
+
+func (s *aggregateSequence) get(tenantId, aggregateId string) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.items[s.getKey(tenantId, aggregateId)]
+	return v, ok
+}
+
+func (s *aggregateSequence) set(tenantId, aggregateId string, sequenceNumber uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[s.getKey(tenantId, aggregateId)] = sequenceNumber
+}
+
+//
+// add
+// @Description: 事件保存成功后增加聚合序号，序号未知(0)时不处理
+//
+func (s *aggregateSequence) add(tenantId, aggregateId string, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.getKey(tenantId, aggregateId)
+	if v, ok := s.items[key]; ok && v > 0 {
+		s.items[key] = v + uint64(count)
+	}
+}
+
+func (s *aggregateSequence) getKey(tenantId, aggregateId string) string {
+	return fmt.Sprintf("%s/%s", tenantId, aggregateId)
+}
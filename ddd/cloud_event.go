@@ -0,0 +1,234 @@
+package ddd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd/ddd_context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	cloudEventHeaderPrefix = "ce-"
+
+	CloudEventExtEventVersion   = "eventversion"   // 非 SDK 发布的事件版本号
+	CloudEventExtTenantId       = "tenantid"       // 非 SDK 发布的事件租户id
+	CloudEventExtAggregateId    = "aggregateid"    // 非 SDK 发布的事件聚合id
+	CloudEventExtSequenceNumber = "sequencenumber" // 非 SDK 发布的事件序号
+	CloudEventExtCorrelationId  = "correlationid"  // 关联id，写入事件 Metadata
+)
+
+var cloudEventAttributes = map[string]bool{
+	"specversion": true, "id": true, "source": true, "type": true, "subject": true, "time": true,
+	"datacontenttype": true, "dataschema": true, "data": true, "data_base64": true,
+}
+
+//
+// SubscribeHeaderContext
+// @Description: 可以读取消息请求头的订阅上下文，用于识别 binary 模式的 CloudEvents
+//
+type SubscribeHeaderContext interface {
+	GetHeader(name string) string
+}
+
+// subscribeRequestContext 可以读取 http 请求的订阅上下文，用于读取 binary 模式 CloudEvents 的全部扩展属性
+type subscribeRequestContext interface {
+	Request() *http.Request
+}
+
+//
+// newSubscribeEventRecord
+// @Description: 解析订阅消息。支持 SDK 的 EventRecord、structured 模式与 binary 模式的 CloudEvents；
+// CloudEvents 的 data 不是 EventRecord 时(非 SDK 发布)，将 data 作为事件数据，type、id 作为事件类型与id。
+// @param sctx 订阅上下文
+// @return *daprclient.EventRecord
+// @return *ddd_context.CloudEvent 不是 CloudEvents 时为 nil
+// @return error
+//
+func newSubscribeEventRecord(sctx SubscribeContext) (*daprclient.EventRecord, *ddd_context.CloudEvent, error) {
+	body, err := sctx.GetBody()
+	if err != nil {
+		return nil, nil, err
+	}
+	if hc, ok := sctx.(SubscribeHeaderContext); ok && hc.GetHeader(cloudEventHeaderPrefix+"specversion") != "" {
+		ce, err := newBinaryCloudEvent(sctx, hc)
+		if err != nil {
+			return nil, nil, err
+		}
+		record, err := newCloudEventRecord(ce, body)
+		return record, ce, err
+	}
+
+	var envelope map[string]json.RawMessage
+	if err = json.Unmarshal(body, &envelope); err != nil {
+		return nil, nil, err
+	}
+	if _, ok := envelope["specversion"]; !ok {
+		record := &daprclient.EventRecord{}
+		if err = json.Unmarshal(body, record); err != nil {
+			return nil, nil, err
+		}
+		return record, nil, nil
+	}
+	ce, data, err := newStructuredCloudEvent(envelope)
+	if err != nil {
+		return nil, nil, err
+	}
+	record, err := newCloudEventRecord(ce, data)
+	return record, ce, err
+}
+
+func newStructuredCloudEvent(envelope map[string]json.RawMessage) (*ddd_context.CloudEvent, []byte, error) {
+	attrs := make(map[string]string)
+	for name, value := range envelope {
+		if name == "data" || name == "data_base64" {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			// 扩展属性可以是数字或布尔值
+			s = string(value)
+		}
+		attrs[name] = s
+	}
+	ce, err := newCloudEvent(attrs)
+	if err != nil {
+		return nil, nil, err
+	}
+	if value, ok := envelope["data_base64"]; ok {
+		var s string
+		if err = json.Unmarshal(value, &s); err != nil {
+			return nil, nil, err
+		}
+		data, err := base64.StdEncoding.DecodeString(s)
+		return ce, data, err
+	}
+	data := []byte(envelope["data"])
+	// 部分发布者将 JSON 数据序列化为字符串
+	var s string
+	if len(data) > 0 && data[0] == '"' && json.Unmarshal(data, &s) == nil && json.Valid([]byte(s)) {
+		data = []byte(s)
+	}
+	return ce, data, nil
+}
+
+func newBinaryCloudEvent(sctx SubscribeContext, hc SubscribeHeaderContext) (*ddd_context.CloudEvent, error) {
+	attrs := make(map[string]string)
+	if rc, ok := sctx.(subscribeRequestContext); ok && rc.Request() != nil {
+		for name, values := range rc.Request().Header {
+			name = strings.ToLower(name)
+			if strings.HasPrefix(name, cloudEventHeaderPrefix) && len(values) > 0 {
+				attrs[strings.TrimPrefix(name, cloudEventHeaderPrefix)] = values[0]
+			}
+		}
+	} else {
+		for name := range cloudEventAttributes {
+			if value := hc.GetHeader(cloudEventHeaderPrefix + name); value != "" {
+				attrs[name] = value
+			}
+		}
+		for _, name := range []string{CloudEventExtEventVersion, CloudEventExtTenantId, CloudEventExtAggregateId, CloudEventExtSequenceNumber, CloudEventExtCorrelationId} {
+			if value := hc.GetHeader(cloudEventHeaderPrefix + name); value != "" {
+				attrs[name] = value
+			}
+		}
+	}
+	if _, ok := attrs["datacontenttype"]; !ok {
+		attrs["datacontenttype"] = hc.GetHeader("Content-Type")
+	}
+	return newCloudEvent(attrs)
+}
+
+func newCloudEvent(attrs map[string]string) (*ddd_context.CloudEvent, error) {
+	ce := &ddd_context.CloudEvent{
+		SpecVersion:     attrs["specversion"],
+		Id:              attrs["id"],
+		Source:          attrs["source"],
+		Type:            attrs["type"],
+		Subject:         attrs["subject"],
+		DataContentType: attrs["datacontenttype"],
+		DataSchema:      attrs["dataschema"],
+		Extensions:      make(map[string]string),
+	}
+	if ce.Id == "" || ce.Type == "" {
+		return nil, errors.New("cloudevent id and type cannot be empty")
+	}
+	if s := attrs["time"]; s != "" {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, err
+		}
+		ce.Time = &t
+	}
+	for name, value := range attrs {
+		if !cloudEventAttributes[name] {
+			ce.Extensions[name] = value
+		}
+	}
+	return ce, nil
+}
+
+//
+// newCloudEventRecord
+// @Description: data 为 SDK 的 EventRecord 时使用该记录，缺少的字段从 CloudEvents 属性补充
+//
+func newCloudEventRecord(ce *ddd_context.CloudEvent, data []byte) (*daprclient.EventRecord, error) {
+	var fields map[string]interface{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, errors.ErrorOf("cloudevent %s data is not a json object: %s", ce.Id, err.Error())
+		}
+	}
+	record := &daprclient.EventRecord{}
+	_, hasEventId := fields["eventId"]
+	_, hasEventData := fields["eventData"]
+	if hasEventId && hasEventData {
+		if err := json.Unmarshal(data, record); err != nil {
+			return nil, err
+		}
+	} else {
+		record.EventData = fields
+	}
+	if record.EventId == "" {
+		record.EventId = ce.Id
+	}
+	if record.EventType == "" {
+		record.EventType = ce.Type
+	}
+	if record.EventVersion == "" {
+		record.EventVersion = ce.Extensions[CloudEventExtEventVersion]
+	}
+	if record.TenantId == "" {
+		record.TenantId = ce.Extensions[CloudEventExtTenantId]
+	}
+	if record.AggregateId == "" {
+		record.AggregateId = ce.Extensions[CloudEventExtAggregateId]
+	}
+	if record.SequenceNumber == 0 {
+		record.SequenceNumber, _ = strconv.ParseUint(ce.Extensions[CloudEventExtSequenceNumber], 10, 64)
+	}
+
+	if record.Metadata == nil {
+		record.Metadata = make(map[string]string)
+	}
+	setMetadata := func(key, value string) {
+		if _, ok := record.Metadata[key]; !ok && value != "" {
+			record.Metadata[key] = value
+		}
+	}
+	setMetadata(ddd_context.MetadataCorrelationId, ce.Extensions[CloudEventExtCorrelationId])
+	setMetadata(cloudEventHeaderPrefix+"source", ce.Source)
+	setMetadata(cloudEventHeaderPrefix+"type", ce.Type)
+	setMetadata(cloudEventHeaderPrefix+"id", ce.Id)
+	if ce.Time != nil {
+		setMetadata(cloudEventHeaderPrefix+"time", ce.Time.Format(time.RFC3339Nano))
+	}
+	for name, value := range ce.Extensions {
+		setMetadata(cloudEventHeaderPrefix+name, value)
+	}
+	return record, nil
+}
@@ -0,0 +1,137 @@
+package ddd
+
+import (
+	"bytes"
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd/ddd_context"
+	"net/http"
+	"testing"
+)
+
+func TestCloudEvent_Structured(t *testing.T) {
+	handler := &cloudEventHandler{}
+	sh := NewSubscribeHandler(&[]Subscribe{}, handler, nil)
+
+	// dapr 包装的 SDK 事件记录
+	body := `{"specversion":"1.0","id":"ce-1","source":"order-service","type":"com.dapr.event.sent","time":"2022-05-01T10:00:00Z",
+		"datacontenttype":"application/json","traceid":"trace-1",
+		"data":{"eventId":"event-1","eventType":"test.OrderEvent","eventVersion":"v1.0","eventData":{"id":"1"}}}`
+	if err := sh.CallQueryEventHandler(context.Background(), &cloudEventSubscribeContext{body: body}); err != nil {
+		t.Fatal(err)
+	}
+	r := handler.record
+	if r.EventId != "event-1" || r.EventType != "test.OrderEvent" || r.EventData["id"] != "1" {
+		t.Errorf("record = %+v", r)
+	}
+	if r.Metadata["ce-source"] != "order-service" || r.Metadata["ce-traceid"] != "trace-1" || r.Metadata["ce-time"] != "2022-05-01T10:00:00Z" {
+		t.Errorf("metadata = %v", r.Metadata)
+	}
+	ce := handler.cloudEvent
+	if ce == nil || ce.Id != "ce-1" || ce.Source != "order-service" || ce.Time == nil || ce.Extensions["traceid"] != "trace-1" {
+		t.Errorf("cloud event = %+v", ce)
+	}
+
+	// 非 SDK 发布的事件，data 为字符串形式的 JSON
+	body = `{"specversion":"1.0","id":"ce-2","source":"legacy","type":"test.LegacyEvent","eventversion":"v2.0",
+		"tenantid":"tenant-1","aggregateid":"agg-1","sequencenumber":"3","correlationid":"corr-1","data":"{\"name\":\"a\"}"}`
+	if err := sh.CallQueryEventHandler(context.Background(), &cloudEventSubscribeContext{body: body}); err != nil {
+		t.Fatal(err)
+	}
+	r = handler.record
+	if r.EventId != "ce-2" || r.EventType != "test.LegacyEvent" || r.EventVersion != "v2.0" || r.TenantId != "tenant-1" ||
+		r.AggregateId != "agg-1" || r.SequenceNumber != 3 || r.EventData["name"] != "a" {
+		t.Errorf("record = %+v", r)
+	}
+	if handler.correlationId != "corr-1" {
+		t.Errorf("correlationId = %s", handler.correlationId)
+	}
+
+	// data_base64
+	body = `{"specversion":"1.0","id":"ce-3","source":"legacy","type":"test.LegacyEvent","data_base64":"eyJuYW1lIjoiYiJ9"}`
+	if err := sh.CallQueryEventHandler(context.Background(), &cloudEventSubscribeContext{body: body}); err != nil {
+		t.Fatal(err)
+	}
+	if handler.record.EventData["name"] != "b" {
+		t.Errorf("record = %+v", handler.record)
+	}
+
+	// 不是 CloudEvents 时不设置上下文
+	body = `{"eventId":"event-4","eventType":"test.OrderEvent","eventData":{}}`
+	if err := sh.CallQueryEventHandler(context.Background(), &cloudEventSubscribeContext{body: body}); err != nil {
+		t.Fatal(err)
+	}
+	if handler.record.EventId != "event-4" || handler.cloudEvent != nil {
+		t.Errorf("record = %+v, cloud event = %+v", handler.record, handler.cloudEvent)
+	}
+
+	body = `{"specversion":"1.0","source":"legacy","data":{}}`
+	if err := sh.CallQueryEventHandler(context.Background(), &cloudEventSubscribeContext{body: body}); err == nil {
+		t.Error("cloudevent without id and type should return error")
+	}
+}
+
+func TestCloudEvent_Binary(t *testing.T) {
+	handler := &cloudEventHandler{}
+	sh := NewSubscribeHandler(&[]Subscribe{}, handler, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/event", bytes.NewBufferString(`{"name":"c"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Ce-Specversion", "1.0")
+	req.Header.Set("Ce-Id", "ce-5")
+	req.Header.Set("Ce-Source", "legacy")
+	req.Header.Set("Ce-Type", "test.LegacyEvent")
+	req.Header.Set("Ce-Eventversion", "v1.0")
+	req.Header.Set("Ce-Partitionkey", "p1")
+	sctx := &cloudEventSubscribeContext{body: `{"name":"c"}`, request: req}
+	if err = sh.CallQueryEventHandler(context.Background(), sctx); err != nil {
+		t.Fatal(err)
+	}
+	r := handler.record
+	if r.EventId != "ce-5" || r.EventType != "test.LegacyEvent" || r.EventVersion != "v1.0" || r.EventData["name"] != "c" {
+		t.Errorf("record = %+v", r)
+	}
+	ce := handler.cloudEvent
+	if ce == nil || ce.DataContentType != "application/json" || ce.Extensions["partitionkey"] != "p1" {
+		t.Errorf("cloud event = %+v", ce)
+	}
+}
+
+type cloudEventHandler struct {
+	record        *daprclient.EventRecord
+	cloudEvent    *ddd_context.CloudEvent
+	correlationId string
+}
+
+func (h *cloudEventHandler) HandleEventRecord(ctx context.Context, record *daprclient.EventRecord) error {
+	h.record = record
+	h.cloudEvent, _ = ddd_context.GetCloudEvent(ctx)
+	h.correlationId = ddd_context.GetCorrelationId(ctx)
+	return nil
+}
+
+type cloudEventSubscribeContext struct {
+	body    string
+	request *http.Request
+}
+
+func (c *cloudEventSubscribeContext) GetBody() ([]byte, error) {
+	return []byte(c.body), nil
+}
+
+func (c *cloudEventSubscribeContext) SetErr(err error) {
+}
+
+func (c *cloudEventSubscribeContext) GetHeader(name string) string {
+	if c.request == nil {
+		return ""
+	}
+	return c.request.Header.Get(name)
+}
+
+func (c *cloudEventSubscribeContext) Request() *http.Request {
+	return c.request
+}
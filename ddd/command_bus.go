@@ -0,0 +1,214 @@
+package ddd
+
+import (
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"reflect"
+	"sync"
+)
+
+//
+// CommandHandlerFunc
+// @Description: 命令处理方法
+//
+type CommandHandlerFunc func(ctx context.Context, cmd Command) error
+
+//
+// CommandInterceptor
+// @Description: 命令拦截器，调用 next 执行后续拦截器与命令处理方法，可在前后加入校验、授权、日志、指标、重试等处理
+//
+type CommandInterceptor func(ctx context.Context, cmd Command, next CommandHandlerFunc) error
+
+//
+// CommandBus
+// @Description: 命令总线，按命令类型分发命令，并依次经过拦截器链
+//
+type CommandBus interface {
+	RegisterHandler(cmd Command, handler CommandHandlerFunc) error
+	Use(interceptors ...CommandInterceptor)
+	Dispatch(ctx context.Context, cmd Command) error
+	Invoke(ctx context.Context, cmd Command, handler CommandHandlerFunc) error
+}
+
+var _commandBus = &commandBusHolder{bus: NewCommandBus()}
+
+type commandBusHolder struct {
+	mu  sync.RWMutex
+	bus CommandBus
+}
+
+//
+// SetCommandBus
+// @Description: 设置 ApplyCommand 与 Saga 使用的命令总线
+// @param bus 命令总线
+//
+func SetCommandBus(bus CommandBus) {
+	_commandBus.mu.Lock()
+	defer _commandBus.mu.Unlock()
+	_commandBus.bus = bus
+}
+
+//
+// GetCommandBus
+// @Description: 获取命令总线
+// @return CommandBus
+//
+func GetCommandBus() CommandBus {
+	_commandBus.mu.RLock()
+	defer _commandBus.mu.RUnlock()
+	return _commandBus.bus
+}
+
+type commandBus struct {
+	mu           sync.RWMutex
+	handlers     map[string]CommandHandlerFunc
+	interceptors []CommandInterceptor
+}
+
+//
+// NewCommandBus
+// @Description: 新建命令总线
+// @return CommandBus
+//
+func NewCommandBus() CommandBus {
+	return &commandBus{handlers: make(map[string]CommandHandlerFunc)}
+}
+
+//
+// RegisterHandler
+// @Description: 注册命令处理方法，按命令结构名称分发，同一命令类型只能注册一次
+// @param cmd 命令，用于取得命令类型
+// @param handler 命令处理方法
+// @return error
+//
+func (b *commandBus) RegisterHandler(cmd Command, handler CommandHandlerFunc) error {
+	if cmd == nil || handler == nil {
+		return errors.New("RegisterHandler(cmd, handler) error: cmd or handler is nil")
+	}
+	name := getCommandTypeName(cmd)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.handlers[name]; ok {
+		return errors.ErrorOf("command handler %s already exists", name)
+	}
+	b.handlers[name] = handler
+	return nil
+}
+
+//
+// Use
+// @Description: 添加拦截器，先添加的拦截器在外层，先于后添加的拦截器执行
+// @param interceptors 拦截器
+//
+func (b *commandBus) Use(interceptors ...CommandInterceptor) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, item := range interceptors {
+		if item != nil {
+			b.interceptors = append(b.interceptors, item)
+		}
+	}
+}
+
+//
+// Dispatch
+// @Description: 按命令类型查找命令处理方法，经过拦截器链执行
+// @param ctx 上下文
+// @param cmd 命令
+// @return error
+//
+func (b *commandBus) Dispatch(ctx context.Context, cmd Command) error {
+	if cmd == nil {
+		return errors.New("Dispatch(ctx, cmd) error: cmd is nil")
+	}
+	name := getCommandTypeName(cmd)
+	b.mu.RLock()
+	handler, ok := b.handlers[name]
+	b.mu.RUnlock()
+	if !ok {
+		return errors.ErrorOf("command handler %s not registered", name)
+	}
+	return b.Invoke(newCommandCorrelationContext(ctx, cmd), cmd, handler)
+}
+
+//
+// Invoke
+// @Description: 使用指定的命令处理方法，经过拦截器链执行命令
+// @param ctx 上下文
+// @param cmd 命令
+// @param handler 命令处理方法
+// @return error
+//
+func (b *commandBus) Invoke(ctx context.Context, cmd Command, handler CommandHandlerFunc) error {
+	b.mu.RLock()
+	interceptors := b.interceptors
+	b.mu.RUnlock()
+
+	next := handler
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, inner := interceptors[i], next
+		next = func(ctx context.Context, cmd Command) error {
+			return interceptor(ctx, cmd, inner)
+		}
+	}
+	return next(ctx, cmd)
+}
+
+//
+// RegisterAggregateCommandHandler
+// @Description: 注册由聚合处理的命令，分发时新建聚合并通过 ApplyCommand 执行
+// @param bus 命令总线
+// @param cmd 命令，用于取得命令类型
+// @param newAggregate 新建空聚合的方法
+// @param opts ApplyCommand 选项
+// @return error
+//
+func RegisterAggregateCommandHandler(bus CommandBus, cmd Command, newAggregate NewAggregateFunc, opts ...*ApplyCommandOptions) error {
+	if newAggregate == nil {
+		return errors.New("RegisterAggregateCommandHandler() error: newAggregate is nil")
+	}
+	return bus.RegisterHandler(cmd, func(ctx context.Context, cmd Command) error {
+		return applyCommand(ctx, newAggregate(), cmd, NewApplyCommandOptions().Merge(opts...))
+	})
+}
+
+//
+// NewBeforeCommandInterceptor
+// @Description: 新建在命令执行前调用的拦截器，返回错误时不执行命令
+//
+func NewBeforeCommandInterceptor(before func(ctx context.Context, cmd Command) error) CommandInterceptor {
+	return func(ctx context.Context, cmd Command, next CommandHandlerFunc) error {
+		if err := before(ctx, cmd); err != nil {
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+//
+// NewAfterCommandInterceptor
+// @Description: 新建在命令执行后调用的拦截器，after 的返回值作为命令的执行结果
+//
+func NewAfterCommandInterceptor(after func(ctx context.Context, cmd Command, err error) error) CommandInterceptor {
+	return func(ctx context.Context, cmd Command, next CommandHandlerFunc) error {
+		return after(ctx, cmd, next(ctx, cmd))
+	}
+}
+
+//
+// NewValidateCommandInterceptor
+// @Description: 新建调用命令 Validate 方法的拦截器
+//
+func NewValidateCommandInterceptor() CommandInterceptor {
+	return NewBeforeCommandInterceptor(func(ctx context.Context, cmd Command) error {
+		return cmd.Validate()
+	})
+}
+
+func getCommandTypeName(cmd Command) string {
+	t := reflect.TypeOf(cmd)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
@@ -0,0 +1,83 @@
+package ddd
+
+import (
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"testing"
+)
+
+func TestCommandBus(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+	bus := NewCommandBus()
+	SetCommandBus(bus)
+	defer SetCommandBus(NewCommandBus())
+
+	var calls []string
+	bus.Use(
+		func(ctx context.Context, cmd Command, next CommandHandlerFunc) error {
+			calls = append(calls, "around-begin")
+			err := next(ctx, cmd)
+			calls = append(calls, "around-end")
+			return err
+		},
+		NewBeforeCommandInterceptor(func(ctx context.Context, cmd Command) error {
+			calls = append(calls, "before")
+			if c, ok := cmd.(*MemUpdateCommand); ok && c.Name == "" {
+				return errors.New("name is empty")
+			}
+			return nil
+		}),
+		NewAfterCommandInterceptor(func(ctx context.Context, cmd Command, err error) error {
+			calls = append(calls, "after")
+			return err
+		}),
+	)
+	if err := RegisterAggregateCommandHandler(bus, &MemUpdateCommand{}, func() Aggregate { return &memAggregate{} }); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.RegisterHandler(&MemUpdateCommand{}, func(ctx context.Context, cmd Command) error { return nil }); err == nil {
+		t.Error("duplicate handler should return error")
+	}
+
+	if _, err := CreateEvent(ctx, &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Dispatch(ctx, &MemUpdateCommand{TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-2"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"around-begin", "before", "after", "around-end"}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("calls = %v, want %v", calls, want)
+		}
+	}
+
+	calls = nil
+	agg := &memAggregate{}
+	cmd := &MemUpdateCommand{TenantId: "tenant-1", AggregateId: "agg-1"}
+	if err := ApplyCommand(ctx, agg, cmd); err == nil || err.Error() != "name is empty" {
+		t.Errorf("err = %v, want name is empty", err)
+	}
+	if cmd.calls != 0 || len(calls) != 3 {
+		t.Errorf("command calls = %d, interceptor calls = %v", cmd.calls, calls)
+	}
+
+	cmd.Name = "name-3"
+	if err := ApplyCommand(ctx, agg, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if agg.Name != "name-3" {
+		t.Errorf("name = %s, want name-3", agg.Name)
+	}
+	if err := bus.Dispatch(ctx, &memOtherCommand{}); err == nil {
+		t.Error("unregistered command should return error")
+	}
+}
+
+type memOtherCommand struct {
+	MemUpdateCommand
+}
@@ -0,0 +1,250 @@
+package ddd
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/applog"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"sync"
+	"time"
+)
+
+// CommandClaimTimeout 命令占用的有效期，执行命令的实例异常退出后，超过此时间其它实例可以重新执行
+const CommandClaimTimeout = time.Minute
+
+// ErrCommandProcessing 相同 CommandId 的命令正在其它实例中执行
+var ErrCommandProcessing = errors.New("command is processing")
+
+//
+// ProcessedCommand
+// @Description: 命令记录，Processing 为 true 表示命令已被占用、正在执行，为 false 表示已成功执行
+//
+type ProcessedCommand struct {
+	TenantId      string    `json:"tenantId"`
+	CommandId     string    `json:"commandId"`
+	CommandType   string    `json:"commandType"`
+	AggregateId   string    `json:"aggregateId"`
+	ProcessedTime time.Time `json:"processedTime"`
+	Processing    bool      `json:"processing"`
+}
+
+//
+// CommandIdempotencyStore
+// @Description: 命令幂等存储器，记录已成功执行的命令，记录的有效期由存储器决定。
+// 多个实例共用存储器时，Claim 须为原子的"不存在时插入"，保证同一命令只有一个实例执行
+//
+type CommandIdempotencyStore interface {
+	Get(ctx context.Context, tenantId, commandId string) (*ProcessedCommand, bool, error)
+	// Claim 不存在记录(或占用已超过 CommandClaimTimeout)时插入 Processing 记录，返回是否占用成功
+	Claim(ctx context.Context, cmd *ProcessedCommand) (bool, error)
+	// Save 保存已成功执行的命令，覆盖占用记录
+	Save(ctx context.Context, cmd *ProcessedCommand) error
+	// Release 命令执行失败时删除占用记录，客户端可以重试
+	Release(ctx context.Context, tenantId, commandId string) error
+}
+
+var _commandIdempotency = &commandIdempotencyHolder{locks: make(map[string]*commandLock)}
+
+type commandIdempotencyHolder struct {
+	mu    sync.Mutex
+	store CommandIdempotencyStore
+	locks map[string]*commandLock
+}
+
+type commandLock struct {
+	mu    sync.Mutex
+	count int
+}
+
+//
+// SetCommandIdempotencyStore
+// @Description: 设置命令幂等存储器，为 nil 时不检查重复命令(默认)
+// @param store 命令幂等存储器
+//
+func SetCommandIdempotencyStore(store CommandIdempotencyStore) {
+	_commandIdempotency.mu.Lock()
+	defer _commandIdempotency.mu.Unlock()
+	_commandIdempotency.store = store
+}
+
+//
+// GetCommandIdempotencyStore
+// @Description: 获取命令幂等存储器
+// @return CommandIdempotencyStore 未设置时为 nil
+//
+func GetCommandIdempotencyStore() CommandIdempotencyStore {
+	_commandIdempotency.mu.Lock()
+	defer _commandIdempotency.mu.Unlock()
+	return _commandIdempotency.store
+}
+
+//
+// applyIdempotentCommand
+// @Description: 同一租户下 CommandId 已成功执行过时直接返回成功，不再调用命令处理方法。
+// 执行前先通过 Claim 占用 CommandId，其它实例正在执行时返回 ErrCommandProcessing；
+// 执行失败时释放占用，客户端可以重试。同一进程内相同 CommandId 的命令串行执行。
+//
+func applyIdempotentCommand(ctx context.Context, store CommandIdempotencyStore, agg Aggregate, cmd Command, opt *ApplyCommandOptions) error {
+	tenantId, commandId := cmd.GetTenantId(), cmd.GetCommandId()
+	unlock := lockCommand(tenantId, commandId)
+	defer unlock()
+
+	processed := &ProcessedCommand{
+		TenantId:      tenantId,
+		CommandId:     commandId,
+		CommandType:   getCommandTypeName(cmd),
+		AggregateId:   cmd.GetAggregateId().RootId(),
+		ProcessedTime: time.Now(),
+		Processing:    true,
+	}
+	claimed, err := store.Claim(ctx, processed)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		exists, ok, err := store.Get(ctx, tenantId, commandId)
+		if err != nil {
+			return err
+		}
+		if ok && !exists.Processing {
+			_, _ = applog.Info(tenantId, "ddd", "ApplyCommand", fmt.Sprintf("command %s already processed at %s", exists.CommandId, exists.ProcessedTime.Format(time.RFC3339)))
+			return nil
+		}
+		return ErrCommandProcessing
+	}
+
+	if err = executeCommand(ctx, agg, cmd, opt); err != nil {
+		if releaseErr := store.Release(ctx, tenantId, commandId); releaseErr != nil {
+			_, _ = applog.Error(tenantId, "ddd", "ApplyCommand", fmt.Sprintf("release command %s error: %s", commandId, releaseErr.Error()))
+		}
+		return err
+	}
+	processed.ProcessedTime = time.Now()
+	processed.Processing = false
+	if err = store.Save(ctx, processed); err != nil {
+		_, _ = applog.Error(tenantId, "ddd", "ApplyCommand", fmt.Sprintf("save processed command %s error: %s", commandId, err.Error()))
+	}
+	return nil
+}
+
+func lockCommand(tenantId, commandId string) func() {
+	key := fmt.Sprintf("%s/%s", tenantId, commandId)
+	h := _commandIdempotency
+	h.mu.Lock()
+	lock, ok := h.locks[key]
+	if !ok {
+		lock = &commandLock{}
+		h.locks[key] = lock
+	}
+	lock.count++
+	h.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		h.mu.Lock()
+		lock.count--
+		if lock.count == 0 {
+			delete(h.locks, key)
+		}
+		h.mu.Unlock()
+	}
+}
+
+//
+// memoryCommandIdempotencyStore
+// @Description: 内存命令幂等存储器，只在单个进程内有效
+//
+type memoryCommandIdempotencyStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	items     map[string]*memoryProcessedCommand
+	lastSweep time.Time
+}
+
+type memoryProcessedCommand struct {
+	cmd        ProcessedCommand
+	expireTime time.Time
+}
+
+//
+// NewMemoryCommandIdempotencyStore
+// @Description: 新建内存命令幂等存储器
+// @param ttl 记录有效期，0表示不过期
+// @return CommandIdempotencyStore
+//
+func NewMemoryCommandIdempotencyStore(ttl time.Duration) CommandIdempotencyStore {
+	return &memoryCommandIdempotencyStore{
+		ttl:       ttl,
+		items:     make(map[string]*memoryProcessedCommand),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *memoryCommandIdempotencyStore) Get(ctx context.Context, tenantId, commandId string) (*ProcessedCommand, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.get(s.getKey(tenantId, commandId))
+	if !ok {
+		return nil, false, nil
+	}
+	cmd := item.cmd
+	return &cmd, true, nil
+}
+
+func (s *memoryCommandIdempotencyStore) Claim(ctx context.Context, cmd *ProcessedCommand) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.getKey(cmd.TenantId, cmd.CommandId)
+	if _, ok := s.get(key); ok {
+		return false, nil
+	}
+	s.items[key] = &memoryProcessedCommand{cmd: *cmd, expireTime: time.Now().Add(CommandClaimTimeout)}
+	return true, nil
+}
+
+func (s *memoryCommandIdempotencyStore) Release(ctx context.Context, tenantId, commandId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.getKey(tenantId, commandId)
+	if item, ok := s.items[key]; ok && item.cmd.Processing {
+		delete(s.items, key)
+	}
+	return nil
+}
+
+func (s *memoryCommandIdempotencyStore) get(key string) (*memoryProcessedCommand, bool) {
+	item, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	if !item.expireTime.IsZero() && time.Now().After(item.expireTime) {
+		delete(s.items, key)
+		return nil, false
+	}
+	return item, true
+}
+
+func (s *memoryCommandIdempotencyStore) Save(ctx context.Context, cmd *ProcessedCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	item := &memoryProcessedCommand{cmd: *cmd}
+	if s.ttl > 0 {
+		item.expireTime = now.Add(s.ttl)
+		if now.Sub(s.lastSweep) >= s.ttl {
+			for key, v := range s.items {
+				if !v.expireTime.IsZero() && now.After(v.expireTime) {
+					delete(s.items, key)
+				}
+			}
+			s.lastSweep = now
+		}
+	}
+	s.items[s.getKey(cmd.TenantId, cmd.CommandId)] = item
+	return nil
+}
+
+func (s *memoryCommandIdempotencyStore) getKey(tenantId, commandId string) string {
+	return fmt.Sprintf("%s/%s", tenantId, commandId)
+}
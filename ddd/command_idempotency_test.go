@@ -0,0 +1,108 @@
+package ddd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCommandIdempotency(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+	store := NewMemoryCommandIdempotencyStore(50 * time.Millisecond)
+	SetCommandIdempotencyStore(store)
+	defer SetCommandIdempotencyStore(nil)
+
+	if _, err := CreateEvent(ctx, &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &MemUpdateCommand{CommandId: "cmd-1", TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-2"}
+	for i := 0; i < 2; i++ {
+		if err := ApplyCommand(ctx, &memAggregate{}, cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cmd.calls != 1 {
+		t.Errorf("calls = %d, want 1", cmd.calls)
+	}
+	processed, ok, err := store.Get(ctx, "tenant-1", "cmd-1")
+	if err != nil || !ok || processed.CommandType != "MemUpdateCommand" || processed.AggregateId != "agg-1" {
+		t.Errorf("processed = %+v, ok = %v, err = %v", processed, ok, err)
+	}
+
+	// 其它租户的相同 CommandId 不视为重复
+	if _, ok, _ = store.Get(ctx, "tenant-2", "cmd-1"); ok {
+		t.Error("tenant-2 command should not be processed")
+	}
+
+	// 执行失败的命令不记录
+	failed := &MemUpdateCommand{CommandId: "cmd-2", TenantId: "tenant-1", AggregateId: "agg-2", Name: "name-3"}
+	if err = ApplyCommand(ctx, &memAggregate{}, failed); err == nil {
+		t.Fatal("aggregate agg-2 should not be found")
+	}
+	if _, ok, _ = store.Get(ctx, "tenant-1", "cmd-2"); ok {
+		t.Error("failed command should not be recorded")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err = ApplyCommand(ctx, &memAggregate{}, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.calls != 2 {
+		t.Errorf("calls = %d, want 2 after ttl", cmd.calls)
+	}
+}
+
+func TestCommandIdempotency_Claim(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+	store := NewMemoryCommandIdempotencyStore(0)
+	SetCommandIdempotencyStore(store)
+	defer SetCommandIdempotencyStore(nil)
+
+	if _, err := CreateEvent(ctx, &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 其它实例已占用，命令不执行
+	claimed, err := store.Claim(ctx, &ProcessedCommand{TenantId: "tenant-1", CommandId: "cmd-1", Processing: true})
+	if err != nil || !claimed {
+		t.Fatalf("Claim() = %v, %v", claimed, err)
+	}
+	if claimed, _ = store.Claim(ctx, &ProcessedCommand{TenantId: "tenant-1", CommandId: "cmd-1", Processing: true}); claimed {
+		t.Error("second Claim() should fail")
+	}
+	cmd := &MemUpdateCommand{CommandId: "cmd-1", TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-2"}
+	if err = ApplyCommand(ctx, &memAggregate{}, cmd); err != ErrCommandProcessing {
+		t.Fatalf("err = %v, want ErrCommandProcessing", err)
+	}
+	if cmd.calls != 0 {
+		t.Errorf("calls = %d, want 0", cmd.calls)
+	}
+
+	// 占用被释放后可以执行，执行失败时释放占用
+	if err = store.Release(ctx, "tenant-1", "cmd-1"); err != nil {
+		t.Fatal(err)
+	}
+	failed := &MemUpdateCommand{CommandId: "cmd-1", TenantId: "tenant-1", AggregateId: "agg-2", Name: "name-2"}
+	if err = ApplyCommand(ctx, &memAggregate{}, failed); err == nil {
+		t.Fatal("aggregate agg-2 should not be found")
+	}
+	if _, ok, _ := store.Get(ctx, "tenant-1", "cmd-1"); ok {
+		t.Error("claim should be released after failure")
+	}
+	if err = ApplyCommand(ctx, &memAggregate{}, cmd); err != nil || cmd.calls != 1 {
+		t.Fatalf("err = %v, calls = %d", err, cmd.calls)
+	}
+	processed, ok, _ := store.Get(ctx, "tenant-1", "cmd-1")
+	if !ok || processed.Processing {
+		t.Errorf("processed = %+v, want processed record", processed)
+	}
+	if err = store.Release(ctx, "tenant-1", "cmd-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ = store.Get(ctx, "tenant-1", "cmd-1"); !ok {
+		t.Error("Release() should not remove processed record")
+	}
+}
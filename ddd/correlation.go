@@ -0,0 +1,40 @@
+package ddd
+
+import (
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd/ddd_context"
+)
+
+//
+// newCommandCorrelationContext
+// @Description: 执行命令的上下文，因果id为命令id；上下文中没有关联id时，以命令id作为关联id
+//
+func newCommandCorrelationContext(ctx context.Context, cmd Command) context.Context {
+	commandId := cmd.GetCommandId()
+	if commandId == "" {
+		return ctx
+	}
+	correlationId := ddd_context.GetCorrelationId(ctx)
+	if correlationId == "" {
+		correlationId = commandId
+	}
+	return ddd_context.NewCorrelationContext(ctx, correlationId, commandId)
+}
+
+//
+// newEventCorrelationContext
+// @Description: 处理事件的上下文，因果id为事件id；关联id取事件 Metadata 中的值，不存在时沿用上下文中的值或使用事件id
+//
+func newEventCorrelationContext(ctx context.Context, eventId string, metadata map[string]string) context.Context {
+	if eventId == "" {
+		return ctx
+	}
+	correlationId := metadata[ddd_context.MetadataCorrelationId]
+	if correlationId == "" {
+		correlationId = ddd_context.GetCorrelationId(ctx)
+	}
+	if correlationId == "" {
+		correlationId = eventId
+	}
+	return ddd_context.NewCorrelationContext(ctx, correlationId, eventId)
+}
@@ -0,0 +1,109 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd/ddd_context"
+	"testing"
+)
+
+func TestCorrelation_ApplyCommand(t *testing.T) {
+	newMemoryStorage(t)
+	if _, err := CreateEvent(context.Background(), &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := ddd_context.NewCorrelationContext(context.Background(), "corr-1", "")
+	cmd := &MemUpdateCommand{CommandId: "cmd-1", TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-2"}
+	if err := ApplyCommand(ctx, &memAggregate{}, cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	record := loadLastEventRecord(t, "tenant-1", "agg-1")
+	if record.Metadata[ddd_context.MetadataCorrelationId] != "corr-1" || record.Metadata[ddd_context.MetadataCausationId] != "cmd-1" {
+		t.Errorf("metadata = %v", record.Metadata)
+	}
+
+	// 没有关联id时，以命令id作为关联id
+	cmd = &MemUpdateCommand{CommandId: "cmd-2", TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-3"}
+	if err := ApplyCommand(context.Background(), &memAggregate{}, cmd); err != nil {
+		t.Fatal(err)
+	}
+	record = loadLastEventRecord(t, "tenant-1", "agg-1")
+	if record.Metadata[ddd_context.MetadataCorrelationId] != "cmd-2" || record.Metadata[ddd_context.MetadataCausationId] != "cmd-2" {
+		t.Errorf("metadata = %v", record.Metadata)
+	}
+}
+
+func TestCorrelation_CallQueryEventHandler(t *testing.T) {
+	handler := &correlationEventHandler{}
+	sh := NewSubscribeHandler(nil, handler, nil)
+
+	record := &daprclient.EventRecord{
+		EventId:   "event-1",
+		EventType: "test.MemUpdatedEvent",
+		Metadata:  map[string]string{ddd_context.MetadataCorrelationId: "corr-1"},
+	}
+	if err := sh.CallQueryEventHandler(context.Background(), newCorrelationSubscribeContext(t, record)); err != nil {
+		t.Fatal(err)
+	}
+	if handler.correlationId != "corr-1" || handler.causationId != "event-1" {
+		t.Errorf("correlationId = %s, causationId = %s", handler.correlationId, handler.causationId)
+	}
+
+	// 事件没有关联id时，以事件id作为关联id
+	record = &daprclient.EventRecord{EventId: "event-2", EventType: "test.MemUpdatedEvent"}
+	if err := sh.CallQueryEventHandler(context.Background(), newCorrelationSubscribeContext(t, record)); err != nil {
+		t.Fatal(err)
+	}
+	if handler.correlationId != "event-2" || handler.causationId != "event-2" {
+		t.Errorf("correlationId = %s, causationId = %s", handler.correlationId, handler.causationId)
+	}
+}
+
+func loadLastEventRecord(t *testing.T, tenantId, aggregateId string) daprclient.EventRecord {
+	storage, err := GetEventStorage("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := storage.LoadEvent(context.Background(), &daprclient.LoadEventsRequest{TenantId: tenantId, AggregateId: aggregateId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.EventRecords == nil || len(*resp.EventRecords) == 0 {
+		t.Fatal("event records is empty")
+	}
+	records := *resp.EventRecords
+	return records[len(records)-1]
+}
+
+type correlationEventHandler struct {
+	correlationId string
+	causationId   string
+}
+
+func (h *correlationEventHandler) HandleEventRecord(ctx context.Context, record *daprclient.EventRecord) error {
+	h.correlationId = ddd_context.GetCorrelationId(ctx)
+	h.causationId = ddd_context.GetCausationId(ctx)
+	return nil
+}
+
+type correlationSubscribeContext struct {
+	body []byte
+}
+
+func newCorrelationSubscribeContext(t *testing.T, record *daprclient.EventRecord) SubscribeContext {
+	body, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &correlationSubscribeContext{body: body}
+}
+
+func (c *correlationSubscribeContext) GetBody() ([]byte, error) {
+	return c.body, nil
+}
+
+func (c *correlationSubscribeContext) SetErr(err error) {
+}
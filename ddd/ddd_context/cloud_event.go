@@ -0,0 +1,51 @@
+package ddd_context
+
+import (
+	"context"
+	"time"
+)
+
+//
+// CloudEvent
+// @Description: 订阅消息的 CloudEvents 属性，消息不是 CloudEvents 格式时不存在
+//
+type CloudEvent struct {
+	SpecVersion     string            `json:"specversion"`
+	Id              string            `json:"id"`
+	Source          string            `json:"source"`
+	Type            string            `json:"type"`
+	Subject         string            `json:"subject,omitempty"`
+	Time            *time.Time        `json:"time,omitempty"`
+	DataContentType string            `json:"datacontenttype,omitempty"`
+	DataSchema      string            `json:"dataschema,omitempty"`
+	Extensions      map[string]string `json:"extensions,omitempty"` // 扩展属性，名称为小写
+}
+
+type ctxCloudEventKey struct {
+}
+
+//
+// NewCloudEventContext
+// @Description: 新建携带 CloudEvents 属性的上下文
+// @param parent 上下文
+// @param event CloudEvents 属性
+// @return context.Context
+//
+func NewCloudEventContext(parent context.Context, event *CloudEvent) context.Context {
+	return context.WithValue(parent, ctxCloudEventKey{}, event)
+}
+
+//
+// GetCloudEvent
+// @Description: 获取上下文中的 CloudEvents 属性
+// @param ctx 上下文
+// @return *CloudEvent
+// @return bool 消息不是 CloudEvents 格式时为 false
+//
+func GetCloudEvent(ctx context.Context) (*CloudEvent, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	event, ok := ctx.Value(ctxCloudEventKey{}).(*CloudEvent)
+	return event, ok && event != nil
+}
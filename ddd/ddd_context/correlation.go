@@ -0,0 +1,73 @@
+package ddd_context
+
+import (
+	"context"
+)
+
+const (
+	MetadataCorrelationId = "correlationId" // 事件 Metadata 中的关联id，同一业务流程中的命令与事件使用相同的关联id
+	MetadataCausationId   = "causationId"   // 事件 Metadata 中的因果id，为直接引起事件的命令id或事件id
+	HeaderCorrelationId   = "X-Correlation-Id"
+)
+
+type ctxCorrelationKey struct {
+}
+
+type correlation struct {
+	correlationId string
+	causationId   string
+}
+
+//
+// NewCorrelationContext
+// @Description: 新建携带关联id与因果id的上下文
+// @param parent 上下文
+// @param correlationId 关联id，为空时沿用 parent 中的关联id
+// @param causationId 因果id
+// @return context.Context
+//
+func NewCorrelationContext(parent context.Context, correlationId, causationId string) context.Context {
+	if correlationId == "" {
+		correlationId = GetCorrelationId(parent)
+	}
+	return context.WithValue(parent, ctxCorrelationKey{}, &correlation{
+		correlationId: correlationId,
+		causationId:   causationId,
+	})
+}
+
+//
+// GetCorrelationId
+// @Description: 获取上下文中的关联id
+// @param ctx 上下文
+// @return string 不存在时为空
+//
+func GetCorrelationId(ctx context.Context) string {
+	if c := getCorrelation(ctx); c != nil {
+		return c.correlationId
+	}
+	return ""
+}
+
+//
+// GetCausationId
+// @Description: 获取上下文中的因果id
+// @param ctx 上下文
+// @return string 不存在时为空
+//
+func GetCausationId(ctx context.Context) string {
+	if c := getCorrelation(ctx); c != nil {
+		return c.causationId
+	}
+	return ""
+}
+
+func getCorrelation(ctx context.Context) *correlation {
+	if ctx == nil {
+		return nil
+	}
+	if v, ok := ctx.Value(ctxCorrelationKey{}).(*correlation); ok {
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package ddd_mongodb
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type processedCommandDocument struct {
+	Id            string    `bson:"_id"`
+	TenantId      string    `bson:"tenant_id"`
+	CommandId     string    `bson:"command_id"`
+	CommandType   string    `bson:"command_type"`
+	AggregateId   string    `bson:"aggregate_id"`
+	ProcessedTime time.Time `bson:"processed_time"`
+	Processing    bool      `bson:"processing"`
+	ExpireTime    time.Time `bson:"expire_time,omitempty"`
+}
+
+//
+// CommandIdempotencyStore
+// @Description: MongoDB 命令幂等存储器，通过 expire_time 字段的 TTL 索引删除过期记录。
+// Claim 依赖 _id 唯一插入，多个实例共用集合时同一命令只有一个实例执行
+//
+type CommandIdempotencyStore struct {
+	collection *mongo.Collection
+	ttl        time.Duration
+}
+
+//
+// NewCommandIdempotencyStore
+// @Description: 新建 MongoDB 命令幂等存储器，并创建 TTL 索引
+// @param ctx 上下文
+// @param mongodb
+// @param collectionName 集合名称
+// @param ttl 记录有效期，0表示不过期
+// @return *CommandIdempotencyStore
+// @return error
+//
+func NewCommandIdempotencyStore(ctx context.Context, mongodb *MongoDB, collectionName string, ttl time.Duration) (*CommandIdempotencyStore, error) {
+	collection := mongodb.GetCollection(collectionName)
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expire_time", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	if _, err := collection.Indexes().CreateOne(ctx, index); err != nil {
+		return nil, err
+	}
+	return &CommandIdempotencyStore{collection: collection, ttl: ttl}, nil
+}
+
+func (s *CommandIdempotencyStore) Get(ctx context.Context, tenantId, commandId string) (*ddd.ProcessedCommand, bool, error) {
+	doc := &processedCommandDocument{}
+	if err := s.collection.FindOne(ctx, bson.D{{Key: ConstIdField, Value: s.getId(tenantId, commandId)}}).Decode(doc); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	// TTL 索引由后台定时删除，到期但尚未删除的记录视为不存在
+	if !doc.ExpireTime.IsZero() && time.Now().After(doc.ExpireTime) {
+		return nil, false, nil
+	}
+	return &ddd.ProcessedCommand{
+		TenantId:      doc.TenantId,
+		CommandId:     doc.CommandId,
+		CommandType:   doc.CommandType,
+		AggregateId:   doc.AggregateId,
+		ProcessedTime: doc.ProcessedTime,
+		Processing:    doc.Processing,
+	}, true, nil
+}
+
+//
+// Claim
+// @Description: 插入占用记录，_id 已存在时只接管已过期的记录
+//
+func (s *CommandIdempotencyStore) Claim(ctx context.Context, cmd *ddd.ProcessedCommand) (bool, error) {
+	now := time.Now()
+	doc := s.newDocument(cmd)
+	doc.ExpireTime = now.Add(ddd.CommandClaimTimeout)
+	_, err := s.collection.InsertOne(ctx, doc)
+	if err == nil {
+		return true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, err
+	}
+	filter := bson.D{{Key: ConstIdField, Value: doc.Id}, {Key: "expire_time", Value: bson.M{"$lt": now}}}
+	res, err := s.collection.ReplaceOne(ctx, filter, doc)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (s *CommandIdempotencyStore) Save(ctx context.Context, cmd *ddd.ProcessedCommand) error {
+	doc := s.newDocument(cmd)
+	if s.ttl > 0 {
+		doc.ExpireTime = cmd.ProcessedTime.Add(s.ttl)
+	}
+	_, err := s.collection.ReplaceOne(ctx, bson.D{{Key: ConstIdField, Value: doc.Id}}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+//
+// Release
+// @Description: 删除占用记录，已成功执行的记录不删除
+//
+func (s *CommandIdempotencyStore) Release(ctx context.Context, tenantId, commandId string) error {
+	filter := bson.D{{Key: ConstIdField, Value: s.getId(tenantId, commandId)}, {Key: "processing", Value: true}}
+	_, err := s.collection.DeleteOne(ctx, filter)
+	return err
+}
+
+func (s *CommandIdempotencyStore) newDocument(cmd *ddd.ProcessedCommand) *processedCommandDocument {
+	return &processedCommandDocument{
+		Id:            s.getId(cmd.TenantId, cmd.CommandId),
+		TenantId:      cmd.TenantId,
+		CommandId:     cmd.CommandId,
+		CommandType:   cmd.CommandType,
+		AggregateId:   cmd.AggregateId,
+		ProcessedTime: cmd.ProcessedTime,
+		Processing:    cmd.Processing,
+	}
+}
+
+func (s *CommandIdempotencyStore) getId(tenantId, commandId string) string {
+	return fmt.Sprintf("%s/%s", tenantId, commandId)
+}
@@ -0,0 +1,146 @@
+package ddd_mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type deadLetterDocument struct {
+	Id          string    `bson:"_id"`
+	TenantId    string    `bson:"tenant_id"`
+	PubsubName  string    `bson:"pubsub_name"`
+	Topic       string    `bson:"topic"`
+	Route       string    `bson:"route"`
+	EventId     string    `bson:"event_id"`
+	EventType   string    `bson:"event_type"`
+	Record      string    `bson:"record"`
+	Error       string    `bson:"error"`
+	Attempts    int       `bson:"attempts"`
+	CreatedTime time.Time `bson:"created_time"`
+	UpdatedTime time.Time `bson:"updated_time"`
+}
+
+//
+// DeadLetterStore
+// @Description: MongoDB 死信存储器，原始事件记录以 JSON 字符串保存在 record 字段
+//
+type DeadLetterStore struct {
+	collection *mongo.Collection
+}
+
+//
+// NewDeadLetterStore
+// @Description: 新建 MongoDB 死信存储器
+// @param mongodb
+// @param collectionName 集合名称
+// @return *DeadLetterStore
+//
+func NewDeadLetterStore(mongodb *MongoDB, collectionName string) *DeadLetterStore {
+	return &DeadLetterStore{collection: mongodb.GetCollection(collectionName)}
+}
+
+func (s *DeadLetterStore) Save(ctx context.Context, letter *ddd.DeadLetter) error {
+	record, err := json.Marshal(letter.Record)
+	if err != nil {
+		return err
+	}
+	doc := &deadLetterDocument{
+		Id:          letter.Id,
+		TenantId:    letter.TenantId,
+		PubsubName:  letter.PubsubName,
+		Topic:       letter.Topic,
+		Route:       letter.Route,
+		EventId:     letter.EventId,
+		EventType:   letter.EventType,
+		Record:      string(record),
+		Error:       letter.Error,
+		Attempts:    letter.Attempts,
+		CreatedTime: letter.CreatedTime,
+		UpdatedTime: letter.UpdatedTime,
+	}
+	_, err = s.collection.ReplaceOne(ctx, bson.D{{Key: ConstIdField, Value: doc.Id}}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *DeadLetterStore) FindById(ctx context.Context, id string) (*ddd.DeadLetter, bool, error) {
+	doc := &deadLetterDocument{}
+	if err := s.collection.FindOne(ctx, bson.D{{Key: ConstIdField, Value: id}}).Decode(doc); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	letter, err := s.newDeadLetter(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	return letter, true, nil
+}
+
+func (s *DeadLetterStore) FindList(ctx context.Context, query *ddd.DeadLetterQuery) ([]*ddd.DeadLetter, error) {
+	filter := bson.D{}
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_time", Value: 1}})
+	if query != nil {
+		if query.TenantId != "" {
+			filter = append(filter, bson.E{Key: ConstTenantIdField, Value: query.TenantId})
+		}
+		if query.Route != "" {
+			filter = append(filter, bson.E{Key: "route", Value: query.Route})
+		}
+		if query.EventType != "" {
+			filter = append(filter, bson.E{Key: "event_type", Value: query.EventType})
+		}
+		if query.Limit > 0 {
+			findOptions.SetLimit(int64(query.Limit))
+		}
+	}
+	cursor, err := s.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var docs []*deadLetterDocument
+	if err = cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	list := make([]*ddd.DeadLetter, 0, len(docs))
+	for _, doc := range docs {
+		letter, err := s.newDeadLetter(doc)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, letter)
+	}
+	return list, nil
+}
+
+func (s *DeadLetterStore) Delete(ctx context.Context, id string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.D{{Key: ConstIdField, Value: id}})
+	return err
+}
+
+func (s *DeadLetterStore) newDeadLetter(doc *deadLetterDocument) (*ddd.DeadLetter, error) {
+	record := &daprclient.EventRecord{}
+	if err := json.Unmarshal([]byte(doc.Record), record); err != nil {
+		return nil, err
+	}
+	return &ddd.DeadLetter{
+		Id:          doc.Id,
+		TenantId:    doc.TenantId,
+		PubsubName:  doc.PubsubName,
+		Topic:       doc.Topic,
+		Route:       doc.Route,
+		EventId:     doc.EventId,
+		EventType:   doc.EventType,
+		Record:      record,
+		Error:       doc.Error,
+		Attempts:    doc.Attempts,
+		CreatedTime: doc.CreatedTime,
+		UpdatedTime: doc.UpdatedTime,
+	}, nil
+}
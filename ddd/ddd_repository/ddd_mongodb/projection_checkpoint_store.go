@@ -0,0 +1,68 @@
+package ddd_mongodb
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+type projectionCheckpointDocument struct {
+	Id             string    `bson:"_id"`
+	Handler        string    `bson:"handler"`
+	TenantId       string    `bson:"tenant_id"`
+	AggregateId    string    `bson:"aggregate_id"`
+	SequenceNumber uint64    `bson:"sequence_number"`
+	UpdatedTime    time.Time `bson:"updated_time"`
+}
+
+//
+// ProjectionCheckpointStore
+// @Description: MongoDB 读模型检查点存储器，sequence_number 只增不减
+//
+type ProjectionCheckpointStore struct {
+	collection *mongo.Collection
+}
+
+//
+// NewProjectionCheckpointStore
+// @Description: 新建 MongoDB 读模型检查点存储器
+// @param mongodb
+// @param collectionName 集合名称
+// @return *ProjectionCheckpointStore
+//
+func NewProjectionCheckpointStore(mongodb *MongoDB, collectionName string) *ProjectionCheckpointStore {
+	return &ProjectionCheckpointStore{collection: mongodb.GetCollection(collectionName)}
+}
+
+func (s *ProjectionCheckpointStore) Get(ctx context.Context, handler, tenantId, aggregateId string) (uint64, error) {
+	doc := &projectionCheckpointDocument{}
+	if err := s.collection.FindOne(ctx, bson.D{{Key: ConstIdField, Value: s.getId(handler, tenantId, aggregateId)}}).Decode(doc); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return doc.SequenceNumber, nil
+}
+
+func (s *ProjectionCheckpointStore) Save(ctx context.Context, handler, tenantId, aggregateId string, sequenceNumber uint64) error {
+	update := bson.D{
+		{Key: "$max", Value: bson.D{{Key: "sequence_number", Value: sequenceNumber}}},
+		{Key: "$set", Value: bson.D{
+			{Key: "handler", Value: handler},
+			{Key: ConstTenantIdField, Value: tenantId},
+			{Key: "aggregate_id", Value: aggregateId},
+			{Key: "updated_time", Value: time.Now()},
+		}},
+	}
+	filter := bson.D{{Key: ConstIdField, Value: s.getId(handler, tenantId, aggregateId)}}
+	_, err := s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *ProjectionCheckpointStore) getId(handler, tenantId, aggregateId string) string {
+	return fmt.Sprintf("%s/%s/%s", handler, tenantId, aggregateId)
+}
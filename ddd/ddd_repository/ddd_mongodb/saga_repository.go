@@ -0,0 +1,91 @@
+package ddd_mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type sagaDocument struct {
+	Id           string            `bson:"_id"`
+	TenantId     string            `bson:"tenant_id"`
+	SagaType     string            `bson:"saga_type"`
+	SagaId       string            `bson:"saga_id"`
+	Associations map[string]string `bson:"associations"`
+	Data         string            `bson:"data"`
+}
+
+//
+// SagaRepository
+// @Description: MongoDB Saga 仓储，Saga 以 JSON 字符串保存在 data 字段，关联属性保存在 associations 字段用于查找
+//
+type SagaRepository struct {
+	collection *mongo.Collection
+}
+
+//
+// NewSagaRepository
+// @Description: 新建 MongoDB Saga 仓储
+// @param mongodb
+// @param collectionName 集合名称
+// @return *SagaRepository
+//
+func NewSagaRepository(mongodb *MongoDB, collectionName string) *SagaRepository {
+	return &SagaRepository{collection: mongodb.GetCollection(collectionName)}
+}
+
+func (r *SagaRepository) FindByAssociation(ctx context.Context, tenantId, sagaType, key, value string, saga ddd.Saga) (bool, error) {
+	filter := bson.D{
+		{Key: ConstTenantIdField, Value: tenantId},
+		{Key: "saga_type", Value: sagaType},
+		{Key: "associations." + key, Value: value},
+	}
+	return r.findOne(ctx, filter, saga)
+}
+
+func (r *SagaRepository) FindById(ctx context.Context, tenantId, sagaType, sagaId string, saga ddd.Saga) (bool, error) {
+	filter := bson.D{{Key: ConstIdField, Value: r.getId(tenantId, sagaType, sagaId)}}
+	return r.findOne(ctx, filter, saga)
+}
+
+func (r *SagaRepository) Save(ctx context.Context, saga ddd.Saga) error {
+	base := saga.GetSagaBase()
+	data, err := json.Marshal(saga)
+	if err != nil {
+		return err
+	}
+	doc := &sagaDocument{
+		Id:           r.getId(base.TenantId, saga.GetSagaType(), base.SagaId),
+		TenantId:     base.TenantId,
+		SagaType:     saga.GetSagaType(),
+		SagaId:       base.SagaId,
+		Associations: base.Associations,
+		Data:         string(data),
+	}
+	_, err = r.collection.ReplaceOne(ctx, bson.D{{Key: ConstIdField, Value: doc.Id}}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *SagaRepository) Delete(ctx context.Context, tenantId, sagaType, sagaId string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.D{{Key: ConstIdField, Value: r.getId(tenantId, sagaType, sagaId)}})
+	return err
+}
+
+func (r *SagaRepository) findOne(ctx context.Context, filter bson.D, saga ddd.Saga) (bool, error) {
+	doc := &sagaDocument{}
+	if err := r.collection.FindOne(ctx, filter).Decode(doc); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(doc.Data), saga)
+}
+
+func (r *SagaRepository) getId(tenantId, sagaType, sagaId string) string {
+	return fmt.Sprintf("%s/%s/%s", tenantId, sagaType, sagaId)
+}
@@ -0,0 +1,250 @@
+package ddd
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// DeadLetter
+// @Description: 重试后仍处理失败的事件
+//
+type DeadLetter struct {
+	Id          string                  `json:"id"`
+	TenantId    string                  `json:"tenantId"`
+	PubsubName  string                  `json:"pubsubName"`
+	Topic       string                  `json:"topic"`
+	Route       string                  `json:"route"`
+	EventId     string                  `json:"eventId"`
+	EventType   string                  `json:"eventType"`
+	Record      *daprclient.EventRecord `json:"record"`
+	Error       string                  `json:"error"`
+	Attempts    int                     `json:"attempts"`
+	CreatedTime time.Time               `json:"createdTime"`
+	UpdatedTime time.Time               `json:"updatedTime"`
+}
+
+//
+// DeadLetterQuery
+// @Description: 死信查询条件，为空的条件不参与查询
+//
+type DeadLetterQuery struct {
+	TenantId  string
+	Route     string
+	EventType string
+	Limit     int // 0表示不限制
+}
+
+//
+// DeadLetterStore
+// @Description: 死信存储器
+//
+type DeadLetterStore interface {
+	Save(ctx context.Context, letter *DeadLetter) error
+	FindById(ctx context.Context, id string) (*DeadLetter, bool, error)
+	FindList(ctx context.Context, query *DeadLetterQuery) ([]*DeadLetter, error)
+	Delete(ctx context.Context, id string) error
+}
+
+var _deadLetter = &deadLetterHolder{routes: make(map[string]*subscribeHandler)}
+
+type deadLetterHolder struct {
+	mu     sync.RWMutex
+	store  DeadLetterStore
+	routes map[string]*subscribeHandler
+}
+
+//
+// SetDeadLetterStore
+// @Description: 设置死信存储器。为 nil 时(默认)重试失败的错误返回给 Dapr，由 Dapr 重新投递或转发到订阅项的 DeadLetterTopic；
+// 设置后失败的事件保存为死信，并向 Dapr 返回成功
+// @param store 死信存储器
+//
+func SetDeadLetterStore(store DeadLetterStore) {
+	_deadLetter.mu.Lock()
+	defer _deadLetter.mu.Unlock()
+	_deadLetter.store = store
+}
+
+//
+// GetDeadLetterStore
+// @Description: 获取死信存储器
+// @return DeadLetterStore 未设置时为 nil
+//
+func GetDeadLetterStore() DeadLetterStore {
+	_deadLetter.mu.RLock()
+	defer _deadLetter.mu.RUnlock()
+	return _deadLetter.store
+}
+
+//
+// ReplayDeadLetter
+// @Description: 将死信重新交给原订阅项的处理器执行一次，成功后删除死信，失败时更新错误与执行次数
+// @param ctx 上下文
+// @param id 死信id
+// @return error
+//
+func ReplayDeadLetter(ctx context.Context, id string) error {
+	store, letter, err := findDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+	_deadLetter.mu.RLock()
+	handler, ok := _deadLetter.routes[letter.Route]
+	_deadLetter.mu.RUnlock()
+	if !ok {
+		return errors.ErrorOf("subscribe route %s not registered", letter.Route)
+	}
+	if err = handler.callEventRecord(ctx, letter.Record); err != nil {
+		letter.Error = err.Error()
+		letter.Attempts++
+		letter.UpdatedTime = time.Now()
+		if saveErr := store.Save(ctx, letter); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+	return store.Delete(ctx, id)
+}
+
+//
+// DiscardDeadLetter
+// @Description: 丢弃死信
+// @param ctx 上下文
+// @param id 死信id
+// @return error
+//
+func DiscardDeadLetter(ctx context.Context, id string) error {
+	store, _, err := findDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+	return store.Delete(ctx, id)
+}
+
+func findDeadLetter(ctx context.Context, id string) (DeadLetterStore, *DeadLetter, error) {
+	store := GetDeadLetterStore()
+	if store == nil {
+		return nil, nil, errors.New("dead letter store is nil")
+	}
+	letter, ok, err := store.FindById(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, errors.ErrorOf("dead letter %s not found", id)
+	}
+	return store, letter, nil
+}
+
+func registerDeadLetterRoute(route string, handler *subscribeHandler) {
+	_deadLetter.mu.Lock()
+	defer _deadLetter.mu.Unlock()
+	_deadLetter.routes[route] = handler
+}
+
+//
+// saveDeadLetter
+// @Description: 保存死信，同一订阅项的同一事件再次失败时累加执行次数
+//
+func saveDeadLetter(ctx context.Context, store DeadLetterStore, subscribe *Subscribe, record *daprclient.EventRecord, attempts int, cause error) error {
+	id := getDeadLetterId(subscribe.Route, record.EventId)
+	now := time.Now()
+	letter, ok, err := store.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		tenantId, _ := getEventRecordIds(record)
+		letter = &DeadLetter{
+			Id:          id,
+			TenantId:    tenantId,
+			PubsubName:  subscribe.PubsubName,
+			Topic:       subscribe.Topic,
+			Route:       subscribe.Route,
+			EventId:     record.EventId,
+			EventType:   record.EventType,
+			CreatedTime: now,
+		}
+	}
+	letter.Record = record
+	letter.Error = cause.Error()
+	letter.Attempts += attempts
+	letter.UpdatedTime = now
+	return store.Save(ctx, letter)
+}
+
+func getDeadLetterId(route, eventId string) string {
+	route = strings.ReplaceAll(strings.Trim(route, "/"), "/", "_")
+	return fmt.Sprintf("%s.%s", eventId, route)
+}
+
+//
+// memoryDeadLetterStore
+// @Description: 内存死信存储器，只在单个进程内有效
+//
+type memoryDeadLetterStore struct {
+	mu      sync.RWMutex
+	letters map[string]DeadLetter
+}
+
+//
+// NewMemoryDeadLetterStore
+// @Description: 新建内存死信存储器
+// @return DeadLetterStore
+//
+func NewMemoryDeadLetterStore() DeadLetterStore {
+	return &memoryDeadLetterStore{letters: make(map[string]DeadLetter)}
+}
+
+func (s *memoryDeadLetterStore) Save(ctx context.Context, letter *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.letters[letter.Id] = *letter
+	return nil
+}
+
+func (s *memoryDeadLetterStore) FindById(ctx context.Context, id string) (*DeadLetter, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	letter, ok := s.letters[id]
+	if !ok {
+		return nil, false, nil
+	}
+	return &letter, true, nil
+}
+
+func (s *memoryDeadLetterStore) FindList(ctx context.Context, query *DeadLetterQuery) ([]*DeadLetter, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*DeadLetter, 0)
+	for _, letter := range s.letters {
+		if query != nil && ((query.TenantId != "" && letter.TenantId != query.TenantId) ||
+			(query.Route != "" && letter.Route != query.Route) ||
+			(query.EventType != "" && letter.EventType != query.EventType)) {
+			continue
+		}
+		item := letter
+		list = append(list, &item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedTime.Before(list[j].CreatedTime)
+	})
+	if query != nil && query.Limit > 0 && len(list) > query.Limit {
+		list = list[:query.Limit]
+	}
+	return list, nil
+}
+
+func (s *memoryDeadLetterStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.letters, id)
+	return nil
+}
@@ -0,0 +1,116 @@
+package ddd
+
+import (
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_GetInterval(t *testing.T) {
+	p := NewRetryPolicy(5, 100*time.Millisecond, time.Second)
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second} {
+		if d := p.getInterval(attempt); d != want {
+			t.Errorf("attempt %d interval = %s, want %s", attempt, d, want)
+		}
+	}
+}
+
+func TestSubscribeRetryAndDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	handler := &failingEventHandler{}
+	subscribe := Subscribe{
+		PubsubName: "pubsub",
+		Topic:      "user",
+		Route:      "/event/user/dead-letter-test",
+		Retry:      NewRetryPolicy(3, time.Millisecond, 0),
+	}
+	sh := NewSubscribeHandler(&[]Subscribe{subscribe}, handler, func(sh SubscribeHandler, subscribe Subscribe) error {
+		return nil
+	})
+	if err := sh.RegisterSubscribe(subscribe); err != nil {
+		t.Fatal(err)
+	}
+	h := sh.(SubscribeRetryHandler)
+	record := &daprclient.EventRecord{
+		EventId:   "event-1",
+		EventType: "test.UserEvent",
+		EventData: map[string]interface{}{"tenantId": "tenant-1"},
+	}
+
+	// 重试后成功
+	handler.failures = 2
+	if err := h.CallSubscribeEventHandler(ctx, &subscribe, newCorrelationSubscribeContext(t, record)); err != nil {
+		t.Fatal(err)
+	}
+	if handler.calls != 3 {
+		t.Errorf("calls = %d, want 3", handler.calls)
+	}
+
+	// 未设置死信存储器时返回错误
+	handler.calls, handler.failures = 0, 10
+	if err := h.CallSubscribeEventHandler(ctx, &subscribe, newCorrelationSubscribeContext(t, record)); err == nil {
+		t.Fatal("error should be returned without dead letter store")
+	}
+
+	store := NewMemoryDeadLetterStore()
+	SetDeadLetterStore(store)
+	defer SetDeadLetterStore(nil)
+	for i := 0; i < 2; i++ {
+		if err := h.CallSubscribeEventHandler(ctx, &subscribe, newCorrelationSubscribeContext(t, record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := store.FindList(ctx, &DeadLetterQuery{TenantId: "tenant-1", Route: subscribe.Route})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("dead letters = %d, want 1", len(list))
+	}
+	letter := list[0]
+	if letter.Attempts != 6 || letter.EventId != "event-1" || letter.Topic != "user" || letter.Error != "handle error" || letter.Record.EventType != "test.UserEvent" {
+		t.Errorf("dead letter = %+v", letter)
+	}
+
+	// 重放失败时累加执行次数
+	if err = ReplayDeadLetter(ctx, letter.Id); err == nil {
+		t.Fatal("replay should fail")
+	}
+	if letter, _, _ = store.FindById(ctx, letter.Id); letter.Attempts != 7 {
+		t.Errorf("attempts = %d, want 7", letter.Attempts)
+	}
+
+	handler.failures = 0
+	if err = ReplayDeadLetter(ctx, letter.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.FindById(ctx, letter.Id); ok {
+		t.Error("dead letter should be deleted after replay")
+	}
+
+	handler.calls, handler.failures = 0, 10
+	if err = h.CallSubscribeEventHandler(ctx, &subscribe, newCorrelationSubscribeContext(t, record)); err != nil {
+		t.Fatal(err)
+	}
+	if err = DiscardDeadLetter(ctx, letter.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err = DiscardDeadLetter(ctx, letter.Id); err == nil {
+		t.Error("discard a missing dead letter should return error")
+	}
+}
+
+type failingEventHandler struct {
+	calls    int
+	failures int
+}
+
+func (h *failingEventHandler) HandleEventRecord(ctx context.Context, record *daprclient.EventRecord) error {
+	h.calls++
+	if h.calls <= h.failures {
+		return errors.New("handle error")
+	}
+	return nil
+}
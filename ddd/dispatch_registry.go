@@ -0,0 +1,117 @@
+package ddd
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"reflect"
+	"sync"
+)
+
+//
+// EventDispatchFunc
+// @Description: 由 ddd-gen 生成的事件分发方法，按方法名称调用 handler 的事件处理方法
+// @return bool 是否已处理，为 false 时使用反射调用
+//
+type EventDispatchFunc func(ctx context.Context, handler interface{}, methodName string, event interface{}) (bool, error)
+
+//
+// CommandDispatchFunc
+// @Description: 由 ddd-gen 生成的命令分发方法，按命令类型调用聚合的命令处理方法
+// @return bool 是否已处理，为 false 时使用反射调用
+//
+type CommandDispatchFunc func(ctx context.Context, aggregate interface{}, cmd interface{}, metadata *map[string]string) (bool, error)
+
+var _dispatchRegistry = &dispatchRegistry{
+	events:   make(map[reflect.Type]EventDispatchFunc),
+	commands: make(map[reflect.Type]CommandDispatchFunc),
+}
+
+type dispatchRegistry struct {
+	mu       sync.RWMutex
+	events   map[reflect.Type]EventDispatchFunc
+	commands map[reflect.Type]CommandDispatchFunc
+}
+
+//
+// RegisterEventDispatchFunc
+// @Description: 注册聚合或查询处理器的事件分发方法，CallEventHandler 优先使用已注册的分发方法
+// @param handler 聚合或查询处理器，可以为类型的 nil 指针，如 (*UserAggregate)(nil)
+// @param fn 事件分发方法
+//
+func RegisterEventDispatchFunc(handler interface{}, fn EventDispatchFunc) {
+	_dispatchRegistry.mu.Lock()
+	defer _dispatchRegistry.mu.Unlock()
+	_dispatchRegistry.events[reflect.TypeOf(handler)] = fn
+}
+
+//
+// RegisterCommandDispatchFunc
+// @Description: 注册聚合的命令分发方法，执行命令时优先使用已注册的分发方法
+// @param aggregate 聚合，可以为类型的 nil 指针
+// @param fn 命令分发方法
+//
+func RegisterCommandDispatchFunc(aggregate interface{}, fn CommandDispatchFunc) {
+	_dispatchRegistry.mu.Lock()
+	defer _dispatchRegistry.mu.Unlock()
+	_dispatchRegistry.commands[reflect.TypeOf(aggregate)] = fn
+}
+
+func getEventDispatchFunc(handler interface{}) (EventDispatchFunc, bool) {
+	_dispatchRegistry.mu.RLock()
+	defer _dispatchRegistry.mu.RUnlock()
+	fn, ok := _dispatchRegistry.events[reflect.TypeOf(handler)]
+	return fn, ok
+}
+
+func getCommandDispatchFunc(aggregate interface{}) (CommandDispatchFunc, bool) {
+	_dispatchRegistry.mu.RLock()
+	defer _dispatchRegistry.mu.RUnlock()
+	fn, ok := _dispatchRegistry.commands[reflect.TypeOf(aggregate)]
+	return fn, ok
+}
+
+//
+// dispatchEvent
+// @Description: 使用生成的分发方法调用事件处理方法，未注册或未处理时返回 false
+//
+func dispatchEvent(ctx context.Context, handler interface{}, methodName string, event interface{}) (ok bool, err error) {
+	fn, find := getEventDispatchFunc(handler)
+	if !find {
+		return false, nil
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			ok, err = true, errors.NewMethodCallError(getDispatchTypeName(handler), methodName, fmt.Sprintf("%v", e))
+		}
+	}()
+	return fn(ctx, handler, methodName, event)
+}
+
+//
+// dispatchCommand
+// @Description: 使用生成的分发方法调用命令处理方法，未注册或未处理时返回 false
+//
+func dispatchCommand(ctx context.Context, aggregate interface{}, methodName string, cmd interface{}, metadata *map[string]string) (ok bool, err error) {
+	fn, find := getCommandDispatchFunc(aggregate)
+	if !find {
+		return false, nil
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			ok, err = true, errors.NewMethodCallError(getDispatchTypeName(aggregate), methodName, fmt.Sprintf("%v", e))
+		}
+	}()
+	return fn(ctx, aggregate, cmd, metadata)
+}
+
+func getDispatchTypeName(v interface{}) string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return t.Name()
+}
@@ -0,0 +1,53 @@
+package ddd
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDispatchFunc(t *testing.T) {
+	ctx := context.Background()
+	var dispatched []string
+	RegisterEventDispatchFunc((*dispatchAggregate)(nil), func(ctx context.Context, handler interface{}, methodName string, event interface{}) (bool, error) {
+		h := handler.(*dispatchAggregate)
+		switch methodName {
+		case "OnMemCreatedEventV1s0":
+			if e, ok := event.(*memCreatedEvent); ok {
+				dispatched = append(dispatched, methodName)
+				return true, h.OnMemCreatedEventV1s0(ctx, e)
+			}
+		}
+		return false, nil
+	})
+	RegisterCommandDispatchFunc((*dispatchAggregate)(nil), func(ctx context.Context, aggregate interface{}, cmd interface{}, metadata *map[string]string) (bool, error) {
+		switch c := cmd.(type) {
+		case *MemUpdateCommand:
+			dispatched = append(dispatched, "MemUpdateCommand")
+			aggregate.(*dispatchAggregate).Name = c.Name
+			return true, nil
+		}
+		return false, nil
+	})
+
+	agg := &dispatchAggregate{}
+	if err := callEventHandler(ctx, agg, "test.MemCreatedEvent", "v1.0", newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	// 未生成分发代码的方法使用反射调用
+	if err := callEventHandler(ctx, agg, "test.MemUpdatedEvent", "v1.0", newMemUpdatedEvent("tenant-1", "agg-1", "name-2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := CallCommandHandler(ctx, agg, &MemUpdateCommand{Name: "name-3"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(dispatched) != 2 || dispatched[0] != "OnMemCreatedEventV1s0" || dispatched[1] != "MemUpdateCommand" {
+		t.Errorf("dispatched = %v", dispatched)
+	}
+	if agg.Name != "name-3" || agg.UserId != "user-1" {
+		t.Errorf("aggregate = %+v", agg)
+	}
+}
+
+type dispatchAggregate struct {
+	memAggregate
+}
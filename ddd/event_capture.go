@@ -0,0 +1,92 @@
+package ddd
+
+import (
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"sync"
+)
+
+type ctxEventCaptureKey struct {
+}
+
+//
+// CapturedEvent
+// @Description: 被捕获的领域事件
+//
+type CapturedEvent struct {
+	CallEventType CallEventType
+	Event         DomainEvent
+}
+
+type eventCapture struct {
+	mu     sync.Mutex
+	events []*CapturedEvent
+}
+
+//
+// NewEventCaptureContext
+// @Description: 新建捕获领域事件的上下文。在此上下文中调用 ApplyEvent/CreateEvent/DeleteEvent 时，事件不写入事件存储器，
+// 只记录下来并调用聚合的事件处理方法，用于不依赖 dapr sidecar 的聚合测试。
+// @param parent 上下文
+// @return context.Context
+//
+func NewEventCaptureContext(parent context.Context) context.Context {
+	return context.WithValue(parent, ctxEventCaptureKey{}, &eventCapture{})
+}
+
+//
+// GetCapturedEvents
+// @Description: 获取上下文中捕获的领域事件
+// @param ctx 上下文
+// @return []*CapturedEvent
+//
+func GetCapturedEvents(ctx context.Context) []*CapturedEvent {
+	capture := getEventCapture(ctx)
+	if capture == nil {
+		return nil
+	}
+	capture.mu.Lock()
+	defer capture.mu.Unlock()
+	events := make([]*CapturedEvent, len(capture.events))
+	copy(events, capture.events)
+	return events
+}
+
+func getEventCapture(ctx context.Context) *eventCapture {
+	if ctx == nil {
+		return nil
+	}
+	if v, ok := ctx.Value(ctxEventCaptureKey{}).(*eventCapture); ok {
+		return v
+	}
+	return nil
+}
+
+//
+// captureEvents
+// @Description: 按顺序调用聚合的事件处理方法并记录领域事件，出错时恢复聚合状态
+//
+func (c *eventCapture) captureEvents(ctx context.Context, callEventType CallEventType, aggregate Aggregate, events []DomainEvent) (any, error) {
+	restore, err := backupAggregate(aggregate)
+	if err != nil {
+		return nil, err
+	}
+	if err := callEventHandlers(ctx, aggregate, events); err != nil {
+		restore()
+		return nil, err
+	}
+	c.mu.Lock()
+	for _, event := range events {
+		c.events = append(c.events, &CapturedEvent{CallEventType: callEventType, Event: event})
+	}
+	c.mu.Unlock()
+
+	headers := daprclient.NewResponseHeaders(daprclient.ResponseStatusSuccess, nil, nil)
+	switch callEventType {
+	case EventCreate:
+		return &daprclient.CreateEventResponse{Headers: headers}, nil
+	case EventDelete:
+		return &daprclient.DeleteEventResponse{Headers: headers}, nil
+	}
+	return &daprclient.ApplyEventResponse{Headers: headers}, nil
+}
@@ -0,0 +1,554 @@
+package ddd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/rsql"
+	"io"
+	"time"
+)
+
+const (
+	ExportKindEvent    = "event"
+	ExportKindSnapshot = "snapshot"
+)
+
+const defaultExportPageSize uint64 = 500
+
+//
+// ExportRecord
+// @Description: 事件导出文件(NDJSON)中的一行，Kind 为 event 时是一个事件，为 snapshot 时是聚合的最新快照。
+// 聚合的关系保存在该聚合导出的第一个事件的 Relations 中。
+//
+type ExportRecord struct {
+	Kind              string                 `json:"kind"`
+	TenantId          string                 `json:"tenantId"`
+	AggregateType     string                 `json:"aggregateType"`
+	AggregateId       string                 `json:"aggregateId"`
+	SequenceNumber    uint64                 `json:"sequenceNumber"`
+	EventId           string                 `json:"eventId,omitempty"`
+	CommandId         string                 `json:"commandId,omitempty"`
+	EventType         string                 `json:"eventType,omitempty"`
+	EventVersion      string                 `json:"eventVersion,omitempty"`
+	EventTime         *time.Time             `json:"eventTime,omitempty"`
+	PubsubName        string                 `json:"pubsubName,omitempty"`
+	Topic             string                 `json:"topic,omitempty"`
+	EventData         map[string]interface{} `json:"eventData,omitempty"`
+	Metadata          map[string]string      `json:"metadata,omitempty"`
+	Relations         RelationValues         `json:"relations,omitempty"`
+	AggregateData     map[string]interface{} `json:"aggregateData,omitempty"`
+	AggregateRevision string                 `json:"aggregateRevision,omitempty"`
+}
+
+//
+// ExportResult
+// @Description: 事件导出结果
+//
+type ExportResult struct {
+	EventRows    uint64 `json:"eventRows"`
+	SnapshotRows uint64 `json:"snapshotRows"`
+}
+
+//
+// ImportResult
+// @Description: 事件导入结果，DuplicateRows 为事件存储器判断为已存在而跳过的事件数量
+//
+type ImportResult struct {
+	TotalRows     uint64 `json:"totalRows"`
+	CreatedRows   uint64 `json:"createdRows"`
+	AppliedRows   uint64 `json:"appliedRows"`
+	DuplicateRows uint64 `json:"duplicateRows"`
+	SnapshotRows  uint64 `json:"snapshotRows"`
+}
+
+type ExportEventsOptions struct {
+	eventStorageKey  *string
+	fromTime         *time.Time
+	toTime           *time.Time
+	pageSize         *uint64
+	includeSnapshots *bool
+	gzip             *bool
+}
+
+type ImportEventsOptions struct {
+	eventStorageKey *string
+	tenantId        *string
+}
+
+func NewExportEventsOptions() *ExportEventsOptions {
+	return &ExportEventsOptions{}
+}
+
+func (o *ExportEventsOptions) Merge(opts ...*ExportEventsOptions) *ExportEventsOptions {
+	for _, item := range opts {
+		if item == nil {
+			continue
+		}
+		if item.eventStorageKey != nil {
+			o.eventStorageKey = item.eventStorageKey
+		}
+		if item.fromTime != nil {
+			o.fromTime = item.fromTime
+		}
+		if item.toTime != nil {
+			o.toTime = item.toTime
+		}
+		if item.pageSize != nil {
+			o.pageSize = item.pageSize
+		}
+		if item.includeSnapshots != nil {
+			o.includeSnapshots = item.includeSnapshots
+		}
+		if item.gzip != nil {
+			o.gzip = item.gzip
+		}
+	}
+	return o
+}
+
+func (o *ExportEventsOptions) SetEventStorageKey(v string) *ExportEventsOptions {
+	o.eventStorageKey = &v
+	return o
+}
+
+func (o *ExportEventsOptions) GetEventStorageKey() string {
+	if o.eventStorageKey == nil {
+		return ""
+	}
+	return *o.eventStorageKey
+}
+
+//
+// SetFromTime
+// @Description: 设置导出事件的开始时间（包含），精确到秒
+//
+func (o *ExportEventsOptions) SetFromTime(v time.Time) *ExportEventsOptions {
+	o.fromTime = &v
+	return o
+}
+
+//
+// SetToTime
+// @Description: 设置导出事件的结束时间（不包含），精确到秒
+//
+func (o *ExportEventsOptions) SetToTime(v time.Time) *ExportEventsOptions {
+	o.toTime = &v
+	return o
+}
+
+func (o *ExportEventsOptions) SetPageSize(v uint64) *ExportEventsOptions {
+	o.pageSize = &v
+	return o
+}
+
+func (o *ExportEventsOptions) GetPageSize() uint64 {
+	if o.pageSize == nil || *o.pageSize == 0 {
+		return defaultExportPageSize
+	}
+	return *o.pageSize
+}
+
+//
+// SetIncludeSnapshots
+// @Description: 是否同时导出每个聚合的最新快照
+//
+func (o *ExportEventsOptions) SetIncludeSnapshots(v bool) *ExportEventsOptions {
+	o.includeSnapshots = &v
+	return o
+}
+
+func (o *ExportEventsOptions) GetIncludeSnapshots() bool {
+	if o.includeSnapshots == nil {
+		return false
+	}
+	return *o.includeSnapshots
+}
+
+//
+// SetGzip
+// @Description: 是否使用 gzip 压缩导出内容，导入时自动识别
+//
+func (o *ExportEventsOptions) SetGzip(v bool) *ExportEventsOptions {
+	o.gzip = &v
+	return o
+}
+
+func (o *ExportEventsOptions) GetGzip() bool {
+	if o.gzip == nil {
+		return false
+	}
+	return *o.gzip
+}
+
+func NewImportEventsOptions() *ImportEventsOptions {
+	return &ImportEventsOptions{}
+}
+
+func (o *ImportEventsOptions) Merge(opts ...*ImportEventsOptions) *ImportEventsOptions {
+	for _, item := range opts {
+		if item == nil {
+			continue
+		}
+		if item.eventStorageKey != nil {
+			o.eventStorageKey = item.eventStorageKey
+		}
+		if item.tenantId != nil {
+			o.tenantId = item.tenantId
+		}
+	}
+	return o
+}
+
+func (o *ImportEventsOptions) SetEventStorageKey(v string) *ImportEventsOptions {
+	o.eventStorageKey = &v
+	return o
+}
+
+func (o *ImportEventsOptions) GetEventStorageKey() string {
+	if o.eventStorageKey == nil {
+		return ""
+	}
+	return *o.eventStorageKey
+}
+
+//
+// SetTenantId
+// @Description: 导入到指定租户，为空时使用导出文件中的租户。
+// 同时改写事件数据与快照聚合数据中顶层的 tenantId，嵌套结构中的租户id不改写
+//
+func (o *ImportEventsOptions) SetTenantId(v string) *ImportEventsOptions {
+	o.tenantId = &v
+	return o
+}
+
+func (o *ImportEventsOptions) GetTenantId() string {
+	if o.tenantId == nil {
+		return ""
+	}
+	return *o.tenantId
+}
+
+//
+// ExportEvents
+// @Description: 按租户与聚合类型分页读取事件，以 NDJSON 格式写入 w，用于租户迁移或逻辑备份
+// @param ctx 上下文
+// @param w 输出
+// @param tenantId 租户id
+// @param aggregateTypes 聚合类型，事件存储按聚合类型查询，导出租户全部事件时需要列出所有聚合类型
+// @param opts 选项
+// @return *ExportResult 导出结果
+// @return error 错误
+//
+func ExportEvents(ctx context.Context, w io.Writer, tenantId string, aggregateTypes []string, opts ...*ExportEventsOptions) (res *ExportResult, resErr error) {
+	if w == nil {
+		return nil, errors.ErrorOf("ExportEvents() error: writer is nil")
+	}
+	if len(tenantId) == 0 {
+		return nil, errors.ErrorOf("ExportEvents() error: tenantId is empty")
+	}
+	if len(aggregateTypes) == 0 {
+		return nil, errors.ErrorOf("ExportEvents() error: aggregateTypes is empty")
+	}
+	options := NewExportEventsOptions().Merge(opts...)
+	eventStorage, err := GetEventStorage(options.GetEventStorageKey())
+	if err != nil {
+		return nil, err
+	}
+
+	if options.GetGzip() {
+		zw := gzip.NewWriter(w)
+		defer func() {
+			if err := zw.Close(); err != nil && resErr == nil {
+				resErr = err
+			}
+		}()
+		w = zw
+	}
+	exporter := &eventExporter{
+		eventStorage: eventStorage,
+		encoder:      json.NewEncoder(w),
+		tenantId:     tenantId,
+		options:      options,
+		result:       &ExportResult{},
+	}
+	for _, aggregateType := range aggregateTypes {
+		if err := exporter.export(ctx, aggregateType); err != nil {
+			return exporter.result, err
+		}
+	}
+	return exporter.result, nil
+}
+
+//
+// ImportEvents
+// @Description: 读取 ExportEvents 导出的 NDJSON(可为 gzip 压缩)，按原事件id写入事件存储。
+// 序号为1的事件调用 CreateEvent，其余调用 ApplyEvent，重复导入时由事件存储器判断重复事件并跳过。
+// 原事件时间通过 EventDto.EventTime 传递，事件存储器不支持时会重新生成事件时间。
+// @param ctx 上下文
+// @param r 输入
+// @param opts 选项
+// @return *ImportResult 导入结果
+// @return error 错误
+//
+func ImportEvents(ctx context.Context, r io.Reader, opts ...*ImportEventsOptions) (*ImportResult, error) {
+	if r == nil {
+		return nil, errors.ErrorOf("ImportEvents() error: reader is nil")
+	}
+	options := NewImportEventsOptions().Merge(opts...)
+	eventStorage, err := GetEventStorage(options.GetEventStorageKey())
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(r)
+	if header, err := reader.Peek(2); err == nil && header[0] == 0x1f && header[1] == 0x8b {
+		zr, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		reader = bufio.NewReader(zr)
+	}
+
+	result := &ImportResult{}
+	decoder := json.NewDecoder(reader)
+	for line := 1; ; line++ {
+		record := &ExportRecord{}
+		if err := decoder.Decode(record); err == io.EOF {
+			break
+		} else if err != nil {
+			return result, errors.ErrorOf("ImportEvents() error: line %d: %s", line, err.Error())
+		}
+		if tenantId := options.GetTenantId(); len(tenantId) > 0 {
+			setExportRecordTenantId(record, tenantId)
+		}
+		if err := importRecord(ctx, eventStorage, record, result); err != nil {
+			return result, errors.ErrorOf("ImportEvents() error: line %d: %s", line, err.Error())
+		}
+		result.TotalRows++
+	}
+	return result, nil
+}
+
+type eventExporter struct {
+	eventStorage EventStorage
+	encoder      *json.Encoder
+	tenantId     string
+	options      *ExportEventsOptions
+	result       *ExportResult
+}
+
+func (e *eventExporter) export(ctx context.Context, aggregateType string) error {
+	pageSize := e.options.GetPageSize()
+	filter, err := getReplayFilter(e.options.fromTime, e.options.toTime)
+	if err != nil {
+		return err
+	}
+	lastAggregateId := ""
+	for pageNum := uint64(0); ; pageNum++ {
+		req := &daprclient.GetEventsRequest{
+			TenantId:      e.tenantId,
+			AggregateType: aggregateType,
+			Filter:        filter,
+			Sort:          "aggregateId:asc,sequenceNumber:asc",
+			PageNum:       pageNum,
+			PageSize:      pageSize,
+		}
+		resp, err := e.eventStorage.GetEvents(ctx, req)
+		if err != nil {
+			return err
+		}
+		if err := checkEventItems(resp.Data); err != nil {
+			return err
+		}
+		for _, item := range resp.Data {
+			record := &ExportRecord{
+				Kind:           ExportKindEvent,
+				TenantId:       e.tenantId,
+				AggregateType:  aggregateType,
+				AggregateId:    item.AggregateId,
+				SequenceNumber: item.SequenceNumber,
+				EventId:        item.EventId,
+				CommandId:      item.CommandId,
+				EventType:      item.EventType,
+				EventVersion:   item.EventVersion,
+				EventTime:      item.EventTime,
+				PubsubName:     item.PubsubName,
+				Topic:          item.Topic,
+				EventData:      item.EventData,
+				Metadata:       item.Metadata,
+			}
+			if item.AggregateId != lastAggregateId {
+				if err := e.exportSnapshot(ctx, aggregateType, lastAggregateId); err != nil {
+					return err
+				}
+				if record.Relations, err = e.getRelations(ctx, aggregateType, item.AggregateId); err != nil {
+					return err
+				}
+				lastAggregateId = item.AggregateId
+			}
+			if err := e.encoder.Encode(record); err != nil {
+				return err
+			}
+			e.result.EventRows++
+		}
+		if uint64(len(resp.Data)) < pageSize {
+			break
+		}
+	}
+	return e.exportSnapshot(ctx, aggregateType, lastAggregateId)
+}
+
+func (e *eventExporter) exportSnapshot(ctx context.Context, aggregateType, aggregateId string) error {
+	if len(aggregateId) == 0 || !e.options.GetIncludeSnapshots() {
+		return nil
+	}
+	resp, err := e.eventStorage.LoadEvent(ctx, &daprclient.LoadEventsRequest{
+		TenantId:      e.tenantId,
+		AggregateId:   aggregateId,
+		AggregateType: aggregateType,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Snapshot == nil {
+		return nil
+	}
+	record := &ExportRecord{
+		Kind:              ExportKindSnapshot,
+		TenantId:          e.tenantId,
+		AggregateType:     aggregateType,
+		AggregateId:       aggregateId,
+		SequenceNumber:    resp.Snapshot.SequenceNumber,
+		Metadata:          resp.Snapshot.Metadata,
+		AggregateData:     resp.Snapshot.AggregateData,
+		AggregateRevision: resp.Snapshot.AggregateRevision,
+	}
+	if err := e.encoder.Encode(record); err != nil {
+		return err
+	}
+	e.result.SnapshotRows++
+	return nil
+}
+
+func (e *eventExporter) getRelations(ctx context.Context, aggregateType, aggregateId string) (RelationValues, error) {
+	filter, err := rsql.NewFilterBuilder().Eq("aggregateId", aggregateId).Build()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.eventStorage.GetRelations(ctx, &daprclient.GetRelationsRequest{
+		TenantId:      e.tenantId,
+		AggregateType: aggregateType,
+		Filter:        filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var relations RelationValues
+	for _, item := range resp.Data {
+		if item.AggregateId != aggregateId {
+			continue
+		}
+		if relations == nil {
+			relations = make(RelationValues)
+		}
+		relations.add(item.RelName, []string{item.RelValue})
+	}
+	return relations, nil
+}
+
+//
+// setExportRecordTenantId
+// @Description: 改写导入记录的租户，包括事件数据与快照聚合数据中顶层的 tenantId
+//
+func setExportRecordTenantId(record *ExportRecord, tenantId string) {
+	record.TenantId = tenantId
+	for _, data := range []map[string]interface{}{record.EventData, record.AggregateData} {
+		if _, ok := data["tenantId"]; ok {
+			data["tenantId"] = tenantId
+		}
+	}
+}
+
+func importRecord(ctx context.Context, eventStorage EventStorage, record *ExportRecord, result *ImportResult) error {
+	switch record.Kind {
+	case ExportKindSnapshot:
+		_, err := eventStorage.SaveSnapshot(ctx, &daprclient.SaveSnapshotRequest{
+			TenantId:         record.TenantId,
+			AggregateId:      record.AggregateId,
+			AggregateType:    record.AggregateType,
+			AggregateData:    record.AggregateData,
+			AggregateVersion: record.AggregateRevision,
+			SequenceNumber:   record.SequenceNumber,
+			Metadata:         record.Metadata,
+		})
+		if err != nil {
+			return err
+		}
+		result.SnapshotRows++
+		return nil
+	case ExportKindEvent:
+	default:
+		return errors.ErrorOf("unknown kind \"%s\"", record.Kind)
+	}
+
+	event := &daprclient.EventDto{
+		EventId:        record.EventId,
+		CommandId:      record.CommandId,
+		EventData:      record.EventData,
+		EventType:      record.EventType,
+		EventVersion:   record.EventVersion,
+		EventTime:      record.EventTime,
+		Metadata:       record.Metadata,
+		PubsubName:     record.PubsubName,
+		Topic:          record.Topic,
+		Relations:      record.Relations.ToRelation(),
+		RelationValues: record.Relations,
+	}
+	headers, err := importEvent(ctx, eventStorage, record, event)
+	if err != nil {
+		return err
+	}
+	if headers != nil && headers.Status == daprclient.ResponseStatusEventDuplicate {
+		result.DuplicateRows++
+		return nil
+	}
+	if headers != nil && headers.Status == daprclient.ResponseStatusError {
+		return errors.New(headers.Message)
+	}
+	if record.SequenceNumber == 1 {
+		result.CreatedRows++
+	} else {
+		result.AppliedRows++
+	}
+	return nil
+}
+
+func importEvent(ctx context.Context, eventStorage EventStorage, record *ExportRecord, event *daprclient.EventDto) (*daprclient.ResponseHeaders, error) {
+	if record.SequenceNumber == 1 {
+		resp, err := eventStorage.CreateEvent(ctx, &daprclient.CreateEventRequest{
+			TenantId:      record.TenantId,
+			AggregateId:   record.AggregateId,
+			AggregateType: record.AggregateType,
+			Events:        []*daprclient.EventDto{event},
+		})
+		if err != nil || resp == nil {
+			return nil, err
+		}
+		return resp.Headers, nil
+	}
+	resp, err := eventStorage.ApplyEvent(ctx, &daprclient.ApplyEventRequest{
+		TenantId:      record.TenantId,
+		AggregateId:   record.AggregateId,
+		AggregateType: record.AggregateType,
+		Events:        []*daprclient.EventDto{event},
+	})
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	return resp.Headers, nil
+}
@@ -0,0 +1,199 @@
+package ddd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportEvents_ImportEvents(t *testing.T) {
+	ctx := context.Background()
+	source := newExportTestStorage(t)
+	agg := &memAggregate{}
+	if _, err := source.SaveSnapshot(ctx, &daprclient.SaveSnapshotRequest{
+		TenantId:         "tenant-1",
+		AggregateId:      "agg-1",
+		AggregateType:    memAggregateType,
+		AggregateData:    &memAggregate{Id: "agg-1", TenantId: "tenant-1", Name: "name-2", UserId: "user-agg-1"},
+		AggregateVersion: "v1.0",
+		SequenceNumber:   2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	exportResult, err := ExportEvents(ctx, buf, "tenant-1", []string{memAggregateType}, NewExportEventsOptions().SetIncludeSnapshots(true).SetPageSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exportResult.EventRows != 3 || exportResult.SnapshotRows != 1 {
+		t.Fatalf("exportResult = %+v", exportResult)
+	}
+	records := readExportRecords(t, buf.Bytes())
+	kinds := make([]string, 0, len(records))
+	for _, record := range records {
+		kinds = append(kinds, record.Kind+":"+record.AggregateId)
+	}
+	if got := strings.Join(kinds, ","); got != "event:agg-1,event:agg-1,snapshot:agg-1,event:agg-2" {
+		t.Fatalf("records = %s", got)
+	}
+	if len(records[0].Relations["userId"]) != 1 || records[0].Relations["userId"][0] != "user-agg-1" || records[1].Relations != nil {
+		t.Errorf("relations = %v, %v", records[0].Relations, records[1].Relations)
+	}
+
+	target := newExportTargetStorage(t)
+	importResult, err := ImportEvents(ctx, bytes.NewReader(buf.Bytes()), NewImportEventsOptions().SetEventStorageKey("target"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if importResult.TotalRows != 4 || importResult.CreatedRows != 2 || importResult.AppliedRows != 1 || importResult.SnapshotRows != 1 {
+		t.Fatalf("importResult = %+v", importResult)
+	}
+
+	loaded, find, err := target.LoadAggregate(ctx, "tenant-1", "agg-1", agg)
+	if err != nil || !find {
+		t.Fatalf("LoadAggregate() = %v, %v", find, err)
+	}
+	if name := loaded.(*memAggregate).Name; name != "name-2" {
+		t.Errorf("name = %s, want name-2", name)
+	}
+	resp, err := target.LoadEvent(ctx, &daprclient.LoadEventsRequest{TenantId: "tenant-1", AggregateId: "agg-1", FromSequenceNumber: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*resp.EventRecords) != 1 || (*resp.EventRecords)[0].EventId != records[1].EventId {
+		t.Errorf("events = %v, want original event id %s", *resp.EventRecords, records[1].EventId)
+	}
+	ok, _, _, err := HasRelations(ctx, "tenant-1", memAggregateType, NewWhereOptions().AddWhere("userId", "user-agg-2").SetEventStorageKey("target"))
+	if err != nil || !ok {
+		t.Errorf("HasRelations() = %v, %v; want true", ok, err)
+	}
+
+	importResult, err = ImportEvents(ctx, bytes.NewReader(buf.Bytes()), NewImportEventsOptions().SetEventStorageKey("target"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if importResult.DuplicateRows != 3 || importResult.CreatedRows != 0 || importResult.AppliedRows != 0 {
+		t.Errorf("reimport result = %+v, want 3 duplicates", importResult)
+	}
+
+	if _, err = ImportEvents(ctx, bytes.NewReader(buf.Bytes()), NewImportEventsOptions().SetEventStorageKey("target").SetTenantId("tenant-3")); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = target.LoadEvent(ctx, &daprclient.LoadEventsRequest{TenantId: "tenant-3", AggregateId: "agg-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Snapshot == nil || resp.Snapshot.AggregateData["tenantId"] != "tenant-3" {
+		t.Errorf("snapshot = %v, want aggregateData.tenantId tenant-3", resp.Snapshot)
+	}
+}
+
+func TestExportEvents_GzipAndTimeRange(t *testing.T) {
+	ctx := context.Background()
+	newExportTestStorage(t)
+
+	buf := &bytes.Buffer{}
+	if _, err := ExportEvents(ctx, buf, "tenant-1", []string{memAggregateType}, NewExportEventsOptions().SetGzip(true)); err != nil {
+		t.Fatal(err)
+	}
+	if data := buf.Bytes(); len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		t.Fatal("export should be gzip compressed")
+	}
+	newExportTargetStorage(t)
+	result, err := ImportEvents(ctx, buf, NewImportEventsOptions().SetEventStorageKey("target").SetTenantId("tenant-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalRows != 3 {
+		t.Errorf("totalRows = %d, want 3", result.TotalRows)
+	}
+	agg, find, err := LoadAggregate(ctx, "tenant-2", "agg-2", &memAggregate{}, NewLoadAggregateOptions().SetEventStorageKey("target"))
+	if err != nil || !find {
+		t.Fatalf("LoadAggregate(tenant-2) = %v, %v", find, err)
+	}
+	if tenantId := agg.(*memAggregate).TenantId; tenantId != "tenant-2" {
+		t.Errorf("aggregate tenantId = %s, want tenant-2", tenantId)
+	}
+	sourceEvents, err := GetEventsByWhere(ctx, "tenant-1", memAggregateType, NewGetEventsWhereOptions().AddWhere("aggregateId", "agg-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetEvents, err := GetEventsByWhere(ctx, "tenant-2", memAggregateType, NewGetEventsWhereOptions().AddWhere("aggregateId", "agg-2").SetEventStorageKey("target"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sourceEvents.Data) != 1 || len(targetEvents.Data) != 1 {
+		t.Fatalf("events = %d, %d; want 1, 1", len(sourceEvents.Data), len(targetEvents.Data))
+	}
+	if tenantId := targetEvents.Data[0].EventData["tenantId"]; tenantId != "tenant-2" {
+		t.Errorf("eventData.tenantId = %v, want tenant-2", tenantId)
+	}
+	if eventTime := targetEvents.Data[0].EventTime; eventTime == nil || !eventTime.Equal(*sourceEvents.Data[0].EventTime) {
+		t.Errorf("eventTime = %v, want original %v", eventTime, sourceEvents.Data[0].EventTime)
+	}
+
+	buf.Reset()
+	future := time.Now().Add(time.Hour)
+	exportResult, err := ExportEvents(ctx, buf, "tenant-1", []string{memAggregateType}, NewExportEventsOptions().SetFromTime(future))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exportResult.EventRows != 0 || buf.Len() != 0 {
+		t.Errorf("eventRows = %d, len = %d; want empty export", exportResult.EventRows, buf.Len())
+	}
+}
+
+func TestImportEvents_InvalidLine(t *testing.T) {
+	newExportTargetStorage(t)
+	input := `{"kind":"unknown","tenantId":"tenant-1"}` + "\n"
+	result, err := ImportEvents(context.Background(), strings.NewReader(input), NewImportEventsOptions().SetEventStorageKey("target"))
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("err = %v, want line 1 error", err)
+	}
+	if result.TotalRows != 0 {
+		t.Errorf("totalRows = %d, want 0", result.TotalRows)
+	}
+}
+
+func newExportTestStorage(t *testing.T) EventStorage {
+	ctx := context.Background()
+	eventStorage := newMemoryStorage(t)
+	for _, id := range []string{"agg-1", "agg-2"} {
+		agg := &memAggregate{}
+		if _, err := CreateEvent(ctx, agg, newMemCreatedEvent("tenant-1", id, "name-1", "user-"+id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ApplyEvent(ctx, &memAggregate{}, newMemUpdatedEvent("tenant-1", "agg-1", "name-2")); err != nil {
+		t.Fatal(err)
+	}
+	return eventStorage
+}
+
+func newExportTargetStorage(t *testing.T) EventStorage {
+	eventStorage, err := NewMemoryEventStorage(PubsubName("pubsub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterEventStorage("target", eventStorage)
+	return eventStorage
+}
+
+func readExportRecords(t *testing.T, data []byte) []*ExportRecord {
+	var records []*ExportRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		record := &ExportRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
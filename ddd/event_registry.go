@@ -37,6 +37,13 @@ func RegisterEventType(eventType string, eventVersion string, newFunc NewEventFu
 	return _eventTypeRegistry.add(eventType, eventVersion, newFunc, options...)
 }
 
+//
+// NewDomainEvent
+// @Description: 按事件类型与版本创建领域事件。不执行事件升级，旧版本事件需先经 CallEventHandler 等入口升级
+// @param record 事件记录
+// @return interface{} 领域事件
+// @return error 错误
+//
 func NewDomainEvent(record *daprclient.EventRecord) (interface{}, error) {
 	if eventTypes, ok := _eventTypeRegistry.typeMap[record.EventType]; ok {
 		if item, ok := eventTypes.versionMap[record.EventVersion]; ok {
@@ -136,14 +143,16 @@ func (r *eventTypeRegistry) add(eventType string, version string, newFunc NewEve
 
 // 事件类
 type eventTypes struct {
-	eventType  string
-	versionMap map[string]*registryItem
+	eventType   string
+	versionMap  map[string]*registryItem
+	upcasterMap map[string]*upcasterItem // key为原版本号
 }
 
 func newEventType(eventType string) *eventTypes {
 	return &eventTypes{
-		eventType:  eventType,
-		versionMap: make(map[string]*registryItem),
+		eventType:   eventType,
+		versionMap:  make(map[string]*registryItem),
+		upcasterMap: make(map[string]*upcasterItem),
 	}
 }
 
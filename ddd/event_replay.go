@@ -0,0 +1,277 @@
+package ddd
+
+import (
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/rsql"
+	"time"
+)
+
+const defaultReplayPageSize uint64 = 100
+
+//
+// ReplayProgress
+// @Description: 事件重放进度，可用于失败后继续重放
+//
+type ReplayProgress struct {
+	TenantId      string     `json:"tenantId"`
+	AggregateType string     `json:"aggregateType"`
+	FromTime      *time.Time `json:"fromTime"`
+	ToTime        *time.Time `json:"toTime"`
+	TotalRows     uint64     `json:"totalRows"`
+	ProcessedRows uint64     `json:"processedRows"`
+	LastEventId   string     `json:"lastEventId"`
+	IsCompleted   bool       `json:"isCompleted"`
+	Error         string     `json:"error"`
+}
+
+//
+// ReplayTruncateHandler
+// @Description: 重放前清空读模型，需要清空时查询事件处理器需实现此接口
+//
+type ReplayTruncateHandler interface {
+	ReplayTruncate(ctx context.Context, tenantId string, aggregateType string) error
+}
+
+type ReplayProgressFunc func(progress *ReplayProgress)
+
+type ReplayEventsOptions struct {
+	eventStorageKey *string
+	fromTime        *time.Time
+	toTime          *time.Time
+	pageSize        *uint64
+	truncate        *bool
+	resume          *ReplayProgress
+	onProgress      ReplayProgressFunc
+}
+
+func NewReplayEventsOptions() *ReplayEventsOptions {
+	return &ReplayEventsOptions{}
+}
+
+func (o *ReplayEventsOptions) Merge(opts ...*ReplayEventsOptions) *ReplayEventsOptions {
+	for _, item := range opts {
+		if item == nil {
+			continue
+		}
+		if item.eventStorageKey != nil {
+			o.eventStorageKey = item.eventStorageKey
+		}
+		if item.fromTime != nil {
+			o.fromTime = item.fromTime
+		}
+		if item.toTime != nil {
+			o.toTime = item.toTime
+		}
+		if item.pageSize != nil {
+			o.pageSize = item.pageSize
+		}
+		if item.truncate != nil {
+			o.truncate = item.truncate
+		}
+		if item.resume != nil {
+			o.resume = item.resume
+		}
+		if item.onProgress != nil {
+			o.onProgress = item.onProgress
+		}
+	}
+	return o
+}
+
+func (o *ReplayEventsOptions) SetEventStorageKey(v string) *ReplayEventsOptions {
+	o.eventStorageKey = &v
+	return o
+}
+
+func (o *ReplayEventsOptions) GetEventStorageKey() string {
+	if o.eventStorageKey == nil {
+		return ""
+	}
+	return *o.eventStorageKey
+}
+
+//
+// SetFromTime
+// @Description: 设置重放事件的开始时间（包含），精确到秒
+//
+func (o *ReplayEventsOptions) SetFromTime(v time.Time) *ReplayEventsOptions {
+	o.fromTime = &v
+	return o
+}
+
+//
+// SetToTime
+// @Description: 设置重放事件的结束时间（不包含），精确到秒
+//
+func (o *ReplayEventsOptions) SetToTime(v time.Time) *ReplayEventsOptions {
+	o.toTime = &v
+	return o
+}
+
+func (o *ReplayEventsOptions) SetPageSize(v uint64) *ReplayEventsOptions {
+	o.pageSize = &v
+	return o
+}
+
+func (o *ReplayEventsOptions) GetPageSize() uint64 {
+	if o.pageSize == nil || *o.pageSize == 0 {
+		return defaultReplayPageSize
+	}
+	return *o.pageSize
+}
+
+//
+// SetTruncate
+// @Description: 重放前是否清空读模型，处理器需实现 ReplayTruncateHandler 接口
+//
+func (o *ReplayEventsOptions) SetTruncate(v bool) *ReplayEventsOptions {
+	o.truncate = &v
+	return o
+}
+
+func (o *ReplayEventsOptions) GetTruncate() bool {
+	if o.truncate == nil {
+		return false
+	}
+	return *o.truncate
+}
+
+//
+// SetResume
+// @Description: 从上次失败的进度继续重放，继续重放时不会清空读模型
+//
+func (o *ReplayEventsOptions) SetResume(v *ReplayProgress) *ReplayEventsOptions {
+	o.resume = v
+	return o
+}
+
+//
+// SetOnProgress
+// @Description: 设置进度回调，每处理完一页事件调用一次
+//
+func (o *ReplayEventsOptions) SetOnProgress(v ReplayProgressFunc) *ReplayEventsOptions {
+	o.onProgress = v
+	return o
+}
+
+//
+// ReplayEvents
+// @Description: 从事件存储中按聚合类型、租户与时间范围分页读取事件，重新调用查询事件处理器，用于重建读模型
+// @param ctx 上下文
+// @param tenantId 租户id
+// @param aggregateType 聚合类型
+// @param handler 查询事件处理器
+// @param opts 选项
+// @return *ReplayProgress 重放进度
+// @return error 错误
+//
+func ReplayEvents(ctx context.Context, tenantId string, aggregateType string, handler QueryEventHandler, opts ...*ReplayEventsOptions) (*ReplayProgress, error) {
+	if handler == nil {
+		return nil, errors.ErrorOf("ReplayEvents() error: handler is nil")
+	}
+	if len(tenantId) == 0 {
+		return nil, errors.ErrorOf("ReplayEvents() error: tenantId is empty")
+	}
+	if len(aggregateType) == 0 {
+		return nil, errors.ErrorOf("ReplayEvents() error: aggregateType is empty")
+	}
+	options := NewReplayEventsOptions().Merge(opts...)
+	eventStorage, err := GetEventStorage(options.GetEventStorageKey())
+	if err != nil {
+		return nil, err
+	}
+	filter, err := getReplayFilter(options.fromTime, options.toTime)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &ReplayProgress{
+		TenantId:      tenantId,
+		AggregateType: aggregateType,
+		FromTime:      options.fromTime,
+		ToTime:        options.toTime,
+	}
+	if resume := options.resume; resume != nil && !resume.IsCompleted {
+		progress.ProcessedRows = resume.ProcessedRows
+		progress.LastEventId = resume.LastEventId
+	} else if options.GetTruncate() {
+		truncateHandler, ok := handler.(ReplayTruncateHandler)
+		if !ok {
+			return nil, errors.ErrorOf("ReplayEvents() error: %T does not implement ReplayTruncateHandler", handler)
+		}
+		if err := truncateHandler.ReplayTruncate(ctx, tenantId, aggregateType); err != nil {
+			return nil, err
+		}
+	}
+
+	fail := func(err error) (*ReplayProgress, error) {
+		progress.Error = err.Error()
+		if options.onProgress != nil {
+			options.onProgress(progress)
+		}
+		return progress, err
+	}
+
+	pageSize := options.GetPageSize()
+	for {
+		req := &daprclient.GetEventsRequest{
+			TenantId:      tenantId,
+			AggregateType: aggregateType,
+			Filter:        filter,
+			Sort:          "eventTime:asc,aggregateId:asc,sequenceNumber:asc",
+			PageNum:       progress.ProcessedRows / pageSize,
+			PageSize:      pageSize,
+		}
+		resp, err := eventStorage.GetEvents(ctx, req)
+		if err != nil {
+			return fail(err)
+		}
+		if err := checkEventItems(resp.Data); err != nil {
+			return fail(err)
+		}
+		progress.TotalRows = resp.TotalRows
+
+		skip := int(progress.ProcessedRows % pageSize)
+		if skip >= len(resp.Data) {
+			break
+		}
+		for _, item := range resp.Data[skip:] {
+			record := newEventRecordByGetEventsItem(tenantId, item)
+			if err := CallEventHandler(ctx, handler, record); err != nil {
+				return fail(err)
+			}
+			progress.ProcessedRows++
+			progress.LastEventId = item.EventId
+		}
+		if options.onProgress != nil {
+			options.onProgress(progress)
+		}
+		if uint64(len(resp.Data)) < pageSize {
+			break
+		}
+	}
+
+	progress.IsCompleted = true
+	progress.Error = ""
+	if options.onProgress != nil {
+		options.onProgress(progress)
+	}
+	return progress, nil
+}
+
+//
+// getReplayFilter
+// @Description: 按事件时间范围生成过滤条件，RSQL 的日期时间精确到秒，开始与结束时间的小数秒被截断
+//
+func getReplayFilter(fromTime *time.Time, toTime *time.Time) (string, error) {
+	filter := rsql.NewFilterBuilder()
+	if fromTime != nil {
+		filter.Ge("eventTime", *fromTime)
+	}
+	if toTime != nil {
+		filter.Lt("eventTime", *toTime)
+	}
+	return filter.Build()
+}
@@ -0,0 +1,150 @@
+package ddd
+
+import (
+	"context"
+	"errors"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"testing"
+	"time"
+)
+
+func TestReplayEvents(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+
+	for _, id := range []string{"agg-1", "agg-2", "agg-3"} {
+		agg := &memAggregate{}
+		if _, err := CreateEvent(ctx, agg, newMemCreatedEvent("tenant-1", id, id, "user-1")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ApplyEvent(ctx, agg, newMemUpdatedEvent("tenant-1", id, id+"-new")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := &replayHandler{names: map[string]string{"old": "old"}, failAt: 4}
+	opts := NewReplayEventsOptions().SetPageSize(4).SetTruncate(true)
+	progress, err := ReplayEvents(ctx, "tenant-1", memAggregateType, handler, opts)
+	if err == nil {
+		t.Fatal("replay should fail at the 4th event")
+	}
+	if progress.ProcessedRows != 3 || progress.IsCompleted {
+		t.Fatalf("processedRows = %d, isCompleted = %v", progress.ProcessedRows, progress.IsCompleted)
+	}
+	if _, ok := handler.names["old"]; ok {
+		t.Error("read model should be truncated")
+	}
+
+	handler.failAt = 0
+	handler.names["sentinel"] = "sentinel"
+	progress, err = ReplayEvents(ctx, "tenant-1", memAggregateType, handler, opts.SetResume(progress))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !progress.IsCompleted || progress.ProcessedRows != 6 || progress.TotalRows != 6 {
+		t.Fatalf("isCompleted = %v, processedRows = %d, totalRows = %d", progress.IsCompleted, progress.ProcessedRows, progress.TotalRows)
+	}
+	if _, ok := handler.names["sentinel"]; !ok {
+		t.Error("resume should not truncate read model")
+	}
+	for _, id := range []string{"agg-1", "agg-2", "agg-3"} {
+		if handler.names[id] != id+"-new" {
+			t.Errorf("names[%s] = %s, want %s-new", id, handler.names[id], id)
+		}
+	}
+
+	future := time.Now().Add(time.Hour)
+	progress, err = ReplayEvents(ctx, "tenant-1", memAggregateType, &replayHandler{names: map[string]string{}}, NewReplayEventsOptions().SetFromTime(future))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.ProcessedRows != 0 {
+		t.Errorf("processedRows = %d, want 0", progress.ProcessedRows)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	progress, err = ReplayEvents(ctx, "tenant-1", memAggregateType, &replayHandler{names: map[string]string{}}, NewReplayEventsOptions().SetFromTime(past).SetToTime(future))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.ProcessedRows != 6 {
+		t.Errorf("processedRows = %d, want 6", progress.ProcessedRows)
+	}
+}
+
+func TestReplayEvents_Grpc(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryStorage(t)
+	agg := &memAggregate{}
+	if _, err := CreateEvent(ctx, agg, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	RegisterEventStorage("grpc", newContractGrpcEventStorage(t, backend))
+
+	// pb 中没有事件序号等字段时 GetEvents 仍然可用，回放则返回错误
+	resp, err := GetEvents(ctx, &daprclient.GetEventsRequest{TenantId: "tenant-1", AggregateType: memAggregateType}, NewApplyCommandOptions().SetEventStorageKey("grpc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 1 {
+		t.Fatalf("len = %d, want 1", len(resp.Data))
+	}
+
+	handler := &replayHandler{names: map[string]string{}}
+	progress, err := ReplayEvents(ctx, "tenant-1", memAggregateType, handler, NewReplayEventsOptions().SetEventStorageKey("grpc"))
+	if !daprclient.GrpcSupportsSequenceNumber() {
+		if !errors.Is(err, ErrEventItemFieldMissing) {
+			t.Errorf("err = %v, want ErrEventItemFieldMissing", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.ProcessedRows != 1 || handler.names["agg-1"] != "name-1" {
+		t.Errorf("processedRows = %d, names = %v", progress.ProcessedRows, handler.names)
+	}
+}
+
+func TestGetReplayFilter(t *testing.T) {
+	from := time.Date(2022, 1, 2, 11, 4, 5, 600, time.FixedZone("CST", 8*3600))
+	to := from.Add(time.Hour)
+	filter, err := getReplayFilter(&from, &to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "eventTime>=2022-01-02T03:04:05Z and eventTime<2022-01-02T04:04:05Z"; filter != want {
+		t.Errorf("filter = %s, want %s", filter, want)
+	}
+	if filter, err = getReplayFilter(nil, nil); err != nil || filter != "" {
+		t.Errorf("getReplayFilter(nil, nil) = %s, %v", filter, err)
+	}
+}
+
+type replayHandler struct {
+	names  map[string]string
+	calls  int
+	failAt int
+}
+
+func (h *replayHandler) ReplayTruncate(ctx context.Context, tenantId string, aggregateType string) error {
+	h.names = make(map[string]string)
+	return nil
+}
+
+func (h *replayHandler) OnMemCreatedEventV1s0(ctx context.Context, event *memCreatedEvent) error {
+	return h.set(event.Data.Id, event.Data.Name)
+}
+
+func (h *replayHandler) OnMemUpdatedEventV1s0(ctx context.Context, event *memUpdatedEvent) error {
+	return h.set(event.Data.Id, event.Data.Name)
+}
+
+func (h *replayHandler) set(id, name string) error {
+	h.calls++
+	if h.failAt > 0 && h.calls == h.failAt {
+		return errors.New("replay handler error")
+	}
+	h.names[id] = name
+	return nil
+}
@@ -0,0 +1,167 @@
+package ddd
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const JsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+//
+// EventTypeSchema
+// @Description: 已注册的事件类型及其 JSON Schema
+//
+type EventTypeSchema struct {
+	EventType    string      `json:"eventType"`
+	EventVersion string      `json:"eventVersion"`
+	Schema       *JsonSchema `json:"schema"`
+}
+
+//
+// JsonSchema
+// @Description: JSON Schema(draft-07)的子集，用于描述事件结构
+//
+type JsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	Properties           map[string]*JsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *JsonSchema            `json:"items,omitempty"`
+	AdditionalProperties *JsonSchema            `json:"additionalProperties,omitempty"`
+	Validate             string                 `json:"x-validate,omitempty"` // 字段的 validate 标签
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+//
+// GetEventTypeSchemas
+// @Description: 获取所有已注册事件类型与版本的 JSON Schema，按事件类型与版本排序
+// @return []*EventTypeSchema
+//
+func GetEventTypeSchemas() []*EventTypeSchema {
+	var list []*EventTypeSchema
+	for eventType, ts := range _eventTypeRegistry.typeMap {
+		for version, item := range ts.versionMap {
+			schema := &JsonSchema{}
+			if event := item.newFunc(); event != nil {
+				schema = NewJsonSchema(reflect.TypeOf(event))
+			}
+			schema.Schema = JsonSchemaDraft
+			schema.Title = eventType
+			list = append(list, &EventTypeSchema{
+				EventType:    eventType,
+				EventVersion: version,
+				Schema:       schema,
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].EventType != list[j].EventType {
+			return list[i].EventType < list[j].EventType
+		}
+		return list[i].EventVersion < list[j].EventVersion
+	})
+	return list
+}
+
+//
+// NewJsonSchema
+// @Description: 通过反射生成类型的 JSON Schema，字段名称与是否必填取自 json 标签(omitempty 为非必填)
+// @param t 类型
+// @return *JsonSchema
+//
+func NewJsonSchema(t reflect.Type) *JsonSchema {
+	return newJsonSchema(t, make(map[reflect.Type]bool))
+}
+
+func newJsonSchema(t reflect.Type, visiting map[reflect.Type]bool) *JsonSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &JsonSchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JsonSchema{Type: "number"}
+	case reflect.String:
+		return &JsonSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &JsonSchema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &JsonSchema{Type: "array", Items: newJsonSchema(t.Elem(), visiting)}
+	case reflect.Map:
+		return &JsonSchema{Type: "object", AdditionalProperties: newJsonSchema(t.Elem(), visiting)}
+	case reflect.Struct:
+		// 递归引用的类型不再展开
+		if visiting[t] {
+			return &JsonSchema{Type: "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		schema := &JsonSchema{Type: "object", Properties: make(map[string]*JsonSchema)}
+		addJsonSchemaFields(schema, t, visiting)
+		sort.Strings(schema.Required)
+		return schema
+	}
+	// interface 等类型可以是任意值
+	return &JsonSchema{}
+}
+
+func addJsonSchemaFields(schema *JsonSchema, t reflect.Type, visiting map[reflect.Type]bool) {
+	// 与 encoding/json 一致，外层字段优先于嵌入结构体中的同名字段
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		// 没有 json 名称的嵌入结构体，字段提升到上一级
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := schema.Properties[name]; ok {
+			continue
+		}
+		property := newJsonSchema(field.Type, visiting)
+		property.Description = field.Tag.Get("description")
+		property.Validate = field.Tag.Get("validate")
+		schema.Properties[name] = property
+		if !strings.Contains(opts, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	for _, ft := range embedded {
+		addJsonSchemaFields(schema, ft, visiting)
+	}
+}
@@ -0,0 +1,356 @@
+package ddd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/rsql"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/utils/validateutils"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type SchemaChangeKind string
+
+const (
+	SchemaChangeFieldAdded    SchemaChangeKind = "fieldAdded"
+	SchemaChangeFieldRemoved  SchemaChangeKind = "fieldRemoved"
+	SchemaChangeTypeChanged   SchemaChangeKind = "typeChanged"
+	SchemaChangeRequiredAdded SchemaChangeKind = "requiredAdded"
+)
+
+//
+// SchemaChange
+// @Description: 两个事件版本之间的结构变化
+//
+type SchemaChange struct {
+	Kind     SchemaChangeKind `json:"kind"`
+	Path     string           `json:"path"`
+	OldType  string           `json:"oldType,omitempty"`
+	NewType  string           `json:"newType,omitempty"`
+	Breaking bool             `json:"breaking"`
+	Message  string           `json:"message"`
+}
+
+//
+// EventRecordDecodeError
+// @Description: 事件记录无法解析为新版本事件的错误
+//
+type EventRecordDecodeError struct {
+	EventId      string `json:"eventId"`
+	AggregateId  string `json:"aggregateId"`
+	EventVersion string `json:"eventVersion"`
+	Error        string `json:"error"`
+}
+
+//
+// SchemaCompatibilityReport
+// @Description: 事件版本兼容性检查报告
+//
+type SchemaCompatibilityReport struct {
+	EventType      string                    `json:"eventType"`
+	FromVersion    string                    `json:"fromVersion"`
+	ToVersion      string                    `json:"toVersion"`
+	Changes        []*SchemaChange           `json:"changes"`
+	CheckedRecords int                       `json:"checkedRecords"`
+	RecordErrors   []*EventRecordDecodeError `json:"recordErrors"`
+}
+
+//
+// CheckEventRecordsOptions
+// @Description: 使用已存储的事件记录检查兼容性的选项
+//
+type CheckEventRecordsOptions struct {
+	TenantId        string
+	AggregateType   string
+	SampleSize      uint64 // 抽样的事件记录数量，默认100，取最新写入的记录
+	EventStorageKey string
+}
+
+//
+// IsBreaking
+// @Description: 是否存在不兼容的结构变化或无法解析的事件记录
+// @return bool
+//
+func (r *SchemaCompatibilityReport) IsBreaking() bool {
+	for _, c := range r.Changes {
+		if c.Breaking {
+			return true
+		}
+	}
+	return len(r.RecordErrors) > 0
+}
+
+//
+// CheckEventSchemaCompatibility
+// @Description: 比较两个已注册事件版本的结构，toVersion 为空时使用最新版本
+// @param eventType 事件类型
+// @param fromVersion 原版本
+// @param toVersion 新版本
+// @return *SchemaCompatibilityReport
+// @return error
+//
+func CheckEventSchemaCompatibility(eventType, fromVersion, toVersion string) (*SchemaCompatibilityReport, error) {
+	if toVersion == "" {
+		toVersion = getLatestEventVersion(eventType)
+	}
+	from, err := getEventSchema(eventType, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	to, err := getEventSchema(eventType, toVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &SchemaCompatibilityReport{
+		EventType:    eventType,
+		FromVersion:  fromVersion,
+		ToVersion:    toVersion,
+		Changes:      CompareJsonSchemas(from, to),
+		RecordErrors: make([]*EventRecordDecodeError, 0),
+	}, nil
+}
+
+//
+// CheckEventRecordsCompatibility
+// @Description: 抽样读取已存储的事件记录，经过升级函数升级到 ToVersion 后解析为 ToVersion 事件并执行 validate 验证，
+// 记录中存在新版本没有的字段时视为解析失败。结果追加到 report 中。
+// 只检查按事件时间倒序(最新写入)的 SampleSize 条记录，不是全量检查，更早的记录可能仍有不兼容的数据。
+// @param ctx 上下文
+// @param report CheckEventSchemaCompatibility 返回的报告
+// @param opts 选项
+// @return error
+//
+func CheckEventRecordsCompatibility(ctx context.Context, report *SchemaCompatibilityReport, opts *CheckEventRecordsOptions) error {
+	if opts == nil || opts.TenantId == "" || opts.AggregateType == "" {
+		return errors.New("CheckEventRecordsCompatibility() error: TenantId and AggregateType cannot be empty")
+	}
+	item, err := getRegistryItem(report.EventType, report.ToVersion)
+	if err != nil {
+		return err
+	}
+	sampleSize := opts.SampleSize
+	if sampleSize == 0 {
+		sampleSize = 100
+	}
+	filter, err := rsql.NewFilterBuilder().Eq("eventType", report.EventType).Eq("eventVersion", report.FromVersion).Build()
+	if err != nil {
+		return err
+	}
+	req := &daprclient.GetEventsRequest{
+		TenantId:      opts.TenantId,
+		AggregateType: opts.AggregateType,
+		Filter:        filter,
+		Sort:          "eventTime:desc,aggregateId:asc,sequenceNumber:desc",
+		PageSize:      sampleSize,
+	}
+	resp, err := GetEvents(ctx, req, NewApplyCommandOptions().SetEventStorageKey(opts.EventStorageKey))
+	if err != nil {
+		return err
+	}
+	for _, e := range resp.Data {
+		report.CheckedRecords++
+		record := &daprclient.EventRecord{
+			EventId:      e.EventId,
+			EventData:    e.EventData,
+			EventType:    e.EventType,
+			EventVersion: e.EventVersion,
+		}
+		if err = decodeEventRecord(ctx, record, report.ToVersion, item); err != nil {
+			report.RecordErrors = append(report.RecordErrors, &EventRecordDecodeError{
+				EventId:      e.EventId,
+				AggregateId:  e.AggregateId,
+				EventVersion: e.EventVersion,
+				Error:        err.Error(),
+			})
+		}
+	}
+	return nil
+}
+
+func decodeEventRecord(ctx context.Context, record *daprclient.EventRecord, toVersion string, item *registryItem) error {
+	record, err := upcastEventRecordTo(record, toVersion)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record.EventData)
+	if err != nil {
+		return err
+	}
+	event := item.newFunc()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(event); err != nil {
+		return err
+	}
+	if reflect.Indirect(reflect.ValueOf(event)).Kind() != reflect.Struct {
+		return nil
+	}
+	return validateutils.Struct(ctx, event)
+}
+
+//
+// CompareJsonSchemas
+// @Description: 比较两个 JSON Schema，删除(或改名)字段、修改类型、新增 validate required 为不兼容变化
+// @param from 原结构
+// @param to 新结构
+// @return []*SchemaChange 按路径排序
+//
+func CompareJsonSchemas(from, to *JsonSchema) []*SchemaChange {
+	changes := make([]*SchemaChange, 0)
+	compareJsonSchema("", from, to, &changes)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func compareJsonSchema(path string, from, to *JsonSchema, changes *[]*SchemaChange) {
+	if from == nil || to == nil {
+		return
+	}
+	oldType, newType := getJsonSchemaTypeName(from), getJsonSchemaTypeName(to)
+	if oldType != newType {
+		// 新类型为任意值，或整数变为浮点数时可以兼容
+		compatible := to.Type == "" || (from.Type == "integer" && to.Type == "number")
+		*changes = append(*changes, &SchemaChange{
+			Kind:     SchemaChangeTypeChanged,
+			Path:     path,
+			OldType:  oldType,
+			NewType:  newType,
+			Breaking: !compatible,
+			Message:  fmt.Sprintf("type changed from %s to %s", oldType, newType),
+		})
+		if from.Type != to.Type {
+			return
+		}
+	}
+	switch to.Type {
+	case "array":
+		compareJsonSchema(path+"[]", from.Items, to.Items, changes)
+	case "object":
+		compareJsonSchema(path+"{}", from.AdditionalProperties, to.AdditionalProperties, changes)
+		for name, oldProperty := range from.Properties {
+			if _, ok := to.Properties[name]; !ok {
+				*changes = append(*changes, &SchemaChange{
+					Kind:     SchemaChangeFieldRemoved,
+					Path:     joinSchemaPath(path, name),
+					OldType:  getJsonSchemaTypeName(oldProperty),
+					Breaking: true,
+					Message:  "field removed or renamed",
+				})
+			}
+		}
+		for name, newProperty := range to.Properties {
+			fieldPath := joinSchemaPath(path, name)
+			oldProperty, ok := from.Properties[name]
+			if !ok {
+				required := isValidateRequired(newProperty.Validate)
+				change := &SchemaChange{
+					Kind:     SchemaChangeFieldAdded,
+					Path:     fieldPath,
+					NewType:  getJsonSchemaTypeName(newProperty),
+					Breaking: required,
+					Message:  "field added",
+				}
+				if required {
+					change.Kind = SchemaChangeRequiredAdded
+					change.Message = "required field added"
+				}
+				*changes = append(*changes, change)
+				continue
+			}
+			if isValidateRequired(newProperty.Validate) && !isValidateRequired(oldProperty.Validate) {
+				*changes = append(*changes, &SchemaChange{
+					Kind:     SchemaChangeRequiredAdded,
+					Path:     fieldPath,
+					Breaking: true,
+					Message:  "field becomes required",
+				})
+			}
+			compareJsonSchema(fieldPath, oldProperty, newProperty, changes)
+		}
+	}
+}
+
+func getEventSchema(eventType, version string) (*JsonSchema, error) {
+	item, err := getRegistryItem(eventType, version)
+	if err != nil {
+		return nil, err
+	}
+	event := item.newFunc()
+	if event == nil {
+		return &JsonSchema{}, nil
+	}
+	return NewJsonSchema(reflect.TypeOf(event)), nil
+}
+
+func getLatestEventVersion(eventType string) string {
+	latest := ""
+	if ts, ok := _eventTypeRegistry.typeMap[eventType]; ok {
+		for version := range ts.versionMap {
+			if latest == "" || CompareEventVersion(version, latest) > 0 {
+				latest = version
+			}
+		}
+	}
+	return latest
+}
+
+//
+// CompareEventVersion
+// @Description: 按数字比较 v1.0、v1.10 格式的版本号
+//
+func CompareEventVersion(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(strings.ToLower(a), "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(strings.ToLower(b), "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func getJsonSchemaTypeName(s *JsonSchema) string {
+	switch {
+	case s.Type == "":
+		return "any"
+	case s.Format != "":
+		return s.Type + "(" + s.Format + ")"
+	case s.ContentEncoding != "":
+		return s.Type + "(" + s.ContentEncoding + ")"
+	}
+	return s.Type
+}
+
+func isValidateRequired(tag string) bool {
+	for _, item := range strings.Split(tag, ",") {
+		if item == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+func joinSchemaPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
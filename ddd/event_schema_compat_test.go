@@ -0,0 +1,203 @@
+package ddd
+
+import (
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"testing"
+)
+
+type compatEventV1 struct {
+	Id     string         `json:"id"`
+	Name   string         `json:"name"`
+	Age    int            `json:"age"`
+	Score  int            `json:"score"`
+	Remark string         `json:"remark"`
+	Data   compatDataV1   `json:"data"`
+	Tags   []string       `json:"tags"`
+	Extra  map[string]int `json:"extra"`
+}
+
+type compatDataV1 struct {
+	Code string `json:"code"`
+}
+
+type compatEventV2 struct {
+	Id       string             `json:"id" validate:"required"`
+	Name     string             `json:"name"`
+	Age      string             `json:"age"`
+	Score    float64            `json:"score"`
+	Data     compatDataV2       `json:"data"`
+	Tags     []int              `json:"tags"`
+	Extra    map[string]float64 `json:"extra"`
+	Email    string             `json:"email,omitempty"`
+	Category string             `json:"category" validate:"required"`
+}
+
+type compatDataV2 struct {
+	Code  string `json:"code"`
+	Title string `json:"title"`
+}
+
+func TestCompareJsonSchemas(t *testing.T) {
+	_ = RegisterEventType("test.CompatEvent", "v1.0", func() interface{} { return &compatEventV1{} })
+	_ = RegisterEventType("test.CompatEvent", "v2.0", func() interface{} { return &compatEventV2{} })
+
+	if v := getLatestEventVersion("test.CompatEvent"); v != "v2.0" {
+		t.Errorf("latest version = %s", v)
+	}
+	report, err := CheckEventSchemaCompatibility("test.CompatEvent", "v1.0", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ToVersion != "v2.0" || !report.IsBreaking() {
+		t.Errorf("report = %+v", report)
+	}
+
+	want := map[string]struct {
+		kind     SchemaChangeKind
+		breaking bool
+	}{
+		"age":        {SchemaChangeTypeChanged, true},
+		"category":   {SchemaChangeRequiredAdded, true},
+		"data.title": {SchemaChangeFieldAdded, false},
+		"email":      {SchemaChangeFieldAdded, false},
+		"extra{}":    {SchemaChangeTypeChanged, false},
+		"id":         {SchemaChangeRequiredAdded, true},
+		"remark":     {SchemaChangeFieldRemoved, true},
+		"score":      {SchemaChangeTypeChanged, false},
+		"tags[]":     {SchemaChangeTypeChanged, true},
+	}
+	if len(report.Changes) != len(want) {
+		t.Errorf("changes = %d, want %d", len(report.Changes), len(want))
+	}
+	for _, c := range report.Changes {
+		w, ok := want[c.Path]
+		if !ok || w.kind != c.Kind || w.breaking != c.Breaking {
+			t.Errorf("unexpected change %+v", c)
+		}
+	}
+
+	if _, err = CheckEventSchemaCompatibility("test.CompatEvent", "v0.1", ""); err == nil {
+		t.Error("unregistered version should return error")
+	}
+}
+
+func TestCheckEventRecordsCompatibility(t *testing.T) {
+	ctx := context.Background()
+	storage := newMemoryStorage(t)
+	_ = RegisterEventType("test.CompatRecordEvent", "v1.0", func() interface{} { return &compatRecordEventV1{} })
+	_ = RegisterEventType("test.CompatRecordEvent", "v2.0", func() interface{} { return &compatRecordEventV2{} })
+
+	for i, data := range []map[string]interface{}{
+		{"id": "1", "name": "a"},
+		{"id": "2", "name": "b", "remark": "removed in v2"},
+		{"id": "", "name": "c"},
+	} {
+		_, err := storage.CreateEvent(ctx, &daprclient.CreateEventRequest{
+			TenantId:      "tenant-1",
+			AggregateId:   data["name"].(string),
+			AggregateType: memAggregateType,
+			Events: []*daprclient.EventDto{{
+				EventId:      string(rune('a' + i)),
+				CommandId:    "cmd-" + data["name"].(string),
+				EventData:    data,
+				EventType:    "test.CompatRecordEvent",
+				EventVersion: "v1.0",
+			}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := CheckEventSchemaCompatibility("test.CompatRecordEvent", "v1.0", "v2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &CheckEventRecordsOptions{TenantId: "tenant-1", AggregateType: memAggregateType}
+	if err = CheckEventRecordsCompatibility(ctx, report, opts); err != nil {
+		t.Fatal(err)
+	}
+	// remark 字段已删除、id 为空时无法通过验证，按事件时间倒序抽样
+	if report.CheckedRecords != 3 || len(report.RecordErrors) != 2 {
+		t.Fatalf("checked = %d, errors = %+v", report.CheckedRecords, report.RecordErrors)
+	}
+	if report.RecordErrors[0].EventId != "c" || report.RecordErrors[1].EventId != "b" {
+		t.Errorf("errors = %+v, %+v", report.RecordErrors[0], report.RecordErrors[1])
+	}
+
+	// 只抽样最新写入的记录
+	report, _ = CheckEventSchemaCompatibility("test.CompatRecordEvent", "v1.0", "v2.0")
+	opts.SampleSize = 1
+	if err = CheckEventRecordsCompatibility(ctx, report, opts); err != nil {
+		t.Fatal(err)
+	}
+	if report.CheckedRecords != 1 || len(report.RecordErrors) != 1 || report.RecordErrors[0].EventId != "c" {
+		t.Errorf("checked = %d, errors = %+v", report.CheckedRecords, report.RecordErrors)
+	}
+}
+
+func TestCheckEventRecordsCompatibility_UpcastToVersion(t *testing.T) {
+	ctx := context.Background()
+	storage := newMemoryStorage(t)
+	_ = RegisterEventType("test.CompatUpcastEvent", "v1.0", func() interface{} { return &compatRecordEventV1{} })
+	_ = RegisterEventType("test.CompatUpcastEvent", "v2.0", func() interface{} { return &compatRecordEventV2{} })
+	_ = RegisterEventType("test.CompatUpcastEvent", "v3.0", func() interface{} { return &compatUpcastEventV3{} })
+	_ = RegisterEventUpcaster("test.CompatUpcastEvent", "v1.0", "v2.0", func(data map[string]any) (map[string]any, error) {
+		delete(data, "remark")
+		return data, nil
+	})
+	_ = RegisterEventUpcaster("test.CompatUpcastEvent", "v2.0", "v3.0", func(data map[string]any) (map[string]any, error) {
+		return map[string]any{"id": data["id"], "title": data["name"]}, nil
+	})
+
+	_, err := storage.CreateEvent(ctx, &daprclient.CreateEventRequest{
+		TenantId:      "tenant-1",
+		AggregateId:   "agg-1",
+		AggregateType: memAggregateType,
+		Events: []*daprclient.EventDto{{
+			EventId:      "e-1",
+			CommandId:    "cmd-1",
+			EventData:    map[string]interface{}{"id": "1", "name": "a", "remark": "removed in v2"},
+			EventType:    "test.CompatUpcastEvent",
+			EventVersion: "v1.0",
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 升级到 v2.0 为止，解析为 v2.0 事件；升级到 v3.0 的数据没有 name 字段
+	report, err := CheckEventSchemaCompatibility("test.CompatUpcastEvent", "v1.0", "v2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = CheckEventRecordsCompatibility(ctx, report, &CheckEventRecordsOptions{TenantId: "tenant-1", AggregateType: memAggregateType}); err != nil {
+		t.Fatal(err)
+	}
+	if report.CheckedRecords != 1 || len(report.RecordErrors) != 0 {
+		t.Errorf("checked = %d, errors = %+v", report.CheckedRecords, report.RecordErrors)
+	}
+}
+
+type compatRecordEventV1 struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Remark string `json:"remark,omitempty"`
+}
+
+type compatRecordEventV2 struct {
+	Id   string `json:"id" validate:"required"`
+	Name string `json:"name"`
+}
+
+func TestCompareEventVersion(t *testing.T) {
+	if CompareEventVersion("v1.10", "v1.9") <= 0 || CompareEventVersion("v1.0", "v2.0") >= 0 || CompareEventVersion("v1.0", "v1.0") != 0 {
+		t.Error("CompareEventVersion error")
+	}
+}
+
+type compatUpcastEventV3 struct {
+	Id    string `json:"id" validate:"required"`
+	Title string `json:"title"`
+}
@@ -0,0 +1,107 @@
+package ddd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type schemaEvent struct {
+	memEventBase
+	EventId  int64               `json:"eventId"`
+	Data     schemaEventData     `json:"data"`
+	Tags     []string            `json:"tags,omitempty"`
+	Labels   map[string]int      `json:"labels,omitempty"`
+	Raw      []byte              `json:"raw,omitempty"`
+	Any      interface{}         `json:"any,omitempty"`
+	Children []*schemaEventChild `json:"children,omitempty"`
+	Ignored  string              `json:"-"`
+	private  string
+}
+
+type schemaEventData struct {
+	Name   string     `json:"name" description:"名称"`
+	Amount float64    `json:"amount"`
+	Count  *uint64    `json:"count,omitempty"`
+	Active bool       `json:"active"`
+	Time   *time.Time `json:"time,omitempty"`
+}
+
+type schemaEventChild struct {
+	Name     string              `json:"name"`
+	Children []*schemaEventChild `json:"children,omitempty"`
+}
+
+func TestNewJsonSchema(t *testing.T) {
+	schema := NewJsonSchema(reflect.TypeOf(&schemaEvent{}))
+	if schema.Type != "object" {
+		t.Fatalf("type = %s", schema.Type)
+	}
+	for _, name := range []string{"tenantId", "commandId", "eventId", "createdTime", "data", "tags", "labels", "raw", "any", "children"} {
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("property %s not found", name)
+		}
+	}
+	for _, name := range []string{"Ignored", "private"} {
+		if _, ok := schema.Properties[name]; ok {
+			t.Errorf("property %s should be skipped", name)
+		}
+	}
+	if !reflect.DeepEqual(schema.Required, []string{"aggregateId", "commandId", "createdTime", "data", "eventId", "tenantId"}) {
+		t.Errorf("required = %v", schema.Required)
+	}
+	// 外层字段优先于嵌入结构体中的同名字段
+	if p := schema.Properties["eventId"]; p.Type != "integer" {
+		t.Errorf("eventId = %+v", p)
+	}
+	if p := schema.Properties["createdTime"]; p.Type != "string" || p.Format != "date-time" {
+		t.Errorf("createdTime = %+v", p)
+	}
+	if p := schema.Properties["tags"]; p.Type != "array" || p.Items.Type != "string" {
+		t.Errorf("tags = %+v", p)
+	}
+	if p := schema.Properties["labels"]; p.Type != "object" || p.AdditionalProperties.Type != "integer" {
+		t.Errorf("labels = %+v", p)
+	}
+	if p := schema.Properties["raw"]; p.Type != "string" || p.ContentEncoding != "base64" {
+		t.Errorf("raw = %+v", p)
+	}
+	if p := schema.Properties["any"]; p.Type != "" {
+		t.Errorf("any = %+v", p)
+	}
+
+	data := schema.Properties["data"]
+	if data.Properties["name"].Description != "名称" || data.Properties["amount"].Type != "number" ||
+		data.Properties["count"].Type != "integer" || data.Properties["active"].Type != "boolean" {
+		t.Errorf("data = %+v", data.Properties)
+	}
+
+	// 递归类型只展开一层
+	child := schema.Properties["children"].Items
+	if child.Properties["children"].Items.Type != "object" || child.Properties["children"].Items.Properties != nil {
+		t.Errorf("children = %+v", child.Properties["children"].Items)
+	}
+}
+
+func TestGetEventTypeSchemas(t *testing.T) {
+	newMemoryStorage(t)
+	var found *EventTypeSchema
+	schemas := GetEventTypeSchemas()
+	for i, item := range schemas {
+		if i > 0 && schemas[i-1].EventType > item.EventType {
+			t.Errorf("schemas are not sorted")
+		}
+		if item.EventType == "test.MemCreatedEvent" && item.EventVersion == "v1.0" {
+			found = item
+		}
+	}
+	if found == nil {
+		t.Fatal("test.MemCreatedEvent not found")
+	}
+	if found.Schema.Schema != JsonSchemaDraft || found.Schema.Title != "test.MemCreatedEvent" {
+		t.Errorf("schema = %+v", found.Schema)
+	}
+	if p := found.Schema.Properties["data"]; p == nil || p.Properties["userId"] == nil {
+		t.Errorf("data = %+v", p)
+	}
+}
@@ -23,6 +23,29 @@ type EventStorage interface {
 	GetPubsubName() string
 }
 
+//
+// sequenceNumberSupporter
+// @Description: 事件存储器可选实现，返回 false 表示加载的事件没有序号，依赖事件序号的功能不可用
+//
+type sequenceNumberSupporter interface {
+	SupportsSequenceNumber() bool
+}
+
+//
+// supportsSequenceNumber
+// @Description: 事件存储器是否返回事件序号，未实现 sequenceNumberSupporter 时视为支持
+//
+func supportsSequenceNumber(eventStorageKey string) bool {
+	eventStorage, err := GetEventStorage(eventStorageKey)
+	if err != nil {
+		return false
+	}
+	if s, ok := eventStorage.(sequenceNumberSupporter); ok {
+		return s.SupportsSequenceNumber()
+	}
+	return true
+}
+
 var snapshotEventsMinCount = 20
 
 type CallEventType int
@@ -37,8 +60,14 @@ type EventStorageOption func(EventStorage)
 
 func PubsubName(pubsubName string) EventStorageOption {
 	return func(es EventStorage) {
-		s, _ := es.(*grpcEventStorage)
-		s.pubsubName = pubsubName
+		switch s := es.(type) {
+		case *grpcEventStorage:
+			s.pubsubName = pubsubName
+		case *httpEventStorage:
+			s.pubsubName = pubsubName
+		case *memoryEventStorage:
+			s.pubsubName = pubsubName
+		}
 	}
 }
 
@@ -69,13 +98,18 @@ func checkEvent(aggregate Aggregate, event DomainEvent) error {
 
 //
 // CallEventHandler
-// @Description: 调用领域事件监听器
+// @Description: 调用领域事件监听器，旧版本事件会先通过升级函数转换为最新版本
 // @param ctx
 // @param handler
 // @param record
 // @return error
 //
 func CallEventHandler(ctx context.Context, handler interface{}, record *daprclient.EventRecord) error {
+	record, err := upcastEventRecord(record)
+	if err != nil {
+		_, _ = applog.Error("", "ddd", "CallEventHandler", err.Error())
+		return err
+	}
 	event, err := NewDomainEvent(record)
 	if err != nil {
 		_, _ = applog.Error("", "ddd", "NewDomainEvent", err.Error())
@@ -89,6 +123,9 @@ func CallEventHandler(ctx context.Context, handler interface{}, record *daprclie
 
 func callEventHandler(ctx context.Context, handler interface{}, eventType string, eventRevision string, event interface{}) error {
 	methodName := getEventMethodName(eventType, eventRevision)
+	if ok, err := dispatchEvent(ctx, handler, methodName, event); ok {
+		return err
+	}
 	return CallMethod(handler, methodName, ctx, event)
 }
 
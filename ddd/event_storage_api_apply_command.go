@@ -14,6 +14,7 @@ type CreateAggregateOptions struct {
 
 type ApplyCommandOptions struct {
 	EventStorageKey string
+	RetryCount      int // 发生并发冲突时，重新加载聚合并执行命令的次数
 }
 
 func NewApplyCommandOptions() *ApplyCommandOptions {
@@ -27,6 +28,9 @@ func (o *ApplyCommandOptions) Merge(opts ...*ApplyCommandOptions) *ApplyCommandO
 		if len(item.EventStorageKey) != 0 {
 			o.EventStorageKey = item.EventStorageKey
 		}
+		if item.RetryCount > 0 {
+			o.RetryCount = item.RetryCount
+		}
 	}
 	return o
 }
@@ -36,9 +40,14 @@ func (o *ApplyCommandOptions) SetEventStorageKey(v string) *ApplyCommandOptions
 	return o
 }
 
+func (o *ApplyCommandOptions) SetRetryCount(v int) *ApplyCommandOptions {
+	o.RetryCount = v
+	return o
+}
+
 //
 // ApplyCommand
-// @Description: 执行聚合命令
+// @Description: 执行聚合命令，经过命令总线的拦截器链
 // @param ctx
 // @param aggregate
 // @param cmd
@@ -54,30 +63,115 @@ func ApplyCommand(ctx context.Context, agg Aggregate, cmd Command, opts ...*Appl
 	}
 	opt := NewApplyCommandOptions()
 	opt.Merge(opts...)
+	ctx = newCommandCorrelationContext(ctx, cmd)
+	return GetCommandBus().Invoke(ctx, cmd, func(ctx context.Context, cmd Command) error {
+		return applyCommand(ctx, agg, cmd, opt)
+	})
+}
+
+//
+// applyCommand
+// @Description: 执行命令，设置了命令幂等存储器时，已成功执行的命令不再重复执行
+//
+func applyCommand(ctx context.Context, agg Aggregate, cmd Command, opt *ApplyCommandOptions) error {
+	store := GetCommandIdempotencyStore()
+	if store == nil || cmd.GetCommandId() == "" || cmd.GetIsValidOnly() {
+		return executeCommand(ctx, agg, cmd, opt)
+	}
+	return applyIdempotentCommand(ctx, store, agg, cmd, opt)
+}
 
+//
+// executeCommand
+// @Description: 加载聚合并调用命令处理方法，发生并发冲突时按 RetryCount 重试
+//
+func executeCommand(ctx context.Context, agg Aggregate, cmd Command, opt *ApplyCommandOptions) error {
 	if _, ok := cmd.(IsAggregateCreateCommand); ok {
 		return callCommandHandler(ctx, agg, cmd)
 	}
 
-	loadOpt := NewLoadAggregateOptions().SetEventStorageKey(opt.EventStorageKey)
+	ctx = newAggregateSequenceContext(ctx)
+	cache := GetAggregateCache()
+	if cache != nil && !supportsSequenceNumber(opt.EventStorageKey) {
+		// 事件没有序号时不能只加载缓存之后的事件
+		cache = nil
+	}
+	tenantId := cmd.GetTenantId()
 	aggId := cmd.GetAggregateId().RootId()
-	_, find, err := LoadAggregate(ctx, cmd.GetTenantId(), aggId, agg, loadOpt)
-	if err != nil {
-		return err
+	for i := 0; ; i++ {
+		find, err := loadCommandAggregate(ctx, cache, tenantId, aggId, agg, opt.EventStorageKey)
+		if err != nil {
+			return err
+		}
+		if !find {
+			return errors.NewAggregateIdNotFondError(aggId)
+		}
+		err = callCommandHandler(ctx, agg, cmd)
+		if cache != nil {
+			if err == nil {
+				sequenceNumber, _ := GetAggregateSequenceNumber(ctx, tenantId, aggId)
+				_ = cache.Put(tenantId, agg.GetAggregateType(), aggId, agg, sequenceNumber)
+			} else {
+				cache.Remove(tenantId, agg.GetAggregateType(), aggId)
+			}
+		}
+		if i >= opt.RetryCount || !errors.IsErrorConcurrencyConflict(err) {
+			return err
+		}
+		resetAggregate(agg)
 	}
-	if !find {
-		return errors.NewAggregateIdNotFondError(aggId)
+}
+
+func loadCommandAggregate(ctx context.Context, cache *AggregateCache, tenantId, aggregateId string, agg Aggregate, eventStorageKey string) (bool, error) {
+	if cache != nil {
+		return cache.loadAggregate(ctx, tenantId, aggregateId, agg, eventStorageKey)
 	}
-	return callCommandHandler(ctx, agg, cmd)
+	_, find, err := LoadAggregate(ctx, tenantId, aggregateId, agg, NewLoadAggregateOptions().SetEventStorageKey(eventStorageKey))
+	return find, err
+}
+
+//
+// resetAggregate
+// @Description: 将聚合根恢复为新建状态，以便重新加载。聚合类型已通过 RegisterAggregateType 注册时复制 NewAggregate 的新实例，
+// 保留构造方法中设置的 map、默认值等；未注册时恢复为零值。
+// @param agg 聚合根
+//
+func resetAggregate(agg Aggregate) {
+	v := reflect.ValueOf(agg)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	if fresh, err := NewAggregate(agg.GetAggregateType()); err == nil {
+		if fv := reflect.ValueOf(fresh); fv.Kind() == reflect.Ptr && !fv.IsNil() && fv.Type() == v.Type() {
+			v.Elem().Set(fv.Elem())
+			return
+		}
+	}
+	v.Elem().Set(reflect.Zero(v.Elem().Type()))
 }
 
 func (o *CreateAggregateOptions) SetEventStorageKey(eventStorageKey string) {
 	o.eventStorageKey = &eventStorageKey
 }
 
+//
+// CallCommandHandler
+// @Description: 直接调用聚合的命令处理方法，不加载聚合
+// @param ctx
+// @param aggregate
+// @param cmd
+// @return error
+//
+func CallCommandHandler(ctx context.Context, aggregate Aggregate, cmd Command) error {
+	return callCommandHandler(ctx, aggregate, cmd)
+}
+
 func callCommandHandler(ctx context.Context, aggregate Aggregate, cmd Command) error {
 	cmdTypeName := reflect.ValueOf(cmd).Elem().Type().Name()
 	methodName := fmt.Sprintf("%s", cmdTypeName)
 	metadata := ddd_context.GetMetadataContext(ctx)
+	if ok, err := dispatchCommand(ctx, aggregate, methodName, cmd, metadata); ok {
+		return err
+	}
 	return CallMethod(aggregate, methodName, ctx, cmd, metadata)
 }
@@ -2,19 +2,45 @@ package ddd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/liuxd6825/dapr-go-ddd-sdk/applog"
 	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd/ddd_context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"reflect"
+	"strconv"
 )
 
 type ApplyEventOptions struct {
 	pubsubName      *string
 	metadata        *map[string]string
 	eventStorageKey *string
+	// 期望的聚合当前事件序号，为空时取 LoadAggregate 时记录的序号
+	expectedSequenceNumber *uint64
 }
 
 func ApplyEvent(ctx context.Context, aggregate Aggregate, event DomainEvent, opts ...*ApplyEventOptions) (*daprclient.ApplyEventResponse, error) {
-	res, err := callDaprEventMethod(ctx, EventApply, aggregate, event, opts...)
+	res, err := callDaprEventMethod(ctx, EventApply, aggregate, []DomainEvent{event}, false, opts...)
+	if resp, ok := res.(*daprclient.ApplyEventResponse); ok {
+		return resp, err
+	}
+	return nil, err
+}
+
+//
+// ApplyEvents
+// @Description: 在一次请求中原子地应用多个领域事件。按顺序调用聚合的事件处理方法，全部成功后一次写入事件存储器，
+// 事件处理方法出错或事件存储器拒绝时，聚合恢复为调用前的状态。
+// @param ctx
+// @param aggregate 聚合根
+// @param events 领域事件，必须属于同一个聚合根
+// @param opts
+// @return *daprclient.ApplyEventResponse
+// @return error
+//
+func ApplyEvents(ctx context.Context, aggregate Aggregate, events []DomainEvent, opts ...*ApplyEventOptions) (*daprclient.ApplyEventResponse, error) {
+	res, err := callDaprEventMethod(ctx, EventApply, aggregate, events, true, opts...)
 	if resp, ok := res.(*daprclient.ApplyEventResponse); ok {
 		return resp, err
 	}
@@ -22,7 +48,7 @@ func ApplyEvent(ctx context.Context, aggregate Aggregate, event DomainEvent, opt
 }
 
 func CreateEvent(ctx context.Context, aggregate Aggregate, event DomainEvent, opts ...*ApplyEventOptions) (*daprclient.CreateEventResponse, error) {
-	res, err := callDaprEventMethod(ctx, EventCreate, aggregate, event, opts...)
+	res, err := callDaprEventMethod(ctx, EventCreate, aggregate, []DomainEvent{event}, false, opts...)
 	if resp, ok := res.(*daprclient.CreateEventResponse); ok {
 		return resp, err
 	}
@@ -30,7 +56,7 @@ func CreateEvent(ctx context.Context, aggregate Aggregate, event DomainEvent, op
 }
 
 func DeleteEvent(ctx context.Context, aggregate Aggregate, event DomainEvent, opts ...*ApplyEventOptions) (*daprclient.DeleteEventResponse, error) {
-	res, err := callDaprEventMethod(ctx, EventDelete, aggregate, event, opts...)
+	res, err := callDaprEventMethod(ctx, EventDelete, aggregate, []DomainEvent{event}, false, opts...)
 	if resp, ok := res.(*daprclient.DeleteEventResponse); ok {
 		return resp, err
 	}
@@ -39,20 +65,26 @@ func DeleteEvent(ctx context.Context, aggregate Aggregate, event DomainEvent, op
 
 //
 // callDaprEventMethod
-// @Description: 应用领域事件
+// @Description: 应用领域事件。默认先写入事件存储器，成功后再调用聚合的事件处理方法；
+// atomic 为 true 时先调用聚合的事件处理方法，再写入事件存储器，任一步骤失败时恢复聚合状态
 // @param ctx
 // @param aggregate
-// @param event
+// @param events
+// @param atomic 是否先调用事件处理方法，失败时恢复聚合状态
 // @param options
 // @return err
 //
-func callDaprEventMethod(ctx context.Context, callEventType CallEventType, aggregate Aggregate, event DomainEvent, opts ...*ApplyEventOptions) (any, error) {
-	if err := checkEvent(aggregate, event); err != nil {
+func callDaprEventMethod(ctx context.Context, callEventType CallEventType, aggregate Aggregate, events []DomainEvent, atomic bool, opts ...*ApplyEventOptions) (any, error) {
+	if err := checkEvents(callEventType, aggregate, events); err != nil {
 		return nil, err
 	}
 
-	tenantId := event.GetTenantId()
-	aggId := event.GetAggregateId()
+	if capture := getEventCapture(ctx); capture != nil {
+		return capture.captureEvents(ctx, callEventType, aggregate, events)
+	}
+
+	tenantId := events[0].GetTenantId()
+	aggId := events[0].GetAggregateId()
 	aggType := aggregate.GetAggregateType()
 
 	metadata := make(map[string]string)
@@ -71,6 +103,9 @@ func callDaprEventMethod(ctx context.Context, callEventType CallEventType, aggre
 		if opt.pubsubName != nil {
 			options.pubsubName = opt.pubsubName
 		}
+		if opt.expectedSequenceNumber != nil {
+			options.expectedSequenceNumber = opt.expectedSequenceNumber
+		}
 	}
 
 	logInfo := &applog.LogInfo{
@@ -89,55 +124,232 @@ func callDaprEventMethod(ctx context.Context, callEventType CallEventType, aggre
 		if err != nil {
 			return nil, err
 		}
-		relation, _, err := GetRelationByStructure(event.GetData())
-		if err != nil {
-			return nil, err
+		applyEvents := make([]*daprclient.EventDto, 0, len(events))
+		for _, event := range events {
+			relationValues, _, err := GetRelationValues(event.GetData())
+			if err != nil {
+				return nil, err
+			}
+			applyEvents = append(applyEvents, &daprclient.EventDto{
+				CommandId:      event.GetCommandId(),
+				EventId:        event.GetEventId(),
+				EventVersion:   event.GetEventVersion(),
+				EventType:      event.GetEventType(),
+				Metadata:       newEventMetadata(ctx, *options.metadata),
+				PubsubName:     *options.pubsubName,
+				EventData:      event,
+				Relations:      relationValues.ToRelation(),
+				RelationValues: relationValues,
+				Topic:          event.GetEventType(),
+			})
 		}
-		applyEvents := []*daprclient.EventDto{
-			{
-				CommandId:    event.GetCommandId(),
-				EventId:      event.GetEventId(),
-				EventVersion: event.GetEventVersion(),
-				EventType:    event.GetEventType(),
-				Metadata:     *options.metadata,
-				PubsubName:   *options.pubsubName,
-				EventData:    event,
-				Relations:    relation,
-				Topic:        event.GetEventType(),
-			},
+
+		restore := func() {}
+		if atomic {
+			if restore, err = backupAggregate(aggregate); err != nil {
+				return nil, err
+			}
+			if err = callEventHandlers(ctx, aggregate, events); err != nil {
+				restore()
+				return nil, err
+			}
 		}
 		if callEventType == EventCreate {
+			setEventsSequenceNumber(*options.eventStorageKey, applyEvents, 0)
 			res, err = createEvent(ctx, eventStorage, tenantId, aggId, aggType, applyEvents)
 		} else if callEventType == EventApply {
-			res, err = applyEvent(ctx, eventStorage, tenantId, aggId, aggType, applyEvents)
+			expectedSequenceNumber, _ := GetAggregateSequenceNumber(ctx, tenantId, aggId)
+			if options.expectedSequenceNumber != nil {
+				expectedSequenceNumber = *options.expectedSequenceNumber
+			}
+			if expectedSequenceNumber > 0 {
+				setEventsSequenceNumber(*options.eventStorageKey, applyEvents, expectedSequenceNumber)
+			}
+			res, err = applyEvent(ctx, eventStorage, tenantId, aggId, aggType, expectedSequenceNumber, applyEvents)
 		} else if callEventType == EventDelete {
 			res, err = deleteEvent(ctx, eventStorage, tenantId, aggId, aggType, applyEvents[0])
 		}
 		if err != nil {
+			restore()
 			return nil, err
 		}
-		if err = callEventHandler(ctx, aggregate, event.GetEventType(), event.GetEventVersion(), event); err != nil {
-			return nil, err
+		if sequence := getAggregateSequence(ctx); sequence != nil {
+			if sequenceNumber := getResponseSequenceNumber(res); sequenceNumber > 0 {
+				sequence.set(tenantId, aggId, sequenceNumber)
+			} else if callEventType == EventCreate {
+				sequence.set(tenantId, aggId, uint64(len(applyEvents)))
+			} else {
+				sequence.add(tenantId, aggId, len(applyEvents))
+			}
+		}
+		if !atomic {
+			if err = callEventHandlers(ctx, aggregate, events); err != nil {
+				return nil, err
+			}
 		}
 		return res, nil
 	})
 
-	go func() {
-		_ = callActorSaveSnapshot(ctx, tenantId, aggId, aggType)
-	}()
+	if err == nil {
+		sequenceNumber := getResponseSequenceNumber(res)
+		if sequenceNumber == 0 {
+			sequenceNumber, _ = GetAggregateSequenceNumber(ctx, tenantId, aggId)
+		}
+		policyCtx := &SnapshotPolicyContext{
+			TenantId:       tenantId,
+			AggregateId:    aggId,
+			AggregateType:  aggType,
+			SequenceNumber: sequenceNumber,
+			EventCount:     len(events),
+			EventDataSize:  getEventDataSize(events),
+		}
+		if GetSnapshotPolicy(aggType).ShouldSnapshot(policyCtx) {
+			if snapshotter := GetSnapshotter(); snapshotter != nil {
+				snapshotter.Submit(ctx, tenantId, aggId, aggType)
+			}
+		}
+	}
 
 	return res, err
 }
 
-func applyEvent(ctx context.Context, eventStorage EventStorage, tenantId, aggregateId, aggregateType string, events []*daprclient.EventDto) (*daprclient.ApplyEventResponse, error) {
+//
+// setEventsSequenceNumber
+// @Description: 在事件 Metadata 中写入事件序号，随事件发布，供订阅端的读模型检查点使用。
+// 事件存储器按期望序号检查并发时，写入成功的事件序号即为期望序号之后的连续序号；不支持事件序号的事件存储器不写入
+// @param eventStorageKey 事件存储器名称
+// @param events 事件
+// @param expectedSequenceNumber 聚合当前的事件序号，新建聚合时为0
+//
+func setEventsSequenceNumber(eventStorageKey string, events []*daprclient.EventDto, expectedSequenceNumber uint64) {
+	if !supportsSequenceNumber(eventStorageKey) {
+		return
+	}
+	for i, event := range events {
+		if event.Metadata == nil {
+			event.Metadata = make(map[string]string)
+		}
+		event.Metadata[MetadataSequenceNumber] = strconv.FormatUint(expectedSequenceNumber+uint64(i)+1, 10)
+	}
+}
+
+//
+// getResponseSequenceNumber
+// @Description: 获取事件存储器返回的聚合最后事件序号，未返回时为0
+//
+func getResponseSequenceNumber(res any) uint64 {
+	switch resp := res.(type) {
+	case *daprclient.ApplyEventResponse:
+		if resp != nil {
+			return resp.SequenceNumber
+		}
+	case *daprclient.CreateEventResponse:
+		if resp != nil {
+			return resp.SequenceNumber
+		}
+	case *daprclient.DeleteEventResponse:
+		if resp != nil {
+			return resp.SequenceNumber
+		}
+	}
+	return 0
+}
+
+func getEventDataSize(events []DomainEvent) int {
+	size := 0
+	for _, event := range events {
+		if bytes, err := json.Marshal(event); err == nil {
+			size += len(bytes)
+		}
+	}
+	return size
+}
+
+//
+// checkEvents
+// @Description: 检查领域事件，批量事件必须属于同一个聚合根
+//
+func checkEvents(callEventType CallEventType, aggregate Aggregate, events []DomainEvent) error {
+	if len(events) == 0 {
+		return errors.ErrorOf("events cannot be empty")
+	}
+	if _, ok := aggregate.(*ReadOnlyAggregate); ok {
+		return ErrReadOnlyAggregate
+	}
+	if callEventType == EventDelete && len(events) > 1 {
+		return errors.ErrorOf("delete event only supports one event")
+	}
+	for _, event := range events {
+		if err := checkEvent(aggregate, event); err != nil {
+			return err
+		}
+		if event.GetTenantId() != events[0].GetTenantId() || event.GetAggregateId() != events[0].GetAggregateId() {
+			return errors.ErrorOf("events must belong to the same aggregate, %s/%s != %s/%s",
+				event.GetTenantId(), event.GetAggregateId(), events[0].GetTenantId(), events[0].GetAggregateId())
+		}
+	}
+	return nil
+}
+
+//
+// callEventHandlers
+// @Description: 按顺序调用聚合的事件处理方法
+//
+func callEventHandlers(ctx context.Context, aggregate Aggregate, events []DomainEvent) error {
+	for _, event := range events {
+		if err := callEventHandler(ctx, aggregate, event.GetEventType(), event.GetEventVersion(), event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//
+// backupAggregate
+// @Description: 备份聚合状态，返回恢复函数。与快照、聚合缓存相同，按 JSON 深拷贝，
+// 事件处理方法修改 map、切片或指针字段后也能完整恢复；不参与 JSON 序列化的字段恢复为零值
+// @param aggregate 聚合根
+// @return func() 恢复聚合到备份时的状态
+// @return error 聚合不能序列化为 JSON
+//
+func backupAggregate(aggregate Aggregate) (func(), error) {
+	v := reflect.ValueOf(aggregate)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return func() {}, nil
+	}
+	data, err := json.Marshal(aggregate)
+	if err != nil {
+		return nil, errors.ErrorOf("backup aggregate %s error: %s", aggregate.GetAggregateType(), err.Error())
+	}
+	return func() {
+		backup := reflect.New(v.Elem().Type())
+		if err := json.Unmarshal(data, backup.Interface()); err != nil {
+			return
+		}
+		v.Elem().Set(backup.Elem())
+	}, nil
+}
+
+func applyEvent(ctx context.Context, eventStorage EventStorage, tenantId, aggregateId, aggregateType string, expectedSequenceNumber uint64, events []*daprclient.EventDto) (*daprclient.ApplyEventResponse, error) {
 	req := &daprclient.ApplyEventRequest{
-		TenantId:      tenantId,
-		AggregateId:   aggregateId,
-		AggregateType: aggregateType,
-		Events:        events,
+		TenantId:               tenantId,
+		AggregateId:            aggregateId,
+		AggregateType:          aggregateType,
+		Events:                 events,
+		ExpectedSequenceNumber: expectedSequenceNumber,
 	}
 	resp, err := eventStorage.ApplyEvent(ctx, req)
-	return resp, err
+	if err != nil {
+		return resp, err
+	}
+	if resp != nil && resp.Headers != nil && resp.Headers.Status == daprclient.ResponseStatusConcurrencyConflict {
+		var actual uint64
+		if v, ok := resp.Headers.Values["actualSequenceNumber"]; ok {
+			actual, _ = strconv.ParseUint(v, 10, 64)
+		}
+		return resp, errors.NewConcurrencyConflictError(aggregateId, expectedSequenceNumber, actual)
+	}
+	return resp, nil
 }
 
 func createEvent(ctx context.Context, eventStorage EventStorage, tenantId, aggregateId, aggregateType string, events []*daprclient.EventDto) (*daprclient.CreateEventResponse, error) {
@@ -172,7 +384,11 @@ func deleteEvent(ctx context.Context, eventStorage EventStorage, tenantId, aggre
 //  @return error
 //
 func callActorSaveSnapshot(ctx context.Context, tenantId, aggregateId, aggregateType string) error {
-	client, err := daprclient.GetDaprDDDClient().DaprClient()
+	daprDddClient := daprclient.GetDaprDDDClient()
+	if daprDddClient == nil {
+		return errors.ErrorOf("daprclient.GetDaprDDDClient() is nil")
+	}
+	client, err := daprDddClient.DaprClient()
 	if err != nil {
 		return err
 	}
@@ -195,6 +411,19 @@ func (a *ApplyEventOptions) SetEventStorageKey(eventStorageKey string) *ApplyEve
 	return a
 }
 
+//
+// SetExpectedSequenceNumber
+// @Description: 设置期望的聚合当前事件序号，与存储中的序号不一致时返回并发冲突错误，0表示不检查。
+// gRPC 存储不支持序号时，非0的期望序号返回 daprclient.ErrGrpcFieldUnsupported
+// @receiver a
+// @param value 事件序号
+// @return *ApplyEventOptions
+//
+func (a *ApplyEventOptions) SetExpectedSequenceNumber(value uint64) *ApplyEventOptions {
+	a.expectedSequenceNumber = &value
+	return a
+}
+
 func (a *ApplyEventOptions) SetMetadata(value *map[string]string) *ApplyEventOptions {
 	a.metadata = value
 	return a
@@ -205,3 +434,28 @@ func NewApplyEventOptions(metadata *map[string]string) *ApplyEventOptions {
 		metadata: metadata,
 	}
 }
+
+//
+// newEventMetadata
+// @Description: 复制事件 Metadata，并写入上下文中的关联id与因果id，Metadata 中已有的值不覆盖
+// @param ctx 上下文
+// @param metadata ApplyEventOptions 中的 Metadata
+// @return map[string]string
+//
+func newEventMetadata(ctx context.Context, metadata map[string]string) map[string]string {
+	res := make(map[string]string, len(metadata)+2)
+	for k, v := range metadata {
+		res[k] = v
+	}
+	if _, ok := res[ddd_context.MetadataCorrelationId]; !ok {
+		if v := ddd_context.GetCorrelationId(ctx); v != "" {
+			res[ddd_context.MetadataCorrelationId] = v
+		}
+	}
+	if _, ok := res[ddd_context.MetadataCausationId]; !ok {
+		if v := ddd_context.GetCausationId(ctx); v != "" {
+			res[ddd_context.MetadataCausationId] = v
+		}
+	}
+	return res
+}
@@ -4,8 +4,13 @@ import (
 	"context"
 	"fmt"
 	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/rsql"
 )
 
+// ErrEventItemFieldMissing 事件存储返回的查询结果缺少聚合id、事件序号或事件时间，例如 sidecar 的 gRPC proto 版本较旧
+var ErrEventItemFieldMissing = errors.New("event item field is missing")
+
 type GetEventsOptions struct {
 	TenantId      string `json:"tenantId"`
 	AggregateType string `json:"aggregateType"`
@@ -18,6 +23,7 @@ type GetEventsOptions struct {
 type GetEventsWhereOptions struct {
 	eventStorageKey *string
 	wheres          map[string]string
+	filter          *rsql.FilterBuilder
 	pageSize        *int
 	pageNum         *int
 	sort            *string
@@ -36,18 +42,38 @@ func GetEvents(ctx context.Context, req *daprclient.GetEventsRequest, opts ...*A
 	return eventStorage.GetEvents(ctx, req)
 }
 
-func (o *GetEventsWhereOptions) GetFilter() string {
-	filter := ""
-	count := len(o.wheres)
-	i := 0
-	for idName, idValue := range o.wheres {
-		filter = filter + fmt.Sprintf("%s==\"%s\"", idName, idValue)
-		if i < count-1 {
-			filter = filter + " and "
-		}
-		i++
+//
+// GetEventsByWhere
+// @Description: 按查询条件获取事件，例如查询一组聚合中序号不小于 10 的事件：
+// NewGetEventsWhereOptions().SetFilter(rsql.NewFilterBuilder().In("aggregateId", ids...).Range("sequenceNumber", 10, nil))
+// @param ctx 上下文
+// @param tenantId 租户id
+// @param aggregateType 聚合类型
+// @param opts 查询条件
+// @return *daprclient.GetEventsResponse
+// @return error 查询条件不合法或查询失败
+//
+func GetEventsByWhere(ctx context.Context, tenantId, aggregateType string, opts ...*GetEventsWhereOptions) (*daprclient.GetEventsResponse, error) {
+	options := NewGetEventsWhereOptions()
+	options.Merge(opts...)
+	filter, err := newWhereFilter(options.wheres, options.filter).Build()
+	if err != nil {
+		return nil, err
+	}
+	req := &daprclient.GetEventsRequest{
+		TenantId:      tenantId,
+		AggregateType: aggregateType,
+		Filter:        filter,
+		PageNum:       uint64(options.GetPageNum()),
+		PageSize:      uint64(options.GetPageSize()),
+		Sort:          options.GetSort(),
 	}
-	return filter
+	return GetEvents(ctx, req, NewApplyCommandOptions().SetEventStorageKey(options.GetEventStorageKey()))
+}
+
+// GetFilter 生成 RSQL 过滤条件，条件不合法时返回空字符串，错误由 GetEventsByWhere 返回
+func (o *GetEventsWhereOptions) GetFilter() string {
+	return newWhereFilter(o.wheres, o.filter).String()
 }
 
 func (o *GetEventsWhereOptions) Merge(opts ...*GetEventsWhereOptions) {
@@ -63,6 +89,12 @@ func (o *GetEventsWhereOptions) Merge(opts ...*GetEventsWhereOptions) {
 				o.wheres[k] = v
 			}
 		}
+		if item.filter != nil {
+			o.filter = mergeWhereFilter(o.filter, item.filter)
+		}
+		if item.eventStorageKey != nil {
+			o.eventStorageKey = item.eventStorageKey
+		}
 		if item.pageSize != nil {
 			o.pageSize = item.pageSize
 		}
@@ -93,7 +125,7 @@ func (o *GetEventsWhereOptions) SetPageNum(v int) *GetEventsWhereOptions {
 }
 
 func (o *GetEventsWhereOptions) GetPageNum() int {
-	if o.pageSize == nil {
+	if o.pageNum == nil {
 		return 0
 	}
 	return *o.pageNum
@@ -127,3 +159,40 @@ func (o *GetEventsWhereOptions) AddWhere(idName, idValue string) *GetEventsWhere
 	o.wheres[idName] = idValue
 	return o
 }
+
+//
+// SetFilter
+// @Description: 设置类型化的查询条件，与 AddWhere() 添加的等于条件为 and 关系
+//
+func (o *GetEventsWhereOptions) SetFilter(v *rsql.FilterBuilder) *GetEventsWhereOptions {
+	o.filter = v
+	return o
+}
+
+func (o *GetEventsWhereOptions) GetFilterBuilder() *rsql.FilterBuilder {
+	return o.filter
+}
+
+//
+// checkEventItems
+// @Description: 回放、导出、历史与按序号加载聚合依赖查询结果中的聚合id、事件序号与事件时间，
+// 缺少时返回 ErrEventItemFieldMissing，而不是按零值继续处理
+// @param items 查询结果
+// @return error
+//
+func checkEventItems(items []*daprclient.GetEventsItem) error {
+	for _, item := range items {
+		field := ""
+		if item.AggregateId == "" {
+			field = "aggregateId"
+		} else if item.SequenceNumber == 0 {
+			field = "sequenceNumber"
+		} else if item.EventTime == nil {
+			field = "eventTime"
+		}
+		if field != "" {
+			return fmt.Errorf("%w: event %s has no %s, the event storage does not return it", ErrEventItemFieldMissing, item.EventId, field)
+		}
+	}
+	return nil
+}
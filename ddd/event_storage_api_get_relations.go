@@ -2,8 +2,9 @@ package ddd
 
 import (
 	"context"
-	"fmt"
 	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/rsql"
+	"sort"
 )
 
 type RelationsOptions struct {
@@ -18,6 +19,7 @@ type RelationsOptions struct {
 type WhereOptions struct {
 	eventStorageKey *string
 	wheres          map[string]string
+	filter          *rsql.FilterBuilder
 	pageSize        *int
 	pageNum         *int
 	sort            *string
@@ -28,19 +30,40 @@ func NewWhereOptions() *WhereOptions {
 }
 
 func HasRelations(ctx context.Context, tenantId, aggregateType string, opts ...*WhereOptions) (bool, uint64, *daprclient.GetRelationsResponse, error) {
+	resp, err := GetRelationsByWhere(ctx, tenantId, aggregateType, opts...)
+	if err != nil {
+		return false, 0, resp, err
+	}
+	return resp.IsFound, resp.TotalRows, resp, err
+}
+
+//
+// GetRelationsByWhere
+// @Description: 按查询条件获取聚合关系，例如查询引用了一组客户id中任意一个的聚合：
+// NewWhereOptions().SetFilter(rsql.NewFilterBuilder().In("customerId", ids...))
+// @param ctx 上下文
+// @param tenantId 租户id
+// @param aggregateType 聚合类型
+// @param opts 查询条件
+// @return *daprclient.GetRelationsResponse
+// @return error 查询条件不合法或查询失败
+//
+func GetRelationsByWhere(ctx context.Context, tenantId, aggregateType string, opts ...*WhereOptions) (*daprclient.GetRelationsResponse, error) {
 	options := NewWhereOptions()
 	options.Merge(opts...)
+	filter, err := newWhereFilter(options.wheres, options.filter).Build()
+	if err != nil {
+		return nil, err
+	}
 	req := &daprclient.GetRelationsRequest{
 		TenantId:      tenantId,
 		AggregateType: aggregateType,
-		Filter:        options.GetFilter(),
+		Filter:        filter,
 		PageNum:       uint64(options.GetPageNum()),
 		PageSize:      uint64(options.GetPageSize()),
 		Sort:          options.GetSort(),
 	}
-
-	resp, err := GetRelations(ctx, req, NewApplyCommandOptions().SetEventStorageKey(options.GetEventStorageKey()))
-	return resp.IsFound, resp.TotalRows, resp, err
+	return GetRelations(ctx, req, NewApplyCommandOptions().SetEventStorageKey(options.GetEventStorageKey()))
 }
 
 func HasAggregate(ctx context.Context, tenantId, aggregateType, aggregateId string) (bool, error) {
@@ -58,18 +81,9 @@ func GetRelations(ctx context.Context, req *daprclient.GetRelationsRequest, opts
 	return eventStorage.GetRelations(ctx, req)
 }
 
+// GetFilter 生成 RSQL 过滤条件，条件不合法时返回空字符串，错误由 HasRelations、GetRelationsByWhere 返回
 func (o *WhereOptions) GetFilter() string {
-	filter := ""
-	count := len(o.wheres)
-	i := 0
-	for idName, idValue := range o.wheres {
-		filter = filter + fmt.Sprintf("%s==\"%s\"", idName, idValue)
-		if i < count-1 {
-			filter = filter + " and "
-		}
-		i++
-	}
-	return filter
+	return newWhereFilter(o.wheres, o.filter).String()
 }
 
 func (o *WhereOptions) Merge(opts ...*WhereOptions) {
@@ -85,6 +99,12 @@ func (o *WhereOptions) Merge(opts ...*WhereOptions) {
 				o.wheres[k] = v
 			}
 		}
+		if item.filter != nil {
+			o.filter = mergeWhereFilter(o.filter, item.filter)
+		}
+		if item.eventStorageKey != nil {
+			o.eventStorageKey = item.eventStorageKey
+		}
 		if item.pageSize != nil {
 			o.pageSize = item.pageSize
 		}
@@ -115,7 +135,7 @@ func (o *WhereOptions) SetPageNum(v int) *WhereOptions {
 }
 
 func (o *WhereOptions) GetPageNum() int {
-	if o.pageSize == nil {
+	if o.pageNum == nil {
 		return 0
 	}
 	return *o.pageNum
@@ -149,3 +169,40 @@ func (o *WhereOptions) AddWhere(idName, idValue string) *WhereOptions {
 	o.wheres[idName] = idValue
 	return o
 }
+
+//
+// SetFilter
+// @Description: 设置类型化的查询条件，与 AddWhere() 添加的等于条件为 and 关系
+//
+func (o *WhereOptions) SetFilter(v *rsql.FilterBuilder) *WhereOptions {
+	o.filter = v
+	return o
+}
+
+func (o *WhereOptions) GetFilterBuilder() *rsql.FilterBuilder {
+	return o.filter
+}
+
+//
+// newWhereFilter
+// @Description: 按名称排序生成 wheres 的等于条件，再以 and 关系加上 filter
+//
+func newWhereFilter(wheres map[string]string, filter *rsql.FilterBuilder) *rsql.FilterBuilder {
+	names := make([]string, 0, len(wheres))
+	for name := range wheres {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	builder := rsql.NewFilterBuilder()
+	for _, name := range names {
+		builder.Eq(name, wheres[name])
+	}
+	return builder.And(filter)
+}
+
+func mergeWhereFilter(filter, other *rsql.FilterBuilder) *rsql.FilterBuilder {
+	if filter == nil || filter == other {
+		return other
+	}
+	return rsql.NewFilterBuilder().And(filter, other)
+}
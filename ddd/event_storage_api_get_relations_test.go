@@ -0,0 +1,70 @@
+package ddd
+
+import (
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/rsql"
+	"strings"
+	"testing"
+)
+
+func TestWhereOptions_GetFilter(t *testing.T) {
+	options := NewWhereOptions().AddWhere("userId", `u"1`).AddWhere("aggregateId", "agg-1")
+	options.Merge(NewWhereOptions().SetFilter(rsql.NewFilterBuilder().Ne("isDeleted", true)))
+	if filter := options.GetFilter(); filter != `aggregateId=="agg-1" and userId=="u\"1" and isDeleted!=true` {
+		t.Errorf("GetFilter() = %s", filter)
+	}
+	eventsOptions := NewGetEventsWhereOptions().AddWhere("eventType", "e").SetFilter(rsql.NewFilterBuilder().Range("sequenceNumber", 2, 5))
+	if filter := eventsOptions.GetFilter(); filter != `eventType=="e" and sequenceNumber>=2 and sequenceNumber<=5` {
+		t.Errorf("GetFilter() = %s", filter)
+	}
+}
+
+func TestGetRelationsByWhere(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+	for _, id := range []string{"agg-1", "agg-2", "agg-3"} {
+		if _, err := CreateEvent(ctx, &memAggregate{}, newMemCreatedEvent("tenant-1", id, "name-"+id, "user-"+id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filter := rsql.NewFilterBuilder().In("userId", "user-agg-1", "user-agg-3", "user-none")
+	resp, err := GetRelationsByWhere(ctx, "tenant-1", memAggregateType, NewWhereOptions().SetFilter(filter).SetSort("aggregateId:asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, item := range resp.Data {
+		if len(ids) == 0 || ids[len(ids)-1] != item.AggregateId {
+			ids = append(ids, item.AggregateId)
+		}
+	}
+	if got := strings.Join(ids, ","); got != "agg-1,agg-3" || resp.TotalRows != 2 {
+		t.Errorf("aggregates = %s, totalRows = %d; want agg-1,agg-3", got, resp.TotalRows)
+	}
+
+	filter = rsql.NewFilterBuilder().Or(rsql.NewFilterBuilder().Eq("userId", "user-agg-2"), rsql.NewFilterBuilder().Like("aggregateId", "-3$"))
+	ok, total, _, err := HasRelations(ctx, "tenant-1", memAggregateType, NewWhereOptions().SetFilter(filter))
+	if err != nil || !ok || total != 2 {
+		t.Errorf("HasRelations() = %v, %d, %v; want true, 2", ok, total, err)
+	}
+
+	if _, _, _, err = HasRelations(ctx, "tenant-1", memAggregateType, NewWhereOptions().SetFilter(rsql.NewFilterBuilder().In("userId"))); err == nil {
+		t.Error("HasRelations() with invalid filter error = nil")
+	}
+}
+
+func TestGetEventsByWhere(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+	newAsOfTestAggregate(t, "name-2", "name-3")
+
+	filter := rsql.NewFilterBuilder().Eq("aggregateId", "agg-1").Range("sequenceNumber", 2, nil)
+	resp, err := GetEventsByWhere(ctx, "tenant-1", memAggregateType, NewGetEventsWhereOptions().SetFilter(filter).SetSort("sequenceNumber:asc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 || resp.Data[0].SequenceNumber != 2 || resp.Data[1].SequenceNumber != 3 {
+		t.Errorf("events = %v, want sequence 2, 3", resp.Data)
+	}
+}
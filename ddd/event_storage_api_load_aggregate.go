@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"github.com/liuxd6825/dapr-go-ddd-sdk/applog"
+	"time"
 )
 
 type LoadAggregateOptions struct {
-	eventStorageKey string
+	eventStorageKey  string
+	toSequenceNumber *uint64
+	toTime           *time.Time
 }
 
 func NewLoadAggregateOptions() *LoadAggregateOptions {
@@ -19,16 +22,47 @@ func (o *LoadAggregateOptions) SetEventStorageKey(eventStorageKey string) *LoadA
 	return o
 }
 
+//
+// SetToSequenceNumber
+// @Description: 只加载到指定的事件序号（包含），返回只读的历史聚合根
+//
+func (o *LoadAggregateOptions) SetToSequenceNumber(v uint64) *LoadAggregateOptions {
+	o.toSequenceNumber = &v
+	return o
+}
+
+//
+// SetToTime
+// @Description: 只加载指定时间（包含）之前的事件，返回只读的历史聚合根
+//
+func (o *LoadAggregateOptions) SetToTime(v time.Time) *LoadAggregateOptions {
+	o.toTime = &v
+	return o
+}
+
+func (o *LoadAggregateOptions) isAsOf() bool {
+	return o.toSequenceNumber != nil || o.toTime != nil
+}
+
 func (o *LoadAggregateOptions) Merge(opts ...*LoadAggregateOptions) *LoadAggregateOptions {
 	for _, item := range opts {
+		if item == nil {
+			continue
+		}
 		o.eventStorageKey = item.eventStorageKey
+		if item.toSequenceNumber != nil {
+			o.toSequenceNumber = item.toSequenceNumber
+		}
+		if item.toTime != nil {
+			o.toTime = item.toTime
+		}
 	}
 	return o
 }
 
 //
 // LoadAggregate
-// @Description: 加载聚合根
+// @Description: 加载聚合根，设置了 ToSequenceNumber 或 ToTime 时返回该时点的只读聚合根 *ReadOnlyAggregate
 // @param ctx 上下文
 // @param tenantId 租户id
 // @param aggregateId 聚合根id
@@ -54,6 +88,10 @@ func LoadAggregate(ctx context.Context, tenantId string, aggregateId string, agg
 			agg, isFound, err = nil, false, e
 			return agg, err
 		}
+		if options.isAsOf() {
+			agg, isFound, err = loadAggregateAsOf(ctx, eventStorage, tenantId, aggregateId, aggregate, options.toSequenceNumber, options.toTime)
+			return agg, err
+		}
 		agg, isFound, err = eventStorage.LoadAggregate(ctx, tenantId, aggregateId, aggregate)
 		return agg, err
 	})
@@ -24,7 +24,7 @@ func SaveSnapshot(ctx context.Context, tenantId string, aggregateType string, ag
 		TenantId:    tenantId,
 		AggregateId: aggregateId,
 	}
-	resp, err := LoadEvents(ctx, req, "")
+	resp, err := LoadEvents(ctx, req, eventStorageKey)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,362 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	pb "github.com/liuxd6825/dapr/pkg/proto/runtime/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//
+// newContractGrpcEventStorage
+// @Description: 在本地端口启动 pb.DaprServer，后端使用内存事件存储，grpcEventStorage 通过 NewDaprDddClient 连接，
+// 请求与响应都经过 daprclient 与 pb 消息之间的转换。NewDaprDddClient 只接受地址，因此使用 127.0.0.1 的随机端口而不是 bufconn
+//
+func newContractGrpcEventStorage(t *testing.T, backend EventStorage) EventStorage {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterDaprServer(server, &contractDaprServer{backend: backend})
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	client, err := daprclient.NewDaprDddClient("127.0.0.1", 0, int64(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewGrpcEventStorage(client, PubsubName("pubsub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage
+}
+
+// contractSupportsSequenceNumber 事件存储器是否返回事件序号，pb 中没有 SequenceNumber 等字段时为 false
+func contractSupportsSequenceNumber(storage EventStorage) bool {
+	s, ok := storage.(sequenceNumberSupporter)
+	return !ok || s.SupportsSequenceNumber()
+}
+
+//
+// skipContractWithoutSequenceNumber
+// @Description: 事件存储器不返回事件序号时跳过依赖事件序号的契约
+//
+func skipContractWithoutSequenceNumber(t *testing.T, storage EventStorage) {
+	if !contractSupportsSequenceNumber(storage) {
+		t.Skip("event storage does not return sequence numbers")
+	}
+}
+
+//
+// skipContractUnsupported
+// @Description: pb 中没有需要的字段时 daprclient 返回 ErrGrpcFieldUnsupported，HTTP API 没有对应接口时返回
+// ErrHttpEventStorageUnsupported，跳过该契约
+//
+func skipContractUnsupported(t *testing.T, err error) {
+	if errors.Is(err, daprclient.ErrGrpcFieldUnsupported) || errors.Is(err, ErrHttpEventStorageUnsupported) {
+		t.Skip(err.Error())
+	}
+}
+
+//
+// contractDaprServer
+// @Description: 模拟 dapr sidecar 的 gRPC 事件存储服务，pb 消息与内存事件存储之间转换。
+// 不同版本 pb 中的可选字段(如 SequenceNumber)按名称读写，pb 中没有该字段时忽略
+//
+type contractDaprServer struct {
+	pb.UnimplementedDaprServer
+	backend EventStorage
+}
+
+func (s *contractDaprServer) LoadEvents(ctx context.Context, in *pb.LoadEventRequest) (*pb.LoadEventResponse, error) {
+	req := &daprclient.LoadEventsRequest{TenantId: in.TenantId, AggregateId: in.AggregateId, AggregateType: in.AggregateType}
+	req.FromSequenceNumber = getContractPbUint64(in, "FromSequenceNumber")
+	resp, err := s.backend.LoadEvent(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := &pb.LoadEventResponse{
+		TenantId:      resp.TenantId,
+		AggregateId:   resp.AggregateId,
+		AggregateType: resp.AggregateType,
+		Headers:       newContractPbHeaders(resp.Headers),
+	}
+	if resp.Snapshot != nil {
+		out.Snapshot = &pb.SnapshotDto{
+			AggregateData:     toContractJson(resp.Snapshot.AggregateData),
+			AggregateRevision: resp.Snapshot.AggregateRevision,
+			SequenceNumber:    resp.Snapshot.SequenceNumber,
+			Metadata:          toContractJson(resp.Snapshot.Metadata),
+		}
+	}
+	if resp.EventRecords != nil {
+		for _, record := range *resp.EventRecords {
+			item := &pb.EventRecordDto{
+				EventId:      record.EventId,
+				EventData:    toContractJson(record.EventData),
+				EventVersion: record.EventVersion,
+				EventType:    record.EventType,
+			}
+			setContractPbField(item, "SequenceNumber", record.SequenceNumber)
+			setContractPbField(item, "Metadata", toContractJson(record.Metadata))
+			out.Events = append(out.Events, item)
+		}
+	}
+	return out, nil
+}
+
+func (s *contractDaprServer) ApplyEvent(ctx context.Context, in *pb.ApplyEventRequest) (*pb.ApplyEventResponse, error) {
+	events, err := newContractPbEventDtos(in.Events)
+	if err != nil {
+		return nil, err
+	}
+	req := &daprclient.ApplyEventRequest{TenantId: in.TenantId, AggregateId: in.AggregateId, AggregateType: in.AggregateType, Events: events}
+	req.ExpectedSequenceNumber = getContractPbUint64(in, "ExpectedSequenceNumber")
+	resp, err := s.backend.ApplyEvent(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := &pb.ApplyEventResponse{Headers: newContractPbHeaders(resp.Headers)}
+	setContractPbField(out, "SequenceNumber", resp.SequenceNumber)
+	return out, nil
+}
+
+func (s *contractDaprServer) CreateEvent(ctx context.Context, in *pb.CreateEventRequest) (*pb.CreateEventResponse, error) {
+	events, err := newContractPbEventDtos(in.Events)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.backend.CreateEvent(ctx, &daprclient.CreateEventRequest{TenantId: in.TenantId, AggregateId: in.AggregateId, AggregateType: in.AggregateType, Events: events})
+	if err != nil {
+		return nil, err
+	}
+	out := &pb.CreateEventResponse{Headers: newContractPbHeaders(resp.Headers)}
+	setContractPbField(out, "SequenceNumber", resp.SequenceNumber)
+	return out, nil
+}
+
+func (s *contractDaprServer) DeleteEvent(ctx context.Context, in *pb.DeleteEventRequest) (*pb.DeleteEventResponse, error) {
+	event, err := newContractPbEventDto(in.Event)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.backend.DeleteEvent(ctx, &daprclient.DeleteEventRequest{TenantId: in.TenantId, AggregateId: in.AggregateId, AggregateType: in.AggregateType, Event: event})
+	if err != nil {
+		return nil, err
+	}
+	out := &pb.DeleteEventResponse{Headers: newContractPbHeaders(resp.Headers)}
+	setContractPbField(out, "SequenceNumber", resp.SequenceNumber)
+	return out, nil
+}
+
+func (s *contractDaprServer) SaveSnapshot(ctx context.Context, in *pb.SaveSnapshotRequest) (*pb.SaveSnapshotResponse, error) {
+	req := &daprclient.SaveSnapshotRequest{
+		TenantId:         in.TenantId,
+		AggregateId:      in.AggregateId,
+		AggregateType:    in.AggregateType,
+		AggregateVersion: in.AggregateVersion,
+		SequenceNumber:   in.SequenceNumber,
+	}
+	aggregateData := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(in.AggregateData), &aggregateData); err != nil {
+		return nil, err
+	}
+	req.AggregateData = aggregateData
+	if err := json.Unmarshal([]byte(in.Metadata), &req.Metadata); err != nil {
+		return nil, err
+	}
+	resp, err := s.backend.SaveSnapshot(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SaveSnapshotResponse{Headers: newContractPbHeaders(resp.Headers)}, nil
+}
+
+func (s *contractDaprServer) GetRelations(ctx context.Context, in *pb.GetRelationsRequest) (*pb.GetRelationsResponse, error) {
+	resp, err := s.backend.GetRelations(ctx, &daprclient.GetRelationsRequest{
+		TenantId:      in.TenantId,
+		AggregateType: in.AggregateType,
+		Filter:        in.Filter,
+		Sort:          in.Sort,
+		PageNum:       in.PageNum,
+		PageSize:      in.PageSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := &pb.GetRelationsResponse{
+		Sort:       resp.Sort,
+		Filter:     resp.Filter,
+		Error:      resp.Error,
+		PageNum:    resp.PageNum,
+		PageSize:   resp.PageSize,
+		TotalRows:  resp.TotalRows,
+		TotalPages: resp.TotalPages,
+		IsFound:    resp.IsFound,
+		Headers:    newContractPbHeaders(resp.Headers),
+	}
+	for _, item := range resp.Data {
+		out.Data = append(out.Data, &pb.RelationDto{
+			Id:          item.Id,
+			TenantId:    item.TenantId,
+			AggregateId: item.AggregateId,
+			TableName:   item.TableName,
+			RelName:     item.RelName,
+			RelValue:    item.RelValue,
+			IsDeleted:   item.IsDeleted,
+		})
+	}
+	return out, nil
+}
+
+func (s *contractDaprServer) GetEvents(ctx context.Context, in *pb.GetEventsRequest) (*pb.GetEventsResponse, error) {
+	resp, err := s.backend.GetEvents(ctx, &daprclient.GetEventsRequest{
+		TenantId:      in.TenantId,
+		AggregateType: in.AggregateType,
+		Filter:        in.Filter,
+		Sort:          in.Sort,
+		PageNum:       in.PageNum,
+		PageSize:      in.PageSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := &pb.GetEventsResponse{
+		Sort:       resp.Sort,
+		Filter:     resp.Filter,
+		Error:      resp.Error,
+		PageNum:    resp.PageNum,
+		PageSize:   resp.PageSize,
+		TotalRows:  resp.TotalRows,
+		TotalPages: resp.TotalPages,
+		IsFound:    resp.IsFound,
+		Headers:    newContractPbHeaders(resp.Headers),
+	}
+	for _, item := range resp.Data {
+		dto := &pb.EventItemDto{
+			EventId:      item.EventId,
+			CommandId:    item.CommandId,
+			EventData:    toContractJson(item.EventData),
+			EventType:    item.EventType,
+			EventVersion: item.EventVersion,
+			PubsubName:   item.PubsubName,
+			Topic:        item.Topic,
+			Metadata:     toContractJson(item.Metadata),
+		}
+		setContractPbField(dto, "AggregateId", item.AggregateId)
+		setContractPbField(dto, "SequenceNumber", item.SequenceNumber)
+		setContractPbField(dto, "EventTime", item.EventTime)
+		out.Data = append(out.Data, dto)
+	}
+	return out, nil
+}
+
+func newContractPbEventDtos(events []*pb.EventDto) ([]*daprclient.EventDto, error) {
+	var list []*daprclient.EventDto
+	for _, item := range events {
+		event, err := newContractPbEventDto(item)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, event)
+	}
+	return list, nil
+}
+
+func newContractPbEventDto(in *pb.EventDto) (*daprclient.EventDto, error) {
+	if in == nil {
+		return nil, nil
+	}
+	event := &daprclient.EventDto{
+		EventId:      in.EventId,
+		CommandId:    in.CommandId,
+		EventType:    in.EventType,
+		EventVersion: in.EventVersion,
+		PubsubName:   in.PubsubName,
+		Topic:        in.Topic,
+		Relations:    in.Relations,
+	}
+	eventData := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(in.EventData), &eventData); err != nil {
+		return nil, err
+	}
+	event.EventData = eventData
+	if err := json.Unmarshal([]byte(in.Metadata), &event.Metadata); err != nil {
+		return nil, err
+	}
+	if field := reflect.ValueOf(in).Elem().FieldByName("RelationValues"); field.Kind() == reflect.String && field.Len() > 0 {
+		if err := json.Unmarshal([]byte(field.String()), &event.RelationValues); err != nil {
+			return nil, err
+		}
+	}
+	return event, nil
+}
+
+func newContractPbHeaders(headers *daprclient.ResponseHeaders) *pb.ResponseHeaders {
+	if headers == nil {
+		return nil
+	}
+	return &pb.ResponseHeaders{Status: int32(headers.Status), Message: headers.Message, Values: headers.Values}
+}
+
+func toContractJson(v interface{}) string {
+	bytes, _ := json.Marshal(v)
+	return string(bytes)
+}
+
+func getContractPbUint64(msg interface{}, name string) uint64 {
+	field := reflect.ValueOf(msg).Elem().FieldByName(name)
+	switch field.Kind() {
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return field.Uint()
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return uint64(field.Int())
+	}
+	return 0
+}
+
+func setContractPbField(msg interface{}, name string, value interface{}) {
+	field := reflect.ValueOf(msg).Elem().FieldByName(name)
+	if !field.IsValid() || !field.CanSet() {
+		return
+	}
+	switch v := value.(type) {
+	case uint64:
+		switch field.Kind() {
+		case reflect.Uint, reflect.Uint32, reflect.Uint64:
+			field.SetUint(v)
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			field.SetInt(int64(v))
+		}
+	case string:
+		if field.Kind() == reflect.String {
+			field.SetString(v)
+		}
+	case *time.Time:
+		if v == nil {
+			return
+		}
+		switch field.Interface().(type) {
+		case *timestamppb.Timestamp:
+			field.Set(reflect.ValueOf(timestamppb.New(*v)))
+		case time.Time:
+			field.Set(reflect.ValueOf(*v))
+		case *time.Time:
+			field.Set(reflect.ValueOf(v))
+		case string:
+			field.SetString(v.Format(time.RFC3339Nano))
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//
+// eventStorageTransport
+// @Description: 事件存储的一种传输方式，同一套契约测试分别运行在 HTTP 与 gRPC 方式上
+//
+type eventStorageTransport struct {
+	name string
+	new  func(t *testing.T, backend EventStorage) EventStorage
+}
+
+var eventStorageTransports = []eventStorageTransport{
+	{name: "http", new: newContractHttpEventStorage},
+	{name: "grpc", new: newContractGrpcEventStorage},
+}
+
+func TestEventStorageContract(t *testing.T) {
+	cases := []struct {
+		name string
+		test func(t *testing.T, storage EventStorage)
+	}{
+		{"CreateAndLoad", testContractCreateAndLoad},
+		{"ApplyEvent", testContractApplyEvent},
+		{"GetEvents", testContractGetEvents},
+		{"GetRelations", testContractGetRelations},
+		{"SaveSnapshot", testContractSaveSnapshot},
+		{"DeleteEvent", testContractDeleteEvent},
+		{"PubsubName", testContractPubsubName},
+		{"Validate", testContractValidate},
+	}
+	for _, transport := range eventStorageTransports {
+		for _, c := range cases {
+			t.Run(transport.name+"/"+c.name, func(t *testing.T) {
+				backend, err := NewMemoryEventStorage()
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.test(t, transport.new(t, backend))
+			})
+		}
+	}
+}
+
+func TestHttpEventStorage_Unsupported(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewHttpEventStorage(daprclient.NewDaprDddHttpClient("127.0.0.1", 1), PubsubName("pubsub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, createErr := storage.CreateEvent(ctx, newContractCreateRequest("tenant-1", "agg-1", "user-1"))
+	_, deleteErr := storage.DeleteEvent(ctx, &daprclient.DeleteEventRequest{TenantId: "tenant-1", AggregateId: "agg-1"})
+	_, eventsErr := storage.GetEvents(ctx, &daprclient.GetEventsRequest{TenantId: "tenant-1", AggregateType: memAggregateType})
+	_, relationsErr := storage.GetRelations(ctx, &daprclient.GetRelationsRequest{TenantId: "tenant-1", AggregateType: memAggregateType})
+	for _, err := range []error{createErr, deleteErr, eventsErr, relationsErr} {
+		if !errors.Is(err, ErrHttpEventStorageUnsupported) {
+			t.Errorf("err = %v, want ErrHttpEventStorageUnsupported", err)
+		}
+	}
+}
+
+func testContractCreateAndLoad(t *testing.T, storage EventStorage) {
+	ctx := context.Background()
+	if _, err := storage.CreateEvent(ctx, newContractCreateRequest("tenant-1", "agg-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.CreateEvent(ctx, newContractCreateRequest("tenant-1", "agg-1", "user-1")); err == nil {
+		t.Error("create an existing aggregate should return error")
+	}
+
+	resp, err := storage.LoadEvent(ctx, &daprclient.LoadEventsRequest{TenantId: "tenant-1", AggregateId: "agg-1", AggregateType: memAggregateType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.AggregateType != memAggregateType || len(*resp.EventRecords) != 1 {
+		t.Fatalf("aggregateType = %s, events = %d", resp.AggregateType, len(*resp.EventRecords))
+	}
+	record := (*resp.EventRecords)[0]
+	if record.EventType != "test.MemCreatedEvent" {
+		t.Errorf("eventType = %s", record.EventType)
+	}
+	if contractSupportsSequenceNumber(storage) && record.SequenceNumber != 1 {
+		t.Errorf("sequenceNumber = %d, want 1", record.SequenceNumber)
+	}
+
+	agg, find, err := storage.LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !find || agg.(*memAggregate).UserId != "user-1" {
+		t.Errorf("LoadAggregate() = %v, %v", agg, find)
+	}
+	if _, find, err = storage.LoadAggregate(ctx, "tenant-1", "agg-none", &memAggregate{}); err != nil || find {
+		t.Errorf("LoadAggregate(agg-none) = %v, %v; want false, nil", find, err)
+	}
+}
+
+func testContractApplyEvent(t *testing.T, storage EventStorage) {
+	skipContractWithoutSequenceNumber(t, storage)
+	ctx := context.Background()
+	if _, err := storage.CreateEvent(ctx, newContractCreateRequest("tenant-1", "agg-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	req := newContractApplyRequest("tenant-1", "agg-1", "name-2")
+	req.ExpectedSequenceNumber = 1
+	resp, err := storage.ApplyEvent(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.SequenceNumber != 2 || resp.Headers.Status != daprclient.ResponseStatusSuccess {
+		t.Errorf("sequenceNumber = %d, status = %v", resp.SequenceNumber, resp.Headers.Status)
+	}
+
+	req = newContractApplyRequest("tenant-1", "agg-1", "name-3")
+	req.ExpectedSequenceNumber = 1
+	if resp, err = storage.ApplyEvent(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Headers.Status != daprclient.ResponseStatusConcurrencyConflict {
+		t.Errorf("status = %v, want ResponseStatusConcurrencyConflict", resp.Headers.Status)
+	}
+
+	if _, err = storage.ApplyEvent(ctx, newContractApplyRequest("tenant-1", "agg-none", "name")); err == nil {
+		t.Error("apply to a missing aggregate should return error")
+	}
+
+	loadResp, err := storage.LoadEvent(ctx, &daprclient.LoadEventsRequest{TenantId: "tenant-1", AggregateId: "agg-1", FromSequenceNumber: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*loadResp.EventRecords) != 1 || (*loadResp.EventRecords)[0].SequenceNumber != 2 {
+		t.Errorf("events = %v, want only sequenceNumber 2", *loadResp.EventRecords)
+	}
+}
+
+func testContractGetEvents(t *testing.T, storage EventStorage) {
+	ctx := context.Background()
+	for _, id := range []string{"agg-1", "agg-2"} {
+		if _, err := storage.CreateEvent(ctx, newContractCreateRequest("tenant-1", id, "user-"+id)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.ApplyEvent(ctx, newContractApplyRequest("tenant-1", id, id+"-new")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := storage.GetEvents(ctx, &daprclient.GetEventsRequest{
+		TenantId:      "tenant-1",
+		AggregateType: memAggregateType,
+		Filter:        `eventType=="test.MemUpdatedEvent" and eventData.data.name=="agg-2-new"`,
+	})
+	skipContractUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.TotalRows != 1 || len(resp.Data) != 1 {
+		t.Fatalf("totalRows = %d, data = %v", resp.TotalRows, resp.Data)
+	}
+	// 不支持事件序号的 gRPC proto 同样没有 EventItemDto.AggregateId，返回空值
+	if id := resp.Data[0].AggregateId; id != "agg-2" && (id != "" || contractSupportsSequenceNumber(storage)) {
+		t.Errorf("aggregateId = %s, want agg-2", id)
+	}
+
+	resp, err = storage.GetEvents(ctx, &daprclient.GetEventsRequest{
+		TenantId:      "tenant-1",
+		AggregateType: memAggregateType,
+		Sort:          "sequenceNumber:desc",
+		PageSize:      3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.TotalRows != 4 || resp.TotalPages != 2 || len(resp.Data) != 3 {
+		t.Errorf("totalRows = %d, totalPages = %d, len = %d", resp.TotalRows, resp.TotalPages, len(resp.Data))
+	}
+}
+
+func testContractGetRelations(t *testing.T, storage EventStorage) {
+	ctx := context.Background()
+	if _, err := storage.CreateEvent(ctx, newContractCreateRequest("tenant-1", "agg-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := storage.GetRelations(ctx, &daprclient.GetRelationsRequest{
+		TenantId:      "tenant-1",
+		AggregateType: memAggregateType,
+		Filter:        `userId=="user-1"`,
+	})
+	skipContractUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsFound || resp.TotalRows != 1 || len(resp.Data) != 1 {
+		t.Fatalf("isFound = %v, totalRows = %d, data = %v", resp.IsFound, resp.TotalRows, resp.Data)
+	}
+	if rel := resp.Data[0]; rel.AggregateId != "agg-1" || rel.RelName != "userId" || rel.RelValue != "user-1" {
+		t.Errorf("relation = %+v", rel)
+	}
+}
+
+func testContractSaveSnapshot(t *testing.T, storage EventStorage) {
+	ctx := context.Background()
+	if _, err := storage.CreateEvent(ctx, newContractCreateRequest("tenant-1", "agg-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := storage.SaveSnapshot(ctx, &daprclient.SaveSnapshotRequest{
+		TenantId:         "tenant-1",
+		AggregateId:      "agg-1",
+		AggregateType:    memAggregateType,
+		AggregateData:    &memAggregate{Id: "agg-1", TenantId: "tenant-1", Name: "snapshot", UserId: "user-1"},
+		AggregateVersion: "v1.0",
+		SequenceNumber:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = storage.ApplyEvent(ctx, newContractApplyRequest("tenant-1", "agg-1", "name-2")); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := storage.LoadEvent(ctx, &daprclient.LoadEventsRequest{TenantId: "tenant-1", AggregateId: "agg-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Snapshot == nil || resp.Snapshot.SequenceNumber != 1 || len(*resp.EventRecords) != 1 {
+		t.Fatalf("snapshot = %v, events = %d", resp.Snapshot, len(*resp.EventRecords))
+	}
+	if name := resp.Snapshot.AggregateData["name"]; name != "snapshot" {
+		t.Errorf("snapshot name = %v, want snapshot", name)
+	}
+
+	agg, _, err := storage.LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := agg.(*memAggregate).Name; name != "name-2" {
+		t.Errorf("name = %s, want name-2", name)
+	}
+}
+
+func testContractDeleteEvent(t *testing.T, storage EventStorage) {
+	ctx := context.Background()
+	if _, err := storage.CreateEvent(ctx, newContractCreateRequest("tenant-1", "agg-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := storage.DeleteEvent(ctx, &daprclient.DeleteEventRequest{
+		TenantId:      "tenant-1",
+		AggregateId:   "agg-1",
+		AggregateType: memAggregateType,
+		Event:         newContractEventDto("test.MemUpdatedEvent", newMemUpdatedEvent("tenant-1", "agg-1", "deleted")),
+	})
+	skipContractUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contractSupportsSequenceNumber(storage) && resp.SequenceNumber != 2 {
+		t.Errorf("sequenceNumber = %d, want 2", resp.SequenceNumber)
+	}
+	relResp, err := storage.GetRelations(ctx, &daprclient.GetRelationsRequest{TenantId: "tenant-1", AggregateType: memAggregateType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(relResp.Data) != 1 || !relResp.Data[0].IsDeleted {
+		t.Errorf("relations = %v, want one deleted relation", relResp.Data)
+	}
+	if resp, err := storage.ApplyEvent(ctx, newContractApplyRequest("tenant-1", "agg-1", "name-3")); err == nil && resp.Headers.Status == daprclient.ResponseStatusSuccess {
+		t.Error("apply event to a deleted aggregate should fail")
+	}
+}
+
+func testContractPubsubName(t *testing.T, storage EventStorage) {
+	ctx := context.Background()
+	if storage.GetPubsubName() != "pubsub" {
+		t.Fatalf("GetPubsubName() = %s, want pubsub", storage.GetPubsubName())
+	}
+	if _, err := storage.CreateEvent(ctx, newContractCreateRequest("tenant-1", "agg-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	req := newContractApplyRequest("tenant-1", "agg-1", "name-2")
+	req.Events[0].PubsubName = "other"
+	if _, err := storage.ApplyEvent(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := storage.GetEvents(ctx, &daprclient.GetEventsRequest{TenantId: "tenant-1", AggregateType: memAggregateType, Sort: "sequenceNumber"})
+	skipContractUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("len = %d, want 2", len(resp.Data))
+	}
+	if name := resp.Data[0].PubsubName; name != "pubsub" {
+		t.Errorf("default pubsubName = %s, want pubsub", name)
+	}
+	if name := resp.Data[1].PubsubName; name != "other" {
+		t.Errorf("pubsubName = %s, want other", name)
+	}
+}
+
+func testContractValidate(t *testing.T, storage EventStorage) {
+	ctx := context.Background()
+	if _, err := storage.LoadEvent(ctx, &daprclient.LoadEventsRequest{AggregateId: "agg-1"}); err == nil {
+		t.Error("LoadEvent() without tenantId should return error")
+	}
+	req := newContractCreateRequest("tenant-1", "", "user-1")
+	if _, err := storage.CreateEvent(ctx, req); err == nil {
+		t.Error("CreateEvent() without aggregateId should return error")
+	}
+	req = newContractCreateRequest("tenant-1", "agg-1", "user-1")
+	req.Events = nil
+	if _, err := storage.CreateEvent(ctx, req); err == nil {
+		t.Error("CreateEvent() without events should return error")
+	}
+	if _, err := storage.GetEvents(ctx, &daprclient.GetEventsRequest{TenantId: "tenant-1"}); err == nil {
+		t.Error("GetEvents() without aggregateType should return error")
+	}
+	if _, err := storage.GetRelations(ctx, &daprclient.GetRelationsRequest{AggregateType: memAggregateType}); err == nil {
+		t.Error("GetRelations() without tenantId should return error")
+	}
+	if _, err := storage.GetEvents(ctx, &daprclient.GetEventsRequest{TenantId: "tenant-1", AggregateType: memAggregateType, Filter: "name=="}); err == nil {
+		t.Error("GetEvents() with an invalid filter should return error")
+	}
+}
+
+func newContractCreateRequest(tenantId, aggregateId, userId string) *daprclient.CreateEventRequest {
+	event := newMemCreatedEvent(tenantId, aggregateId, "name-1", userId)
+	dto := newContractEventDto("test.MemCreatedEvent", event)
+	dto.Relations = map[string]string{"userId": userId}
+	return &daprclient.CreateEventRequest{
+		TenantId:      tenantId,
+		AggregateId:   aggregateId,
+		AggregateType: memAggregateType,
+		Events:        []*daprclient.EventDto{dto},
+	}
+}
+
+func newContractApplyRequest(tenantId, aggregateId, name string) *daprclient.ApplyEventRequest {
+	event := newMemUpdatedEvent(tenantId, aggregateId, name)
+	return &daprclient.ApplyEventRequest{
+		TenantId:      tenantId,
+		AggregateId:   aggregateId,
+		AggregateType: memAggregateType,
+		Events:        []*daprclient.EventDto{newContractEventDto("test.MemUpdatedEvent", event)},
+	}
+}
+
+func newContractEventDto(eventType string, event interface{}) *daprclient.EventDto {
+	return &daprclient.EventDto{
+		EventId:      uuid.New().String(),
+		CommandId:    uuid.New().String(),
+		EventData:    event,
+		EventType:    eventType,
+		EventVersion: "v1.0",
+		Topic:        eventType,
+	}
+}
+
+//
+// newContractHttpEventStorage
+// @Description: 启动一个模拟 dapr sidecar 事件存储 HTTP API 的本地服务，后端使用内存事件存储。
+// HTTP API 没有创建事件的接口，契约中的聚合直接在后端创建，其余方法经过 HTTP 调用
+//
+func newContractHttpEventStorage(t *testing.T, backend EventStorage) EventStorage {
+	server := httptest.NewServer(newContractSidecarHandler(t, backend))
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpPort, err := strconv.ParseInt(port, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewHttpEventStorage(daprclient.NewDaprDddHttpClient(host, httpPort), PubsubName("pubsub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &contractHttpEventStorage{EventStorage: storage, backend: backend}
+}
+
+type contractHttpEventStorage struct {
+	EventStorage
+	backend EventStorage
+}
+
+func (s *contractHttpEventStorage) CreateEvent(ctx context.Context, req *daprclient.CreateEventRequest) (*daprclient.CreateEventResponse, error) {
+	if _, err := s.EventStorage.CreateEvent(ctx, req); !errors.Is(err, ErrHttpEventStorageUnsupported) {
+		return nil, fmt.Errorf("httpEventStorage.CreateEvent() error = %v, want ErrHttpEventStorageUnsupported", err)
+	}
+	return s.backend.CreateEvent(ctx, req)
+}
+
+func newContractSidecarHandler(t *testing.T, backend EventStorage) http.Handler {
+	ctx := context.Background()
+	mux := http.NewServeMux()
+	post := func(path string, newReq func() interface{}, call func(req interface{}) (interface{}, error)) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				t.Errorf("%s method = %s, want POST", path, r.Method)
+			}
+			req := newReq()
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+				writeContractResponse(w)(nil, err)
+				return
+			}
+			writeContractResponse(w)(call(req))
+		})
+	}
+	post(ApiEventStorageEventApply, func() interface{} { return &daprclient.ApplyEventRequest{} }, func(req interface{}) (interface{}, error) {
+		return backend.ApplyEvent(ctx, req.(*daprclient.ApplyEventRequest))
+	})
+	post(ApiEventStorageSnapshotSave, func() interface{} { return &daprclient.SaveSnapshotRequest{} }, func(req interface{}) (interface{}, error) {
+		return backend.SaveSnapshot(ctx, req.(*daprclient.SaveSnapshotRequest))
+	})
+
+	loadPrefix := strings.Split(ApiEventStorageLoadEvents, "%s")[0]
+	mux.HandleFunc(loadPrefix, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("%s method = %s, want GET", r.URL.Path, r.Method)
+		}
+		ids := strings.Split(strings.TrimPrefix(r.URL.Path, loadPrefix), "/")
+		if len(ids) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		req := &daprclient.LoadEventsRequest{
+			TenantId:      ids[0],
+			AggregateId:   ids[1],
+			AggregateType: r.URL.Query().Get("aggregateType"),
+		}
+		if value := r.URL.Query().Get("fromSequenceNumber"); value != "" {
+			number, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				writeContractResponse(w)(nil, err)
+				return
+			}
+			req.FromSequenceNumber = number
+		}
+		writeContractResponse(w)(backend.LoadEvent(ctx, req))
+	})
+	return mux
+}
+
+func writeContractResponse(w http.ResponseWriter) func(data interface{}, err error) {
+	return func(data interface{}, err error) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(data)
+	}
+}
+
+//
+// contractGrpcClient
+// @Description: 模拟 dapr gRPC 客户端，类型化方法直接调用内存事件存储，用于需要改写客户端返回值的测试。
+// 契约测试的 gRPC 方式使用 newContractGrpcEventStorage 启动的 pb 服务
+//
+type contractGrpcClient struct {
+	daprclient.DaprDddClient
+	backend EventStorage
+}
+
+func (c *contractGrpcClient) LoadEvents(ctx context.Context, req *daprclient.LoadEventsRequest) (*daprclient.LoadEventsResponse, error) {
+	return c.backend.LoadEvent(ctx, req)
+}
+
+func (c *contractGrpcClient) ApplyEvent(ctx context.Context, req *daprclient.ApplyEventRequest) (*daprclient.ApplyEventResponse, error) {
+	return c.backend.ApplyEvent(ctx, req)
+}
+
+func (c *contractGrpcClient) CreateEvent(ctx context.Context, req *daprclient.CreateEventRequest) (*daprclient.CreateEventResponse, error) {
+	return c.backend.CreateEvent(ctx, req)
+}
+
+func (c *contractGrpcClient) DeleteEvent(ctx context.Context, req *daprclient.DeleteEventRequest) (*daprclient.DeleteEventResponse, error) {
+	return c.backend.DeleteEvent(ctx, req)
+}
+
+func (c *contractGrpcClient) SaveSnapshot(ctx context.Context, req *daprclient.SaveSnapshotRequest) (*daprclient.SaveSnapshotResponse, error) {
+	return c.backend.SaveSnapshot(ctx, req)
+}
+
+func (c *contractGrpcClient) GetRelations(ctx context.Context, req *daprclient.GetRelationsRequest) (*daprclient.GetRelationsResponse, error) {
+	return c.backend.GetRelations(ctx, req)
+}
+
+func (c *contractGrpcClient) GetEvents(ctx context.Context, req *daprclient.GetEventsRequest) (*daprclient.GetEventsResponse, error) {
+	return c.backend.GetEvents(ctx, req)
+}
@@ -31,6 +31,10 @@ func (s *grpcEventStorage) GetPubsubName() string {
 	return s.pubsubName
 }
 
+func (s *grpcEventStorage) SupportsSequenceNumber() bool {
+	return daprclient.GrpcSupportsSequenceNumber()
+}
+
 func (s *grpcEventStorage) LoadAggregate(ctx context.Context, tenantId string, aggregateId string, aggregate Aggregate) (agg Aggregate, isFound bool, resErr error) {
 	defer func() {
 		if e := recover(); e != nil {
@@ -84,6 +88,7 @@ func (s *grpcEventStorage) LoadAggregate(ctx context.Context, tenantId string, a
 			}
 		}
 	}
+	setAggregateSequenceNumber(ctx, tenantId, aggregateId, resp)
 	return aggregate, true, err
 }
 
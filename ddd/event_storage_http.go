@@ -10,6 +10,8 @@ import (
 	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd/ddd_utils"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"strconv"
 )
 
 const (
@@ -19,6 +21,9 @@ const (
 	ApiEventStorageLoadEvents     = "/v1.0/event-storage/events/%s/%s"
 )
 
+// ErrHttpEventStorageUnsupported sidecar 的事件存储 HTTP API 没有对应的接口，需要使用 NewGrpcEventStorage
+var ErrHttpEventStorageUnsupported = errors.New("operation is not supported by the dapr event storage http api")
+
 type httpEventStorage struct {
 	client     daprclient.DaprDddClient
 	pubsubName string
@@ -26,28 +31,23 @@ type httpEventStorage struct {
 }
 
 func (s *httpEventStorage) GetEvents(ctx context.Context, req *daprclient.GetEventsRequest) (*daprclient.GetEventsResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	return nil, newHttpEventStorageUnsupportedError("GetEvents")
 }
 
 func (s *httpEventStorage) GetRelations(ctx context.Context, req *daprclient.GetRelationsRequest) (*daprclient.GetRelationsResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	return nil, newHttpEventStorageUnsupportedError("GetRelations")
 }
 
 func (s *httpEventStorage) LoadEvent(ctx context.Context, req *daprclient.LoadEventsRequest) (*daprclient.LoadEventsResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	return s.LoadEvents(ctx, req)
 }
 
 func (s *httpEventStorage) CreateEvent(ctx context.Context, req *daprclient.CreateEventRequest) (*daprclient.CreateEventResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	return nil, newHttpEventStorageUnsupportedError("CreateEvent")
 }
 
 func (s *httpEventStorage) DeleteEvent(ctx context.Context, req *daprclient.DeleteEventRequest) (*daprclient.DeleteEventResponse, error) {
-	//TODO implement me
-	panic("implement me")
+	return nil, newHttpEventStorageUnsupportedError("DeleteEvent")
 }
 
 func NewHttpEventStorage(httpClient daprclient.DaprDddClient, options ...func(s EventStorage)) (EventStorage, error) {
@@ -78,8 +78,9 @@ func (s *httpEventStorage) LoadAggregate(ctx context.Context, tenantId string, a
 	}
 
 	req := &daprclient.LoadEventsRequest{
-		TenantId:    tenantId,
-		AggregateId: aggregateId,
+		TenantId:      tenantId,
+		AggregateType: aggregate.GetAggregateType(),
+		AggregateId:   aggregateId,
 	}
 
 	resp, err := s.LoadEvents(ctx, req)
@@ -108,11 +109,28 @@ func (s *httpEventStorage) LoadAggregate(ctx context.Context, tenantId string, a
 			}
 		}
 	}
+	setAggregateSequenceNumber(ctx, tenantId, aggregateId, resp)
 	return aggregate, true, nil
 }
 
 func (s *httpEventStorage) LoadEvents(ctx context.Context, req *daprclient.LoadEventsRequest) (res *daprclient.LoadEventsResponse, resErr error) {
-	url := fmt.Sprintf(ApiEventStorageLoadEvents, req.TenantId, req.AggregateId)
+	if err := ddd_utils.IsEmpty(req.TenantId, "TenantId"); err != nil {
+		return nil, err
+	}
+	if err := ddd_utils.IsEmpty(req.AggregateId, "AggregateId"); err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf(ApiEventStorageLoadEvents, neturl.PathEscape(req.TenantId), neturl.PathEscape(req.AggregateId))
+	query := neturl.Values{}
+	if len(req.AggregateType) > 0 {
+		query.Set("aggregateType", req.AggregateType)
+	}
+	if req.FromSequenceNumber > 0 {
+		query.Set("fromSequenceNumber", strconv.FormatUint(req.FromSequenceNumber, 10))
+	}
+	if len(query) > 0 {
+		url = url + "?" + query.Encode()
+	}
 	data := &daprclient.LoadEventsResponse{}
 	s.client.HttpGet(ctx, url).OnSuccess(data, func() error {
 		res = data
@@ -134,28 +152,8 @@ func (s *httpEventStorage) ApplyEvent(ctx context.Context, req *daprclient.Apply
 	if req.Events == nil {
 		return nil, errors.New("EventData cannot be null.")
 	}
-	for _, e := range req.Events {
-		if err := ddd_utils.IsEmpty(e.CommandId, "CommandId"); err != nil {
-			return nil, err
-		}
-		if err := ddd_utils.IsEmpty(e.PubsubName, "PubsubName"); err != nil {
-			return nil, err
-		}
-		if err := ddd_utils.IsEmpty(e.EventType, "EventType"); err != nil {
-			return nil, err
-		}
-		if err := ddd_utils.IsEmpty(e.EventId, "EventId"); err != nil {
-			return nil, err
-		}
-		if err := ddd_utils.IsEmpty(e.EventVersion, "EventVersion"); err != nil {
-			return nil, err
-		}
-		if err := ddd_utils.IsEmpty(e.Topic, "Topic"); err != nil {
-			return nil, err
-		}
-		if len(e.PubsubName) == 0 {
-			e.PubsubName = s.pubsubName
-		}
+	if err := s.checkEvents(req.Events); err != nil {
+		return nil, err
 	}
 
 	data := &daprclient.ApplyEventResponse{}
@@ -181,7 +179,7 @@ func (s *httpEventStorage) SaveSnapshot(ctx context.Context, req *daprclient.Sav
 }
 
 func (s *httpEventStorage) ExistAggregate(ctx context.Context, tenantId string, aggregateId string) (isFind bool, resErr error) {
-	url := fmt.Sprintf(ApiEventStorageExistAggregate, tenantId, aggregateId)
+	url := fmt.Sprintf(ApiEventStorageExistAggregate, neturl.PathEscape(tenantId), neturl.PathEscape(aggregateId))
 	data := &daprclient.ExistAggregateResponse{}
 	isFind = false
 	s.client.HttpGet(ctx, url).OnSuccess(data, func() error {
@@ -193,6 +191,37 @@ func (s *httpEventStorage) ExistAggregate(ctx context.Context, tenantId string,
 	return
 }
 
+//
+// checkEvents
+// @Description: 设置事件默认的 PubsubName 并检查必填字段，与 gRPC 方式的检查一致
+//
+func (s *httpEventStorage) checkEvents(events []*daprclient.EventDto) error {
+	for _, e := range events {
+		if len(e.PubsubName) == 0 {
+			e.PubsubName = s.pubsubName
+		}
+		if err := ddd_utils.IsEmpty(e.CommandId, "CommandId"); err != nil {
+			return err
+		}
+		if err := ddd_utils.IsEmpty(e.PubsubName, "PubsubName"); err != nil {
+			return err
+		}
+		if err := ddd_utils.IsEmpty(e.EventType, "EventType"); err != nil {
+			return err
+		}
+		if err := ddd_utils.IsEmpty(e.EventId, "EventId"); err != nil {
+			return err
+		}
+		if err := ddd_utils.IsEmpty(e.EventVersion, "EventVersion"); err != nil {
+			return err
+		}
+		if err := ddd_utils.IsEmpty(e.Topic, "Topic"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *httpEventStorage) getBodyBytes(resp *http.Response) ([]byte, error) {
 	bytes, err := io.ReadAll(resp.Body)
 	defer func(Body io.ReadCloser) {
@@ -204,3 +233,7 @@ func (s *httpEventStorage) getBodyBytes(resp *http.Response) ([]byte, error) {
 
 	return bytes, err
 }
+
+func newHttpEventStorageUnsupportedError(method string) error {
+	return fmt.Errorf("%w: httpEventStorage.%s(), use ddd.NewGrpcEventStorage instead", ErrHttpEventStorageUnsupported, method)
+}
@@ -0,0 +1,634 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/assert"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd/ddd_utils"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//
+// memoryEventStorage
+// @Description: 内存事件存储器，不依赖dapr sidecar，用于单元测试与本地开发。
+//
+type memoryEventStorage struct {
+	mu         sync.RWMutex
+	pubsubName string
+	aggregates map[string]*memoryAggregate
+	eventIds   map[string]string
+}
+
+type memoryAggregate struct {
+	tenantId      string
+	aggregateId   string
+	aggregateType string
+	isDeleted     bool
+	events        []*memoryEvent
+	snapshots     []*daprclient.Snapshot
+	relations     map[string][]string
+}
+
+type memoryEvent struct {
+	tenantId       string
+	aggregateId    string
+	aggregateType  string
+	eventId        string
+	commandId      string
+	eventType      string
+	eventVersion   string
+	eventTime      time.Time
+	pubsubName     string
+	topic          string
+	eventData      []byte
+	metadata       map[string]string
+	relations      map[string][]string
+	sequenceNumber uint64
+}
+
+func NewMemoryEventStorage(options ...func(s EventStorage)) (EventStorage, error) {
+	res := &memoryEventStorage{
+		aggregates: make(map[string]*memoryAggregate),
+		eventIds:   make(map[string]string),
+	}
+	for _, option := range options {
+		option(res)
+	}
+	return res, nil
+}
+
+func (s *memoryEventStorage) GetPubsubName() string {
+	return s.pubsubName
+}
+
+func (s *memoryEventStorage) LoadAggregate(ctx context.Context, tenantId string, aggregateId string, aggregate Aggregate) (Aggregate, bool, error) {
+	if err := assert.NotNil(aggregate, assert.NewOptions("aggregate is nil")); err != nil {
+		return nil, false, err
+	}
+	if err := assert.NotEmpty(aggregateId, assert.NewOptions("aggregateId is nil")); err != nil {
+		return nil, false, err
+	}
+	if err := assert.NotEmpty(tenantId, assert.NewOptions("tenantId is nil")); err != nil {
+		return nil, false, err
+	}
+
+	req := &daprclient.LoadEventsRequest{
+		TenantId:      tenantId,
+		AggregateType: aggregate.GetAggregateType(),
+		AggregateId:   aggregateId,
+	}
+	resp, err := s.LoadEvent(ctx, req)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.Snapshot == nil && (resp.EventRecords == nil || len(*resp.EventRecords) == 0) {
+		return nil, false, nil
+	}
+
+	if resp.Snapshot != nil {
+		bytes, err := json.Marshal(resp.Snapshot.AggregateData)
+		if err != nil {
+			return nil, false, err
+		}
+		if err = json.Unmarshal(bytes, aggregate); err != nil {
+			return nil, false, err
+		}
+	}
+	if resp.EventRecords != nil {
+		for _, record := range *resp.EventRecords {
+			if err = CallEventHandler(ctx, aggregate, &record); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	setAggregateSequenceNumber(ctx, tenantId, aggregateId, resp)
+	return aggregate, true, nil
+}
+
+func (s *memoryEventStorage) LoadEvent(ctx context.Context, req *daprclient.LoadEventsRequest) (*daprclient.LoadEventsResponse, error) {
+	if err := ddd_utils.IsEmpty(req.TenantId, "TenantId"); err != nil {
+		return nil, err
+	}
+	if err := ddd_utils.IsEmpty(req.AggregateId, "AggregateId"); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	resp := &daprclient.LoadEventsResponse{
+		TenantId:      req.TenantId,
+		AggregateId:   req.AggregateId,
+		AggregateType: req.AggregateType,
+		Headers:       daprclient.NewResponseHeaders(daprclient.ResponseStatusSuccess, nil, nil),
+	}
+	records := make([]daprclient.EventRecord, 0)
+	resp.EventRecords = &records
+
+	agg, ok := s.aggregates[s.getAggregateKey(req.TenantId, req.AggregateId)]
+	if !ok {
+		return resp, nil
+	}
+	resp.AggregateType = agg.aggregateType
+
+	sequenceNumber := req.FromSequenceNumber
+	if count := len(agg.snapshots); count > 0 && req.FromSequenceNumber == 0 {
+		snapshot := agg.snapshots[count-1]
+		aggregateData := make(map[string]interface{})
+		for k, v := range snapshot.AggregateData {
+			aggregateData[k] = v
+		}
+		resp.Snapshot = &daprclient.Snapshot{
+			AggregateData:     aggregateData,
+			AggregateRevision: snapshot.AggregateRevision,
+			SequenceNumber:    snapshot.SequenceNumber,
+			Metadata:          copyStringMap(snapshot.Metadata),
+		}
+		sequenceNumber = snapshot.SequenceNumber
+	}
+
+	for _, event := range agg.events {
+		if event.sequenceNumber <= sequenceNumber {
+			continue
+		}
+		record, err := event.newEventRecord()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+	resp.EventRecords = &records
+	return resp, nil
+}
+
+func (s *memoryEventStorage) ApplyEvent(ctx context.Context, req *daprclient.ApplyEventRequest) (*daprclient.ApplyEventResponse, error) {
+	headers, sequenceNumber, err := s.saveEvents(EventApply, req.TenantId, req.AggregateId, req.AggregateType, req.ExpectedSequenceNumber, req.Events)
+	if err != nil {
+		return nil, err
+	}
+	return &daprclient.ApplyEventResponse{Headers: headers, SequenceNumber: sequenceNumber}, nil
+}
+
+func (s *memoryEventStorage) CreateEvent(ctx context.Context, req *daprclient.CreateEventRequest) (*daprclient.CreateEventResponse, error) {
+	headers, sequenceNumber, err := s.saveEvents(EventCreate, req.TenantId, req.AggregateId, req.AggregateType, 0, req.Events)
+	if err != nil {
+		return nil, err
+	}
+	return &daprclient.CreateEventResponse{Headers: headers, SequenceNumber: sequenceNumber}, nil
+}
+
+func (s *memoryEventStorage) DeleteEvent(ctx context.Context, req *daprclient.DeleteEventRequest) (*daprclient.DeleteEventResponse, error) {
+	if req.Event == nil {
+		return nil, errors.New("req.event cannot be nil")
+	}
+	headers, sequenceNumber, err := s.saveEvents(EventDelete, req.TenantId, req.AggregateId, req.AggregateType, 0, []*daprclient.EventDto{req.Event})
+	if err != nil {
+		return nil, err
+	}
+	return &daprclient.DeleteEventResponse{Headers: headers, SequenceNumber: sequenceNumber}, nil
+}
+
+func (s *memoryEventStorage) SaveSnapshot(ctx context.Context, req *daprclient.SaveSnapshotRequest) (*daprclient.SaveSnapshotResponse, error) {
+	if err := ddd_utils.IsEmpty(req.TenantId, "tenantId"); err != nil {
+		return nil, err
+	}
+	if err := ddd_utils.IsEmpty(req.AggregateId, "AggregateId"); err != nil {
+		return nil, err
+	}
+	if err := ddd_utils.IsEmpty(req.AggregateType, "AggregateType"); err != nil {
+		return nil, err
+	}
+	if err := ddd_utils.IsEmpty(req.AggregateVersion, "AggregateVersion"); err != nil {
+		return nil, err
+	}
+
+	aggregateData := make(map[string]interface{})
+	bytes, err := json.Marshal(req.AggregateData)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(bytes, &aggregateData); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agg, ok := s.aggregates[s.getAggregateKey(req.TenantId, req.AggregateId)]
+	if !ok {
+		return nil, errors.NewAggregateIdNotFondError(req.AggregateId)
+	}
+	agg.snapshots = append(agg.snapshots, &daprclient.Snapshot{
+		AggregateData:     aggregateData,
+		AggregateRevision: req.AggregateVersion,
+		SequenceNumber:    req.SequenceNumber,
+		Metadata:          copyStringMap(req.Metadata),
+	})
+	return &daprclient.SaveSnapshotResponse{
+		Headers: daprclient.NewResponseHeaders(daprclient.ResponseStatusSuccess, nil, nil),
+	}, nil
+}
+
+func (s *memoryEventStorage) GetEvents(ctx context.Context, req *daprclient.GetEventsRequest) (*daprclient.GetEventsResponse, error) {
+	if req == nil {
+		return nil, errors.New("memoryEventStorage.GetEvents(ctx, req) error: req is nil")
+	}
+	if len(req.TenantId) == 0 {
+		return nil, errors.New("memoryEventStorage.GetEvents(ctx, req) error: req.TenantId is nil")
+	}
+	if len(req.AggregateType) == 0 {
+		return nil, errors.New("memoryEventStorage.GetEvents(ctx, req) error: req.AggregateType is nil")
+	}
+	filter, err := newMemoryFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var docs []map[string]interface{}
+	events := make(map[string]*memoryEvent)
+	for _, agg := range s.aggregates {
+		if agg.tenantId != req.TenantId || agg.aggregateType != req.AggregateType {
+			continue
+		}
+		for _, event := range agg.events {
+			doc, err := event.newDoc()
+			if err != nil {
+				return nil, err
+			}
+			if filter.Match(doc) {
+				docs = append(docs, doc)
+				events[event.eventId] = event
+			}
+		}
+	}
+	if len(req.Sort) == 0 {
+		err = sortMemoryDocs(docs, "aggregateId:asc,sequenceNumber:asc")
+	} else {
+		err = sortMemoryDocs(docs, req.Sort)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	page, totalPages := pagingMemoryDocs(docs, req.PageNum, req.PageSize)
+	data := make([]*daprclient.GetEventsItem, 0)
+	for _, doc := range page {
+		item, err := events[doc["eventId"].(string)].newGetEventsItem()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, item)
+	}
+
+	return &daprclient.GetEventsResponse{
+		Headers:    daprclient.NewResponseHeaders(daprclient.ResponseStatusSuccess, nil, nil),
+		Data:       data,
+		TotalRows:  uint64(len(docs)),
+		TotalPages: totalPages,
+		PageNum:    req.PageNum,
+		PageSize:   req.PageSize,
+		Filter:     req.Filter,
+		Sort:       req.Sort,
+		IsFound:    len(docs) > 0,
+	}, nil
+}
+
+func (s *memoryEventStorage) GetRelations(ctx context.Context, req *daprclient.GetRelationsRequest) (*daprclient.GetRelationsResponse, error) {
+	if req == nil {
+		return nil, errors.New("memoryEventStorage.GetRelations(ctx, req) error: req is nil")
+	}
+	if len(req.TenantId) == 0 {
+		return nil, errors.New("memoryEventStorage.GetRelations(ctx, req) error: req.TenantId is nil")
+	}
+	if len(req.AggregateType) == 0 {
+		return nil, errors.New("memoryEventStorage.GetRelations(ctx, req) error: req.AggregateType is nil")
+	}
+	filter, err := newMemoryFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var docs []map[string]interface{}
+	for _, agg := range s.aggregates {
+		if agg.tenantId != req.TenantId || agg.aggregateType != req.AggregateType {
+			continue
+		}
+		doc := agg.newRelationDoc()
+		if filter.Match(doc) {
+			docs = append(docs, doc)
+		}
+	}
+	sortText := req.Sort
+	if len(sortText) == 0 {
+		sortText = "aggregateId:asc"
+	}
+	if err = sortMemoryDocs(docs, sortText); err != nil {
+		return nil, err
+	}
+
+	page, totalPages := pagingMemoryDocs(docs, req.PageNum, req.PageSize)
+	data := make([]*daprclient.Relation, 0)
+	for _, doc := range page {
+		agg := s.aggregates[s.getAggregateKey(req.TenantId, doc["aggregateId"].(string))]
+		data = append(data, agg.newRelations()...)
+	}
+
+	return &daprclient.GetRelationsResponse{
+		Headers:    daprclient.NewResponseHeaders(daprclient.ResponseStatusSuccess, nil, nil),
+		Data:       data,
+		TotalRows:  uint64(len(docs)),
+		TotalPages: totalPages,
+		PageNum:    req.PageNum,
+		PageSize:   req.PageSize,
+		Filter:     req.Filter,
+		Sort:       req.Sort,
+		IsFound:    len(docs) > 0,
+	}, nil
+}
+
+//
+// saveEvents
+// @Description: 保存领域事件，同一批次的事件要么全部保存，要么全部不保存。
+// @param callEventType 事件调用类型
+// @param expectedSequenceNumber 期望的聚合当前序号，0表示不检查
+// @return *daprclient.ResponseHeaders
+// @return uint64 保存后聚合最后的事件序号
+// @return error
+//
+func (s *memoryEventStorage) saveEvents(callEventType CallEventType, tenantId, aggregateId, aggregateType string, expectedSequenceNumber uint64, events []*daprclient.EventDto) (*daprclient.ResponseHeaders, uint64, error) {
+	if err := ddd_utils.IsEmpty(tenantId, "tenantId"); err != nil {
+		return nil, 0, err
+	}
+	if err := ddd_utils.IsEmpty(aggregateId, "AggregateId"); err != nil {
+		return nil, 0, err
+	}
+	if err := ddd_utils.IsEmpty(aggregateType, "AggregateType"); err != nil {
+		return nil, 0, err
+	}
+	if len(events) == 0 {
+		return nil, 0, errors.New("req.events cannot be nil")
+	}
+
+	newEvents := make([]*memoryEvent, 0, len(events))
+	for _, e := range events {
+		if len(e.PubsubName) == 0 {
+			e.PubsubName = s.pubsubName
+		}
+		event, err := newMemoryEvent(tenantId, aggregateId, aggregateType, e)
+		if err != nil {
+			return nil, 0, err
+		}
+		newEvents = append(newEvents, event)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range newEvents {
+		if _, ok := s.eventIds[s.getEventKey(tenantId, e.eventId)]; ok {
+			msg := fmt.Sprintf("eventId %s already exists", e.eventId)
+			return daprclient.NewResponseHeaders(daprclient.ResponseStatusEventDuplicate, nil, map[string]string{"message": msg}), 0, nil
+		}
+	}
+
+	key := s.getAggregateKey(tenantId, aggregateId)
+	agg, ok := s.aggregates[key]
+	if callEventType == EventCreate {
+		if ok {
+			return nil, 0, errors.NewAggregateIdExistsError(aggregateId)
+		}
+		agg = &memoryAggregate{
+			tenantId:      tenantId,
+			aggregateId:   aggregateId,
+			aggregateType: aggregateType,
+			relations:     make(map[string][]string),
+		}
+		s.aggregates[key] = agg
+	} else if !ok {
+		return nil, 0, errors.NewAggregateIdNotFondError(aggregateId)
+	} else if agg.isDeleted {
+		// 与 sidecar 一致：已删除的聚合根不再接受新事件
+		return nil, 0, errors.ErrorOf("aggregate root id %s has been deleted", aggregateId)
+	}
+
+	sequenceNumber := uint64(len(agg.events))
+	if expectedSequenceNumber > 0 && expectedSequenceNumber != sequenceNumber {
+		values := map[string]string{"actualSequenceNumber": strconv.FormatUint(sequenceNumber, 10)}
+		headers := daprclient.NewResponseHeaders(daprclient.ResponseStatusConcurrencyConflict, nil, values)
+		headers.Message = errors.NewConcurrencyConflictError(aggregateId, expectedSequenceNumber, sequenceNumber).Error()
+		return headers, 0, nil
+	}
+	for _, e := range newEvents {
+		sequenceNumber++
+		e.sequenceNumber = sequenceNumber
+		agg.events = append(agg.events, e)
+		for k, values := range e.relations {
+			agg.relations[k] = values
+		}
+		s.eventIds[s.getEventKey(tenantId, e.eventId)] = key
+	}
+	if callEventType == EventDelete {
+		agg.isDeleted = true
+	}
+	return daprclient.NewResponseHeaders(daprclient.ResponseStatusSuccess, nil, nil), sequenceNumber, nil
+}
+
+func (s *memoryEventStorage) getAggregateKey(tenantId, aggregateId string) string {
+	return fmt.Sprintf("%s/%s", tenantId, aggregateId)
+}
+
+func (s *memoryEventStorage) getEventKey(tenantId, eventId string) string {
+	return fmt.Sprintf("%s/%s", tenantId, eventId)
+}
+
+func newMemoryEvent(tenantId, aggregateId, aggregateType string, e *daprclient.EventDto) (*memoryEvent, error) {
+	if err := ddd_utils.IsEmpty(e.CommandId, "CommandId"); err != nil {
+		return nil, err
+	}
+	if err := ddd_utils.IsEmpty(e.EventType, "EventType"); err != nil {
+		return nil, err
+	}
+	if err := ddd_utils.IsEmpty(e.EventId, "EventId"); err != nil {
+		return nil, err
+	}
+	if err := ddd_utils.IsEmpty(e.EventVersion, "EventVersion"); err != nil {
+		return nil, err
+	}
+	eventData, err := json.Marshal(e.EventData)
+	if err != nil {
+		return nil, err
+	}
+	eventTime := time.Now()
+	if e.EventTime != nil {
+		eventTime = *e.EventTime
+	}
+	return &memoryEvent{
+		tenantId:      tenantId,
+		aggregateId:   aggregateId,
+		aggregateType: aggregateType,
+		eventId:       e.EventId,
+		commandId:     e.CommandId,
+		eventType:     e.EventType,
+		eventVersion:  e.EventVersion,
+		eventTime:     eventTime,
+		pubsubName:    e.PubsubName,
+		topic:         e.Topic,
+		eventData:     eventData,
+		metadata:      copyStringMap(e.Metadata),
+		relations:     newMemoryRelationValues(e),
+	}, nil
+}
+
+func (e *memoryEvent) getEventData() (map[string]interface{}, error) {
+	eventData := make(map[string]interface{})
+	if err := json.Unmarshal(e.eventData, &eventData); err != nil {
+		return nil, err
+	}
+	return eventData, nil
+}
+
+func (e *memoryEvent) newEventRecord() (*daprclient.EventRecord, error) {
+	eventData, err := e.getEventData()
+	if err != nil {
+		return nil, err
+	}
+	return &daprclient.EventRecord{
+		TenantId:       e.tenantId,
+		AggregateId:    e.aggregateId,
+		EventId:        e.eventId,
+		EventData:      eventData,
+		EventType:      e.eventType,
+		EventVersion:   e.eventVersion,
+		SequenceNumber: e.sequenceNumber,
+		Metadata:       copyStringMap(e.metadata),
+	}, nil
+}
+
+func (e *memoryEvent) newGetEventsItem() (*daprclient.GetEventsItem, error) {
+	eventData, err := e.getEventData()
+	if err != nil {
+		return nil, err
+	}
+	eventTime := e.eventTime
+	return &daprclient.GetEventsItem{
+		EventId:        e.eventId,
+		CommandId:      e.commandId,
+		EventData:      eventData,
+		EventType:      e.eventType,
+		EventVersion:   e.eventVersion,
+		EventTime:      &eventTime,
+		PubsubName:     e.pubsubName,
+		Topic:          e.topic,
+		Metadata:       copyStringMap(e.metadata),
+		AggregateId:    e.aggregateId,
+		SequenceNumber: e.sequenceNumber,
+	}, nil
+}
+
+func (e *memoryEvent) newDoc() (map[string]interface{}, error) {
+	eventData, err := e.getEventData()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"tenantId":       e.tenantId,
+		"aggregateId":    e.aggregateId,
+		"aggregateType":  e.aggregateType,
+		"eventId":        e.eventId,
+		"commandId":      e.commandId,
+		"eventType":      e.eventType,
+		"eventVersion":   e.eventVersion,
+		"eventTime":      e.eventTime,
+		"pubsubName":     e.pubsubName,
+		"topic":          e.topic,
+		"sequenceNumber": e.sequenceNumber,
+		"eventData":      eventData,
+	}, nil
+}
+
+func (a *memoryAggregate) newRelationDoc() map[string]interface{} {
+	doc := map[string]interface{}{
+		"id":          a.aggregateId,
+		"tenantId":    a.tenantId,
+		"aggregateId": a.aggregateId,
+		"tableName":   a.aggregateType,
+		"isDeleted":   a.isDeleted,
+	}
+	for k, values := range a.relations {
+		if _, ok := doc[k]; ok {
+			continue
+		}
+		if len(values) == 1 {
+			doc[k] = values[0]
+		} else {
+			items := make([]interface{}, 0, len(values))
+			for _, v := range values {
+				items = append(items, v)
+			}
+			doc[k] = items
+		}
+	}
+	return doc
+}
+
+func (a *memoryAggregate) newRelations() []*daprclient.Relation {
+	names := make([]string, 0, len(a.relations))
+	for name := range a.relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	relations := make([]*daprclient.Relation, 0, len(names))
+	for _, name := range names {
+		for i, value := range a.relations[name] {
+			id := fmt.Sprintf("%s-%s", a.aggregateId, name)
+			if i > 0 {
+				id = fmt.Sprintf("%s-%d", id, i)
+			}
+			relations = append(relations, &daprclient.Relation{
+				Id:          id,
+				TenantId:    a.tenantId,
+				TableName:   a.aggregateType,
+				AggregateId: a.aggregateId,
+				IsDeleted:   a.isDeleted,
+				RelName:     name,
+				RelValue:    value,
+			})
+		}
+	}
+	return relations
+}
+
+// newMemoryRelationValues 优先使用多值的 RelationValues，没有时使用 Relations
+func newMemoryRelationValues(e *daprclient.EventDto) map[string][]string {
+	res := make(map[string][]string)
+	if len(e.RelationValues) > 0 {
+		for k, values := range e.RelationValues {
+			res[k] = append([]string{}, values...)
+		}
+		return res
+	}
+	for k, v := range e.Relations {
+		res[k] = []string{v}
+	}
+	return res
+}
+
+func copyStringMap(data map[string]string) map[string]string {
+	res := make(map[string]string, len(data))
+	for k, v := range data {
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,331 @@
+package ddd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/rsql"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var memoryTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+//
+// memoryFilter
+// @Description: 内存RSQL过滤器，用于内存事件存储器的查询
+//
+type memoryFilter struct {
+	expr rsql.Expression
+}
+
+func newMemoryFilter(filter string) (*memoryFilter, error) {
+	if len(strings.TrimSpace(filter)) == 0 {
+		return &memoryFilter{}, nil
+	}
+	expr, err := rsql.Parse(filter)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("rsql %s expression error, %s", filter, err.Error()))
+	}
+	return &memoryFilter{expr: expr}, nil
+}
+
+//
+// Match
+// @Description: 判断数据是否满足过滤条件
+// @param doc 数据
+// @return bool
+//
+func (f *memoryFilter) Match(doc map[string]interface{}) bool {
+	if f.expr == nil {
+		return true
+	}
+	return matchExpression(f.expr, doc)
+}
+
+func matchExpression(expr rsql.Expression, doc map[string]interface{}) bool {
+	switch ex := expr.(type) {
+	case rsql.AndExpression:
+		for _, item := range ex.Items {
+			if !matchExpression(item, doc) {
+				return false
+			}
+		}
+		return true
+	case rsql.OrExpression:
+		for _, item := range ex.Items {
+			if matchExpression(item, doc) {
+				return true
+			}
+		}
+		return false
+	case rsql.EqualsComparison:
+		v, ok := getDocValue(doc, ex.Identifier.Val)
+		return ok && compareEquals(v, rsql.GetValue(ex.Val))
+	case rsql.NotEqualsComparison:
+		v, ok := getDocValue(doc, ex.Identifier.Val)
+		return !ok || !compareEquals(v, rsql.GetValue(ex.Val))
+	case rsql.LikeComparison:
+		v, ok := getDocValue(doc, ex.Identifier.Val)
+		return ok && compareLike(v, rsql.GetValue(ex.Val))
+	case rsql.NotLikeComparison:
+		v, ok := getDocValue(doc, ex.Identifier.Val)
+		return !ok || !compareLike(v, rsql.GetValue(ex.Val))
+	case rsql.GreaterThanComparison:
+		return matchOrder(doc, ex.Comparison, func(c int) bool { return c > 0 })
+	case rsql.GreaterThanOrEqualsComparison:
+		return matchOrder(doc, ex.Comparison, func(c int) bool { return c >= 0 })
+	case rsql.LessThanComparison:
+		return matchOrder(doc, ex.Comparison, func(c int) bool { return c < 0 })
+	case rsql.LessThanOrEqualsComparison:
+		return matchOrder(doc, ex.Comparison, func(c int) bool { return c <= 0 })
+	case rsql.InComparison:
+		v, ok := getDocValue(doc, ex.Identifier.Val)
+		return ok && compareIn(v, rsql.GetValue(ex.Val))
+	case rsql.NotInComparison:
+		v, ok := getDocValue(doc, ex.Identifier.Val)
+		return !ok || !compareIn(v, rsql.GetValue(ex.Val))
+	}
+	return false
+}
+
+func matchOrder(doc map[string]interface{}, comparison rsql.Comparison, fun func(c int) bool) bool {
+	v, ok := getDocValue(doc, comparison.Identifier.Val)
+	if !ok {
+		return false
+	}
+	c, ok := compareValue(v, rsql.GetValue(comparison.Val))
+	return ok && fun(c)
+}
+
+//
+// getDocValue
+// @Description: 获取数据字段值，字段名称不区分大小写，支持"eventData.name"形式
+// @param doc 数据
+// @param name 字段名称
+// @return interface{} 字段值
+// @return bool 是否存在
+//
+func getDocValue(doc map[string]interface{}, name string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, key := range strings.Split(name, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; ok {
+			continue
+		}
+		found := false
+		for k, v := range m {
+			if strings.EqualFold(k, key) {
+				current, found = v, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func compareEquals(docValue interface{}, value interface{}) bool {
+	if list, ok := docValue.([]interface{}); ok {
+		for _, item := range list {
+			if compareEquals(item, value) {
+				return true
+			}
+		}
+		return false
+	}
+	c, ok := compareValue(docValue, value)
+	return ok && c == 0
+}
+
+func compareLike(docValue interface{}, value interface{}) bool {
+	reg, err := regexp.Compile("(?im)" + fmt.Sprintf("%v", value))
+	if err != nil {
+		return false
+	}
+	return reg.MatchString(fmt.Sprintf("%v", docValue))
+}
+
+func compareIn(docValue interface{}, value interface{}) bool {
+	list, ok := value.([]interface{})
+	if !ok {
+		return compareEquals(docValue, value)
+	}
+	for _, item := range list {
+		if compareEquals(docValue, item) {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// compareValue
+// @Description: 比较两个值的大小
+// @return int 小于0表示v1<v2，等于0表示相等，大于0表示v1>v2
+// @return bool 是否可以比较
+//
+func compareValue(v1 interface{}, v2 interface{}) (int, bool) {
+	if v1 == nil || v2 == nil {
+		return 0, v1 == v2
+	}
+	if t1, ok := asTime(v1); ok {
+		if t2, ok := asTime(v2); ok {
+			return compareTime(t1, t2), true
+		}
+	}
+	if f1, ok := asFloat(v1); ok {
+		if f2, ok := asFloat(v2); ok {
+			switch {
+			case f1 < f2:
+				return -1, true
+			case f1 > f2:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	if b1, ok := v1.(bool); ok {
+		if b2, ok := v2.(bool); ok {
+			if b1 == b2 {
+				return 0, true
+			}
+			return 1, false
+		}
+	}
+	return strings.Compare(fmt.Sprintf("%v", v1), fmt.Sprintf("%v", v2)), true
+}
+
+func compareTime(t1, t2 time.Time) int {
+	switch {
+	case t1.Before(t2):
+		return -1
+	case t1.After(t2):
+		return 1
+	}
+	return 0
+}
+
+func asTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t != nil {
+			return *t, true
+		}
+	case string:
+		for _, layout := range memoryTimeLayouts {
+			if value, err := time.Parse(layout, t); err == nil {
+				return value, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func asFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+//
+// sortMemoryDocs
+// @Description: 按排序语句对数据排序
+// @param docs 数据
+// @param sortText 排序语句 "name:desc,id:asc"
+// @return error
+//
+func sortMemoryDocs(docs []map[string]interface{}, sortText string) error {
+	if len(strings.TrimSpace(sortText)) == 0 {
+		return nil
+	}
+	type sortItem struct {
+		name string
+		desc bool
+	}
+	var items []sortItem
+	for _, s := range strings.Split(sortText, ",") {
+		list := strings.Split(s, ":")
+		item := sortItem{name: strings.Trim(list[0], " ")}
+		if len(list) > 1 {
+			order := strings.ToLower(strings.Trim(list[1], " "))
+			switch order {
+			case "asc":
+			case "desc":
+				item.desc = true
+			default:
+				return errors.New("order " + order + " is error")
+			}
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, item := range items {
+			v1, _ := getDocValue(docs[i], item.name)
+			v2, _ := getDocValue(docs[j], item.name)
+			c, _ := compareValue(v1, v2)
+			if c == 0 {
+				continue
+			}
+			if item.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return nil
+}
+
+//
+// pagingMemoryDocs
+// @Description: 数据分页, pageNum从0开始
+// @return []map[string]interface{} 当前页数据
+// @return uint64 总页数
+//
+func pagingMemoryDocs(docs []map[string]interface{}, pageNum uint64, pageSize uint64) ([]map[string]interface{}, uint64) {
+	total := uint64(len(docs))
+	if pageSize == 0 {
+		if total == 0 {
+			return docs, 0
+		}
+		return docs, 1
+	}
+	totalPages := total / pageSize
+	if total%pageSize > 0 {
+		totalPages++
+	}
+	start := pageNum * pageSize
+	if start >= total {
+		return []map[string]interface{}{}, totalPages
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return docs[start:end], totalPages
+}
@@ -0,0 +1,484 @@
+package ddd
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryEventStorage_ApplyEvent(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+
+	agg := &memAggregate{}
+	if _, err := CreateEvent(ctx, agg, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApplyEvent(ctx, agg, newMemUpdatedEvent("tenant-1", "agg-1", "name-2")); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, find, err := LoadAggregate(ctx, "tenant-1", "agg-1", &memAggregate{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !find {
+		t.Fatal("aggregate not found")
+	}
+	if name := loaded.(*memAggregate).Name; name != "name-2" {
+		t.Errorf("name = %s, want name-2", name)
+	}
+
+	if _, err := CreateEvent(ctx, &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err == nil {
+		t.Error("create an existing aggregate should return error")
+	}
+}
+
+func TestMemoryEventStorage_GetEvents(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+
+	for _, id := range []string{"agg-1", "agg-2"} {
+		agg := &memAggregate{}
+		if _, err := CreateEvent(ctx, agg, newMemCreatedEvent("tenant-1", id, id, "user-"+id)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ApplyEvent(ctx, agg, newMemUpdatedEvent("tenant-1", id, id+"-new")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := &daprclient.GetEventsRequest{
+		TenantId:      "tenant-1",
+		AggregateType: memAggregateType,
+		Filter:        `eventType=="test.MemUpdatedEvent" and eventData.data.name=in=("agg-2-new","none")`,
+	}
+	resp, err := GetEvents(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.TotalRows != 1 || len(resp.Data) != 1 {
+		t.Fatalf("totalRows = %d, want 1", resp.TotalRows)
+	}
+
+	req = &daprclient.GetEventsRequest{
+		TenantId:      "tenant-1",
+		AggregateType: memAggregateType,
+		Sort:          "sequenceNumber:desc",
+		PageNum:       0,
+		PageSize:      3,
+	}
+	if resp, err = GetEvents(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if resp.TotalRows != 4 || resp.TotalPages != 2 || len(resp.Data) != 3 {
+		t.Fatalf("totalRows = %d, totalPages = %d, len = %d", resp.TotalRows, resp.TotalPages, len(resp.Data))
+	}
+	if resp.Data[0].EventType != "test.MemUpdatedEvent" {
+		t.Errorf("eventType = %s, want test.MemUpdatedEvent", resp.Data[0].EventType)
+	}
+}
+
+func TestMemoryEventStorage_GetRelations(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+
+	if _, err := CreateEvent(ctx, &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	ok, total, _, err := HasRelations(ctx, "tenant-1", memAggregateType, NewWhereOptions().AddWhere("userId", "user-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || total != 1 {
+		t.Errorf("HasRelations() = %v, %d; want true, 1", ok, total)
+	}
+	if ok, err = HasAggregate(ctx, "tenant-1", memAggregateType, "agg-2"); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Error("HasAggregate() = true, want false")
+	}
+}
+
+func TestMemoryEventStorage_RelationValues(t *testing.T) {
+	ctx := context.Background()
+	eventStorage := newMemoryStorage(t)
+
+	event := newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")
+	if _, err := eventStorage.CreateEvent(ctx, &daprclient.CreateEventRequest{
+		TenantId:      "tenant-1",
+		AggregateId:   "agg-1",
+		AggregateType: memAggregateType,
+		Events: []*daprclient.EventDto{{
+			EventId:        event.EventId,
+			CommandId:      event.CommandId,
+			EventData:      event,
+			EventType:      event.GetEventType(),
+			EventVersion:   event.GetEventVersion(),
+			Relations:      map[string]string{"userId": "user-1"},
+			RelationValues: map[string][]string{"userId": {"user-1", "user-2"}},
+		}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, userId := range []string{"user-1", "user-2"} {
+		ok, _, _, err := HasRelations(ctx, "tenant-1", memAggregateType, NewWhereOptions().AddWhere("userId", userId))
+		if err != nil || !ok {
+			t.Errorf("HasRelations(%s) = %v, %v; want true", userId, ok, err)
+		}
+	}
+	resp, err := eventStorage.GetRelations(ctx, &daprclient.GetRelationsRequest{TenantId: "tenant-1", AggregateType: memAggregateType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 || resp.Data[0].Id == resp.Data[1].Id {
+		t.Errorf("relations = %v, want 2 rows with distinct ids", resp.Data)
+	}
+}
+
+func TestMemoryEventStorage_SaveSnapshot(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+
+	agg := &memAggregate{}
+	if _, err := CreateEvent(ctx, agg, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	eventStorage, _ := GetEventStorage("")
+	_, err := eventStorage.SaveSnapshot(ctx, &daprclient.SaveSnapshotRequest{
+		TenantId:         "tenant-1",
+		AggregateId:      "agg-1",
+		AggregateType:    memAggregateType,
+		AggregateData:    agg,
+		AggregateVersion: agg.GetAggregateVersion(),
+		SequenceNumber:   1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApplyEvent(ctx, agg, newMemUpdatedEvent("tenant-1", "agg-1", "name-2")); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := eventStorage.LoadEvent(ctx, &daprclient.LoadEventsRequest{TenantId: "tenant-1", AggregateId: "agg-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Snapshot == nil || len(*resp.EventRecords) != 1 {
+		t.Fatalf("snapshot = %v, events = %d", resp.Snapshot, len(*resp.EventRecords))
+	}
+	if seq := (*resp.EventRecords)[0].SequenceNumber; seq != 2 {
+		t.Errorf("sequenceNumber = %d, want 2", seq)
+	}
+}
+
+func TestMemoryEventStorage_ConcurrencyConflict(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+
+	if _, err := CreateEvent(ctx, &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	opt := &ApplyEventOptions{}
+	if _, err := ApplyEvent(ctx, &memAggregate{}, newMemUpdatedEvent("tenant-1", "agg-1", "name-2"), opt.SetExpectedSequenceNumber(1)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ApplyEvent(ctx, &memAggregate{}, newMemUpdatedEvent("tenant-1", "agg-1", "name-3"), opt.SetExpectedSequenceNumber(1))
+	if !errors.IsErrorConcurrencyConflict(err) {
+		t.Fatalf("err = %v, want concurrency conflict error", err)
+	}
+}
+
+func TestMemoryEventStorage_ApplyDeleted(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+
+	if _, err := CreateEvent(ctx, &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeleteEvent(ctx, &memAggregate{}, newMemUpdatedEvent("tenant-1", "agg-1", "deleted")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApplyEvent(ctx, &memAggregate{}, newMemUpdatedEvent("tenant-1", "agg-1", "name-2")); err == nil {
+		t.Error("apply event to a deleted aggregate should return error")
+	}
+	if _, err := DeleteEvent(ctx, &memAggregate{}, newMemUpdatedEvent("tenant-1", "agg-1", "deleted")); err == nil {
+		t.Error("delete a deleted aggregate should return error")
+	}
+}
+
+func TestApplyEvents(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+
+	agg := &memAggregate{}
+	if _, err := CreateEvent(ctx, agg, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	events := []DomainEvent{newMemUpdatedEvent("tenant-1", "agg-1", "name-2"), newMemUpdatedEvent("tenant-1", "agg-1", "name-3")}
+	if _, err := ApplyEvents(ctx, agg, events); err != nil {
+		t.Fatal(err)
+	}
+	if agg.Name != "name-3" {
+		t.Errorf("name = %s, want name-3", agg.Name)
+	}
+
+	events = []DomainEvent{newMemUpdatedEvent("tenant-1", "agg-1", "name-4"), newMemUpdatedEvent("tenant-1", "agg-1", "name-5")}
+	opt := &ApplyEventOptions{}
+	if _, err := ApplyEvents(ctx, agg, events, opt.SetExpectedSequenceNumber(1)); !errors.IsErrorConcurrencyConflict(err) {
+		t.Fatalf("err = %v, want concurrency conflict error", err)
+	}
+	if agg.Name != "name-3" {
+		t.Errorf("name = %s, aggregate should be rolled back to name-3", agg.Name)
+	}
+
+	eventStorage, _ := GetEventStorage("")
+	resp, err := eventStorage.LoadEvent(ctx, &daprclient.LoadEventsRequest{TenantId: "tenant-1", AggregateId: "agg-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := len(*resp.EventRecords); count != 3 {
+		t.Errorf("events = %d, want 3", count)
+	}
+}
+
+func TestApplyEvents_RestoreMapField(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+
+	agg := &defaultsAggregate{Tags: map[string]string{"k": "v"}}
+	if _, err := CreateEvent(ctx, agg, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	events := []DomainEvent{newMemUpdatedEvent("tenant-1", "agg-1", "name-2"), newMemUpdatedEvent("tenant-1", "agg-1", "fail")}
+	if _, err := ApplyEvents(ctx, agg, events); err == nil {
+		t.Fatal("ApplyEvents() error = nil, want handler error")
+	}
+	if agg.Name != "name-1" || len(agg.Tags) != 1 || agg.Tags["k"] != "v" {
+		t.Errorf("aggregate = %+v, should be restored to name-1 with tags k=v", agg)
+	}
+
+	events = []DomainEvent{newMemUpdatedEvent("tenant-1", "agg-1", "name-3")}
+	opt := &ApplyEventOptions{}
+	if _, err := ApplyEvents(ctx, agg, events, opt.SetExpectedSequenceNumber(5)); !errors.IsErrorConcurrencyConflict(err) {
+		t.Fatalf("err = %v, want concurrency conflict error", err)
+	}
+	if agg.Name != "name-1" || len(agg.Tags) != 1 {
+		t.Errorf("aggregate = %+v, should be restored to name-1 with tags k=v", agg)
+	}
+}
+
+func TestApplyCommand_RetryCount(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+
+	if _, err := CreateEvent(ctx, &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := &MemUpdateCommand{TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-2", concurrent: 1}
+	if err := ApplyCommand(ctx, &memAggregate{}, cmd); !errors.IsErrorConcurrencyConflict(err) {
+		t.Fatalf("err = %v, want concurrency conflict error", err)
+	}
+
+	cmd = &MemUpdateCommand{TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-3", concurrent: 1}
+	agg := &memAggregate{}
+	if err := ApplyCommand(ctx, agg, cmd, NewApplyCommandOptions().SetRetryCount(1)); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.calls != 2 {
+		t.Errorf("calls = %d, want 2", cmd.calls)
+	}
+	if agg.Name != "name-3" {
+		t.Errorf("name = %s, want name-3", agg.Name)
+	}
+}
+
+func TestResetAggregate(t *testing.T) {
+	RegisterAggregateType(defaultsAggregateType, func() Aggregate {
+		return &defaultsAggregate{Tags: map[string]string{"source": "constructor"}}
+	})
+	agg := &defaultsAggregate{memAggregate: memAggregate{Id: "agg-1", Name: "name-1"}, Tags: map[string]string{"k": "v"}}
+	resetAggregate(agg)
+	if agg.Id != "" || agg.Name != "" || len(agg.Tags) != 1 || agg.Tags["source"] != "constructor" {
+		t.Errorf("resetAggregate() = %+v, want constructor state", agg)
+	}
+
+	mem := &memAggregate{Id: "agg-1"}
+	resetAggregate(mem)
+	if mem.Id != "" {
+		t.Errorf("resetAggregate() = %+v, want zero value", mem)
+	}
+}
+
+const defaultsAggregateType = "ddd.defaultsAggregate"
+
+type defaultsAggregate struct {
+	memAggregate
+	Tags map[string]string `json:"tags"`
+}
+
+func (a *defaultsAggregate) GetAggregateType() string {
+	return defaultsAggregateType
+}
+
+func (a *defaultsAggregate) OnMemUpdatedEventV1s0(ctx context.Context, event *memUpdatedEvent) error {
+	a.Tags[event.Data.Name] = event.Data.Name
+	if event.Data.Name == "fail" {
+		return errors.New("update failed")
+	}
+	a.Name = event.Data.Name
+	return nil
+}
+
+const memAggregateType = "ddd.memAggregate"
+
+func init() {
+	_ = RegisterEventType("test.MemCreatedEvent", "v1.0", func() interface{} { return &memCreatedEvent{} })
+	_ = RegisterEventType("test.MemUpdatedEvent", "v1.0", func() interface{} { return &memUpdatedEvent{} })
+	RegisterAggregateType(memAggregateType, func() Aggregate { return &memAggregate{} })
+}
+
+func newMemoryStorage(t *testing.T) EventStorage {
+	eventStorage, err := NewMemoryEventStorage(PubsubName("pubsub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterEventStorage("", eventStorage)
+	return eventStorage
+}
+
+type memAggregate struct {
+	Id       string `json:"id"`
+	TenantId string `json:"tenantId"`
+	Name     string `json:"name"`
+	UserId   string `json:"userId"`
+}
+
+func (a *memAggregate) GetTenantId() string {
+	return a.TenantId
+}
+
+func (a *memAggregate) GetAggregateId() string {
+	return a.Id
+}
+
+func (a *memAggregate) GetAggregateType() string {
+	return memAggregateType
+}
+
+func (a *memAggregate) GetAggregateVersion() string {
+	return "v1.0"
+}
+
+func (a *memAggregate) OnMemCreatedEventV1s0(ctx context.Context, event *memCreatedEvent) error {
+	a.Id = event.Data.Id
+	a.TenantId = event.TenantId
+	a.Name = event.Data.Name
+	a.UserId = event.Data.UserId
+	return nil
+}
+
+func (a *memAggregate) OnMemUpdatedEventV1s0(ctx context.Context, event *memUpdatedEvent) error {
+	a.Name = event.Data.Name
+	return nil
+}
+
+//
+// MemUpdateCommand
+// @Description: 测试命令，concurrent 表示在前几次执行时模拟其它命令并发修改聚合
+//
+type MemUpdateCommand struct {
+	CommandId   string
+	TenantId    string
+	AggregateId string
+	Name        string
+	concurrent  int
+	calls       int
+}
+
+func (a *memAggregate) MemUpdateCommand(ctx context.Context, cmd *MemUpdateCommand, metadata *map[string]string) error {
+	cmd.calls++
+	if cmd.calls <= cmd.concurrent {
+		other := &memAggregate{}
+		if _, err := ApplyEvent(context.Background(), other, newMemUpdatedEvent(cmd.TenantId, cmd.AggregateId, "other")); err != nil {
+			return err
+		}
+	}
+	_, err := ApplyEvent(ctx, a, newMemUpdatedEvent(cmd.TenantId, cmd.AggregateId, cmd.Name))
+	return err
+}
+
+func (c *MemUpdateCommand) GetCommandId() string        { return c.CommandId }
+func (c *MemUpdateCommand) GetTenantId() string         { return c.TenantId }
+func (c *MemUpdateCommand) GetAggregateId() AggregateId { return NewAggregateId(c.AggregateId) }
+func (c *MemUpdateCommand) GetIsValidOnly() bool        { return false }
+func (c *MemUpdateCommand) Validate() error             { return nil }
+
+type memEventBase struct {
+	TenantId    string    `json:"tenantId"`
+	CommandId   string    `json:"commandId"`
+	EventId     string    `json:"eventId"`
+	AggregateId string    `json:"aggregateId"`
+	CreatedTime time.Time `json:"createdTime"`
+}
+
+type memCreatedData struct {
+	Id     string `json:"id" ddd-rel:"-"`
+	Name   string `json:"name"`
+	UserId string `json:"userId" ddd-rel:"userId"`
+}
+
+type memCreatedEvent struct {
+	memEventBase
+	Data memCreatedData `json:"data"`
+}
+
+type memUpdatedData struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type memUpdatedEvent struct {
+	memEventBase
+	Data memUpdatedData `json:"data"`
+}
+
+func newMemEventBase(tenantId, aggregateId string) memEventBase {
+	return memEventBase{
+		TenantId:    tenantId,
+		CommandId:   uuid.New().String(),
+		EventId:     uuid.New().String(),
+		AggregateId: aggregateId,
+		CreatedTime: time.Now(),
+	}
+}
+
+func newMemCreatedEvent(tenantId, id, name, userId string) *memCreatedEvent {
+	return &memCreatedEvent{
+		memEventBase: newMemEventBase(tenantId, id),
+		Data:         memCreatedData{Id: id, Name: name, UserId: userId},
+	}
+}
+
+func newMemUpdatedEvent(tenantId, id, name string) *memUpdatedEvent {
+	return &memUpdatedEvent{
+		memEventBase: newMemEventBase(tenantId, id),
+		Data:         memUpdatedData{Id: id, Name: name},
+	}
+}
+
+func (e *memEventBase) GetTenantId() string       { return e.TenantId }
+func (e *memEventBase) GetCommandId() string      { return e.CommandId }
+func (e *memEventBase) GetEventId() string        { return e.EventId }
+func (e *memEventBase) GetEventVersion() string   { return "v1.0" }
+func (e *memEventBase) GetAggregateId() string    { return e.AggregateId }
+func (e *memEventBase) GetCreatedTime() time.Time { return e.CreatedTime }
+
+func (e *memCreatedEvent) GetEventType() string { return "test.MemCreatedEvent" }
+func (e *memCreatedEvent) GetData() interface{} { return e.Data }
+func (e *memUpdatedEvent) GetEventType() string { return "test.MemUpdatedEvent" }
+func (e *memUpdatedEvent) GetData() interface{} { return e.Data }
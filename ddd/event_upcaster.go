@@ -0,0 +1,136 @@
+package ddd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/assert"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+)
+
+//
+// EventUpcaster
+// @Description: 事件升级函数，将旧版本的事件数据转换为新版本的事件数据
+// @param data 旧版本的事件数据
+// @return map[string]any 新版本的事件数据
+// @return error 错误
+//
+type EventUpcaster func(data map[string]any) (map[string]any, error)
+
+type upcasterItem struct {
+	fromVersion string
+	toVersion   string
+	upcaster    EventUpcaster
+}
+
+//
+// RegisterEventUpcaster
+// @Description: 注册事件升级函数，加载事件时按 fromVersion -> toVersion 链式升级到最新版本，聚合只需保留最新版本的事件处理方法
+// @param eventType 事件类型
+// @param fromVersion 原版本号
+// @param toVersion 目标版本号
+// @param upcaster 升级函数
+// @return error
+//
+func RegisterEventUpcaster(eventType string, fromVersion string, toVersion string, upcaster EventUpcaster) error {
+	if err := assert.NotEmpty(eventType, assert.NewOptions("ddd.RegisterEventUpcaster() eventType is nil")); err != nil {
+		return err
+	}
+	if err := assert.NotEmpty(fromVersion, assert.NewOptions("ddd.RegisterEventUpcaster() fromVersion is nil")); err != nil {
+		return err
+	}
+	if err := assert.NotEmpty(toVersion, assert.NewOptions("ddd.RegisterEventUpcaster() toVersion is nil")); err != nil {
+		return err
+	}
+	if err := assert.NotNil(upcaster, assert.NewOptions("ddd.RegisterEventUpcaster() upcaster is nil")); err != nil {
+		return err
+	}
+	if fromVersion == toVersion {
+		return errors.New(fmt.Sprintf("ddd.RegisterEventUpcaster() %s fromVersion equals toVersion %s", eventType, toVersion))
+	}
+	return _eventTypeRegistry.addUpcaster(eventType, fromVersion, toVersion, upcaster)
+}
+
+//
+// addUpcaster
+// @Description: 添加事件升级函数
+// @receiver r
+// @param eventType 事件类型
+// @param fromVersion 原版本号
+// @param toVersion 目标版本号
+// @param upcaster 升级函数
+// @return error
+//
+func (r *eventTypeRegistry) addUpcaster(eventType string, fromVersion string, toVersion string, upcaster EventUpcaster) error {
+	ts, ok := r.typeMap[eventType]
+	if !ok {
+		ts = newEventType(eventType)
+		r.typeMap[eventType] = ts
+	}
+	if _, ok := ts.upcasterMap[fromVersion]; ok {
+		return errors.New(fmt.Sprintf("%s.%s的升级函数已经存在", eventType, fromVersion))
+	}
+	ts.upcasterMap[fromVersion] = &upcasterItem{
+		fromVersion: fromVersion,
+		toVersion:   toVersion,
+		upcaster:    upcaster,
+	}
+	return nil
+}
+
+//
+// upcastEventRecord
+// @Description: 将事件记录链式升级到已注册的最新版本，没有升级函数时返回原记录
+// @param record 事件记录
+// @return *daprclient.EventRecord 升级后的事件记录
+// @return error
+//
+func upcastEventRecord(record *daprclient.EventRecord) (*daprclient.EventRecord, error) {
+	return upcastEventRecordTo(record, "")
+}
+
+//
+// upcastEventRecordTo
+// @Description: 将事件记录链式升级到指定版本，到达 toVersion 后不再升级；toVersion 为空时升级到最新版本
+// @param record 事件记录
+// @param toVersion 目标版本号
+// @return *daprclient.EventRecord 升级后的事件记录
+// @return error
+//
+func upcastEventRecordTo(record *daprclient.EventRecord, toVersion string) (*daprclient.EventRecord, error) {
+	ts, ok := _eventTypeRegistry.typeMap[record.EventType]
+	if !ok || len(ts.upcasterMap) == 0 {
+		return record, nil
+	}
+	version := record.EventVersion
+	data := record.EventData
+	visited := map[string]bool{version: true}
+	for version != toVersion {
+		item, ok := ts.upcasterMap[version]
+		if !ok {
+			break
+		}
+		if visited[item.toVersion] {
+			return nil, errors.New(fmt.Sprintf("事件 %s 的升级函数存在循环 %s -> %s", record.EventType, version, item.toVersion))
+		}
+		newData, err := item.upcaster(data)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("事件 %s 从 %s 升级到 %s 出错, %s", record.EventType, version, item.toVersion, err.Error()))
+		}
+		data = newData
+		version = item.toVersion
+		visited[version] = true
+	}
+	if version == record.EventVersion {
+		return record, nil
+	}
+	return &daprclient.EventRecord{
+		TenantId:       record.TenantId,
+		AggregateId:    record.AggregateId,
+		EventId:        record.EventId,
+		EventData:      data,
+		EventType:      record.EventType,
+		EventVersion:   version,
+		SequenceNumber: record.SequenceNumber,
+		Metadata:       record.Metadata,
+	}, nil
+}
@@ -0,0 +1,101 @@
+package ddd
+
+import (
+	"context"
+	"errors"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"testing"
+)
+
+func TestCallEventHandler_Upcaster(t *testing.T) {
+	record := &daprclient.EventRecord{
+		EventId:      "event-1",
+		EventType:    "test.UpcastRenamedEvent",
+		EventVersion: "v1.0",
+		EventData: map[string]interface{}{
+			"data": map[string]interface{}{"title": "name-1"},
+		},
+	}
+	handler := &upcastHandler{}
+	if err := CallEventHandler(context.Background(), handler, record); err != nil {
+		t.Fatal(err)
+	}
+	if handler.name != "name-1!" {
+		t.Errorf("name = %s, want name-1!", handler.name)
+	}
+	if record.EventVersion != "v1.0" {
+		t.Errorf("record.EventVersion = %s, the original record should not be changed", record.EventVersion)
+	}
+}
+
+func TestNewDomainEvent_NoUpcast(t *testing.T) {
+	record := &daprclient.EventRecord{
+		EventId:      "event-1",
+		EventType:    "test.UpcastRenamedEvent",
+		EventVersion: "v3.0",
+		EventData: map[string]interface{}{
+			"data": map[string]interface{}{"name": "name-1!"},
+		},
+	}
+	event, err := NewDomainEvent(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := event.(*upcastRenamedEvent).Data.Name; name != "name-1!" {
+		t.Errorf("name = %s, want name-1!", name)
+	}
+
+	record.EventVersion = "v1.0"
+	if _, err := NewDomainEvent(record); err == nil {
+		t.Error("NewDomainEvent should not upcast an old version record")
+	}
+}
+
+func TestRegisterEventUpcaster(t *testing.T) {
+	if err := RegisterEventUpcaster("test.UpcastRenamedEvent", "v1.0", "v3.0", upcastNothing); err == nil {
+		t.Error("register an existing upcaster should return error")
+	}
+	if err := RegisterEventUpcaster("test.UpcastLoopEvent", "v1.0", "v1.0", upcastNothing); err == nil {
+		t.Error("register an upcaster to the same version should return error")
+	}
+	_ = RegisterEventUpcaster("test.UpcastLoopEvent", "v1.0", "v2.0", upcastNothing)
+	_ = RegisterEventUpcaster("test.UpcastLoopEvent", "v2.0", "v1.0", upcastNothing)
+	if _, err := upcastEventRecord(&daprclient.EventRecord{EventType: "test.UpcastLoopEvent", EventVersion: "v1.0"}); err == nil {
+		t.Error("upcaster loop should return error")
+	}
+}
+
+func init() {
+	_ = RegisterEventType("test.UpcastRenamedEvent", "v3.0", func() interface{} { return &upcastRenamedEvent{} })
+	_ = RegisterEventUpcaster("test.UpcastRenamedEvent", "v1.0", "v2.0", func(data map[string]any) (map[string]any, error) {
+		d, ok := data["data"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("data is not map")
+		}
+		return map[string]any{"data": map[string]any{"name": d["title"]}}, nil
+	})
+	_ = RegisterEventUpcaster("test.UpcastRenamedEvent", "v2.0", "v3.0", func(data map[string]any) (map[string]any, error) {
+		d := data["data"].(map[string]any)
+		d["name"] = d["name"].(string) + "!"
+		return data, nil
+	})
+}
+
+func upcastNothing(data map[string]any) (map[string]any, error) {
+	return data, nil
+}
+
+type upcastRenamedEvent struct {
+	Data struct {
+		Name string `json:"name"`
+	} `json:"data"`
+}
+
+type upcastHandler struct {
+	name string
+}
+
+func (h *upcastHandler) OnUpcastRenamedEventV3s0(ctx context.Context, event *upcastRenamedEvent) error {
+	h.name = event.Data.Name
+	return nil
+}
@@ -0,0 +1,301 @@
+package ddd
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/applog"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+//
+// ProjectionCheckpointStore
+// @Description: 读模型检查点存储器，记录每个查询处理器已处理的聚合最后事件序号
+//
+type ProjectionCheckpointStore interface {
+	//
+	// Get
+	// @Description: 获取已处理的最后事件序号
+	// @return uint64 没有检查点时为0
+	//
+	Get(ctx context.Context, handler, tenantId, aggregateId string) (uint64, error)
+	Save(ctx context.Context, handler, tenantId, aggregateId string, sequenceNumber uint64) error
+}
+
+type OutOfOrderPolicy int
+
+const (
+	OutOfOrderReject OutOfOrderPolicy = iota // 返回 ErrEventOutOfOrder，由重试或 Dapr 重新投递
+	OutOfOrderBuffer                         // 在内存中缓存并返回 ErrEventOutOfOrder，缺失的事件到达后按序执行；缓存丢失时依靠 Dapr 重新投递
+)
+
+var ErrEventOutOfOrder = errors.New("event out of order")
+
+// MetadataSequenceNumber 事件 Metadata 中的事件序号，写入事件时由 SDK 按期望序号填写，随事件发布到订阅端
+const MetadataSequenceNumber = "sequenceNumber"
+
+//
+// ProjectionCheckpointOptions
+// @Description: 读模型检查点选项
+//
+type ProjectionCheckpointOptions struct {
+	OutOfOrder      OutOfOrderPolicy
+	MaxBufferSize   int  // 每个聚合最多缓存的乱序事件数量，超过时拒绝，默认100
+	AllowInitialGap bool // 没有检查点的聚合接受任意序号的事件，用于已有读模型启用检查点
+}
+
+//
+// ProjectionCheckpointer
+// @Description: 按 (查询处理器, 租户, 聚合) 保证事件按序号执行，跳过重复事件。
+// 检查点在事件处理成功后保存，与读模型的修改不在同一事务中。
+//
+type ProjectionCheckpointer struct {
+	store   ProjectionCheckpointStore
+	options ProjectionCheckpointOptions
+	mu      sync.Mutex
+	locks   map[string]*commandLock
+	buffers map[string]map[uint64]*daprclient.EventRecord
+}
+
+type projectionCheckpointerHolder struct {
+	mu           sync.RWMutex
+	checkpointer *ProjectionCheckpointer
+}
+
+var _projectionCheckpointer = &projectionCheckpointerHolder{}
+
+type eventRecordFunc func(ctx context.Context, record *daprclient.EventRecord) error
+
+//
+// NewProjectionCheckpointer
+// @Description: 新建读模型检查点
+// @param store 检查点存储器
+// @param options 选项，可以为 nil
+// @return *ProjectionCheckpointer
+//
+func NewProjectionCheckpointer(store ProjectionCheckpointStore, options *ProjectionCheckpointOptions) *ProjectionCheckpointer {
+	c := &ProjectionCheckpointer{
+		store:   store,
+		locks:   make(map[string]*commandLock),
+		buffers: make(map[string]map[uint64]*daprclient.EventRecord),
+	}
+	if options != nil {
+		c.options = *options
+	}
+	if c.options.MaxBufferSize <= 0 {
+		c.options.MaxBufferSize = 100
+	}
+	return c
+}
+
+//
+// SetProjectionCheckpointer
+// @Description: 设置读模型检查点，为 nil 时不检查事件顺序(默认)
+// @param checkpointer
+//
+func SetProjectionCheckpointer(checkpointer *ProjectionCheckpointer) {
+	_projectionCheckpointer.mu.Lock()
+	defer _projectionCheckpointer.mu.Unlock()
+	_projectionCheckpointer.checkpointer = checkpointer
+}
+
+//
+// GetProjectionCheckpointer
+// @Description: 获取读模型检查点
+// @return *ProjectionCheckpointer 未设置时为 nil
+//
+func GetProjectionCheckpointer() *ProjectionCheckpointer {
+	_projectionCheckpointer.mu.RLock()
+	defer _projectionCheckpointer.mu.RUnlock()
+	return _projectionCheckpointer.checkpointer
+}
+
+//
+// handle
+// @Description: 序号小于等于检查点的事件视为重复并跳过；序号不连续的事件返回 ErrEventOutOfOrder，按 OutOfOrder 策略决定是否缓存。
+// 没有序号、租户或聚合id的事件直接执行。事件序号取 EventRecord.SequenceNumber，为0时取 Metadata 中的 sequenceNumber。
+//
+func (c *ProjectionCheckpointer) handle(ctx context.Context, handler string, record *daprclient.EventRecord, fn eventRecordFunc) error {
+	tenantId, aggregateId := getEventRecordIds(record)
+	if record.SequenceNumber == 0 || tenantId == "" || aggregateId == "" {
+		return fn(ctx, record)
+	}
+	key := fmt.Sprintf("%s/%s/%s", handler, tenantId, aggregateId)
+	unlock := c.lock(key)
+	defer unlock()
+
+	last, err := c.store.Get(ctx, handler, tenantId, aggregateId)
+	if err != nil {
+		return err
+	}
+	seq := record.SequenceNumber
+	switch {
+	case seq <= last:
+		_, _ = applog.Debug(tenantId, "ddd", "ProjectionCheckpointer", fmt.Sprintf("%s skip duplicate event %s, sequence %d <= %d", handler, record.EventId, seq, last))
+	case seq == last+1 || (last == 0 && c.options.AllowInitialGap):
+		if err = c.apply(ctx, handler, tenantId, aggregateId, record, fn); err != nil {
+			return err
+		}
+		last = seq
+	default:
+		// 缓存只在内存中，缓存后仍返回错误由 Dapr 重新投递，进程重启丢失缓存时事件不会丢失；
+		// 缺失的事件到达后缓存的事件立即执行，重新投递时按重复事件跳过
+		if c.options.OutOfOrder == OutOfOrderBuffer && c.buffer(key, record) {
+			return fmt.Errorf("%w: %s event %s sequence %d is buffered, expected %d", ErrEventOutOfOrder, handler, record.EventId, seq, last+1)
+		}
+		return fmt.Errorf("%w: %s event %s sequence %d, expected %d", ErrEventOutOfOrder, handler, record.EventId, seq, last+1)
+	}
+	return c.drain(ctx, handler, tenantId, aggregateId, key, last, fn)
+}
+
+func (c *ProjectionCheckpointer) apply(ctx context.Context, handler, tenantId, aggregateId string, record *daprclient.EventRecord, fn eventRecordFunc) error {
+	if err := fn(ctx, record); err != nil {
+		return err
+	}
+	return c.store.Save(ctx, handler, tenantId, aggregateId, record.SequenceNumber)
+}
+
+//
+// drain
+// @Description: 按序执行缓存中已连续的事件
+//
+func (c *ProjectionCheckpointer) drain(ctx context.Context, handler, tenantId, aggregateId, key string, last uint64, fn eventRecordFunc) error {
+	for {
+		c.mu.Lock()
+		buffer := c.buffers[key]
+		for seq := range buffer {
+			if seq <= last {
+				delete(buffer, seq)
+			}
+		}
+		record, ok := buffer[last+1]
+		if len(buffer) == 0 {
+			delete(c.buffers, key)
+		}
+		c.mu.Unlock()
+		if !ok {
+			return nil
+		}
+		if err := c.apply(ctx, handler, tenantId, aggregateId, record, fn); err != nil {
+			return err
+		}
+		last = record.SequenceNumber
+	}
+}
+
+func (c *ProjectionCheckpointer) buffer(key string, record *daprclient.EventRecord) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	buffer, ok := c.buffers[key]
+	if !ok {
+		buffer = make(map[uint64]*daprclient.EventRecord)
+		c.buffers[key] = buffer
+	}
+	if _, ok = buffer[record.SequenceNumber]; !ok && len(buffer) >= c.options.MaxBufferSize {
+		return false
+	}
+	buffer[record.SequenceNumber] = record
+	return true
+}
+
+func (c *ProjectionCheckpointer) lock(key string) func() {
+	c.mu.Lock()
+	lock, ok := c.locks[key]
+	if !ok {
+		lock = &commandLock{}
+		c.locks[key] = lock
+	}
+	lock.count++
+	c.mu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		c.mu.Lock()
+		lock.count--
+		if lock.count == 0 {
+			delete(c.locks, key)
+		}
+		c.mu.Unlock()
+	}
+}
+
+//
+// setEventRecordSequenceNumber
+// @Description: 订阅的事件记录没有序号时，使用发布时写入 Metadata 的序号
+//
+func setEventRecordSequenceNumber(record *daprclient.EventRecord) {
+	if record.SequenceNumber > 0 || record.Metadata == nil {
+		return
+	}
+	if seq, err := strconv.ParseUint(record.Metadata[MetadataSequenceNumber], 10, 64); err == nil {
+		record.SequenceNumber = seq
+	}
+}
+
+//
+// getEventRecordIds
+// @Description: 获取事件记录的租户id与聚合id，记录中没有时从事件数据中获取
+//
+func getEventRecordIds(record *daprclient.EventRecord) (string, string) {
+	tenantId, aggregateId := record.TenantId, record.AggregateId
+	if tenantId == "" {
+		tenantId, _ = record.EventData["tenantId"].(string)
+	}
+	if aggregateId == "" {
+		aggregateId, _ = record.EventData["aggregateId"].(string)
+	}
+	return tenantId, aggregateId
+}
+
+func getProjectionHandlerName(handler interface{}) string {
+	t := reflect.TypeOf(handler)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+//
+// memoryProjectionCheckpointStore
+// @Description: 内存检查点存储器，只在单个进程内有效
+//
+type memoryProjectionCheckpointStore struct {
+	mu    sync.RWMutex
+	items map[string]uint64
+}
+
+//
+// NewMemoryProjectionCheckpointStore
+// @Description: 新建内存检查点存储器
+// @return ProjectionCheckpointStore
+//
+func NewMemoryProjectionCheckpointStore() ProjectionCheckpointStore {
+	return &memoryProjectionCheckpointStore{items: make(map[string]uint64)}
+}
+
+func (s *memoryProjectionCheckpointStore) Get(ctx context.Context, handler, tenantId, aggregateId string) (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.items[s.getKey(handler, tenantId, aggregateId)], nil
+}
+
+func (s *memoryProjectionCheckpointStore) Save(ctx context.Context, handler, tenantId, aggregateId string, sequenceNumber uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.getKey(handler, tenantId, aggregateId)
+	if sequenceNumber > s.items[key] {
+		s.items[key] = sequenceNumber
+	}
+	return nil
+}
+
+func (s *memoryProjectionCheckpointStore) getKey(handler, tenantId, aggregateId string) string {
+	return fmt.Sprintf("%s/%s/%s", handler, tenantId, aggregateId)
+}
@@ -0,0 +1,191 @@
+package ddd
+
+import (
+	"context"
+	"errors"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProjectionCheckpointer(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryProjectionCheckpointStore()
+	handler := &sequenceEventHandler{}
+	sh := NewSubscribeHandler(&[]Subscribe{}, handler, nil).(SubscribeRetryHandler)
+	call := func(aggregateId string, seq uint64) error {
+		record := &daprclient.EventRecord{TenantId: "tenant-1", AggregateId: aggregateId, EventId: aggregateId + string(rune('0'+seq)), SequenceNumber: seq}
+		return sh.CallSubscribeEventHandler(ctx, nil, newCorrelationSubscribeContext(t, record))
+	}
+
+	SetProjectionCheckpointer(NewProjectionCheckpointer(store, nil))
+	defer SetProjectionCheckpointer(nil)
+	for _, seq := range []uint64{1, 1, 2} {
+		if err := call("agg-1", seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := call("agg-1", 4); !errors.Is(err, ErrEventOutOfOrder) {
+		t.Fatalf("out of order event error = %v", err)
+	}
+	for _, seq := range []uint64{3, 4} {
+		if err := call("agg-1", seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := handler.get("agg-1"); got != "1,2,3,4" {
+		t.Errorf("agg-1 events = %s", got)
+	}
+	if last, _ := store.Get(ctx, "ddd.sequenceEventHandler", "tenant-1", "agg-1"); last != 4 {
+		t.Errorf("checkpoint = %d, want 4", last)
+	}
+
+	// 缓存的事件仍返回错误，由 Dapr 重新投递
+	SetProjectionCheckpointer(NewProjectionCheckpointer(store, &ProjectionCheckpointOptions{OutOfOrder: OutOfOrderBuffer, MaxBufferSize: 2}))
+	for _, seq := range []uint64{3, 2} {
+		if err := call("agg-2", seq); !errors.Is(err, ErrEventOutOfOrder) {
+			t.Fatalf("buffered event error = %v, want ErrEventOutOfOrder", err)
+		}
+	}
+	if err := call("agg-2", 4); !errors.Is(err, ErrEventOutOfOrder) {
+		t.Errorf("buffer is full, err = %v, want ErrEventOutOfOrder", err)
+	}
+	if got := handler.get("agg-2"); got != "" {
+		t.Errorf("agg-2 events = %s, buffered events should not be handled", got)
+	}
+	for _, seq := range []uint64{1, 3, 2, 4} {
+		if err := call("agg-2", seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := handler.get("agg-2"); got != "1,2,3,4" {
+		t.Errorf("agg-2 events = %s", got)
+	}
+
+	// 进程重启丢失缓存后，重新投递的事件按序执行
+	for _, seq := range []uint64{6, 7} {
+		if err := call("agg-2", seq); !errors.Is(err, ErrEventOutOfOrder) {
+			t.Fatalf("buffered event error = %v, want ErrEventOutOfOrder", err)
+		}
+	}
+	SetProjectionCheckpointer(NewProjectionCheckpointer(store, &ProjectionCheckpointOptions{OutOfOrder: OutOfOrderBuffer, MaxBufferSize: 2}))
+	for _, seq := range []uint64{5, 6, 7} {
+		if err := call("agg-2", seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := handler.get("agg-2"); got != "1,2,3,4,5,6,7" {
+		t.Errorf("agg-2 events = %s", got)
+	}
+
+	SetProjectionCheckpointer(NewProjectionCheckpointer(store, &ProjectionCheckpointOptions{AllowInitialGap: true}))
+	for _, seq := range []uint64{5, 6} {
+		if err := call("agg-3", seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := handler.get("agg-3"); got != "5,6" {
+		t.Errorf("agg-3 events = %s", got)
+	}
+}
+
+func TestEventRecordIds(t *testing.T) {
+	newMemoryStorage(t)
+	if _, err := CreateEvent(context.Background(), &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	record := loadLastEventRecord(t, "tenant-1", "agg-1")
+	if record.TenantId != "tenant-1" || record.AggregateId != "agg-1" || record.SequenceNumber != 1 {
+		t.Errorf("record = %+v", record)
+	}
+	tenantId, aggregateId := getEventRecordIds(&daprclient.EventRecord{EventData: map[string]interface{}{"tenantId": "t", "aggregateId": "a"}})
+	if tenantId != "t" || aggregateId != "a" {
+		t.Errorf("tenantId = %s, aggregateId = %s", tenantId, aggregateId)
+	}
+}
+
+func TestProjectionCheckpointer_DeadLetter(t *testing.T) {
+	ctx := context.Background()
+	handler := &sequenceEventHandler{failSequence: 3}
+	subscribe := Subscribe{PubsubName: "pubsub", Topic: "user", Route: "/event/user/checkpoint-test", Retry: NewRetryPolicy(2, time.Millisecond, 0)}
+	sh := NewSubscribeHandler(&[]Subscribe{subscribe}, handler, nil).(SubscribeRetryHandler)
+	call := func(seq uint64) error {
+		record := &daprclient.EventRecord{TenantId: "tenant-1", AggregateId: "agg-1", EventId: "event-" + string(rune('0'+seq)), SequenceNumber: seq}
+		return sh.CallSubscribeEventHandler(ctx, &subscribe, newCorrelationSubscribeContext(t, record))
+	}
+	SetProjectionCheckpointer(NewProjectionCheckpointer(NewMemoryProjectionCheckpointStore(), nil))
+	defer SetProjectionCheckpointer(nil)
+	store := NewMemoryDeadLetterStore()
+	SetDeadLetterStore(store)
+	defer SetDeadLetterStore(nil)
+
+	// 乱序事件返回错误由 Dapr 重新投递，不进入死信
+	if err := call(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := call(3); !errors.Is(err, ErrEventOutOfOrder) {
+		t.Fatalf("err = %v, want ErrEventOutOfOrder", err)
+	}
+	list, err := store.FindList(ctx, &DeadLetterQuery{TenantId: "tenant-1", Route: subscribe.Route})
+	if err != nil || len(list) != 0 {
+		t.Fatalf("dead letters = %d, err = %v; want 0", len(list), err)
+	}
+
+	// 处理失败的事件进入死信
+	if err = call(2); err != nil {
+		t.Fatal(err)
+	}
+	if err = call(3); err != nil {
+		t.Fatal(err)
+	}
+	list, err = store.FindList(ctx, &DeadLetterQuery{TenantId: "tenant-1", Route: subscribe.Route})
+	if err != nil || len(list) != 1 || list[0].EventId != "event-3" {
+		t.Fatalf("dead letters = %+v, err = %v; want event-3", list, err)
+	}
+	if got := handler.get("agg-1"); got != "1,2" {
+		t.Errorf("agg-1 events = %s", got)
+	}
+}
+
+func TestEventsSequenceNumberMetadata(t *testing.T) {
+	ctx := context.Background()
+	newMemoryStorage(t)
+	if _, err := CreateEvent(ctx, &memAggregate{}, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyCommand(ctx, &memAggregate{}, &MemUpdateCommand{TenantId: "tenant-1", AggregateId: "agg-1", Name: "name-2"}); err != nil {
+		t.Fatal(err)
+	}
+	record := loadLastEventRecord(t, "tenant-1", "agg-1")
+	if record.SequenceNumber != 2 || record.Metadata[MetadataSequenceNumber] != "2" {
+		t.Errorf("sequenceNumber = %d, metadata = %v", record.SequenceNumber, record.Metadata)
+	}
+
+	// 订阅的事件记录没有序号时使用 Metadata 中的序号
+	received := &daprclient.EventRecord{Metadata: map[string]string{MetadataSequenceNumber: "2"}}
+	setEventRecordSequenceNumber(received)
+	if received.SequenceNumber != 2 {
+		t.Errorf("sequenceNumber = %d, want 2", received.SequenceNumber)
+	}
+}
+
+type sequenceEventHandler struct {
+	events       map[string][]string
+	failSequence uint64
+}
+
+func (h *sequenceEventHandler) HandleEventRecord(ctx context.Context, record *daprclient.EventRecord) error {
+	if h.failSequence > 0 && record.SequenceNumber == h.failSequence {
+		return errors.New("handle error")
+	}
+	if h.events == nil {
+		h.events = make(map[string][]string)
+	}
+	h.events[record.AggregateId] = append(h.events[record.AggregateId], string(rune('0'+record.SequenceNumber)))
+	return nil
+}
+
+func (h *sequenceEventHandler) get(aggregateId string) string {
+	return strings.Join(h.events[aggregateId], ",")
+}
@@ -1,4 +1,17 @@
 package ddd
 
+import (
+	"context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+)
+
 type QueryEventHandler interface {
 }
+
+//
+// EventRecordHandler
+// @Description: 自行处理事件记录的 QueryEventHandler，如 SagaManager。订阅收到事件后直接调用 HandleEventRecord，不按方法名分发
+//
+type EventRecordHandler interface {
+	HandleEventRecord(ctx context.Context, record *daprclient.EventRecord) error
+}
@@ -1,15 +1,69 @@
 package ddd
 
 import (
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
 	"reflect"
+	"strconv"
+	"strings"
 )
 
 const (
 	dddRelTagName = "ddd-rel"
 )
 
+// 嵌套结构的最大解析深度，防止循环引用
+const maxRelationDepth = 8
+
 type Relation map[string]string
 
+//
+// RelationValues
+// @Description: 多值的聚合关系，切片类型的字段产生多个关系值
+//
+type RelationValues map[string][]string
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+//
+// ToRelation
+// @Description: 转换为单值的聚合关系，每个关系名称取第一个值，没有值时为空字符串
+//
+func (r RelationValues) ToRelation() Relation {
+	if r == nil {
+		return nil
+	}
+	relation := Relation{}
+	for name, values := range r {
+		value := ""
+		if len(values) > 0 {
+			value = values[0]
+		}
+		relation[name] = value
+	}
+	return relation
+}
+
+func (r RelationValues) add(name string, values []string) {
+	items, ok := r[name]
+	if !ok {
+		items = make([]string, 0, len(values))
+	}
+	for _, value := range values {
+		exists := false
+		for _, item := range items {
+			if item == value {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			items = append(items, value)
+		}
+	}
+	r[name] = items
+}
+
 func GetRelation(data interface{}) ([]Relation, bool, error) {
 	reflectValue := reflect.ValueOf(data)
 	if reflectValue.Type().Kind() == reflect.Slice {
@@ -43,30 +97,218 @@ func GetRelationByList(list interface{}) ([]Relation, bool, error) {
 	return relations, len(relations) > 0, nil
 }
 
-// GetRelationByStructure 从结构中获得聚合关系
+// GetRelationByStructure 从结构中获得聚合关系，多值的关系只取第一个值，见 GetRelationValues
 func GetRelationByStructure(structure interface{}) (Relation, bool, error) {
+	values, ok, err := GetRelationValues(structure)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return values.ToRelation(), true, nil
+}
+
+//
+// GetRelationValues
+// @Description: 从结构中获得多值的聚合关系。
+// 标记 ddd-rel 的字段支持字符串、数值、布尔、fmt.Stringer(如 uuid.UUID)及其指针，切片产生多个关系值；
+// 标记的字段为结构时解析其中标记的字段，关系名称以点分隔，如 customer.id；
+// 未标记的嵌入结构按同一层级解析，未标记的嵌套结构及结构切片以 json 名称为前缀解析。
+// 标签值为空或 - 时使用字段名称作为关系名称。
+// @param structure 结构或结构指针
+// @return RelationValues 聚合关系
+// @return bool 是否有聚合关系
+// @return error 字段类型不支持时返回错误
+//
+func GetRelationValues(structure interface{}) (RelationValues, bool, error) {
 	reflectValue := reflect.ValueOf(structure)
-	reflectType := reflectValue.Type()
-	for reflectType.Kind() == reflect.Slice || reflectType.Kind() == reflect.Ptr {
-		reflectType = reflectType.Elem()
-		reflectValue = reflectValue.Elem()
+	for reflectValue.Kind() == reflect.Slice || reflectValue.Kind() == reflect.Ptr || reflectValue.Kind() == reflect.Interface {
+		if reflectValue.Kind() == reflect.Slice {
+			reflectValue = reflect.Zero(reflectValue.Type().Elem())
+		} else if reflectValue.IsNil() {
+			return nil, false, nil
+		} else {
+			reflectValue = reflectValue.Elem()
+		}
+	}
+	if reflectValue.Kind() != reflect.Struct {
+		return nil, false, nil
+	}
+	relation := RelationValues{}
+	if err := getStructRelationValues(relation, "", reflectValue, 0); err != nil {
+		return nil, false, err
+	}
+	if len(relation) == 0 {
+		return nil, false, nil
 	}
+	return relation, true, nil
+}
 
-	var relation Relation
+func getStructRelationValues(relation RelationValues, prefix string, reflectValue reflect.Value, depth int) error {
+	if depth > maxRelationDepth {
+		return nil
+	}
+	reflectType := reflectValue.Type()
 	for i := 0; i < reflectType.NumField(); i++ {
-		fieldName := reflectType.Field(i).Name
-		relationName, ok := reflectType.Field(i).Tag.Lookup(dddRelTagName)
-		relationId := "null"
-		if ok {
-			if relation == nil {
-				relation = Relation{}
+		field := reflectType.Field(i)
+		fieldValue := reflectValue.Field(i)
+		if len(field.PkgPath) > 0 && !field.Anonymous {
+			continue
+		}
+		relationName, ok := field.Tag.Lookup(dddRelTagName)
+		if !ok {
+			if err := getNestedRelationValues(relation, prefix, field, fieldValue, depth); err != nil {
+				return err
 			}
-			if len(relationName) == 0 || relationName == "-" {
-				relationName = fieldName
+			continue
+		}
+		if len(relationName) == 0 || relationName == "-" {
+			relationName = field.Name
+		}
+		name := prefix + relationName
+
+		values, isStruct, err := getRelationFieldValues(fieldValue)
+		if err != nil {
+			return errors.ErrorOf("ddd-rel field %s.%s: %s", reflectType.Name(), field.Name, err.Error())
+		}
+		if !isStruct {
+			relation.add(name, values)
+			continue
+		}
+		for _, item := range getStructValues(fieldValue) {
+			if err := getStructRelationValues(relation, name+".", item, depth+1); err != nil {
+				return err
 			}
-			relationId = reflectValue.Field(i).String()
-			relation[relationName] = relationId
 		}
 	}
-	return relation, relation != nil, nil
+	return nil
+}
+
+//
+// getNestedRelationValues
+// @Description: 解析未标记 ddd-rel 的嵌入结构、嵌套结构与结构切片
+//
+func getNestedRelationValues(relation RelationValues, prefix string, field reflect.StructField, fieldValue reflect.Value, depth int) error {
+	fieldType := field.Type
+	for fieldType.Kind() == reflect.Ptr || fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Array {
+		fieldType = fieldType.Elem()
+	}
+	if fieldType.Kind() != reflect.Struct || fieldType.Implements(stringerType) || reflect.PtrTo(fieldType).Implements(stringerType) {
+		return nil
+	}
+	nestedPrefix := prefix
+	if !field.Anonymous {
+		nestedPrefix = prefix + getJsonFieldName(field) + "."
+	}
+	for _, item := range getStructValues(fieldValue) {
+		if err := getStructRelationValues(relation, nestedPrefix, item, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//
+// getRelationFieldValues
+// @Description: 获取标记字段的关系值
+// @return []string 关系值
+// @return bool 字段是否为需要继续解析的结构
+// @return error
+//
+func getRelationFieldValues(value reflect.Value) ([]string, bool, error) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if s, ok := getStringerValue(value); ok {
+			return []string{s}, false, nil
+		}
+		if value.IsNil() {
+			return []string{}, false, nil
+		}
+		value = value.Elem()
+	}
+	if s, ok := getStringerValue(value); ok {
+		return []string{s}, false, nil
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		return nil, true, nil
+	case reflect.Slice, reflect.Array:
+		elemType := value.Type().Elem()
+		for elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+		if elemType.Kind() == reflect.Struct && !elemType.Implements(stringerType) && !reflect.PtrTo(elemType).Implements(stringerType) {
+			return nil, true, nil
+		}
+		values := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			items, _, err := getRelationFieldValues(value.Index(i))
+			if err != nil {
+				return nil, false, err
+			}
+			values = append(values, items...)
+		}
+		return values, false, nil
+	}
+	s, err := getScalarValue(value)
+	if err != nil {
+		return nil, false, err
+	}
+	return []string{s}, false, nil
+}
+
+func getStringerValue(value reflect.Value) (string, bool) {
+	if !value.IsValid() || !value.CanInterface() || !value.Type().Implements(stringerType) {
+		return "", false
+	}
+	if (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && value.IsNil() {
+		return "", false
+	}
+	return value.Interface().(fmt.Stringer).String(), true
+}
+
+func getScalarValue(value reflect.Value) (string, error) {
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), nil
+	}
+	return "", errors.ErrorOf("unsupported type %s", value.Type().String())
+}
+
+//
+// getStructValues
+// @Description: 获取字段中的结构值，字段为结构切片时返回每个元素，忽略 nil 指针
+//
+func getStructValues(value reflect.Value) []reflect.Value {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		return []reflect.Value{value}
+	case reflect.Slice, reflect.Array:
+		var values []reflect.Value
+		for i := 0; i < value.Len(); i++ {
+			values = append(values, getStructValues(value.Index(i))...)
+		}
+		return values
+	}
+	return nil
+}
+
+func getJsonFieldName(field reflect.StructField) string {
+	if tag, ok := field.Tag.Lookup("json"); ok {
+		if name := strings.Split(tag, ",")[0]; len(name) > 0 && name != "-" {
+			return name
+		}
+	}
+	return field.Name
 }
@@ -3,6 +3,7 @@ package ddd
 import (
 	"encoding/json"
 	"github.com/google/uuid"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -51,6 +52,84 @@ func Test_GetRelations_Items(t *testing.T) {
 	}
 }
 
+func Test_GetRelationValues(t *testing.T) {
+	orgId := uuid.MustParse("7f1c2d3e-0000-4000-8000-000000000001")
+	count := int64(3)
+	data := &relValuesData{
+		relValuesBase: relValuesBase{SysId: "sys-1"},
+		OrgId:         orgId,
+		Count:         &count,
+		Level:         2,
+		Enabled:       true,
+		UserIds:       []string{"user-1", "user-2", "user-1"},
+		Customer:      relCustomer{Id: "customer-1", Name: "c1"},
+		Items:         []*relItem{{ProductId: "product-1"}, {ProductId: "product-2"}},
+	}
+	values, ok, err := GetRelationValues(data)
+	if err != nil || !ok {
+		t.Fatalf("GetRelationValues() = %v, %v", ok, err)
+	}
+	want := RelationValues{
+		"sysId":           {"sys-1"},
+		"orgId":           {orgId.String()},
+		"count":           {"3"},
+		"level":           {"2"},
+		"enabled":         {"true"},
+		"ownerId":         {},
+		"userIds":         {"user-1", "user-2"},
+		"customer.id":     {"customer-1"},
+		"items.productId": {"product-1", "product-2"},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("GetRelationValues() = %v, want %v", values, want)
+	}
+
+	relation, ok, err := GetRelationByStructure(*data)
+	if err != nil || !ok {
+		t.Fatalf("GetRelationByStructure() = %v, %v", ok, err)
+	}
+	if relation["userIds"] != "user-1" || relation["ownerId"] != "" || relation["count"] != "3" {
+		t.Errorf("GetRelationByStructure() = %v", relation)
+	}
+
+	if _, ok, err = GetRelationValues((*relValuesData)(nil)); ok || err != nil {
+		t.Errorf("GetRelationValues(nil) = %v, %v; want false, nil", ok, err)
+	}
+	if _, _, err = GetRelationValues(&relUnsupported{Data: map[string]string{}}); err == nil {
+		t.Error("GetRelationValues(map) error = nil, want unsupported type error")
+	}
+}
+
+type relValuesBase struct {
+	SysId string `json:"sysId" ddd-rel:"sysId"`
+}
+
+type relCustomer struct {
+	Id   string `json:"id" ddd-rel:"id"`
+	Name string `json:"name"`
+}
+
+type relItem struct {
+	ProductId string `json:"productId" ddd-rel:"productId"`
+}
+
+type relValuesData struct {
+	relValuesBase
+	OrgId    uuid.UUID   `json:"orgId" ddd-rel:"orgId"`
+	Count    *int64      `json:"count" ddd-rel:"count"`
+	OwnerId  *string     `json:"ownerId" ddd-rel:"ownerId"`
+	Level    uint8       `json:"level" ddd-rel:"level"`
+	Enabled  bool        `json:"enabled" ddd-rel:"enabled"`
+	UserIds  []string    `json:"userIds" ddd-rel:"userIds"`
+	Customer relCustomer `json:"customer" ddd-rel:"customer"`
+	Items    []*relItem  `json:"items"`
+	Remark   string      `json:"remark"`
+}
+
+type relUnsupported struct {
+	Data map[string]string `json:"data" ddd-rel:"data"`
+}
+
 type fields struct {
 	Id     string `json:"id" ddd-rel:""`
 	UserId string `json:"userId" ddd-rel:"userId"`
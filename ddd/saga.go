@@ -0,0 +1,538 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/applog"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd/ddd_context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"sync"
+	"time"
+)
+
+//
+// Saga
+// @Description: 长流程(流程管理器)，监听一个或多个聚合的领域事件，并向其它聚合发送命令。
+// 实现结构需嵌入 SagaBase，事件处理方法与聚合相同，命名为 On<Event>V<ver>(ctx, event) error。
+// Saga 状态以 JSON 保存到 SagaRepository 中。
+//
+type Saga interface {
+	GetSagaType() string
+	GetSagaBase() *SagaBase
+}
+
+//
+// SagaDeadlineHandler
+// @Description: 处理 Saga 超时，由 SagaBase.ScheduleDeadline 设置的超时到期后调用
+//
+type SagaDeadlineHandler interface {
+	OnDeadline(ctx context.Context, name string) error
+}
+
+type NewSagaFunc func() Saga
+
+// maxSagaHandledEventIds Saga 中最多记录的已处理事件id数量
+const maxSagaHandledEventIds = 100
+
+//
+// SagaCommandDispatcher
+// @Description: 发送 Saga 产生的命令
+//
+type SagaCommandDispatcher func(ctx context.Context, cmd Command) error
+
+//
+// SagaBase
+// @Description: Saga 基础结构，保存租户、id、关联属性、结束状态与最近处理过的事件id。
+// Send/ScheduleDeadline/CancelDeadline 在事件处理成功并保存 Saga 后才执行。
+//
+type SagaBase struct {
+	TenantId        string            `json:"tenantId"`
+	SagaId          string            `json:"sagaId"`
+	Associations    map[string]string `json:"associations"`
+	IsEnded         bool              `json:"isEnded"`
+	HandledEventIds []string          `json:"handledEventIds,omitempty"`
+
+	commands  []Command
+	deadlines []*sagaDeadlineAction
+}
+
+type sagaDeadlineAction struct {
+	name    string
+	dueTime time.Duration
+	cancel  bool
+}
+
+func (s *SagaBase) GetSagaBase() *SagaBase {
+	return s
+}
+
+func (s *SagaBase) GetTenantId() string {
+	return s.TenantId
+}
+
+func (s *SagaBase) GetSagaId() string {
+	return s.SagaId
+}
+
+//
+// AssociateWith
+// @Description: 添加关联属性，带有此属性值的事件会路由到当前 Saga
+// @param key 属性名称，如 orderId
+// @param value 属性值
+//
+func (s *SagaBase) AssociateWith(key, value string) {
+	if s.Associations == nil {
+		s.Associations = make(map[string]string)
+	}
+	s.Associations[key] = value
+}
+
+func (s *SagaBase) RemoveAssociation(key string) {
+	delete(s.Associations, key)
+}
+
+func (s *SagaBase) GetAssociation(key string) (string, bool) {
+	v, ok := s.Associations[key]
+	return v, ok
+}
+
+//
+// End
+// @Description: 结束 Saga，处理完成后从仓储中删除，之后到期的超时会被忽略
+//
+func (s *SagaBase) End() {
+	s.IsEnded = true
+}
+
+//
+// Send
+// @Description: 发送命令，Saga 保存成功后通过 SagaCommandDispatcher 发送
+// @param cmd 命令
+//
+func (s *SagaBase) Send(cmd Command) {
+	s.commands = append(s.commands, cmd)
+}
+
+//
+// ScheduleDeadline
+// @Description: 设置超时，到期后调用 Saga 的 OnDeadline 方法。同名超时会被覆盖
+// @param name 超时名称
+// @param dueTime 到期时间
+//
+func (s *SagaBase) ScheduleDeadline(name string, dueTime time.Duration) {
+	s.deadlines = append(s.deadlines, &sagaDeadlineAction{name: name, dueTime: dueTime})
+}
+
+//
+// CancelDeadline
+// @Description: 取消超时
+// @param name 超时名称
+//
+func (s *SagaBase) CancelDeadline(name string) {
+	s.deadlines = append(s.deadlines, &sagaDeadlineAction{name: name, cancel: true})
+}
+
+//
+// isEventHandled
+// @Description: 事件是否已经处理过，Dapr 重新投递的事件不再调用事件处理方法
+//
+func (s *SagaBase) isEventHandled(eventId string) bool {
+	for _, id := range s.HandledEventIds {
+		if id == eventId {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// addHandledEvent
+// @Description: 记录处理过的事件id，只保留最近 maxSagaHandledEventIds 个
+//
+func (s *SagaBase) addHandledEvent(eventId string) {
+	if eventId == "" {
+		return
+	}
+	s.HandledEventIds = append(s.HandledEventIds, eventId)
+	if count := len(s.HandledEventIds); count > maxSagaHandledEventIds {
+		s.HandledEventIds = s.HandledEventIds[count-maxSagaHandledEventIds:]
+	}
+}
+
+func (s *SagaBase) takeActions() ([]Command, []*sagaDeadlineAction) {
+	commands, deadlines := s.commands, s.deadlines
+	s.commands, s.deadlines = nil, nil
+	return commands, deadlines
+}
+
+type sagaEventConfig struct {
+	associationProperty string
+	isStart             bool
+	isEnd               bool
+}
+
+//
+// SagaManager
+// @Description: Saga 管理器，按关联属性查找或创建 Saga 并调用事件处理方法。
+// 实现 EventRecordHandler，可作为 QueryEventHandler 通过 SubscribeHandler/RegisterQueryHandler 注册。
+//
+type SagaManager struct {
+	sagaType   string
+	newSaga    NewSagaFunc
+	repository SagaRepository
+	dispatcher SagaCommandDispatcher
+	scheduler  SagaDeadlineScheduler
+	events     map[string]*sagaEventConfig
+	mu         sync.Mutex
+}
+
+//
+// NewSagaManager
+// @Description: 新建 Saga 管理器
+// @param newSaga 新建空 Saga 的方法
+// @param repository Saga 仓储
+// @return *SagaManager
+//
+func NewSagaManager(newSaga NewSagaFunc, repository SagaRepository) *SagaManager {
+	return &SagaManager{
+		sagaType:   newSaga().GetSagaType(),
+		newSaga:    newSaga,
+		repository: repository,
+		events:     make(map[string]*sagaEventConfig),
+	}
+}
+
+//
+// StartOn
+// @Description: 设置开始事件，找不到关联的 Saga 时新建 Saga
+// @param eventType 事件类型
+// @param associationProperty 事件数据中的关联属性名称，如 orderId
+//
+func (m *SagaManager) StartOn(eventType, associationProperty string) *SagaManager {
+	m.events[eventType] = &sagaEventConfig{associationProperty: associationProperty, isStart: true}
+	return m
+}
+
+//
+// On
+// @Description: 设置处理的事件，找不到关联的 Saga 时忽略事件
+// @param eventType 事件类型
+// @param associationProperty 事件数据中的关联属性名称
+//
+func (m *SagaManager) On(eventType, associationProperty string) *SagaManager {
+	m.events[eventType] = &sagaEventConfig{associationProperty: associationProperty}
+	return m
+}
+
+//
+// EndOn
+// @Description: 设置结束事件，事件处理后结束 Saga
+// @param eventType 事件类型
+// @param associationProperty 事件数据中的关联属性名称
+//
+func (m *SagaManager) EndOn(eventType, associationProperty string) *SagaManager {
+	m.events[eventType] = &sagaEventConfig{associationProperty: associationProperty, isEnd: true}
+	return m
+}
+
+//
+// SetCommandDispatcher
+// @Description: 设置发送命令的方法，默认通过 GetCommandBus().Dispatch 发送
+//
+func (m *SagaManager) SetCommandDispatcher(dispatcher SagaCommandDispatcher) *SagaManager {
+	m.dispatcher = dispatcher
+	return m
+}
+
+//
+// SetDeadlineScheduler
+// @Description: 设置超时调度器，默认使用 GetSagaDeadlineScheduler()
+//
+func (m *SagaManager) SetDeadlineScheduler(scheduler SagaDeadlineScheduler) *SagaManager {
+	m.scheduler = scheduler
+	return m
+}
+
+func (m *SagaManager) GetSagaType() string {
+	return m.sagaType
+}
+
+//
+// HandleEventRecord
+// @Description: 处理订阅收到的事件记录，旧版本事件先升级为最新版本
+//
+func (m *SagaManager) HandleEventRecord(ctx context.Context, record *daprclient.EventRecord) error {
+	record, err := upcastEventRecord(record)
+	if err != nil {
+		return err
+	}
+	event, err := NewDomainEvent(record)
+	if err != nil {
+		return err
+	}
+	domainEvent, ok := event.(DomainEvent)
+	if !ok {
+		return errors.ErrorOf("event type %s is not ddd.DomainEvent", record.EventType)
+	}
+	ctx = newEventCorrelationContext(ctx, record.EventId, record.Metadata)
+	return m.HandleEvent(ctx, domainEvent)
+}
+
+//
+// HandleEvent
+// @Description: 按关联属性查找或新建 Saga，调用事件处理方法后保存 Saga，再发送命令与设置超时。
+// 已处理过的事件直接跳过；发送命令或设置超时失败时恢复 Saga 之前的状态并返回错误，重新投递时再次处理
+// @param ctx 上下文
+// @param event 领域事件
+// @return error
+//
+func (m *SagaManager) HandleEvent(ctx context.Context, event DomainEvent) error {
+	config, ok := m.events[event.GetEventType()]
+	if !ok {
+		return nil
+	}
+	value, err := getEventProperty(event, config.associationProperty)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ddd_context.GetCausationId(ctx) != event.GetEventId() {
+		ctx = newEventCorrelationContext(ctx, event.GetEventId(), nil)
+	}
+	tenantId := event.GetTenantId()
+	saga := m.newSaga()
+	find, err := m.repository.FindByAssociation(ctx, tenantId, m.sagaType, config.associationProperty, value, saga)
+	if err != nil {
+		return err
+	}
+	var backup []byte
+	if !find {
+		if !config.isStart {
+			return nil
+		}
+		saga = m.newSaga()
+		base := saga.GetSagaBase()
+		base.TenantId = tenantId
+		base.SagaId = uuid.New().String()
+		base.AssociateWith(config.associationProperty, value)
+	} else if base := saga.GetSagaBase(); base.IsEnded {
+		return nil
+	} else if base.isEventHandled(event.GetEventId()) {
+		_, _ = applog.Debug(tenantId, "ddd", "SagaManager", fmt.Sprintf("%s skip handled event %s", m.sagaType, event.GetEventId()))
+		return nil
+	} else if backup, err = json.Marshal(saga); err != nil {
+		return err
+	}
+
+	if err = callEventHandler(ctx, saga, event.GetEventType(), event.GetEventVersion(), event); err != nil {
+		return err
+	}
+	if config.isEnd {
+		saga.GetSagaBase().End()
+	}
+	saga.GetSagaBase().addHandledEvent(event.GetEventId())
+	return m.complete(ctx, saga, backup)
+}
+
+//
+// HandleDeadline
+// @Description: 处理到期的超时，调用 Saga 的 OnDeadline 方法，Saga 不存在或已结束时忽略
+// @param ctx 上下文
+// @param deadline 超时
+// @return error
+//
+func (m *SagaManager) HandleDeadline(ctx context.Context, deadline *SagaDeadline) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saga := m.newSaga()
+	find, err := m.repository.FindById(ctx, deadline.TenantId, m.sagaType, deadline.SagaId, saga)
+	if err != nil || !find || saga.GetSagaBase().IsEnded {
+		return err
+	}
+	handler, ok := saga.(SagaDeadlineHandler)
+	if !ok {
+		return errors.NewMethodNotExistError(m.sagaType, "OnDeadline")
+	}
+	backup, err := json.Marshal(saga)
+	if err != nil {
+		return err
+	}
+	if err = handler.OnDeadline(ctx, deadline.Name); err != nil {
+		return err
+	}
+	return m.complete(ctx, saga, backup)
+}
+
+//
+// complete
+// @Description: 保存或删除 Saga，然后设置超时并发送命令。设置超时或发送命令失败时按 backup 恢复 Saga，
+// backup 为 nil 表示新建的 Saga，恢复时删除
+//
+func (m *SagaManager) complete(ctx context.Context, saga Saga, backup []byte) error {
+	base := saga.GetSagaBase()
+	commands, deadlines := base.takeActions()
+	if base.IsEnded {
+		if err := m.repository.Delete(ctx, base.TenantId, m.sagaType, base.SagaId); err != nil {
+			return err
+		}
+	} else if err := m.repository.Save(ctx, saga); err != nil {
+		return err
+	}
+
+	if err := m.dispatch(ctx, base, commands, deadlines); err != nil {
+		if restoreErr := m.restore(ctx, base, backup); restoreErr != nil {
+			_, _ = applog.Error(base.TenantId, "ddd", "SagaManager", fmt.Sprintf("%s restore saga %s error: %s", m.sagaType, base.SagaId, restoreErr.Error()))
+		}
+		return err
+	}
+	return nil
+}
+
+//
+// restore
+// @Description: 恢复 Saga 到处理事件之前的状态
+//
+func (m *SagaManager) restore(ctx context.Context, base *SagaBase, backup []byte) error {
+	if backup == nil {
+		return m.repository.Delete(ctx, base.TenantId, m.sagaType, base.SagaId)
+	}
+	saga := m.newSaga()
+	if err := json.Unmarshal(backup, saga); err != nil {
+		return err
+	}
+	return m.repository.Save(ctx, saga)
+}
+
+//
+// dispatch
+// @Description: 设置超时并发送命令
+//
+func (m *SagaManager) dispatch(ctx context.Context, base *SagaBase, commands []Command, deadlines []*sagaDeadlineAction) error {
+	if len(deadlines) > 0 {
+		scheduler := m.getScheduler()
+		if scheduler == nil {
+			return errors.ErrorOf("saga %s deadline scheduler is nil", m.sagaType)
+		}
+		for _, action := range deadlines {
+			deadline := &SagaDeadline{TenantId: base.TenantId, SagaType: m.sagaType, SagaId: base.SagaId, Name: action.name}
+			var err error
+			if action.cancel {
+				err = scheduler.Cancel(ctx, deadline)
+			} else {
+				err = scheduler.Schedule(ctx, deadline, action.dueTime)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	dispatcher := m.dispatcher
+	if dispatcher == nil {
+		dispatcher = GetCommandBus().Dispatch
+	}
+	for _, cmd := range commands {
+		if err := dispatcher(ctx, cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *SagaManager) getScheduler() SagaDeadlineScheduler {
+	if m.scheduler != nil {
+		return m.scheduler
+	}
+	return GetSagaDeadlineScheduler()
+}
+
+//
+// getEventProperty
+// @Description: 获取事件的关联属性值，先从事件数据(GetData)中查找，再从事件中查找
+//
+func getEventProperty(event DomainEvent, name string) (string, error) {
+	for _, item := range []interface{}{event.GetData(), event} {
+		if item == nil {
+			continue
+		}
+		bytes, err := json.Marshal(item)
+		if err != nil {
+			return "", err
+		}
+		data := make(map[string]interface{})
+		if err = json.Unmarshal(bytes, &data); err != nil {
+			continue
+		}
+		if v, ok := data[name]; ok && v != nil {
+			if s := fmt.Sprintf("%v", v); s != "" {
+				return s, nil
+			}
+		}
+	}
+	return "", errors.ErrorOf("event %s association property %s is empty", event.GetEventType(), name)
+}
+
+var _sagaManagers = &sagaManagerRegistry{managers: make(map[string]*SagaManager)}
+
+type sagaManagerRegistry struct {
+	mu       sync.RWMutex
+	managers map[string]*SagaManager
+}
+
+//
+// RegisterSagaManager
+// @Description: 注册 Saga 管理器，超时到期时按 Saga 类型查找管理器
+// @param manager Saga 管理器
+//
+func RegisterSagaManager(manager *SagaManager) {
+	_sagaManagers.mu.Lock()
+	defer _sagaManagers.mu.Unlock()
+	_sagaManagers.managers[manager.sagaType] = manager
+}
+
+//
+// GetSagaManager
+// @Description: 获取 Saga 管理器
+// @param sagaType Saga 类型
+// @return *SagaManager
+// @return bool 是否存在
+//
+func GetSagaManager(sagaType string) (*SagaManager, bool) {
+	_sagaManagers.mu.RLock()
+	defer _sagaManagers.mu.RUnlock()
+	m, ok := _sagaManagers.managers[sagaType]
+	return m, ok
+}
+
+//
+// HasSagaManagers
+// @Description: 是否注册了 Saga 管理器
+// @return bool
+//
+func HasSagaManagers() bool {
+	_sagaManagers.mu.RLock()
+	defer _sagaManagers.mu.RUnlock()
+	return len(_sagaManagers.managers) > 0
+}
+
+//
+// HandleSagaDeadline
+// @Description: 按 Saga 类型查找管理器并处理到期的超时
+// @param ctx 上下文
+// @param deadline 超时
+// @return error
+//
+func HandleSagaDeadline(ctx context.Context, deadline *SagaDeadline) error {
+	manager, ok := GetSagaManager(deadline.SagaType)
+	if !ok {
+		return errors.ErrorOf("saga manager %s not registered", deadline.SagaType)
+	}
+	return manager.HandleDeadline(ctx, deadline)
+}
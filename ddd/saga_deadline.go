@@ -0,0 +1,205 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/applog"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"github.com/liuxd6825/go-sdk/actor"
+	dapr "github.com/liuxd6825/go-sdk/client"
+	"sync"
+	"time"
+)
+
+const sagaActorType = "ddd.SagaActorType"
+
+//
+// SagaDeadline
+// @Description: Saga 超时，作为 actor reminder 的数据
+//
+type SagaDeadline struct {
+	TenantId string `json:"tenantId"`
+	SagaType string `json:"sagaType"`
+	SagaId   string `json:"sagaId"`
+	Name     string `json:"name"`
+}
+
+func (d *SagaDeadline) getKey() string {
+	return fmt.Sprintf("%s/%s/%s/%s", d.TenantId, d.SagaType, d.SagaId, d.Name)
+}
+
+//
+// SagaDeadlineScheduler
+// @Description: Saga 超时调度器，到期后调用 HandleSagaDeadline
+//
+type SagaDeadlineScheduler interface {
+	Schedule(ctx context.Context, deadline *SagaDeadline, dueTime time.Duration) error
+	Cancel(ctx context.Context, deadline *SagaDeadline) error
+}
+
+var _sagaDeadlineScheduler = &sagaDeadlineSchedulerHolder{scheduler: NewActorSagaDeadlineScheduler()}
+
+type sagaDeadlineSchedulerHolder struct {
+	mu        sync.RWMutex
+	scheduler SagaDeadlineScheduler
+}
+
+//
+// SetSagaDeadlineScheduler
+// @Description: 设置 Saga 超时调度器，默认通过 dapr actor reminder 实现
+// @param scheduler 超时调度器
+//
+func SetSagaDeadlineScheduler(scheduler SagaDeadlineScheduler) {
+	_sagaDeadlineScheduler.mu.Lock()
+	defer _sagaDeadlineScheduler.mu.Unlock()
+	_sagaDeadlineScheduler.scheduler = scheduler
+}
+
+//
+// GetSagaDeadlineScheduler
+// @Description: 获取 Saga 超时调度器
+// @return SagaDeadlineScheduler
+//
+func GetSagaDeadlineScheduler() SagaDeadlineScheduler {
+	_sagaDeadlineScheduler.mu.RLock()
+	defer _sagaDeadlineScheduler.mu.RUnlock()
+	return _sagaDeadlineScheduler.scheduler
+}
+
+//
+// actorSagaDeadlineScheduler
+// @Description: 通过 dapr actor reminder 实现的超时调度器，需要注册 SagaActorService
+//
+type actorSagaDeadlineScheduler struct {
+}
+
+func NewActorSagaDeadlineScheduler() SagaDeadlineScheduler {
+	return &actorSagaDeadlineScheduler{}
+}
+
+func (s *actorSagaDeadlineScheduler) Schedule(ctx context.Context, deadline *SagaDeadline, dueTime time.Duration) error {
+	client, err := s.getClient()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(deadline)
+	if err != nil {
+		return err
+	}
+	return client.RegisterActorReminder(ctx, &dapr.RegisterActorReminderRequest{
+		ActorType: sagaActorType,
+		ActorID:   getSagaActorId(deadline),
+		Name:      deadline.Name,
+		DueTime:   dueTime.String(),
+		Data:      data,
+	})
+}
+
+func (s *actorSagaDeadlineScheduler) Cancel(ctx context.Context, deadline *SagaDeadline) error {
+	client, err := s.getClient()
+	if err != nil {
+		return err
+	}
+	return client.UnregisterActorReminder(ctx, &dapr.UnregisterActorReminderRequest{
+		ActorType: sagaActorType,
+		ActorID:   getSagaActorId(deadline),
+		Name:      deadline.Name,
+	})
+}
+
+func (s *actorSagaDeadlineScheduler) getClient() (dapr.Client, error) {
+	daprDddClient := daprclient.GetDaprDDDClient()
+	if daprDddClient == nil {
+		return nil, errors.ErrorOf("daprclient.GetDaprDDDClient() is nil")
+	}
+	return daprDddClient.DaprClient()
+}
+
+func getSagaActorId(deadline *SagaDeadline) string {
+	return fmt.Sprintf("tenantId(%s),sagaType(%s),sagaId(%s)", deadline.TenantId, deadline.SagaType, deadline.SagaId)
+}
+
+//
+// SagaActorService
+// @Description: 接收 Saga 超时 reminder 的 actor。restapp 只在注册了 Saga 管理器或配置 saga.enable 时注册
+//
+type SagaActorService struct {
+	actor.ServerImplBase
+}
+
+func NewSagaActorService() *SagaActorService {
+	return &SagaActorService{}
+}
+
+func (s *SagaActorService) Type() string {
+	return sagaActorType
+}
+
+func (s *SagaActorService) ReminderCall(reminderName string, state []byte, dueTime string, period string) {
+	deadline := &SagaDeadline{}
+	if err := json.Unmarshal(state, deadline); err != nil {
+		_, _ = applog.Error("", "ddd.SagaActorService", "ReminderCall", err.Error())
+		return
+	}
+	if err := HandleSagaDeadline(context.Background(), deadline); err != nil {
+		_, _ = applog.Error(deadline.TenantId, "ddd.SagaActorService", "ReminderCall", err.Error())
+	}
+}
+
+//
+// LocalSagaDeadlineScheduler
+// @Description: 进程内超时调度器，使用定时器实现，进程重启后超时丢失，用于单元测试与本地开发
+//
+type LocalSagaDeadlineScheduler struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+	wg     sync.WaitGroup
+}
+
+func NewLocalSagaDeadlineScheduler() *LocalSagaDeadlineScheduler {
+	return &LocalSagaDeadlineScheduler{timers: make(map[string]*time.Timer)}
+}
+
+func (s *LocalSagaDeadlineScheduler) Schedule(ctx context.Context, deadline *SagaDeadline, dueTime time.Duration) error {
+	key := deadline.getKey()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop(key)
+	s.wg.Add(1)
+	s.timers[key] = time.AfterFunc(dueTime, func() {
+		defer s.wg.Done()
+		s.mu.Lock()
+		delete(s.timers, key)
+		s.mu.Unlock()
+		if err := HandleSagaDeadline(context.Background(), deadline); err != nil {
+			_, _ = applog.Error(deadline.TenantId, "ddd.LocalSagaDeadlineScheduler", "HandleSagaDeadline", err.Error())
+		}
+	})
+	return nil
+}
+
+func (s *LocalSagaDeadlineScheduler) Cancel(ctx context.Context, deadline *SagaDeadline) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop(deadline.getKey())
+	return nil
+}
+
+//
+// Wait
+// @Description: 等待已设置的超时全部执行或取消
+//
+func (s *LocalSagaDeadlineScheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *LocalSagaDeadlineScheduler) stop(key string) {
+	if timer, ok := s.timers[key]; ok {
+		if timer.Stop() {
+			s.wg.Done()
+		}
+		delete(s.timers, key)
+	}
+}
@@ -0,0 +1,93 @@
+package ddd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+//
+// SagaRepository
+// @Description: Saga 状态仓储，Saga 以 JSON 保存，查找时反序列化到传入的 saga 对象
+//
+type SagaRepository interface {
+	FindByAssociation(ctx context.Context, tenantId, sagaType, key, value string, saga Saga) (bool, error)
+	FindById(ctx context.Context, tenantId, sagaType, sagaId string, saga Saga) (bool, error)
+	Save(ctx context.Context, saga Saga) error
+	Delete(ctx context.Context, tenantId, sagaType, sagaId string) error
+}
+
+//
+// memorySagaRepository
+// @Description: 内存 Saga 仓储，用于单元测试与本地开发
+//
+type memorySagaRepository struct {
+	mu    sync.RWMutex
+	sagas map[string]*memorySaga
+}
+
+type memorySaga struct {
+	tenantId     string
+	sagaType     string
+	associations map[string]string
+	data         []byte
+}
+
+func NewMemorySagaRepository() SagaRepository {
+	return &memorySagaRepository{sagas: make(map[string]*memorySaga)}
+}
+
+func (r *memorySagaRepository) FindByAssociation(ctx context.Context, tenantId, sagaType, key, value string, saga Saga) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, item := range r.sagas {
+		if item.tenantId == tenantId && item.sagaType == sagaType && item.associations[key] == value {
+			return true, json.Unmarshal(item.data, saga)
+		}
+	}
+	return false, nil
+}
+
+func (r *memorySagaRepository) FindById(ctx context.Context, tenantId, sagaType, sagaId string, saga Saga) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	item, ok := r.sagas[r.getKey(tenantId, sagaType, sagaId)]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(item.data, saga)
+}
+
+func (r *memorySagaRepository) Save(ctx context.Context, saga Saga) error {
+	base := saga.GetSagaBase()
+	data, err := json.Marshal(saga)
+	if err != nil {
+		return err
+	}
+	associations := make(map[string]string, len(base.Associations))
+	for k, v := range base.Associations {
+		associations[k] = v
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sagas[r.getKey(base.TenantId, saga.GetSagaType(), base.SagaId)] = &memorySaga{
+		tenantId:     base.TenantId,
+		sagaType:     saga.GetSagaType(),
+		associations: associations,
+		data:         data,
+	}
+	return nil
+}
+
+func (r *memorySagaRepository) Delete(ctx context.Context, tenantId, sagaType, sagaId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sagas, r.getKey(tenantId, sagaType, sagaId))
+	return nil
+}
+
+func (r *memorySagaRepository) getKey(tenantId, sagaType, sagaId string) string {
+	return fmt.Sprintf("%s/%s/%s", tenantId, sagaType, sagaId)
+}
@@ -0,0 +1,133 @@
+package ddd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSagaManager(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemorySagaRepository()
+	scheduler := NewLocalSagaDeadlineScheduler()
+	var commands []Command
+	manager := NewSagaManager(func() Saga { return &memSaga{} }, repository).
+		StartOn("test.MemCreatedEvent", "id").
+		On("test.MemUpdatedEvent", "id").
+		SetDeadlineScheduler(scheduler).
+		SetCommandDispatcher(func(ctx context.Context, cmd Command) error {
+			commands = append(commands, cmd)
+			return nil
+		})
+	RegisterSagaManager(manager)
+
+	if err := manager.HandleEvent(ctx, newMemUpdatedEvent("tenant-1", "agg-1", "name-0")); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.HandleEvent(ctx, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.HandleEvent(ctx, newMemUpdatedEvent("tenant-1", "agg-1", "name-2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.HandleEvent(ctx, newMemUpdatedEvent("tenant-1", "agg-2", "other")); err != nil {
+		t.Fatal(err)
+	}
+
+	saga := &memSaga{}
+	find, err := repository.FindByAssociation(ctx, "tenant-1", memSagaType, "id", "agg-1", saga)
+	if err != nil || !find {
+		t.Fatalf("find = %v, err = %v", find, err)
+	}
+	if saga.Names != "name-1,name-2" {
+		t.Errorf("names = %s, want name-1,name-2", saga.Names)
+	}
+	if len(commands) != 1 || commands[0].(*MemUpdateCommand).Name != "name-2" {
+		t.Errorf("commands = %v", commands)
+	}
+
+	scheduler.Wait()
+	if find, _ = repository.FindById(ctx, "tenant-1", memSagaType, saga.SagaId, &memSaga{}); find {
+		t.Error("saga should be ended by deadline")
+	}
+}
+
+func TestSagaManager_Redelivery(t *testing.T) {
+	ctx := context.Background()
+	repository := NewMemorySagaRepository()
+	var commands []Command
+	dispatchErr := errors.New("dispatch error")
+	manager := NewSagaManager(func() Saga { return &memSaga{} }, repository).
+		StartOn("test.MemCreatedEvent", "id").
+		On("test.MemUpdatedEvent", "id").
+		SetDeadlineScheduler(NewLocalSagaDeadlineScheduler()).
+		SetCommandDispatcher(func(ctx context.Context, cmd Command) error {
+			if dispatchErr != nil {
+				return dispatchErr
+			}
+			commands = append(commands, cmd)
+			return nil
+		})
+
+	if err := manager.HandleEvent(ctx, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	// 发送命令失败时恢复 Saga，重新投递后再次处理
+	updated := newMemUpdatedEvent("tenant-1", "agg-1", "name-2")
+	if err := manager.HandleEvent(ctx, updated); !errors.Is(err, dispatchErr) {
+		t.Fatalf("err = %v, want dispatch error", err)
+	}
+	saga := &memSaga{}
+	if _, err := repository.FindByAssociation(ctx, "tenant-1", memSagaType, "id", "agg-1", saga); err != nil {
+		t.Fatal(err)
+	}
+	if saga.Names != "name-1" {
+		t.Errorf("names = %s, saga should be restored to name-1", saga.Names)
+	}
+
+	dispatchErr = nil
+	for i := 0; i < 2; i++ {
+		if err := manager.HandleEvent(ctx, updated); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saga = &memSaga{}
+	if _, err := repository.FindByAssociation(ctx, "tenant-1", memSagaType, "id", "agg-1", saga); err != nil {
+		t.Fatal(err)
+	}
+	if saga.Names != "name-1,name-2" {
+		t.Errorf("names = %s, want name-1,name-2", saga.Names)
+	}
+	if len(commands) != 1 {
+		t.Errorf("commands = %d, redelivered event should be skipped", len(commands))
+	}
+}
+
+const memSagaType = "ddd.memSaga"
+
+type memSaga struct {
+	SagaBase
+	Names string `json:"names"`
+}
+
+func (s *memSaga) GetSagaType() string {
+	return memSagaType
+}
+
+func (s *memSaga) OnMemCreatedEventV1s0(ctx context.Context, event *memCreatedEvent) error {
+	s.Names = event.Data.Name
+	s.ScheduleDeadline("timeout", 20*time.Millisecond)
+	return nil
+}
+
+func (s *memSaga) OnMemUpdatedEventV1s0(ctx context.Context, event *memUpdatedEvent) error {
+	s.Names += "," + event.Data.Name
+	s.Send(&MemUpdateCommand{TenantId: event.TenantId, AggregateId: event.Data.Id, Name: event.Data.Name})
+	return nil
+}
+
+func (s *memSaga) OnDeadline(ctx context.Context, name string) error {
+	s.End()
+	return nil
+}
@@ -0,0 +1,276 @@
+package ddd
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+//
+// SnapshotPolicyContext
+// @Description: 快照策略的判断依据，每次成功写入事件后生成
+//
+type SnapshotPolicyContext struct {
+	TenantId       string
+	AggregateId    string
+	AggregateType  string
+	SequenceNumber uint64 // 写入后聚合最后的事件序号，取事件存储器的返回值或加载聚合时记录的序号，0表示未知
+	EventCount     int    // 本次写入的事件数量
+	EventDataSize  int    // 本次写入的事件数据大小(字节)
+}
+
+func (c *SnapshotPolicyContext) getKey() string {
+	return fmt.Sprintf("%s/%s", c.TenantId, c.AggregateId)
+}
+
+//
+// SnapshotPolicy
+// @Description: 聚合快照策略，决定写入事件后是否调用快照 actor 生成快照。
+// 生成快照时上次快照之后的事件不超过20个则跳过，策略触发过于频繁时不会重复生成快照
+//
+type SnapshotPolicy interface {
+	ShouldSnapshot(ctx *SnapshotPolicyContext) bool
+}
+
+var _snapshotPolicies = &snapshotPolicyRegistry{
+	policies:      make(map[string]SnapshotPolicy),
+	defaultPolicy: NewEveryEventsSnapshotPolicy(20),
+}
+
+type snapshotPolicyRegistry struct {
+	mu            sync.RWMutex
+	policies      map[string]SnapshotPolicy
+	defaultPolicy SnapshotPolicy
+}
+
+//
+// RegisterSnapshotPolicy
+// @Description: 注册聚合类型的快照策略
+// @param aggregateType 聚合类型
+// @param policy 快照策略
+//
+func RegisterSnapshotPolicy(aggregateType string, policy SnapshotPolicy) {
+	_snapshotPolicies.mu.Lock()
+	defer _snapshotPolicies.mu.Unlock()
+	_snapshotPolicies.policies[aggregateType] = policy
+}
+
+//
+// SetDefaultSnapshotPolicy
+// @Description: 设置未注册快照策略的聚合类型使用的默认策略，默认每20个事件生成一次快照
+// @param policy 快照策略
+//
+func SetDefaultSnapshotPolicy(policy SnapshotPolicy) {
+	_snapshotPolicies.mu.Lock()
+	defer _snapshotPolicies.mu.Unlock()
+	_snapshotPolicies.defaultPolicy = policy
+}
+
+//
+// GetSnapshotPolicy
+// @Description: 获取聚合类型的快照策略
+// @param aggregateType 聚合类型
+// @return SnapshotPolicy
+//
+func GetSnapshotPolicy(aggregateType string) SnapshotPolicy {
+	_snapshotPolicies.mu.RLock()
+	defer _snapshotPolicies.mu.RUnlock()
+	if policy, ok := _snapshotPolicies.policies[aggregateType]; ok && policy != nil {
+		return policy
+	}
+	if _snapshotPolicies.defaultPolicy == nil {
+		return NewNeverSnapshotPolicy()
+	}
+	return _snapshotPolicies.defaultPolicy
+}
+
+// 按时间、大小生成快照的策略最多记录的聚合数量，超过时淘汰最久未写入的聚合
+const maxSnapshotPolicyKeys = 10000
+
+//
+// snapshotPolicyStates
+// @Description: 快照策略记录的聚合状态，按 LRU 淘汰，防止聚合数量增长时无限占用内存
+//
+type snapshotPolicyStates[V any] struct {
+	size  int
+	items map[string]*list.Element
+	lru   *list.List
+}
+
+type snapshotPolicyState[V any] struct {
+	key   string
+	value V
+}
+
+func newSnapshotPolicyStates[V any](size int) *snapshotPolicyStates[V] {
+	return &snapshotPolicyStates[V]{
+		size:  size,
+		items: make(map[string]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+func (s *snapshotPolicyStates[V]) get(key string) (V, bool) {
+	elem, ok := s.items[key]
+	if !ok {
+		var value V
+		return value, false
+	}
+	s.lru.MoveToFront(elem)
+	return elem.Value.(*snapshotPolicyState[V]).value, true
+}
+
+func (s *snapshotPolicyStates[V]) set(key string, value V) {
+	if elem, ok := s.items[key]; ok {
+		elem.Value.(*snapshotPolicyState[V]).value = value
+		s.lru.MoveToFront(elem)
+		return
+	}
+	s.items[key] = s.lru.PushFront(&snapshotPolicyState[V]{key: key, value: value})
+	for s.lru.Len() > s.size {
+		s.remove(s.lru.Back().Value.(*snapshotPolicyState[V]).key)
+	}
+}
+
+func (s *snapshotPolicyStates[V]) remove(key string) {
+	if elem, ok := s.items[key]; ok {
+		s.lru.Remove(elem)
+		delete(s.items, key)
+	}
+}
+
+func (s *snapshotPolicyStates[V]) len() int {
+	return s.lru.Len()
+}
+
+//
+// everyEventsSnapshotPolicy
+// @Description: 每N个事件生成一次快照，按聚合的事件序号判断，不在进程内计数，多实例下结果一致。
+// 序号未知(事件存储器未返回且加载聚合时未记录)时退回到进程内计数，累计写入N个事件后生成快照；
+// 最多记录 maxSnapshotPolicyKeys 个聚合的计数，被淘汰的聚合重新计数
+//
+type everyEventsSnapshotPolicy struct {
+	count  uint64
+	mu     sync.Mutex
+	counts *snapshotPolicyStates[uint64]
+}
+
+func NewEveryEventsSnapshotPolicy(count uint64) SnapshotPolicy {
+	return &everyEventsSnapshotPolicy{
+		count:  count,
+		counts: newSnapshotPolicyStates[uint64](maxSnapshotPolicyKeys),
+	}
+}
+
+func (p *everyEventsSnapshotPolicy) ShouldSnapshot(ctx *SnapshotPolicyContext) bool {
+	if p.count == 0 || ctx.EventCount <= 0 {
+		return false
+	}
+	eventCount := uint64(ctx.EventCount)
+	if ctx.SequenceNumber == 0 {
+		return p.countEvents(ctx.getKey(), eventCount)
+	}
+	if eventCount > ctx.SequenceNumber {
+		eventCount = ctx.SequenceNumber
+	}
+	return ctx.SequenceNumber/p.count > (ctx.SequenceNumber-eventCount)/p.count
+}
+
+func (p *everyEventsSnapshotPolicy) countEvents(key string, eventCount uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	count, _ := p.counts.get(key)
+	count += eventCount
+	if count < p.count {
+		p.counts.set(key, count)
+		return false
+	}
+	p.counts.set(key, 0)
+	return true
+}
+
+//
+// intervalSnapshotPolicy
+// @Description: 距离上次快照超过指定时间后，在下一次写入事件时生成快照。
+// 最多记录 maxSnapshotPolicyKeys 个聚合的快照时间，被淘汰的聚合重新计时
+//
+type intervalSnapshotPolicy struct {
+	interval time.Duration
+	mu       sync.Mutex
+	times    *snapshotPolicyStates[time.Time]
+}
+
+func NewIntervalSnapshotPolicy(interval time.Duration) SnapshotPolicy {
+	return &intervalSnapshotPolicy{
+		interval: interval,
+		times:    newSnapshotPolicyStates[time.Time](maxSnapshotPolicyKeys),
+	}
+}
+
+func (p *intervalSnapshotPolicy) ShouldSnapshot(ctx *SnapshotPolicyContext) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := ctx.getKey()
+	now := time.Now()
+	last, ok := p.times.get(key)
+	if !ok {
+		p.times.set(key, now)
+		return false
+	}
+	if now.Sub(last) >= p.interval {
+		p.times.set(key, now)
+		return true
+	}
+	return false
+}
+
+//
+// sizeSnapshotPolicy
+// @Description: 上次快照后写入的事件数据累计超过指定大小(字节)时生成快照。
+// 最多记录 maxSnapshotPolicyKeys 个聚合的累计大小，被淘汰的聚合重新累计
+//
+type sizeSnapshotPolicy struct {
+	size  int
+	mu    sync.Mutex
+	sizes *snapshotPolicyStates[int]
+}
+
+func NewSizeSnapshotPolicy(size int) SnapshotPolicy {
+	return &sizeSnapshotPolicy{
+		size:  size,
+		sizes: newSnapshotPolicyStates[int](maxSnapshotPolicyKeys),
+	}
+}
+
+func (p *sizeSnapshotPolicy) ShouldSnapshot(ctx *SnapshotPolicyContext) bool {
+	if p.size <= 0 {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := ctx.getKey()
+	size, _ := p.sizes.get(key)
+	size += ctx.EventDataSize
+	if size >= p.size {
+		p.sizes.remove(key)
+		return true
+	}
+	p.sizes.set(key, size)
+	return false
+}
+
+//
+// neverSnapshotPolicy
+// @Description: 从不生成快照
+//
+type neverSnapshotPolicy struct {
+}
+
+func NewNeverSnapshotPolicy() SnapshotPolicy {
+	return &neverSnapshotPolicy{}
+}
+
+func (p *neverSnapshotPolicy) ShouldSnapshot(ctx *SnapshotPolicyContext) bool {
+	return false
+}
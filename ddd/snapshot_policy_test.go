@@ -0,0 +1,90 @@
+package ddd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEveryEventsSnapshotPolicy(t *testing.T) {
+	policy := NewEveryEventsSnapshotPolicy(3)
+	var got []uint64
+	for seq := uint64(1); seq <= 7; seq++ {
+		if policy.ShouldSnapshot(&SnapshotPolicyContext{AggregateId: "agg-1", SequenceNumber: seq, EventCount: 1}) {
+			got = append(got, seq)
+		}
+	}
+	if len(got) != 2 || got[0] != 3 || got[1] != 6 {
+		t.Errorf("snapshot at %v, want [3 6]", got)
+	}
+	if !policy.ShouldSnapshot(&SnapshotPolicyContext{AggregateId: "agg-1", SequenceNumber: 10, EventCount: 3}) {
+		t.Error("a batch crossing 9 should snapshot")
+	}
+
+	count := 0
+	for i := 0; i < 7; i++ {
+		if policy.ShouldSnapshot(&SnapshotPolicyContext{AggregateId: "agg-2", EventCount: 1}) {
+			count++
+		}
+	}
+	if count != 2 {
+		t.Errorf("snapshot count without sequence number = %d, want 2", count)
+	}
+}
+
+func TestSnapshotPolicyStates(t *testing.T) {
+	states := newSnapshotPolicyStates[int](2)
+	states.set("agg-1", 1)
+	states.set("agg-2", 2)
+	if _, ok := states.get("agg-1"); !ok {
+		t.Fatal("agg-1 should exist")
+	}
+	states.set("agg-3", 3)
+	if _, ok := states.get("agg-2"); ok {
+		t.Error("least recently used agg-2 should be evicted")
+	}
+	if v, ok := states.get("agg-1"); !ok || v != 1 || states.len() != 2 {
+		t.Errorf("agg-1 = %d, %v, len = %d; want 1, true, 2", v, ok, states.len())
+	}
+
+	size := NewSizeSnapshotPolicy(100).(*sizeSnapshotPolicy)
+	for i := 0; i < maxSnapshotPolicyKeys+10; i++ {
+		size.ShouldSnapshot(&SnapshotPolicyContext{AggregateId: fmt.Sprintf("agg-%d", i), EventDataSize: 1})
+	}
+	if size.sizes.len() != maxSnapshotPolicyKeys {
+		t.Errorf("size policy keys = %d, want %d", size.sizes.len(), maxSnapshotPolicyKeys)
+	}
+}
+
+func TestSizeAndIntervalSnapshotPolicy(t *testing.T) {
+	size := NewSizeSnapshotPolicy(100)
+	if size.ShouldSnapshot(&SnapshotPolicyContext{AggregateId: "agg-1", EventDataSize: 60}) {
+		t.Error("60 bytes should not snapshot")
+	}
+	if !size.ShouldSnapshot(&SnapshotPolicyContext{AggregateId: "agg-1", EventDataSize: 60}) {
+		t.Error("120 bytes should snapshot")
+	}
+	if size.ShouldSnapshot(&SnapshotPolicyContext{AggregateId: "agg-1", EventDataSize: 60}) {
+		t.Error("size should be reset after snapshot")
+	}
+
+	interval := NewIntervalSnapshotPolicy(10 * time.Millisecond)
+	ctx := &SnapshotPolicyContext{AggregateId: "agg-1", EventCount: 1}
+	if interval.ShouldSnapshot(ctx) {
+		t.Error("first write should not snapshot")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !interval.ShouldSnapshot(ctx) {
+		t.Error("write after interval should snapshot")
+	}
+}
+
+func TestGetSnapshotPolicy(t *testing.T) {
+	RegisterSnapshotPolicy("test.neverAggregate", NewNeverSnapshotPolicy())
+	if GetSnapshotPolicy("test.neverAggregate").ShouldSnapshot(&SnapshotPolicyContext{SequenceNumber: 20, EventCount: 20}) {
+		t.Error("never policy should not snapshot")
+	}
+	if !GetSnapshotPolicy("test.otherAggregate").ShouldSnapshot(&SnapshotPolicyContext{SequenceNumber: 20, EventCount: 1}) {
+		t.Error("default policy should snapshot every 20 events")
+	}
+}
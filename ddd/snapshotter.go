@@ -0,0 +1,185 @@
+package ddd
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/applog"
+	"sync"
+)
+
+//
+// Snapshotter
+// @Description: 聚合快照生成器，快照策略决定生成快照后调用，Submit 不应阻塞调用方
+//
+type Snapshotter interface {
+	Submit(ctx context.Context, tenantId, aggregateId, aggregateType string)
+}
+
+var _snapshotter = newSnapshotterHolder()
+
+type snapshotterHolder struct {
+	mu          sync.RWMutex
+	snapshotter Snapshotter
+}
+
+func newSnapshotterHolder() *snapshotterHolder {
+	return &snapshotterHolder{snapshotter: NewActorSnapshotter()}
+}
+
+//
+// SetSnapshotter
+// @Description: 设置聚合快照生成器，默认通过 dapr actor 生成快照
+// @param snapshotter 快照生成器
+//
+func SetSnapshotter(snapshotter Snapshotter) {
+	_snapshotter.mu.Lock()
+	defer _snapshotter.mu.Unlock()
+	_snapshotter.snapshotter = snapshotter
+}
+
+//
+// GetSnapshotter
+// @Description: 获取聚合快照生成器
+// @return Snapshotter
+//
+func GetSnapshotter() Snapshotter {
+	_snapshotter.mu.RLock()
+	defer _snapshotter.mu.RUnlock()
+	return _snapshotter.snapshotter
+}
+
+//
+// actorSnapshotter
+// @Description: 通过 dapr actor 生成快照
+//
+type actorSnapshotter struct {
+}
+
+func NewActorSnapshotter() Snapshotter {
+	return &actorSnapshotter{}
+}
+
+func (s *actorSnapshotter) Submit(ctx context.Context, tenantId, aggregateId, aggregateType string) {
+	go func() {
+		_ = callActorSaveSnapshot(ctx, tenantId, aggregateId, aggregateType)
+	}()
+}
+
+type LocalSnapshotterOptions struct {
+	Workers         int    // 工作协程数量，默认为1
+	QueueSize       int    // 等待队列长度，队列已满时丢弃请求，默认为100
+	EventStorageKey string // 事件存储器名称
+}
+
+type localSnapshotTask struct {
+	tenantId      string
+	aggregateId   string
+	aggregateType string
+}
+
+type localSnapshotState struct {
+	running bool
+	again   bool
+}
+
+//
+// LocalSnapshotter
+// @Description: 进程内快照生成器，不依赖 dapr actor。使用有界工作池执行 SaveSnapshot，
+// 同一聚合的请求在排队或执行期间会被合并，执行期间收到的请求在执行结束后再执行一次。
+//
+type LocalSnapshotter struct {
+	eventStorageKey string
+	tasks           chan *localSnapshotTask
+	mu              sync.Mutex
+	states          map[string]*localSnapshotState
+	wg              sync.WaitGroup
+}
+
+//
+// NewLocalSnapshotter
+// @Description: 新建进程内快照生成器
+// @param opts 选项
+// @return *LocalSnapshotter
+//
+func NewLocalSnapshotter(opts *LocalSnapshotterOptions) *LocalSnapshotter {
+	workers, queueSize, eventStorageKey := 1, 100, ""
+	if opts != nil {
+		if opts.Workers > 0 {
+			workers = opts.Workers
+		}
+		if opts.QueueSize > 0 {
+			queueSize = opts.QueueSize
+		}
+		eventStorageKey = opts.EventStorageKey
+	}
+	s := &LocalSnapshotter{
+		eventStorageKey: eventStorageKey,
+		tasks:           make(chan *localSnapshotTask, queueSize),
+		states:          make(map[string]*localSnapshotState),
+	}
+	for i := 0; i < workers; i++ {
+		go s.run()
+	}
+	return s
+}
+
+func (s *LocalSnapshotter) Submit(ctx context.Context, tenantId, aggregateId, aggregateType string) {
+	key := fmt.Sprintf("%s/%s", tenantId, aggregateId)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state, ok := s.states[key]; ok {
+		if state.running {
+			state.again = true
+		}
+		return
+	}
+	task := &localSnapshotTask{tenantId: tenantId, aggregateId: aggregateId, aggregateType: aggregateType}
+	s.wg.Add(1)
+	select {
+	case s.tasks <- task:
+		s.states[key] = &localSnapshotState{}
+	default:
+		s.wg.Done()
+		_, _ = applog.Warn(tenantId, "ddd.LocalSnapshotter", "Submit", fmt.Sprintf("snapshot queue is full, aggregateId=%s", aggregateId))
+	}
+}
+
+//
+// Wait
+// @Description: 等待已提交的快照请求全部执行完成
+//
+func (s *LocalSnapshotter) Wait() {
+	s.wg.Wait()
+}
+
+func (s *LocalSnapshotter) run() {
+	for task := range s.tasks {
+		s.execute(task)
+	}
+}
+
+func (s *LocalSnapshotter) execute(task *localSnapshotTask) {
+	defer s.wg.Done()
+	key := fmt.Sprintf("%s/%s", task.tenantId, task.aggregateId)
+	for {
+		s.mu.Lock()
+		s.states[key].running = true
+		s.mu.Unlock()
+
+		err := SaveSnapshot(context.Background(), task.tenantId, task.aggregateType, task.aggregateId, s.eventStorageKey)
+		if err != nil {
+			_, _ = applog.Error(task.tenantId, "ddd.LocalSnapshotter", "SaveSnapshot", err.Error())
+		}
+
+		s.mu.Lock()
+		state := s.states[key]
+		if !state.again {
+			delete(s.states, key)
+			s.mu.Unlock()
+			return
+		}
+		state.again = false
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,58 @@
+package ddd
+
+import (
+	"context"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"testing"
+)
+
+func TestLocalSnapshotter(t *testing.T) {
+	ctx := context.Background()
+	eventStorage := newMemoryStorage(t)
+
+	agg := &memAggregate{}
+	if _, err := CreateEvent(ctx, agg, newMemCreatedEvent("tenant-1", "agg-1", "name-1", "user-1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApplyEvent(ctx, agg, newMemUpdatedEvent("tenant-1", "agg-1", "name-2")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 快照之后的事件不超过 snapshotEventsMinCount 时不生成快照
+	snapshotter := NewLocalSnapshotter(&LocalSnapshotterOptions{Workers: 2, QueueSize: 10})
+	snapshotter.Submit(ctx, "tenant-1", "agg-1", memAggregateType)
+	snapshotter.Wait()
+	resp, err := eventStorage.LoadEvent(ctx, &daprclient.LoadEventsRequest{TenantId: "tenant-1", AggregateId: "agg-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Snapshot != nil {
+		t.Fatalf("snapshot sequenceNumber = %d, want no snapshot", resp.Snapshot.SequenceNumber)
+	}
+
+	last := uint64(snapshotEventsMinCount + 2)
+	for seq := uint64(3); seq <= last; seq++ {
+		if _, err := ApplyEvent(ctx, agg, newMemUpdatedEvent("tenant-1", "agg-1", fmt.Sprintf("name-%d", seq))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		snapshotter.Submit(ctx, "tenant-1", "agg-1", memAggregateType)
+	}
+	snapshotter.Wait()
+
+	resp, err = eventStorage.LoadEvent(ctx, &daprclient.LoadEventsRequest{TenantId: "tenant-1", AggregateId: "agg-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Snapshot == nil {
+		t.Fatal("snapshot is nil")
+	}
+	if resp.Snapshot.SequenceNumber != last || len(*resp.EventRecords) != 0 {
+		t.Errorf("snapshot sequenceNumber = %d, events = %d", resp.Snapshot.SequenceNumber, len(*resp.EventRecords))
+	}
+	if name := resp.Snapshot.AggregateData["name"]; name != fmt.Sprintf("name-%d", last) {
+		t.Errorf("snapshot name = %v, want name-%d", name, last)
+	}
+}
@@ -0,0 +1,105 @@
+package ddd
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+//
+// RetryPolicy
+// @Description: 查询端事件处理失败时的重试策略，重试间隔按 Multiplier 指数增长，不超过 MaxInterval
+//
+type RetryPolicy struct {
+	MaxAttempts     int           // 最大执行次数(包含首次执行)，小于等于1时不重试
+	InitialInterval time.Duration // 首次重试间隔
+	MaxInterval     time.Duration // 最大重试间隔，0表示不限制
+	Multiplier      float64       // 间隔增长倍数，小于1时按2计算
+}
+
+var _retryPolicy = &retryPolicyHolder{}
+
+type retryPolicyHolder struct {
+	mu     sync.RWMutex
+	policy *RetryPolicy
+}
+
+//
+// NewRetryPolicy
+// @Description: 新建重试策略，间隔增长倍数为2
+// @param maxAttempts 最大执行次数(包含首次执行)
+// @param initialInterval 首次重试间隔
+// @param maxInterval 最大重试间隔
+// @return *RetryPolicy
+//
+func NewRetryPolicy(maxAttempts int, initialInterval, maxInterval time.Duration) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:     maxAttempts,
+		InitialInterval: initialInterval,
+		MaxInterval:     maxInterval,
+		Multiplier:      2,
+	}
+}
+
+//
+// SetSubscribeRetryPolicy
+// @Description: 设置订阅项未指定 Retry 时使用的默认重试策略，为 nil 时不重试(默认)
+// @param policy 重试策略
+//
+func SetSubscribeRetryPolicy(policy *RetryPolicy) {
+	_retryPolicy.mu.Lock()
+	defer _retryPolicy.mu.Unlock()
+	_retryPolicy.policy = policy
+}
+
+//
+// GetSubscribeRetryPolicy
+// @Description: 获取默认重试策略
+// @return *RetryPolicy 未设置时为 nil
+//
+func GetSubscribeRetryPolicy() *RetryPolicy {
+	_retryPolicy.mu.RLock()
+	defer _retryPolicy.mu.RUnlock()
+	return _retryPolicy.policy
+}
+
+//
+// getInterval
+// @Description: 第 attempt 次执行失败后的重试间隔，attempt 从1开始
+//
+func (p *RetryPolicy) getInterval(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	interval := float64(p.InitialInterval) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 && interval > float64(p.MaxInterval) {
+		return p.MaxInterval
+	}
+	return time.Duration(interval)
+}
+
+//
+// retry
+// @Description: 按重试策略执行 fn，返回执行次数与最后一次的错误；上下文取消时停止重试
+//
+func (p *RetryPolicy) retry(ctx context.Context, fn func() error) (int, error) {
+	maxAttempts := 1
+	if p != nil && p.MaxAttempts > 1 {
+		maxAttempts = p.MaxAttempts
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= maxAttempts {
+			return attempt, err
+		}
+		timer := time.NewTimer(p.getInterval(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+	}
+}
@@ -2,15 +2,21 @@ package ddd
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/applog"
 	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd/ddd_context"
 )
 
 // Subscribe dapr消息订阅项
 type Subscribe struct {
-	PubsubName string            `json:"pubsubName"`
-	Topic      string            `json:"topic"`
-	Route      string            `json:"route"`
-	Metadata   map[string]string `json:"metadata"`
+	PubsubName      string            `json:"pubsubName"`
+	Topic           string            `json:"topic"`
+	Route           string            `json:"route"`
+	Metadata        map[string]string `json:"metadata"`
+	DeadLetterTopic string            `json:"deadLetterTopic,omitempty"` // 未设置死信存储器时，由 Dapr 将处理失败的消息转发到该主题
+	Retry           *RetryPolicy      `json:"-"`                         // 重试策略，为 nil 时使用 GetSubscribeRetryPolicy()
 }
 
 // NewSubscribe 新建消息订阅项
@@ -35,6 +41,14 @@ type SubscribeContext interface {
 	SetErr(err error)
 }
 
+//
+// SubscribeRetryHandler
+// @Description: 按订阅项的重试策略与死信设置处理消息
+//
+type SubscribeRetryHandler interface {
+	CallSubscribeEventHandler(ctx context.Context, subscribe *Subscribe, sctx SubscribeContext) error
+}
+
 type SubscribeHandlerFunc func(sh SubscribeHandler, subscribe Subscribe) error
 
 // SubscribeHandler 消息订阅处理器
@@ -57,16 +71,69 @@ func (h *subscribeHandler) GetSubscribes() (*[]Subscribe, error) {
 }
 
 func (h *subscribeHandler) RegisterSubscribe(subscribe Subscribe) error {
+	registerDeadLetterRoute(subscribe.Route, h)
 	return h.subscribeHandlerFunc(h, subscribe)
 }
 
 // CallQueryEventHandler 消息订阅处理器
 func (h *subscribeHandler) CallQueryEventHandler(ctx context.Context, sctx SubscribeContext) error {
-	data, err := sctx.GetBody()
+	return h.CallSubscribeEventHandler(ctx, nil, sctx)
+}
+
+//
+// CallSubscribeEventHandler
+// @Description: 解析消息(支持 CloudEvents)并按重试策略执行查询事件处理器，重试后仍失败且设置了死信存储器时保存为死信并返回成功
+// @param ctx 上下文
+// @param subscribe 订阅项，为 nil 时使用默认重试策略且不保存死信
+// @param sctx 消息上下文
+// @return error
+//
+func (h *subscribeHandler) CallSubscribeEventHandler(ctx context.Context, subscribe *Subscribe, sctx SubscribeContext) error {
+	eventRecord, cloudEvent, err := newSubscribeEventRecord(sctx)
 	if err != nil {
 		return err
 	}
-	return daprclient.NewEventRecordByJsonBytes(data).OnSuccess(func(eventRecord *daprclient.EventRecord) error {
-		return CallEventHandler(ctx, h.queryEventHandler, eventRecord)
-	}).GetError()
+	setEventRecordSequenceNumber(eventRecord)
+	if cloudEvent != nil {
+		ctx = ddd_context.NewCloudEventContext(ctx, cloudEvent)
+	}
+	policy := GetSubscribeRetryPolicy()
+	if subscribe != nil && subscribe.Retry != nil {
+		policy = subscribe.Retry
+	}
+	attempts, err := policy.retry(ctx, func() error {
+		return h.callEventRecord(ctx, eventRecord)
+	})
+	if err == nil || subscribe == nil {
+		return err
+	}
+	// 乱序的事件等待 Dapr 重新投递，缺失的事件到达后可以按序执行，不进入死信
+	if errors.Is(err, ErrEventOutOfOrder) {
+		return err
+	}
+	store := GetDeadLetterStore()
+	if store == nil {
+		return err
+	}
+	if saveErr := saveDeadLetter(ctx, store, subscribe, eventRecord, attempts, err); saveErr != nil {
+		_, _ = applog.Error("", "ddd", "CallSubscribeEventHandler", fmt.Sprintf("save dead letter %s error: %s", eventRecord.EventId, saveErr.Error()))
+		return err
+	}
+	_, _ = applog.Error("", "ddd", "CallSubscribeEventHandler", fmt.Sprintf("event %s moved to dead letter after %d attempts: %s", eventRecord.EventId, attempts, err.Error()))
+	return nil
+}
+
+func (h *subscribeHandler) callEventRecord(ctx context.Context, eventRecord *daprclient.EventRecord) error {
+	if checkpointer := GetProjectionCheckpointer(); checkpointer != nil {
+		return checkpointer.handle(ctx, getProjectionHandlerName(h.queryEventHandler), eventRecord, h.applyEventRecord)
+	}
+	return h.applyEventRecord(ctx, eventRecord)
+}
+
+func (h *subscribeHandler) applyEventRecord(ctx context.Context, eventRecord *daprclient.EventRecord) error {
+	ctx = newEventCorrelationContext(ctx, eventRecord.EventId, eventRecord.Metadata)
+	if handler, ok := h.queryEventHandler.(EventRecordHandler); ok {
+		return handler.HandleEventRecord(ctx, eventRecord)
+	}
+	return CallEventHandler(ctx, h.queryEventHandler, eventRecord)
 }
@@ -0,0 +1,200 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/daprclient"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+	"reflect"
+	"strings"
+)
+
+type NewAggregateFunc func() ddd.Aggregate
+
+//
+// Fixture
+// @Description: Given/When/Then 聚合测试夹具，不依赖 dapr sidecar。
+// 例：test.NewFixture(newAggregate).Given(events...).When(cmd).ExpectEvents(events...)
+//
+type Fixture struct {
+	newAggregate NewAggregateFunc
+	givenEvents  []ddd.DomainEvent
+	ctx          context.Context
+}
+
+//
+// ResultValidator
+// @Description: 命令执行结果，用于校验产生的事件与错误
+//
+type ResultValidator struct {
+	aggregate ddd.Aggregate
+	events    []ddd.DomainEvent
+	err       error
+}
+
+//
+// NewFixture
+// @Description: 新建聚合测试夹具
+// @param newAggregate 新建空聚合的方法
+// @return *Fixture
+//
+func NewFixture(newAggregate NewAggregateFunc) *Fixture {
+	return &Fixture{
+		newAggregate: newAggregate,
+		ctx:          context.Background(),
+	}
+}
+
+//
+// WithContext
+// @Description: 设置执行命令的上下文，如携带 metadata 的上下文
+//
+func (f *Fixture) WithContext(ctx context.Context) *Fixture {
+	f.ctx = ctx
+	return f
+}
+
+//
+// Given
+// @Description: 设置聚合的历史事件，执行命令前通过 ddd.CallEventHandler 重放
+//
+func (f *Fixture) Given(events ...ddd.DomainEvent) *Fixture {
+	f.givenEvents = append(f.givenEvents, events...)
+	return f
+}
+
+//
+// When
+// @Description: 重放历史事件后执行命令，捕获命令产生的事件
+// @param cmd 命令
+// @return *ResultValidator
+//
+func (f *Fixture) When(cmd ddd.Command) *ResultValidator {
+	res := &ResultValidator{aggregate: f.newAggregate()}
+	for _, event := range f.givenEvents {
+		record, err := newEventRecord(event)
+		if err == nil {
+			err = ddd.CallEventHandler(f.ctx, res.aggregate, record)
+		}
+		if err != nil {
+			res.err = fmt.Errorf("given event %s error: %w", event.GetEventType(), err)
+			return res
+		}
+	}
+
+	ctx := ddd.NewEventCaptureContext(f.ctx)
+	res.err = ddd.CallCommandHandler(ctx, res.aggregate, cmd)
+	for _, item := range ddd.GetCapturedEvents(ctx) {
+		res.events = append(res.events, item.Event)
+	}
+	return res
+}
+
+//
+// GetAggregate
+// @Description: 获取执行命令后的聚合
+//
+func (r *ResultValidator) GetAggregate() ddd.Aggregate {
+	return r.aggregate
+}
+
+//
+// GetEvents
+// @Description: 获取命令产生的事件
+//
+func (r *ResultValidator) GetEvents() []ddd.DomainEvent {
+	return r.events
+}
+
+//
+// ExpectEvents
+// @Description: 校验命令执行成功，并产生期望的事件。事件按类型、版本与数据(GetData)比较，忽略事件id、命令id与时间。
+// @param events 期望的事件，为空表示不应产生事件
+// @return error 不一致时返回差异说明
+//
+func (r *ResultValidator) ExpectEvents(events ...ddd.DomainEvent) error {
+	if r.err != nil {
+		return fmt.Errorf("expected events, but got error: %s", r.err.Error())
+	}
+	var diffs []string
+	count := len(events)
+	if len(r.events) > count {
+		count = len(r.events)
+	}
+	for i := 0; i < count; i++ {
+		var expected, actual string
+		if i < len(events) {
+			expected = describeEvent(events[i])
+		}
+		if i < len(r.events) {
+			actual = describeEvent(r.events[i])
+		}
+		if expected != actual {
+			diffs = append(diffs, fmt.Sprintf("event[%d]\n  expected: %s\n  actual:   %s", i, expected, actual))
+		}
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("expected %d events, got %d\n%s", len(events), len(r.events), strings.Join(diffs, "\n"))
+	}
+	return nil
+}
+
+//
+// ExpectError
+// @Description: 校验命令执行失败。期望错误与实际错误类型与信息相同，或 errors.Is 成立时视为一致；expected 为 nil 时只校验有错误。
+// @param expected 期望的错误
+// @return error 不一致时返回差异说明
+//
+func (r *ResultValidator) ExpectError(expected error) error {
+	if r.err == nil {
+		return fmt.Errorf("expected error %v, but command succeeded with %d events", expected, len(r.events))
+	}
+	if expected == nil || errors.Is(r.err, expected) {
+		return nil
+	}
+	if reflect.TypeOf(expected) == reflect.TypeOf(r.err) && expected.Error() == r.err.Error() {
+		return nil
+	}
+	return fmt.Errorf("expected error: %T %s\nactual error:   %T %s", expected, expected.Error(), r.err, r.err.Error())
+}
+
+//
+// ExpectSuccess
+// @Description: 校验命令执行成功，不校验产生的事件
+//
+func (r *ResultValidator) ExpectSuccess() error {
+	if r.err != nil {
+		return fmt.Errorf("expected success, but got error: %s", r.err.Error())
+	}
+	return nil
+}
+
+func newEventRecord(event ddd.DomainEvent) (*daprclient.EventRecord, error) {
+	bytes, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	eventData := make(map[string]interface{})
+	if err = json.Unmarshal(bytes, &eventData); err != nil {
+		return nil, err
+	}
+	return &daprclient.EventRecord{
+		EventId:      event.GetEventId(),
+		EventData:    eventData,
+		EventType:    event.GetEventType(),
+		EventVersion: event.GetEventVersion(),
+	}, nil
+}
+
+func describeEvent(event ddd.DomainEvent) string {
+	if event == nil {
+		return "<nil>"
+	}
+	data, err := json.Marshal(event.GetData())
+	if err != nil {
+		data = []byte(err.Error())
+	}
+	return fmt.Sprintf("%s %s %s", event.GetEventType(), event.GetEventVersion(), string(data))
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+	"testing"
+	"time"
+)
+
+func TestFixture_ExpectEvents(t *testing.T) {
+	fixture := NewFixture(func() ddd.Aggregate { return &counterAggregate{} })
+	err := fixture.Given(newCounterEvent("counter.CreatedEvent", 0), newCounterEvent("counter.AddedEvent", 2)).
+		When(&AddCommand{TenantId: "tenant-1", AggregateId: "counter-1", Value: 3}).
+		ExpectEvents(newCounterEvent("counter.AddedEvent", 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := fixture.When(&AddCommand{TenantId: "tenant-1", AggregateId: "counter-1", Value: 3})
+	if total := res.GetAggregate().(*counterAggregate).Total; total != 5 {
+		t.Errorf("total = %d, want 5", total)
+	}
+	if err := res.ExpectEvents(newCounterEvent("counter.AddedEvent", 4)); err == nil {
+		t.Error("different events should return error")
+	}
+}
+
+func TestFixture_ExpectError(t *testing.T) {
+	fixture := NewFixture(func() ddd.Aggregate { return &counterAggregate{} })
+	res := fixture.Given(newCounterEvent("counter.CreatedEvent", 0)).
+		When(&AddCommand{TenantId: "tenant-1", AggregateId: "counter-1", Value: -1})
+	if err := res.ExpectError(errValueNegative); err != nil {
+		t.Fatal(err)
+	}
+	if err := res.ExpectEvents(); err == nil {
+		t.Error("ExpectEvents() should return error when command failed")
+	}
+}
+
+var errValueNegative = errors.New("value cannot be negative")
+
+func init() {
+	_ = ddd.RegisterEventType("counter.CreatedEvent", "v1.0", func() interface{} { return &counterEvent{} })
+	_ = ddd.RegisterEventType("counter.AddedEvent", "v1.0", func() interface{} { return &counterEvent{} })
+}
+
+type counterAggregate struct {
+	Id       string `json:"id"`
+	TenantId string `json:"tenantId"`
+	Total    int    `json:"total"`
+}
+
+func (a *counterAggregate) GetTenantId() string         { return a.TenantId }
+func (a *counterAggregate) GetAggregateId() string      { return a.Id }
+func (a *counterAggregate) GetAggregateType() string    { return "test.counterAggregate" }
+func (a *counterAggregate) GetAggregateVersion() string { return "v1.0" }
+
+func (a *counterAggregate) AddCommand(ctx context.Context, cmd *AddCommand, metadata *map[string]string) error {
+	if cmd.Value < 0 {
+		return errValueNegative
+	}
+	_, err := ddd.ApplyEvent(ctx, a, newCounterEvent("counter.AddedEvent", cmd.Value))
+	return err
+}
+
+func (a *counterAggregate) OnCreatedEventV1s0(ctx context.Context, event *counterEvent) error {
+	a.Id = event.AggregateId
+	a.TenantId = event.TenantId
+	return nil
+}
+
+func (a *counterAggregate) OnAddedEventV1s0(ctx context.Context, event *counterEvent) error {
+	a.Total += event.Data.Value
+	return nil
+}
+
+type AddCommand struct {
+	TenantId    string
+	AggregateId string
+	Value       int
+}
+
+func (c *AddCommand) GetCommandId() string            { return uuid.New().String() }
+func (c *AddCommand) GetTenantId() string             { return c.TenantId }
+func (c *AddCommand) GetAggregateId() ddd.AggregateId { return ddd.NewAggregateId(c.AggregateId) }
+func (c *AddCommand) GetIsValidOnly() bool            { return false }
+func (c *AddCommand) Validate() error                 { return nil }
+
+type counterData struct {
+	Value int `json:"value"`
+}
+
+type counterEvent struct {
+	TenantId    string      `json:"tenantId"`
+	CommandId   string      `json:"commandId"`
+	EventId     string      `json:"eventId"`
+	EventType   string      `json:"eventType"`
+	AggregateId string      `json:"aggregateId"`
+	CreatedTime time.Time   `json:"createdTime"`
+	Data        counterData `json:"data"`
+}
+
+func newCounterEvent(eventType string, value int) *counterEvent {
+	return &counterEvent{
+		TenantId:    "tenant-1",
+		CommandId:   uuid.New().String(),
+		EventId:     uuid.New().String(),
+		EventType:   eventType,
+		AggregateId: "counter-1",
+		CreatedTime: time.Now(),
+		Data:        counterData{Value: value},
+	}
+}
+
+func (e *counterEvent) GetTenantId() string       { return e.TenantId }
+func (e *counterEvent) GetCommandId() string      { return e.CommandId }
+func (e *counterEvent) GetEventId() string        { return e.EventId }
+func (e *counterEvent) GetEventType() string      { return e.EventType }
+func (e *counterEvent) GetEventVersion() string   { return "v1.0" }
+func (e *counterEvent) GetAggregateId() string    { return e.AggregateId }
+func (e *counterEvent) GetCreatedTime() time.Time { return e.CreatedTime }
+func (e *counterEvent) GetData() interface{}      { return e.Data }
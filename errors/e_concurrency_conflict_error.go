@@ -0,0 +1,30 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+)
+
+type ConcurrencyConflictError struct {
+	AggregateId            string
+	ExpectedSequenceNumber uint64
+	ActualSequenceNumber   uint64
+}
+
+func NewConcurrencyConflictError(aggregateId string, expectedSequenceNumber, actualSequenceNumber uint64) *ConcurrencyConflictError {
+	return &ConcurrencyConflictError{
+		AggregateId:            aggregateId,
+		ExpectedSequenceNumber: expectedSequenceNumber,
+		ActualSequenceNumber:   actualSequenceNumber,
+	}
+}
+
+func (e *ConcurrencyConflictError) Error() string {
+	return fmt.Sprintf("aggregate root id %s concurrency conflict, expected sequence number %d, actual sequence number %d.", e.AggregateId, e.ExpectedSequenceNumber, e.ActualSequenceNumber)
+}
+
+// IsErrorConcurrencyConflict 是否是并发冲突错误，支持 fmt.Errorf("%w") 包装的错误
+func IsErrorConcurrencyConflict(err error) bool {
+	var conflictError *ConcurrencyConflictError
+	return errors.As(err, &conflictError)
+}
@@ -0,0 +1,20 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIsErrorConcurrencyConflict(t *testing.T) {
+	err := NewConcurrencyConflictError("agg-1", 1, 2)
+	if !IsErrorConcurrencyConflict(err) {
+		t.Error("IsErrorConcurrencyConflict(err) = false")
+	}
+	if !IsErrorConcurrencyConflict(fmt.Errorf("apply event: %w", err)) {
+		t.Error("IsErrorConcurrencyConflict(wrapped) = false")
+	}
+	if IsErrorConcurrencyConflict(errors.New("other")) || IsErrorConcurrencyConflict(nil) {
+		t.Error("IsErrorConcurrencyConflict(other) = true")
+	}
+}
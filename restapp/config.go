@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -17,11 +18,16 @@ type Config struct {
 }
 
 type EnvConfig struct {
-	App   AppConfig               `yaml:"app"`
-	Log   LogConfig               `yaml:"log"`
-	Dapr  DaprConfig              `yaml:"dapr"`
-	Mongo map[string]*MongoConfig `yaml:"mongo"`
-	Neo4j map[string]*Neo4jConfig `json:"neo4j"`
+	App      AppConfig               `yaml:"app"`
+	Log      LogConfig               `yaml:"log"`
+	Dapr     DaprConfig              `yaml:"dapr"`
+	Mongo    map[string]*MongoConfig `yaml:"mongo"`
+	Neo4j    map[string]*Neo4jConfig `json:"neo4j"`
+	Snapshot SnapshotConfig          `yaml:"snapshot"`
+	Cache    AggregateCacheConfig    `yaml:"aggregateCache"`
+	Retry    SubscribeRetryConfig    `yaml:"subscribeRetry"`
+	Admin    AdminConfig             `yaml:"admin"`
+	Saga     SagaConfig              `yaml:"saga"`
 }
 
 func (e *EnvConfig) Init() error {
@@ -38,6 +44,13 @@ func (e *EnvConfig) Init() error {
 		e.Log.level = l
 	}
 
+	if e.Snapshot.Mode == "" {
+		e.Snapshot.Mode = SnapshotModeActor
+	}
+	if e.Snapshot.Mode != SnapshotModeActor && e.Snapshot.Mode != SnapshotModeLocal {
+		return errors.New(fmt.Sprintf("config snapshot.mode \"%s\" is error. choose one of: [actor, local]", e.Snapshot.Mode))
+	}
+
 	if e.Dapr.Host == nil {
 		var value = "localhost"
 		e.Dapr.Host = e.GetEnvString("DAPR_HOST", &value)
@@ -111,6 +124,52 @@ func (d DaprConfig) GetGrpcPort() int64 {
 	return *d.GrpcPort
 }
 
+const (
+	SnapshotModeActor = "actor" // 通过 dapr actor 生成快照
+	SnapshotModeLocal = "local" // 在服务进程内生成快照，不依赖 dapr actor
+)
+
+type SnapshotConfig struct {
+	Mode      string `yaml:"mode"`      // actor 或 local，默认为 actor
+	Workers   int    `yaml:"workers"`   // local 模式的工作协程数量
+	QueueSize int    `yaml:"queueSize"` // local 模式的等待队列长度
+}
+
+func (s SnapshotConfig) IsLocal() bool {
+	return s.Mode == SnapshotModeLocal
+}
+
+type AggregateCacheConfig struct {
+	Enable bool          `yaml:"enable"` // 是否启用聚合根缓存，默认不启用
+	Size   int           `yaml:"size"`   // 最多缓存的聚合数量
+	TTL    time.Duration `yaml:"ttl"`    // 缓存有效期，如 10m，0表示不过期
+}
+
+type SubscribeRetryConfig struct {
+	MaxAttempts     int           `yaml:"maxAttempts"`     // 查询事件处理器最大执行次数(包含首次执行)，小于等于1时不重试
+	InitialInterval time.Duration `yaml:"initialInterval"` // 首次重试间隔，如 500ms
+	MaxInterval     time.Duration `yaml:"maxInterval"`     // 最大重试间隔，如 10s
+	Multiplier      float64       `yaml:"multiplier"`      // 间隔增长倍数，默认2
+}
+
+//
+// AdminConfig
+// @Description: 管理接口配置，如事件重放、死信重放与丢弃。管理接口会修改读模型或丢弃消息，默认不注册
+//
+type AdminConfig struct {
+	Enable bool   `yaml:"enable"` // 是否注册管理接口，默认不注册
+	Token  string `yaml:"token"`  // 访问令牌，设置后请求头 Authorization 须为 "Bearer <token>"
+}
+
+//
+// SagaConfig
+// @Description: Saga 配置。注册了 Saga 管理器时自动注册 Saga 超时 actor，
+// Saga 管理器在服务启动之后才注册时需要设置 Enable
+//
+type SagaConfig struct {
+	Enable bool `yaml:"enable"` // 是否注册 Saga 超时 actor
+}
+
 type LogConfig struct {
 	Level string `yaml:"level"`
 	level applog.Level
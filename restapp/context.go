@@ -17,7 +17,11 @@ func NewContext(irisCtx iris.Context) context.Context {
 		metadata[k] = v[0]
 	}
 	serverCtx := newServerContext(irisCtx)
-	return ddd_context.NewContext(context.Background(), metadata, serverCtx)
+	ctx := ddd_context.NewContext(context.Background(), metadata, serverCtx)
+	if correlationId := header.Get(ddd_context.HeaderCorrelationId); correlationId != "" {
+		ctx = ddd_context.NewCorrelationContext(ctx, correlationId, "")
+	}
+	return ctx
 }
 
 func newServerContext(ctx iris.Context) ddd_context.ServerContext {
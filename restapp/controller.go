@@ -1 +1,38 @@
 package restapp
+
+import (
+	"context"
+	"github.com/kataras/iris/v12"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+)
+
+//
+// DoAggregateHistory
+// @Description: 查询聚合根的变更历史并输出 JSON，聚合根不存在时返回404，可在控制器中直接使用：
+//
+//	func (c *UserCommandController) GetHistory(ctx iris.Context) {
+//		_, _, _ = restapp.DoAggregateHistory(ctx, ctx.Params().Get("tenantId"), model.AggregateType, ctx.Params().Get("id"))
+//	}
+//
+// @param ctx 上下文
+// @param tenantId 租户id
+// @param aggregateType 聚合类型，需要通过 ddd.RegisterAggregateType 注册
+// @param aggregateId 聚合根id
+// @param opts 选项
+// @return *ddd.AggregateHistory 变更历史
+// @return bool 是否找到
+// @return error 错误
+//
+func DoAggregateHistory(ctx iris.Context, tenantId, aggregateType, aggregateId string, opts ...*ddd.AggregateHistoryOptions) (*ddd.AggregateHistory, bool, error) {
+	data, isFound, err := DoQueryOne(ctx, func(c context.Context) (interface{}, bool, error) {
+		history, isFound, err := ddd.GetAggregateHistory(c, tenantId, aggregateType, aggregateId, opts...)
+		if err != nil || !isFound {
+			return nil, isFound, err
+		}
+		return history, true, nil
+	})
+	if err != nil || !isFound {
+		return nil, false, err
+	}
+	return data.(*ddd.AggregateHistory), true, nil
+}
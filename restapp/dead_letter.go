@@ -0,0 +1,81 @@
+package restapp
+
+import (
+	iriscontext "github.com/kataras/iris/v12/context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+	"net/http"
+)
+
+//
+// deadLettersHandler
+// @Description: 查询死信列表，可按 tenantId、route、eventType 过滤，limit 限制数量
+//
+func (s *service) deadLettersHandler(ctx *iriscontext.Context) {
+	store := ddd.GetDeadLetterStore()
+	if store == nil {
+		_ = SetErrorNotFond(ctx)
+		return
+	}
+	query := &ddd.DeadLetterQuery{
+		TenantId:  ctx.URLParam("tenantId"),
+		Route:     ctx.URLParam("route"),
+		EventType: ctx.URLParam("eventType"),
+		Limit:     ctx.URLParamIntDefault("limit", 0),
+	}
+	list, err := store.FindList(ctx, query)
+	if err != nil {
+		ctx.StatusCode(http.StatusInternalServerError)
+		_, _ = ctx.WriteString(err.Error())
+		return
+	}
+	_, _ = ctx.JSON(list)
+}
+
+//
+// deadLetterHandler
+// @Description: 查看死信，包含原始事件记录、错误与执行次数
+//
+func (s *service) deadLetterHandler(ctx *iriscontext.Context) {
+	store := ddd.GetDeadLetterStore()
+	if store == nil {
+		_ = SetErrorNotFond(ctx)
+		return
+	}
+	letter, ok, err := store.FindById(ctx, ctx.Params().Get("id"))
+	if err != nil {
+		ctx.StatusCode(http.StatusInternalServerError)
+		_, _ = ctx.WriteString(err.Error())
+		return
+	}
+	if !ok {
+		_ = SetErrorNotFond(ctx)
+		return
+	}
+	_, _ = ctx.JSON(letter)
+}
+
+//
+// replayDeadLetterHandler
+// @Description: 重新处理死信，成功后删除死信
+//
+func (s *service) replayDeadLetterHandler(ctx *iriscontext.Context) {
+	if err := ddd.ReplayDeadLetter(ctx, ctx.Params().Get("id")); err != nil {
+		ctx.StatusCode(http.StatusInternalServerError)
+		_, _ = ctx.WriteString(err.Error())
+		return
+	}
+	ctx.StatusCode(http.StatusOK)
+}
+
+//
+// discardDeadLetterHandler
+// @Description: 丢弃死信
+//
+func (s *service) discardDeadLetterHandler(ctx *iriscontext.Context) {
+	if err := ddd.DiscardDeadLetter(ctx, ctx.Params().Get("id")); err != nil {
+		ctx.StatusCode(http.StatusInternalServerError)
+		_, _ = ctx.WriteString(err.Error())
+		return
+	}
+	ctx.StatusCode(http.StatusOK)
+}
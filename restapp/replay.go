@@ -0,0 +1,206 @@
+package restapp
+
+import (
+	"context"
+	"fmt"
+	iriscontext "github.com/kataras/iris/v12/context"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
+	"github.com/liuxd6825/dapr-go-ddd-sdk/errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+//
+// ReplayEventsRequest
+// @Description: 事件重放请求，用于重建查询端读模型
+//
+type ReplayEventsRequest struct {
+	Handler         string     `json:"handler"` // 查询事件处理器结构名称，如 UserQueryHandler
+	TenantId        string     `json:"tenantId"`
+	AggregateType   string     `json:"aggregateType"`
+	FromTime        *time.Time `json:"fromTime"`
+	ToTime          *time.Time `json:"toTime"`
+	PageSize        uint64     `json:"pageSize"`
+	Truncate        bool       `json:"truncate"` // 重放前清空读模型
+	Resume          bool       `json:"resume"`   // 从上次失败的进度继续
+	EventStorageKey string     `json:"eventStorageKey"`
+}
+
+type replayState struct {
+	progress  *ddd.ReplayProgress
+	isRunning bool
+}
+
+//
+// replayManager
+// @Description: 管理事件重放任务及其进度
+//
+type replayManager struct {
+	mu     sync.Mutex
+	states map[string]*replayState
+}
+
+func newReplayManager() *replayManager {
+	return &replayManager{states: make(map[string]*replayState)}
+}
+
+func (m *replayManager) getKey(handler, tenantId, aggregateType string) string {
+	return fmt.Sprintf("%s/%s/%s", handler, tenantId, aggregateType)
+}
+
+func (m *replayManager) getProgress(key string) (*ddd.ReplayProgress, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.states[key]
+	if !ok || state.progress == nil {
+		return nil, false
+	}
+	progress := *state.progress
+	return &progress, true
+}
+
+//
+// start
+// @Description: 启动重放任务，同一处理器、租户与聚合类型同时只能有一个任务
+// @return *ddd.ReplayProgress 当前进度
+// @return error
+//
+func (m *replayManager) start(req *ReplayEventsRequest, handler ddd.QueryEventHandler) (*ddd.ReplayProgress, error) {
+	key := m.getKey(req.Handler, req.TenantId, req.AggregateType)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.states[key]
+	if ok && state.isRunning {
+		return nil, errors.ErrorOf("replay %s is running", key)
+	}
+	if !ok {
+		state = &replayState{}
+		m.states[key] = state
+	}
+
+	opts := ddd.NewReplayEventsOptions().
+		SetEventStorageKey(req.EventStorageKey).
+		SetPageSize(req.PageSize).
+		SetTruncate(req.Truncate).
+		SetOnProgress(func(progress *ddd.ReplayProgress) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			p := *progress
+			state.progress = &p
+		})
+	if req.FromTime != nil {
+		opts.SetFromTime(*req.FromTime)
+	}
+	if req.ToTime != nil {
+		opts.SetToTime(*req.ToTime)
+	}
+
+	previous := state.progress
+	state.isRunning = true
+	state.progress = &ddd.ReplayProgress{
+		TenantId:      req.TenantId,
+		AggregateType: req.AggregateType,
+		FromTime:      req.FromTime,
+		ToTime:        req.ToTime,
+	}
+	if req.Resume && previous != nil && !previous.IsCompleted {
+		opts.SetResume(previous)
+		state.progress.ProcessedRows = previous.ProcessedRows
+		state.progress.LastEventId = previous.LastEventId
+	}
+	progress := *state.progress
+
+	go func() {
+		defer func() {
+			if e := errors.GetRecoverError(recover()); e != nil {
+				m.mu.Lock()
+				state.progress.Error = e.Error()
+				m.mu.Unlock()
+			}
+			m.mu.Lock()
+			state.isRunning = false
+			m.mu.Unlock()
+		}()
+		if _, err := ddd.ReplayEvents(context.Background(), req.TenantId, req.AggregateType, handler, opts); err != nil {
+			m.mu.Lock()
+			state.progress.Error = err.Error()
+			m.mu.Unlock()
+		}
+	}()
+	return &progress, nil
+}
+
+//
+// findQueryEventHandler
+// @Description: 按结构名称查找已注册的查询事件处理器
+// @param name 结构名称
+// @return ddd.QueryEventHandler
+// @return bool
+//
+func (s *service) findQueryEventHandler(name string) (ddd.QueryEventHandler, bool) {
+	for _, subscribe := range s.subscribes {
+		if subscribe == nil || subscribe.GetHandler() == nil {
+			continue
+		}
+		handler := subscribe.GetHandler()
+		t := reflect.TypeOf(handler)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Name() == name {
+			return handler, true
+		}
+	}
+	return nil, false
+}
+
+//
+// replayEventsHandler
+// @Description: 启动事件重放，异步执行，返回当前进度
+//
+func (s *service) replayEventsHandler(ctx *iriscontext.Context) {
+	req := &ReplayEventsRequest{}
+	if err := ctx.ReadJSON(req); err != nil {
+		ctx.StatusCode(http.StatusBadRequest)
+		_, _ = ctx.WriteString(err.Error())
+		return
+	}
+	if len(req.Handler) == 0 || len(req.TenantId) == 0 || len(req.AggregateType) == 0 {
+		ctx.StatusCode(http.StatusBadRequest)
+		_, _ = ctx.WriteString("handler, tenantId and aggregateType cannot be empty")
+		return
+	}
+	handler, ok := s.findQueryEventHandler(req.Handler)
+	if !ok {
+		_ = SetErrorNotFond(ctx)
+		return
+	}
+	progress, err := s.replays.start(req, handler)
+	if err != nil {
+		ctx.StatusCode(http.StatusConflict)
+		_, _ = ctx.WriteString(err.Error())
+		return
+	}
+	ctx.StatusCode(http.StatusAccepted)
+	_, _ = ctx.JSON(progress)
+}
+
+//
+// replayProgressHandler
+// @Description: 获取事件重放进度
+//
+func (s *service) replayProgressHandler(ctx *iriscontext.Context) {
+	handler := ctx.URLParam("handler")
+	tenantId := ctx.URLParam("tenantId")
+	aggregateType := ctx.URLParam("aggregateType")
+	progress, ok := s.replays.getProgress(s.replays.getKey(handler, tenantId, aggregateType))
+	if !ok {
+		_ = SetErrorNotFond(ctx)
+		return
+	}
+	_, _ = ctx.JSON(progress)
+}
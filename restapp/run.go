@@ -8,6 +8,7 @@ import (
 	"github.com/liuxd6825/dapr-go-ddd-sdk/ddd"
 	"github.com/liuxd6825/go-sdk/actor"
 	"github.com/liuxd6825/go-sdk/service/common"
+	log "github.com/sirupsen/logrus"
 )
 
 type StartOptions struct {
@@ -16,6 +17,9 @@ type StartOptions struct {
 	HttpPort   int
 	LogLevel   applog.Level
 	DaprClient daprclient.DaprDddClient
+	AdminApi   bool   // 是否注册管理接口
+	AdminToken string // 管理接口访问令牌
+	SagaActor  bool   // 是否注册 Saga 超时 actor，注册了 Saga 管理器时自动注册
 }
 
 type RegisterSubscribe interface {
@@ -76,6 +80,10 @@ func aggregateSnapshotActorFactory() actor.Server {
 	return ddd.NewAggregateSnapshotActorService(client)
 }
 
+func sagaActorFactory() actor.Server {
+	return ddd.NewSagaActorService()
+}
+
 func RunWithConfig(envType string, configFile string, subsFunc func() []RegisterSubscribe,
 	controllersFunc func() []Controller, eventsFunc func() []RegisterEventType, actorsFunc func() []actor.Factory) (common.Service, error) {
 	config, err := NewConfigByFile(configFile)
@@ -113,12 +121,39 @@ func RubWithEnvConfig(config *EnvConfig, subsFunc func() []RegisterSubscribe,
 
 	daprclient.SetDaprDddClient(daprClient)
 
+	if config.Snapshot.IsLocal() {
+		ddd.SetSnapshotter(ddd.NewLocalSnapshotter(&ddd.LocalSnapshotterOptions{
+			Workers:   config.Snapshot.Workers,
+			QueueSize: config.Snapshot.QueueSize,
+		}))
+	}
+
+	if config.Cache.Enable && !daprclient.GrpcSupportsSequenceNumber() {
+		log.Warnln("aggregateCache is disabled: dapr grpc proto has no event sequence number")
+	} else if config.Cache.Enable {
+		ddd.SetAggregateCache(ddd.NewAggregateCache(&ddd.AggregateCacheOptions{
+			Size: config.Cache.Size,
+			TTL:  config.Cache.TTL,
+		}))
+	}
+
+	if config.Retry.MaxAttempts > 1 {
+		policy := ddd.NewRetryPolicy(config.Retry.MaxAttempts, config.Retry.InitialInterval, config.Retry.MaxInterval)
+		if config.Retry.Multiplier > 0 {
+			policy.Multiplier = config.Retry.Multiplier
+		}
+		ddd.SetSubscribeRetryPolicy(policy)
+	}
+
 	options := &StartOptions{
 		AppId:      config.App.AppId,
 		HttpHost:   config.App.HttpHost,
 		HttpPort:   config.App.HttpPort,
 		LogLevel:   config.Log.GetLevel(),
 		DaprClient: daprClient,
+		AdminApi:   config.Admin.Enable,
+		AdminToken: config.Admin.Token,
+		SagaActor:  config.Saga.Enable,
 	}
 
 	//创建dapr事件存储器
@@ -155,17 +190,27 @@ func Run(options *StartOptions, webRootPath string, subsFunc func() []RegisterSu
 	ddd.Init(options.AppId)
 	applog.Init(options.DaprClient, options.AppId, options.LogLevel)
 
+	eventTypes := eventTypesFunc()
+	subscribes := subsFunc()
+	controllers := controllersFunc()
+	// Saga 管理器可能在以上方法中注册，之后再判断是否需要 Saga 超时 actor
+	actorFactories := actorsFunc()
+	if options.SagaActor || ddd.HasSagaManagers() {
+		actorFactories = append(actorFactories, sagaActorFactory)
+	}
+
 	serverOptions := &ServiceOptions{
 		AppId:          options.AppId,
 		HttpHost:       options.HttpHost,
 		HttpPort:       options.HttpPort,
 		LogLevel:       options.LogLevel,
-		EventTypes:     eventTypesFunc(),
+		EventTypes:     eventTypes,
 		EventStorages:  eventStorages,
-		Subscribes:     subsFunc(),
-		Controllers:    controllersFunc(),
-		ActorFactories: actorsFunc(),
-		AuthToken:      "",
+		Subscribes:     subscribes,
+		Controllers:    controllers,
+		ActorFactories: actorFactories,
+		AuthToken:      options.AdminToken,
+		AdminApi:       options.AdminApi,
 		WebRootPath:    webRootPath,
 	}
 	service := NewService(options.DaprClient, serverOptions)
@@ -1,6 +1,7 @@
 package restapp
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"github.com/iris-contrib/swagger/v12"
 	"github.com/iris-contrib/swagger/v12/swaggerFiles"
@@ -29,7 +30,8 @@ type ServiceOptions struct {
 	Subscribes     []RegisterSubscribe
 	Controllers    []Controller
 	EventTypes     []RegisterEventType
-	AuthToken      string
+	AuthToken      string // 管理接口访问令牌
+	AdminApi       bool   // 是否注册管理接口，默认不注册
 	WebRootPath    string
 	SwaggerDoc     string
 }
@@ -46,7 +48,9 @@ type service struct {
 	controllers    []Controller
 	eventTypes     []RegisterEventType
 	authToken      string
+	adminApi       bool
 	webRootPath    string
+	replays        *replayManager
 }
 
 func (s *service) AddServiceInvocationHandler(name string, fn common.ServiceInvocationHandler) error {
@@ -93,7 +97,9 @@ func NewService(daprDddClient daprclient.DaprDddClient, opts *ServiceOptions) co
 		controllers:    opts.Controllers,
 		eventTypes:     opts.EventTypes,
 		authToken:      opts.AuthToken,
+		adminApi:       opts.AdminApi,
 		webRootPath:    opts.WebRootPath,
+		replays:        newReplayManager(),
 		app:            iris.New(),
 	}
 }
@@ -106,6 +112,21 @@ func (s *service) Start() error {
 
 	// register domain event types
 	app.Get("dapr/event-types", s.eventTypesHandler)
+	app.Get("dapr/event-types/compatibility", s.eventTypeCompatibilityHandler)
+
+	// register query event replay handler, only when admin api is enabled
+	if s.adminApi {
+		app.Post("/dapr/replay-events", s.adminAuthHandler, s.replayEventsHandler)
+		app.Get("/dapr/replay-events", s.adminAuthHandler, s.replayProgressHandler)
+	}
+
+	// register dead letter handler, only when admin api is enabled
+	if s.adminApi {
+		app.Get("/dapr/dead-letters", s.adminAuthHandler, s.deadLettersHandler)
+		app.Get("/dapr/dead-letters/{id}", s.adminAuthHandler, s.deadLetterHandler)
+		app.Post("/dapr/dead-letters/{id}/replay", s.adminAuthHandler, s.replayDeadLetterHandler)
+		app.Delete("/dapr/dead-letters/{id}", s.adminAuthHandler, s.discardDeadLetterHandler)
+	}
 
 	//	register health check handler
 	app.Get("/healthz", s.healthHandler)
@@ -255,14 +276,71 @@ func (s *service) subscribesHandler(ctx *context.Context) {
 	_, _ = ctx.JSON(data)
 }
 
+// register domain event types handler，返回已注册的事件类型、版本及 JSON Schema
 func (s *service) eventTypesHandler(ctx *context.Context) {
+	eventType := ctx.URLParam("eventType")
+	data := make([]*ddd.EventTypeSchema, 0)
+	for _, item := range ddd.GetEventTypeSchemas() {
+		if eventType == "" || item.EventType == eventType {
+			data = append(data, item)
+		}
+	}
+	_, _ = ctx.JSON(data)
+}
 
+//
+// eventTypeCompatibilityHandler
+// @Description: 检查事件两个版本的兼容性，指定 tenantId 与 aggregateType 时抽样解析已存储的事件记录
+//
+func (s *service) eventTypeCompatibilityHandler(ctx *context.Context) {
+	eventType := ctx.URLParam("eventType")
+	fromVersion := ctx.URLParam("fromVersion")
+	if len(eventType) == 0 || len(fromVersion) == 0 {
+		ctx.StatusCode(http.StatusBadRequest)
+		_, _ = ctx.WriteString("eventType and fromVersion cannot be empty")
+		return
+	}
+	report, err := ddd.CheckEventSchemaCompatibility(eventType, fromVersion, ctx.URLParam("toVersion"))
+	if err != nil {
+		ctx.StatusCode(http.StatusBadRequest)
+		_, _ = ctx.WriteString(err.Error())
+		return
+	}
+	if tenantId := ctx.URLParam("tenantId"); len(tenantId) > 0 {
+		opts := &ddd.CheckEventRecordsOptions{
+			TenantId:        tenantId,
+			AggregateType:   ctx.URLParam("aggregateType"),
+			SampleSize:      ctx.URLParamUint64("sampleSize"),
+			EventStorageKey: ctx.URLParam("eventStorageKey"),
+		}
+		if err = ddd.CheckEventRecordsCompatibility(ctx, report, opts); err != nil {
+			ctx.StatusCode(http.StatusInternalServerError)
+			_, _ = ctx.WriteString(err.Error())
+			return
+		}
+	}
+	_, _ = ctx.JSON(report)
 }
 
 func (s *service) healthHandler(context *context.Context) {
 	context.StatusCode(http.StatusOK)
 }
 
+//
+// adminAuthHandler
+// @Description: 管理接口鉴权，设置了访问令牌时请求头 Authorization 须为 "Bearer <token>"
+//
+func (s *service) adminAuthHandler(ctx *context.Context) {
+	if len(s.authToken) > 0 {
+		token := ctx.GetHeader("Authorization")
+		if subtle.ConstantTimeCompare([]byte(token), []byte("Bearer "+s.authToken)) != 1 {
+			ctx.StatusCode(http.StatusUnauthorized)
+			return
+		}
+	}
+	ctx.Next()
+}
+
 // register actor config handler
 func (s *service) actorConfigHandler(ctx *context.Context) {
 	data, err := runtime.GetActorRuntimeInstance().GetJSONSerializedConfig()
@@ -308,8 +386,14 @@ func (s *service) registerSubscribeHandler(subscribes *[]ddd.Subscribe, queryEve
 			}
 		}()
 		s.app.Handle("POST", subscribe.Route, func(c *context.Context) {
-			if err = sh.CallQueryEventHandler(c, c); err != nil {
-				c.SetErr(err)
+			var callErr error
+			if h, ok := sh.(ddd.SubscribeRetryHandler); ok {
+				callErr = h.CallSubscribeEventHandler(c, &subscribe, c)
+			} else {
+				callErr = sh.CallQueryEventHandler(c, c)
+			}
+			if callErr != nil {
+				c.SetErr(callErr)
 			}
 		})
 		return err
@@ -0,0 +1,392 @@
+package rsql
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// FilterBuilder
+// @Description: 类型化的 RSQL 过滤条件构建器，多个条件之间为 and 关系，Or() 添加 or 分组。
+// 生成的过滤条件可以被 Parse() 解析，字符串值会加引号并转义。
+// 条件名称或值不合法时记录第一个错误，由 Build() 返回。
+//
+type FilterBuilder struct {
+	items []Expression
+	err   error
+}
+
+func NewFilterBuilder() *FilterBuilder {
+	return &FilterBuilder{}
+}
+
+// Eq 等于，name==value
+func (b *FilterBuilder) Eq(name string, value interface{}) *FilterBuilder {
+	return b.addComparison(name, value, func(c Comparison) Expression { return EqualsComparison{c} })
+}
+
+// Ne 不等于，name!=value
+func (b *FilterBuilder) Ne(name string, value interface{}) *FilterBuilder {
+	return b.addComparison(name, value, func(c Comparison) Expression { return NotEqualsComparison{c} })
+}
+
+// Like 正则匹配，name==~pattern
+func (b *FilterBuilder) Like(name string, pattern string) *FilterBuilder {
+	return b.addComparison(name, pattern, func(c Comparison) Expression { return LikeComparison{c} })
+}
+
+// In 等于其中一个值，name=in=(v1,v2)，values 不能为空
+func (b *FilterBuilder) In(name string, values ...interface{}) *FilterBuilder {
+	if len(values) == 0 {
+		return b.setError(fmt.Errorf("rsql filter %s: in requires at least one value", name))
+	}
+	return b.addComparison(name, values, func(c Comparison) Expression { return InComparison{c} })
+}
+
+// Gt 大于，name>value
+func (b *FilterBuilder) Gt(name string, value interface{}) *FilterBuilder {
+	return b.addComparison(name, value, func(c Comparison) Expression { return GreaterThanComparison{c} })
+}
+
+// Ge 大于等于，name>=value
+func (b *FilterBuilder) Ge(name string, value interface{}) *FilterBuilder {
+	return b.addComparison(name, value, func(c Comparison) Expression { return GreaterThanOrEqualsComparison{c} })
+}
+
+// Lt 小于，name<value
+func (b *FilterBuilder) Lt(name string, value interface{}) *FilterBuilder {
+	return b.addComparison(name, value, func(c Comparison) Expression { return LessThanComparison{c} })
+}
+
+// Le 小于等于，name<=value
+func (b *FilterBuilder) Le(name string, value interface{}) *FilterBuilder {
+	return b.addComparison(name, value, func(c Comparison) Expression { return LessThanOrEqualsComparison{c} })
+}
+
+//
+// Range
+// @Description: 范围条件，包含边界，name>=from and name<=to。from 或 to 为 nil 时不限制该边界。
+//
+func (b *FilterBuilder) Range(name string, from, to interface{}) *FilterBuilder {
+	if from != nil {
+		b.Ge(name, from)
+	}
+	if to != nil {
+		b.Le(name, to)
+	}
+	return b
+}
+
+//
+// Or
+// @Description: 添加 or 分组，(group1) or (group2)，nil 或空的分组被忽略
+//
+func (b *FilterBuilder) Or(groups ...*FilterBuilder) *FilterBuilder {
+	var items []Expression
+	for _, group := range groups {
+		if expr := b.mergeGroup(group); expr != nil {
+			items = append(items, expr)
+		}
+	}
+	switch len(items) {
+	case 0:
+	case 1:
+		b.items = append(b.items, items[0])
+	default:
+		b.items = append(b.items, OrExpression{Items: items})
+	}
+	return b
+}
+
+//
+// And
+// @Description: 以 and 关系添加其它构建器的条件，nil 或空的构建器被忽略
+//
+func (b *FilterBuilder) And(groups ...*FilterBuilder) *FilterBuilder {
+	for _, group := range groups {
+		if expr := b.mergeGroup(group); expr != nil {
+			b.items = append(b.items, expr)
+		}
+	}
+	return b
+}
+
+func (b *FilterBuilder) IsEmpty() bool {
+	return len(b.items) == 0
+}
+
+//
+// Expression
+// @Description: 获取条件表达式，没有条件时返回 nil
+//
+func (b *FilterBuilder) Expression() Expression {
+	switch len(b.items) {
+	case 0:
+		return nil
+	case 1:
+		return b.items[0]
+	}
+	return AndExpression{Items: append([]Expression{}, b.items...)}
+}
+
+//
+// Build
+// @Description: 生成 RSQL 过滤条件，没有条件时返回空字符串
+// @return string 过滤条件
+// @return error 条件名称或值不合法时的错误
+//
+func (b *FilterBuilder) Build() (string, error) {
+	if b.err != nil {
+		return "", b.err
+	}
+	expr := b.Expression()
+	if expr == nil {
+		return "", nil
+	}
+	return Format(expr)
+}
+
+// String 生成 RSQL 过滤条件，有错误时返回空字符串
+func (b *FilterBuilder) String() string {
+	filter, _ := b.Build()
+	return filter
+}
+
+func (b *FilterBuilder) mergeGroup(group *FilterBuilder) Expression {
+	if group == nil {
+		return nil
+	}
+	if group.err != nil {
+		b.setError(group.err)
+	}
+	return group.Expression()
+}
+
+func (b *FilterBuilder) addComparison(name string, value interface{}, newExpr func(c Comparison) Expression) *FilterBuilder {
+	if err := checkIdentifier(name); err != nil {
+		return b.setError(err)
+	}
+	v, err := NewValue(value)
+	if err != nil {
+		return b.setError(fmt.Errorf("rsql filter %s: %s", name, err.Error()))
+	}
+	b.items = append(b.items, newExpr(Comparison{Identifier: Identifier{Val: name}, Val: v}))
+	return b
+}
+
+func (b *FilterBuilder) setError(err error) *FilterBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+//
+// NewValue
+// @Description: 将 Go 值转换为 RSQL 值。支持字符串、整数、浮点数、布尔、time.Time、fmt.Stringer 及其指针和切片，
+// time.Time 转换为 UTC 的 DateTimeValue，如 2022-01-02T03:04:05Z。词法分析的日期时间不支持小数秒，因此精确到秒，小数秒被截断。
+//
+func NewValue(value interface{}) (Value, error) {
+	switch v := value.(type) {
+	case Value:
+		return v, nil
+	case string:
+		return StringValue{Value: v}, nil
+	case bool:
+		return BooleanValue{Value: v}, nil
+	case time.Time:
+		return newDateTimeValue(v), nil
+	case *time.Time:
+		if v == nil {
+			return nil, fmt.Errorf("nil value")
+		}
+		return newDateTimeValue(*v), nil
+	case fmt.Stringer:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil, fmt.Errorf("nil value")
+		}
+		return StringValue{Value: v.String()}, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil, fmt.Errorf("nil value")
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, fmt.Errorf("nil value")
+		}
+		return NewValue(rv.Elem().Interface())
+	case reflect.String:
+		return StringValue{Value: rv.String()}, nil
+	case reflect.Bool:
+		return BooleanValue{Value: rv.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return IntegerValue{Value: rv.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("value %d out of range", rv.Uint())
+		}
+		return IntegerValue{Value: int64(rv.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return DoubleValue{Value: rv.Float()}, nil
+	case reflect.Slice, reflect.Array:
+		list := ListValue{Value: make([]Value, 0, rv.Len())}
+		for i := 0; i < rv.Len(); i++ {
+			item, err := NewValue(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			list.Value = append(list.Value, item)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", value)
+}
+
+func newDateTimeValue(t time.Time) DateTimeValue {
+	return DateTimeValue{Value: t.UTC().Format(time.RFC3339)}
+}
+
+//
+// Format
+// @Description: 将条件表达式格式化为 RSQL 过滤条件，与 Parse() 互逆
+//
+func Format(expr Expression) (string, error) {
+	switch ex := expr.(type) {
+	case AndExpression:
+		return formatItems(ex.Items, " and ", func(item Expression) bool {
+			_, ok := item.(OrExpression)
+			return ok
+		})
+	case OrExpression:
+		return formatItems(ex.Items, " or ", func(item Expression) bool { return false })
+	case EqualsComparison:
+		return formatComparison(ex.Comparison, "==")
+	case NotEqualsComparison:
+		return formatComparison(ex.Comparison, "!=")
+	case LikeComparison:
+		return formatComparison(ex.Comparison, "==~")
+	case NotLikeComparison:
+		return formatComparison(ex.Comparison, "!=~")
+	case GreaterThanComparison:
+		return formatComparison(ex.Comparison, ">")
+	case GreaterThanOrEqualsComparison:
+		return formatComparison(ex.Comparison, ">=")
+	case LessThanComparison:
+		return formatComparison(ex.Comparison, "<")
+	case LessThanOrEqualsComparison:
+		return formatComparison(ex.Comparison, "<=")
+	case InComparison:
+		return formatComparison(ex.Comparison, "=in=")
+	case NotInComparison:
+		return formatComparison(ex.Comparison, "=out=")
+	}
+	return "", fmt.Errorf("rsql format: unsupported expression %T", expr)
+}
+
+func formatItems(items []Expression, separator string, needParen func(item Expression) bool) (string, error) {
+	if len(items) == 0 {
+		return "", fmt.Errorf("rsql format: empty expression")
+	}
+	texts := make([]string, 0, len(items))
+	for _, item := range items {
+		text, err := Format(item)
+		if err != nil {
+			return "", err
+		}
+		if len(items) > 1 && needParen(item) {
+			text = "(" + text + ")"
+		}
+		texts = append(texts, text)
+	}
+	return strings.Join(texts, separator), nil
+}
+
+func formatComparison(c Comparison, operator string) (string, error) {
+	if err := checkIdentifier(c.Identifier.Val); err != nil {
+		return "", err
+	}
+	value, err := formatValue(c.Val)
+	if err != nil {
+		return "", fmt.Errorf("rsql filter %s: %s", c.Identifier.Val, err.Error())
+	}
+	return c.Identifier.Val + operator + value, nil
+}
+
+func formatValue(value Value) (string, error) {
+	switch v := value.(type) {
+	case StringValue:
+		return quoteString(v.Value)
+	case BooleanValue:
+		return strconv.FormatBool(v.Value), nil
+	case IntegerValue:
+		if v.Value < 0 {
+			return "", fmt.Errorf("negative number %d is not supported", v.Value)
+		}
+		return strconv.FormatInt(v.Value, 10), nil
+	case DoubleValue:
+		if v.Value < 0 || math.IsNaN(v.Value) || math.IsInf(v.Value, 0) {
+			return "", fmt.Errorf("number %v is not supported", v.Value)
+		}
+		return strconv.FormatFloat(v.Value, 'f', -1, 64), nil
+	case DateValue:
+		return v.Value, nil
+	case DateTimeValue:
+		return v.Value, nil
+	case ListValue:
+		if len(v.Value) == 0 {
+			return "", fmt.Errorf("empty list")
+		}
+		texts := make([]string, 0, len(v.Value))
+		for _, item := range v.Value {
+			if _, ok := item.(ListValue); ok {
+				return "", fmt.Errorf("nested list is not supported")
+			}
+			text, err := formatValue(item)
+			if err != nil {
+				return "", err
+			}
+			texts = append(texts, text)
+		}
+		return "(" + strings.Join(texts, ",") + ")", nil
+	}
+	return "", fmt.Errorf("unsupported value %T", value)
+}
+
+//
+// quoteString
+// @Description: 用双引号包围字符串，内部的双引号转义为 \"。
+// 词法分析不支持转义反斜杠，以反斜杠结尾的字符串无法表示。
+//
+func quoteString(s string) (string, error) {
+	if strings.HasSuffix(s, `\`) {
+		return "", fmt.Errorf("string value %q cannot end with a backslash", s)
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`, nil
+}
+
+func checkIdentifier(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("rsql filter: name is empty")
+	}
+	for _, part := range strings.Split(name, ".") {
+		if len(part) == 0 || !isIdentifierStart(part[0]) {
+			return fmt.Errorf("rsql filter: invalid name %q", name)
+		}
+		for i := 1; i < len(part); i++ {
+			if !isIdentifierStart(part[i]) && !(part[i] >= '0' && part[i] <= '9') {
+				return fmt.Errorf("rsql filter: invalid name %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+func isIdentifierStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '$'
+}
@@ -0,0 +1,66 @@
+package rsql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFilterBuilder_Build(t *testing.T) {
+	at := time.Date(2022, 1, 2, 3, 4, 5, 6, time.UTC)
+	filter, err := NewFilterBuilder().
+		Eq("tenantId", "t-1").
+		Ne("isDeleted", true).
+		In("customerId", "c-1", "c-2").
+		Range("sequenceNumber", 2, uint64(10)).
+		Range("eventTime", nil, at).
+		Like("name", "^na").
+		Or(NewFilterBuilder().Eq("a", 1).Eq("b", 2), NewFilterBuilder().Eq("c", 1.5), nil, NewFilterBuilder()).
+		Build()
+	assert.NoError(t, err)
+	assert.Equal(t, `tenantId=="t-1" and isDeleted!=true and customerId=in=("c-1","c-2") and sequenceNumber>=2 and sequenceNumber<=10`+
+		` and eventTime<=2022-01-02T03:04:05Z and name==~"^na" and (a==1 and b==2 or c==1.5)`, filter)
+
+	expr, err := Parse(filter)
+	assert.NoError(t, err)
+	assert.Len(t, expr.(AndExpression).Items, 8)
+	assert.Equal(t, DateTimeValue{Value: "2022-01-02T03:04:05Z"}, expr.(AndExpression).Items[5].(LessThanOrEqualsComparison).Val)
+	assert.IsType(t, OrExpression{}, expr.(AndExpression).Items[7])
+
+	local := time.Date(2022, 1, 2, 11, 4, 5, 0, time.FixedZone("CST", 8*3600))
+	filter, err = NewFilterBuilder().Ge("eventTime", &local).Build()
+	assert.NoError(t, err)
+	assert.Equal(t, `eventTime>=2022-01-02T03:04:05Z`, filter)
+}
+
+func TestFilterBuilder_Quote(t *testing.T) {
+	for _, value := range []string{`say "hi"`, `a\"b`, `it's`, `x and y==1`, `(1,2)`} {
+		filter, err := NewFilterBuilder().Eq("name", value).Build()
+		assert.NoError(t, err)
+		expr, err := Parse(filter)
+		if assert.NoError(t, err, filter) {
+			assert.Equal(t, value, GetValue(expr.(EqualsComparison).Val), filter)
+		}
+	}
+}
+
+func TestFilterBuilder_Invalid(t *testing.T) {
+	for _, b := range []*FilterBuilder{
+		NewFilterBuilder().Eq("", "v"),
+		NewFilterBuilder().Eq("1name", "v"),
+		NewFilterBuilder().Eq("name;drop", "v"),
+		NewFilterBuilder().Eq("name", `ends\`),
+		NewFilterBuilder().Eq("name", -1),
+		NewFilterBuilder().Eq("name", map[string]string{}),
+		NewFilterBuilder().In("name"),
+		NewFilterBuilder().Or(NewFilterBuilder().Eq("a.", 1)),
+	} {
+		filter, err := b.Build()
+		assert.Error(t, err, filter)
+		assert.Equal(t, "", b.String())
+	}
+
+	filter, err := NewFilterBuilder().Build()
+	assert.NoError(t, err)
+	assert.Equal(t, "", filter)
+}